@@ -16,9 +16,9 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/api/v1/segments": {
-            "get": {
-                "description": "Получить все сегменты из БД",
+        "/api/v1/audiences/overlap": {
+            "post": {
+                "description": "Посчитать для набора сегментов число активных участников каждого и число пользователей, состоящих в каждой паре сегментов одновременно. Помогает проверить, не пересекаются ли аудитории экспериментов",
                 "consumes": [
                     "application/json"
                 ],
@@ -26,18 +26,38 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "segments"
+                    "audiences"
+                ],
+                "summary": "Получить матрицу пересечений сегментов",
+                "operationId": "get-segment-overlap",
+                "parameters": [
+                    {
+                        "description": "Названия сегментов",
+                        "name": "Segments",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.SegmentOverlapRequestDto"
+                        }
+                    }
                 ],
-                "summary": "Получить семгенты",
-                "operationId": "get-all-segments",
                 "responses": {
                     "200": {
-                        "description": "Все сегменты успешно получены",
+                        "description": "Пересечения успешно посчитаны",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/dto.SegmentDto"
-                            }
+                            "$ref": "#/definitions/dto.SegmentOverlapDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Сегменты не найдены",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
                         }
                     },
                     "500": {
@@ -47,9 +67,11 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
+            }
+        },
+        "/api/v1/audiences/query": {
             "post": {
-                "description": "Добавить сегмент в БД",
+                "description": "Найти пользователей по булеву выражению над сегментами, например \"A AND NOT B\" или \"(A OR B) AND C\". Операторы AND, OR, NOT (или \u0026\u0026, ||, !), названия сегментов со служебными символами пишутся в кавычках. Учитываются только активные участия; NOT отбирает всех пользователей, не состоящих в сегменте. Возвращаются общее число пользователей и страница их идентификаторов по возрастанию",
                 "consumes": [
                     "application/json"
                 ],
@@ -57,26 +79,26 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "segments"
+                    "audiences"
                 ],
-                "summary": "Добавить сегмент",
-                "operationId": "create-segment",
+                "summary": "Запросить аудиторию по выражению над сегментами",
+                "operationId": "query-audience",
                 "parameters": [
                     {
-                        "description": "Информация о добавляемом сегменте",
-                        "name": "Segment",
+                        "description": "Выражение и параметры страницы",
+                        "name": "Query",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/dto.CreateOrUpdateSegmentDto"
+                            "$ref": "#/definitions/dto.AudienceQueryDto"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Сегмент успешно создан",
+                    "200": {
+                        "description": "Аудитория успешно получена",
                         "schema": {
-                            "$ref": "#/definitions/dto.CreateSegmentResponseDto"
+                            "$ref": "#/definitions/dto.AudienceResultDto"
                         }
                     },
                     "400": {
@@ -85,6 +107,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/dto.ErrorDto"
                         }
                     },
+                    "404": {
+                        "description": "Сегменты из выражения не найдены",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
                     "500": {
                         "description": "Возникла внутренняя ошибка сервера",
                         "schema": {
@@ -94,44 +122,69 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/segments/{slug}": {
+        "/api/v1/blobs/{key}": {
             "get": {
-                "description": "Получить сегмент из БД по названию",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Скачать файл из локального хранилища. Ссылку со всеми параметрами выдает сервис, например в download_url готового отчета; после истечения срока действия ссылка перестает работать",
                 "produces": [
-                    "application/json"
+                    "application/octet-stream"
                 ],
                 "tags": [
-                    "segments"
+                    "history"
                 ],
-                "summary": "Получить сегмент",
-                "operationId": "get-segment-by-name",
+                "summary": "Скачать файл по подписанной ссылке",
+                "operationId": "download-blob",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Название сегмента",
-                        "name": "slug",
+                        "description": "Ключ объекта",
+                        "name": "key",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Имя файла",
+                        "name": "filename",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Тип содержимого",
+                        "name": "content_type",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Срок действия ссылки (Unix time)",
+                        "name": "expires",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Подпись ссылки",
+                        "name": "signature",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Сегмент с данным названием успешно получен",
+                        "description": "Файл",
                         "schema": {
-                            "$ref": "#/definitions/dto.SegmentDto"
+                            "type": "file"
                         }
                     },
-                    "400": {
-                        "description": "Некорректные входные данные",
+                    "403": {
+                        "description": "Ссылка недействительна или истек срок ее действия",
                         "schema": {
                             "$ref": "#/definitions/dto.ErrorDto"
                         }
                     },
                     "404": {
-                        "description": "Сегмент с данным названием не найден",
+                        "description": "Файл не найден",
                         "schema": {
                             "$ref": "#/definitions/dto.ErrorDto"
                         }
@@ -143,9 +196,11 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "put": {
-                "description": "Обновить сегмент в БД",
+            }
+        },
+        "/api/v1/evaluate": {
+            "post": {
+                "description": "Вычислить сегменты пользователя по идентификатору и атрибутам без сохранения пользователя в сервисе: учитываются сохраненные привязки, процентные сегменты и правила таргетинга",
                 "consumes": [
                     "application/json"
                 ],
@@ -153,80 +208,121 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "segments"
+                    "evaluation"
                 ],
-                "summary": "Обновить сегмент",
-                "operationId": "update-segment",
+                "summary": "Вычислить сегменты пользователя",
+                "operationId": "evaluate",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Название сегмента",
-                        "name": "slug",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "Информация о добавляемом сегменте",
-                        "name": "сегменте",
+                        "description": "Идентификатор и атрибуты пользователя",
+                        "name": "Пользователь",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/dto.CreateOrUpdateSegmentDto"
+                            "$ref": "#/definitions/dto.EvaluateRequestDto"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Сегмент с данным названием успешно обновлен",
+                        "description": "Сегменты пользователя успешно вычислены",
                         "schema": {
-                            "$ref": "#/definitions/dto.UpdateSegmentResponseDto"
+                            "$ref": "#/definitions/dto.EvaluateResponseDto"
                         }
                     },
                     "400": {
-                        "description": "Некорректные входные данные",
-                        "schema": {
-                            "$ref": "#/definitions/dto.ErrorDto"
-                        }
-                    },
-                    "404": {
-                        "description": "Сегмент с данным названием не найден",
+                        "description": "Некорректные входные данные или числовой идентификатор вне диапазона",
                         "schema": {
                             "$ref": "#/definitions/dto.ErrorDto"
                         }
                     },
                     "500": {
-                        "description": "Возникла внутренняя ошибка сервреа",
+                        "description": "Возникла внутренняя ошибка сервера",
                         "schema": {
                             "$ref": "#/definitions/dto.ErrorDto"
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Удалить сегмент в БД",
-                "consumes": [
-                    "application/json"
-                ],
+            }
+        },
+        "/api/v1/history": {
+            "get": {
+                "description": "Получить записи истории добавления пользователей в сегменты и удаления из них с фильтрами. Записи возвращаются от новых к старым страницами; для получения следующей страницы передается next_cursor из предыдущего ответа",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "segments"
+                    "history"
                 ],
-                "summary": "Удалить сегмент",
-                "operationId": "delete-segment",
+                "summary": "Получить историю изменений сегментов",
+                "operationId": "get-history",
                 "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Идентификатор пользователя (числовой или внешний)",
+                        "name": "user_id",
+                        "in": "query"
+                    },
                     {
                         "type": "string",
                         "description": "Название сегмента",
                         "name": "slug",
-                        "in": "path",
-                        "required": true
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "ADDING",
+                            "REMOVING",
+                            "UPDATING"
+                        ],
+                        "type": "string",
+                        "description": "Тип операции",
+                        "name": "operation_type",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "api",
+                            "import",
+                            "rollout",
+                            "erasure"
+                        ],
+                        "type": "string",
+                        "description": "Источник изменения",
+                        "name": "actor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало периода в формате RFC 3339 (включительно)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Конец периода в формате RFC 3339 (не включительно)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Размер страницы (по умолчанию 100, не более 1000)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Курсор страницы",
+                        "name": "cursor",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "Сегмент с данным названием успешно удален"
+                    "200": {
+                        "description": "Записи истории успешно получены",
+                        "schema": {
+                            "$ref": "#/definitions/dto.HistoryPageDto"
+                        }
                     },
                     "400": {
                         "description": "Некорректные входные данные",
@@ -235,7 +331,7 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "Сегмент с данным названием не найден",
+                        "description": "Пользователь с данным идентификатором не найден",
                         "schema": {
                             "$ref": "#/definitions/dto.ErrorDto"
                         }
@@ -249,71 +345,79 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/users": {
+        "/api/v1/history/report": {
             "get": {
-                "description": "Получить всех пользователей из БД",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Получить отчет по истории изменений сегментов за период. Формат выбирается параметром format или заголовком Accept: CSV (по умолчанию) — запись истории в строке, XLSX — по листу на каждый месяц с автофильтром, DOCX — сводная таблица по сегментам",
                 "produces": [
-                    "application/json"
+                    "text/csv",
+                    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+                    "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
                 ],
                 "tags": [
-                    "users"
+                    "history"
+                ],
+                "summary": "Получить отчет по истории",
+                "operationId": "get-history-report",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Начало периода в формате RFC 3339 (включительно)",
+                        "name": "from",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Конец периода в формате RFC 3339 (не включительно)",
+                        "name": "to",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Идентификатор пользователя (числовой или внешний)",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Название сегмента",
+                        "name": "slug",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "csv",
+                            "xlsx",
+                            "docx"
+                        ],
+                        "type": "string",
+                        "description": "Формат отчета",
+                        "name": "format",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Получить пользователей",
-                "operationId": "get-all-users",
                 "responses": {
                     "200": {
-                        "description": "Все пользователи успешно получены",
+                        "description": "Отчет успешно сформирован",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/dto.UserDto"
-                            }
+                            "type": "file"
                         }
                     },
-                    "500": {
-                        "description": "Возникла внутренняя ошибка сервера",
+                    "400": {
+                        "description": "Некорректные входные данные",
                         "schema": {
                             "$ref": "#/definitions/dto.ErrorDto"
                         }
-                    }
-                }
-            },
-            "post": {
-                "description": "Добавить пользователя в БД",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "users"
-                ],
-                "summary": "Добавить пользователя",
-                "operationId": "create-user",
-                "parameters": [
-                    {
-                        "description": "Информация о добавляемом пользователе",
-                        "name": "User",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/dto.CreateUserDto"
-                        }
-                    }
-                ],
-                "responses": {
-                    "201": {
-                        "description": "Пользователь успешно создан",
+                    },
+                    "404": {
+                        "description": "Пользователь с данным идентификатором не найден",
                         "schema": {
-                            "$ref": "#/definitions/dto.CreateUserResponseDto"
+                            "$ref": "#/definitions/dto.ErrorDto"
                         }
                     },
-                    "400": {
-                        "description": "Некорректные входные данные",
+                    "406": {
+                        "description": "Неподдерживаемый формат отчета",
                         "schema": {
                             "$ref": "#/definitions/dto.ErrorDto"
                         }
@@ -327,9 +431,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/users/{userId}": {
+        "/api/v1/holdout/users/{userId}": {
             "get": {
-                "description": "Получить пользователя из БД по идентификатору",
+                "description": "Проверить, входит ли пользователь в глобальную контрольную группу, исключенную из всех экспериментов",
                 "consumes": [
                     "application/json"
                 ],
@@ -337,13 +441,13 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "users"
+                    "holdout"
                 ],
-                "summary": "Получить пользователя",
-                "operationId": "get-user-by-id",
+                "summary": "Проверить принадлежность к контрольной группе",
+                "operationId": "get-user-holdout",
                 "parameters": [
                     {
-                        "type": "integer",
+                        "type": "string",
                         "description": "Идентификатор пользователя",
                         "name": "userId",
                         "in": "path",
@@ -352,9 +456,9 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "200": {
-                        "description": "Пользователь с данным идентификатором успешно получен",
+                        "description": "Принадлежность к контрольной группе успешно получена",
                         "schema": {
-                            "$ref": "#/definitions/dto.UserDto"
+                            "$ref": "#/definitions/dto.UserHoldoutDto"
                         }
                     },
                     "400": {
@@ -378,11 +482,11 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/users/{userId}/active": {
-            "get": {
-                "description": "Получить из БД активные сегменты пользователя, в которых он участвует на момент запроса",
+        "/api/v1/import": {
+            "post": {
+                "description": "Импортировать пользователей и их сегменты из CSV-файла со строками вида user_id[,slug,deadline], где user_id — числовой или внешний идентификатор. Строка только с внешним идентификатором создает пользователя, строка со слагом добавляет пользователю сегмент. Строки с ошибками не применяются и попадают в отчет, при dry_run=true ничего не записывается",
                 "consumes": [
-                    "application/json"
+                    "text/csv"
                 ],
                 "produces": [
                     "application/json"
@@ -390,22 +494,101 @@ const docTemplate = `{
                 "tags": [
                     "users"
                 ],
-                "summary": "Получить активные сегменты пользователя",
-                "operationId": "get-active-segments-of-user",
+                "summary": "Импортировать пользователей и их сегменты",
+                "operationId": "import-users",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Идентификатор пользователя",
-                        "name": "userId",
-                        "in": "path",
-                        "required": true
+                        "type": "boolean",
+                        "description": "Только проверить файл, не применяя изменения",
+                        "name": "dry_run",
+                        "in": "query"
+                    },
+                    {
+                        "description": "CSV-файл",
+                        "name": "file",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Активные сегменты пользователя успешно получены",
+                        "description": "Файл успешно обработан",
                         "schema": {
-                            "$ref": "#/definitions/dto.UsersActiveSegments"
+                            "$ref": "#/definitions/dto.ImportReportDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "409": {
+                        "description": "Параллельный запрос добавил пользователя в другой сегмент слоя",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "503": {
+                        "description": "Сервис пользователей недоступен",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/reports": {
+            "post": {
+                "description": "Поставить в очередь формирование отчета по истории за период. Отчет формируется в фоне, статус и прогресс задания возвращает GET /api/v1/reports/{id}, а после завершения — и подписанную ссылку на скачивание файла",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "history"
+                ],
+                "summary": "Заказать отчет по истории",
+                "operationId": "create-report",
+                "parameters": [
+                    {
+                        "description": "Параметры отчета",
+                        "name": "Report",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.CreateReportDto"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ключ идемпотентности для безопасного повтора запроса",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Задание поставлено в очередь",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ReportJobDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
                         }
                     },
                     "404": {
@@ -414,6 +597,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/dto.ErrorDto"
                         }
                     },
+                    "422": {
+                        "description": "Ключ идемпотентности уже использован для другого запроса",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
                     "500": {
                         "description": "Возникла внутренняя ошибка сервера",
                         "schema": {
@@ -423,9 +612,82 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/users/{userId}/changeSegmentsOfUser": {
+        "/api/v1/reports/{id}": {
+            "get": {
+                "description": "Получить статус и прогресс формирования отчета. Для готового отчета возвращается подписанная ссылка на скачивание с ограниченным сроком действия; при каждом запросе выдается новая ссылка",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "history"
+                ],
+                "summary": "Получить задание на отчет",
+                "operationId": "get-report",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Идентификатор задания",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Задание успешно получено",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ReportJobDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Задание с данным идентификатором не найдено",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/segments": {
+            "get": {
+                "description": "Получить все сегменты из БД",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "segments"
+                ],
+                "summary": "Получить семгенты",
+                "operationId": "get-all-segments",
+                "responses": {
+                    "200": {
+                        "description": "Все сегменты успешно получены",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.SegmentDto"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
             "post": {
-                "description": "Добавить и удалить у пользователя указанные сегменты",
+                "description": "Добавить сегмент в БД",
                 "consumes": [
                     "application/json"
                 ],
@@ -433,31 +695,142 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "users"
+                    "segments"
                 ],
-                "summary": "Изменить сегменты пользователя",
-                "operationId": "change-segments-of-user",
+                "summary": "Добавить сегмент",
+                "operationId": "create-segment",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Идентификатор пользователя",
-                        "name": "userId",
+                        "description": "Информация о добавляемом сегменте",
+                        "name": "Segment",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.CreateOrUpdateSegmentDto"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ключ идемпотентности для безопасного повтора запроса",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Сегмент успешно создан",
+                        "schema": {
+                            "$ref": "#/definitions/dto.CreateSegmentResponseDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "422": {
+                        "description": "Ключ идемпотентности уже использован для другого запроса",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/segments/{slug}": {
+            "get": {
+                "description": "Получить сегмент из БД по названию",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "segments"
+                ],
+                "summary": "Получить сегмент",
+                "operationId": "get-segment-by-name",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название сегмента",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Сегмент с данным названием успешно получен",
+                        "schema": {
+                            "$ref": "#/definitions/dto.SegmentDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Сегмент с данным названием не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Обновить в БД переданные поля сегмента. Перенос сегмента в слой отклоняется, если его участники уже состоят в других сегментах этого слоя",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "segments"
+                ],
+                "summary": "Обновить сегмент",
+                "operationId": "update-segment",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название сегмента",
+                        "name": "slug",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "Информация о добавляемых и удаляемых сегментах",
-                        "name": "сегментах",
+                        "description": "Изменяемые поля сегмента",
+                        "name": "сегменте",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/dto.ChangeUserSegmentsDto"
+                            "$ref": "#/definitions/dto.UpdateSegmentDto"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Сегменты пользователя успешно изменены"
+                        "description": "Сегмент с данным названием успешно обновлен",
+                        "schema": {
+                            "$ref": "#/definitions/dto.UpdateSegmentResponseDto"
+                        }
                     },
                     "400": {
                         "description": "Некорректные входные данные",
@@ -466,174 +839,3203 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "Пользователь с данным идентификатором не найден",
+                        "description": "Сегмент с данным названием не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "409": {
+                        "description": "Участники сегмента уже состоят в другом сегменте слоя",
                         "schema": {
                             "$ref": "#/definitions/dto.ErrorDto"
                         }
                     },
                     "500": {
-                        "description": "Внутренняя ошибка сервера",
+                        "description": "Возникла внутренняя ошибка сервреа",
                         "schema": {
                             "$ref": "#/definitions/dto.ErrorDto"
                         }
                     }
                 }
+            },
+            "delete": {
+                "description": "Удалить сегмент в БД",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "segments"
+                ],
+                "summary": "Удалить сегмент",
+                "operationId": "delete-segment",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название сегмента",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Сегмент с данным названием успешно удален"
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Сегмент с данным названием не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/segments/{slug}/analytics": {
+            "get": {
+                "description": "Получить показатели сегмента по периодам (дням, неделям или месяцам) и за весь интервал: число добавлений, удалений и выходов по дате отключения, число участников в начале и в конце периода, наибольшее число участников одновременно, медианную и среднюю длительность участий, завершившихся в периоде. Показатели считаются по истории сегмента и текущим участникам. При format=csv возвращается CSV-файл с одной строкой на период",
+                "produces": [
+                    "application/json",
+                    "text/csv"
+                ],
+                "tags": [
+                    "segments"
+                ],
+                "summary": "Получить аналитику сегмента",
+                "operationId": "get-segment-analytics",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название сегмента",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало интервала в формате RFC 3339 (включительно)",
+                        "name": "from",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Конец интервала в формате RFC 3339 (не включительно)",
+                        "name": "to",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "day",
+                            "week",
+                            "month"
+                        ],
+                        "type": "string",
+                        "description": "Длина периода (по умолчанию month)",
+                        "name": "period",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "json",
+                            "csv"
+                        ],
+                        "type": "string",
+                        "description": "Формат ответа",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Аналитика сегмента успешно получена",
+                        "schema": {
+                            "$ref": "#/definitions/dto.SegmentAnalyticsDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Сегмент с данным названием не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/segments/{slug}/diff": {
+            "get": {
+                "description": "Сравнить состав сегмента в начале и в конце периода: пользователи, вошедшие в сегмент, вышедшие из него (удаленные вручную или по наступлению даты отключения) и изменение числа участников. При format=csv возвращается CSV-файл с колонками user_id, change, reason, date",
+                "produces": [
+                    "application/json",
+                    "text/csv"
+                ],
+                "tags": [
+                    "segments"
+                ],
+                "summary": "Получить изменение состава сегмента за период",
+                "operationId": "get-segment-diff",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название сегмента",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало периода в формате RFC 3339",
+                        "name": "from",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Конец периода в формате RFC 3339",
+                        "name": "to",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "json",
+                            "csv"
+                        ],
+                        "type": "string",
+                        "description": "Формат ответа",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Изменение состава сегмента успешно получено",
+                        "schema": {
+                            "$ref": "#/definitions/dto.SegmentDiffDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Сегмент с данным названием не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/segments/{slug}/members:batchAdd": {
+            "post": {
+                "description": "Добавить сегмент множеству пользователей. Числовые или внешние идентификаторы передаются JSON-списком, потоком NDJSON (application/x-ndjson) или CSV (text/csv, идентификатор в первой колонке). Изменения применяются пачками, каждая в своей транзакции",
+                "consumes": [
+                    "application/json",
+                    "text/csv",
+                    "application/x-ndjson"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "segments"
+                ],
+                "summary": "Добавить сегмент пользователям",
+                "operationId": "batch-add-members",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название сегмента",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Дата отключения пользователей от сегмента",
+                        "name": "deadline_date",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Только подсчитать изменения, не применяя их",
+                        "name": "dry_run",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Идентификаторы пользователей",
+                        "name": "Пользователи",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.BatchMembersDto"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Сегмент успешно добавлен пользователям",
+                        "schema": {
+                            "$ref": "#/definitions/dto.BatchMembersResultDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные или дата отключения",
+                        "schema": {
+                            "$ref": "#/definitions/dto.BatchMembersErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Сегмент с данным названием не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "409": {
+                        "description": "Параллельный запрос добавил пользователя в другой сегмент слоя",
+                        "schema": {
+                            "$ref": "#/definitions/dto.BatchMembersErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.BatchMembersErrorDto"
+                        }
+                    },
+                    "503": {
+                        "description": "Сервис пользователей недоступен",
+                        "schema": {
+                            "$ref": "#/definitions/dto.BatchMembersErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/segments/{slug}/members:batchRemove": {
+            "post": {
+                "description": "Удалить сегмент у множества пользователей. Числовые или внешние идентификаторы передаются JSON-списком, потоком NDJSON (application/x-ndjson) или CSV (text/csv, идентификатор в первой колонке). Изменения применяются пачками, каждая в своей транзакции",
+                "consumes": [
+                    "application/json",
+                    "text/csv",
+                    "application/x-ndjson"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "segments"
+                ],
+                "summary": "Удалить сегмент у пользователей",
+                "operationId": "batch-remove-members",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название сегмента",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Только подсчитать изменения, не применяя их",
+                        "name": "dry_run",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Идентификаторы пользователей",
+                        "name": "Пользователи",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.BatchMembersDto"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Сегмент успешно удален у пользователей",
+                        "schema": {
+                            "$ref": "#/definitions/dto.BatchMembersResultDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.BatchMembersErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Сегмент с данным названием не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.BatchMembersErrorDto"
+                        }
+                    },
+                    "503": {
+                        "description": "Сервис пользователей недоступен",
+                        "schema": {
+                            "$ref": "#/definitions/dto.BatchMembersErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/segments/{slug}/rollout": {
+            "get": {
+                "description": "Получить расписание постепенного раскатывания сегмента и его текущее состояние",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rollouts"
+                ],
+                "summary": "Получить расписание раскатывания",
+                "operationId": "get-rollout",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название сегмента",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Расписание успешно получено",
+                        "schema": {
+                            "$ref": "#/definitions/dto.RolloutDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Расписание для данного сегмента не найдено",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Задать расписание постепенного повышения процента пользователей, автоматически добавляемых в сегмент. Предыдущее расписание сегмента заменяется",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rollouts"
+                ],
+                "summary": "Задать расписание раскатывания",
+                "operationId": "set-rollout",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название сегмента",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Шаги расписания",
+                        "name": "Расписание",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.SetRolloutDto"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Расписание успешно задано",
+                        "schema": {
+                            "$ref": "#/definitions/dto.RolloutDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Сегмент с данным названием не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/segments/{slug}/rollout/pause": {
+            "post": {
+                "description": "Приостановить применение шагов расписания раскатывания сегмента",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rollouts"
+                ],
+                "summary": "Приостановить раскатывание",
+                "operationId": "pause-rollout",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название сегмента",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Расписание успешно приостановлено",
+                        "schema": {
+                            "$ref": "#/definitions/dto.RolloutDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Расписание для данного сегмента не найдено",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/segments/{slug}/rollout/resume": {
+            "post": {
+                "description": "Возобновить применение шагов расписания раскатывания сегмента",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rollouts"
+                ],
+                "summary": "Возобновить раскатывание",
+                "operationId": "resume-rollout",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название сегмента",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Расписание успешно возобновлено",
+                        "schema": {
+                            "$ref": "#/definitions/dto.RolloutDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Расписание для данного сегмента не найдено",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/segments/{slug}/rollout/rollback": {
+            "post": {
+                "description": "Вернуть сегмент на предыдущий шаг расписания: автоматически добавленные пользователи, не попадающие в прежний процент, удаляются из сегмента, а расписание приостанавливается. Откаченный шаг и следующие за ним переносятся на ROLLOUT_ROLLBACK_DELAY после отката",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rollouts"
+                ],
+                "summary": "Откатить раскатывание",
+                "operationId": "rollback-rollout",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название сегмента",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Расписание успешно откачено",
+                        "schema": {
+                            "$ref": "#/definitions/dto.RolloutDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Расписание для данного сегмента не найдено",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "409": {
+                        "description": "Ни один шаг расписания еще не применен",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/segments/{slug}/users": {
+            "get": {
+                "description": "Восстановить по истории, какие пользователи состояли в сегменте в указанный момент времени, с учетом дат отключения",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "segments"
+                ],
+                "summary": "Получить пользователей сегмента на момент времени",
+                "operationId": "get-users-of-segment-as-of",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название сегмента",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Момент времени в формате RFC 3339",
+                        "name": "as_of",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Пользователи сегмента успешно получены",
+                        "schema": {
+                            "$ref": "#/definitions/dto.SegmentUsersAsOfDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Сегмент с данным названием не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users": {
+            "get": {
+                "description": "Получить всех пользователей из БД",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Получить пользователей",
+                "operationId": "get-all-users",
+                "responses": {
+                    "200": {
+                        "description": "Все пользователи успешно получены",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.UserDto"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Добавить пользователя в БД",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Добавить пользователя",
+                "operationId": "create-user",
+                "parameters": [
+                    {
+                        "description": "Информация о добавляемом пользователе",
+                        "name": "User",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.CreateUserDto"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ключ идемпотентности для безопасного повтора запроса",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Пользователь успешно создан",
+                        "schema": {
+                            "$ref": "#/definitions/dto.CreateUserResponseDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "409": {
+                        "description": "Пользователь с таким внешним идентификатором уже существует",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "422": {
+                        "description": "Ключ идемпотентности уже использован для другого запроса",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/active:batchGet": {
+            "post": {
+                "description": "Получить активные сегменты сразу для нескольких пользователей (не больше BATCH_READ_LIMIT) за один запрос к БД вместо отдельного запроса на каждого. Пользователи задаются числовыми или внешними идентификаторами и возвращаются в порядке идентификаторов в запросе, повторяющиеся пользователи учитываются один раз. Идентификаторы, пользователей с которыми нет в БД, и некорректные идентификаторы возвращаются отдельно",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Получить активные сегменты нескольких пользователей",
+                "operationId": "batch-get-active-segments",
+                "parameters": [
+                    {
+                        "description": "Идентификаторы пользователей",
+                        "name": "Пользователи",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.BatchGetActiveSegmentsDto"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Активные сегменты пользователей успешно получены",
+                        "schema": {
+                            "$ref": "#/definitions/dto.BatchActiveSegmentsDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные или слишком много пользователей",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/{userId}": {
+            "get": {
+                "description": "Получить пользователя из БД по идентификатору",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Получить пользователя",
+                "operationId": "get-user-by-id",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Идентификатор пользователя (числовой или внешний)",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Пользователь с данным идентификатором успешно получен",
+                        "schema": {
+                            "$ref": "#/definitions/dto.UserDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Пользователь с данным идентификатором не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Удалить пользователя по запросу на удаление данных: завершить все его привязки к сегментам, удалить или псевдонимизировать его историю (в зависимости от ERASURE_HISTORY_MODE) и сохранить запись об удалении",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Удалить пользователя",
+                "operationId": "delete-user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Идентификатор пользователя (числовой или внешний)",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Пользователь успешно удален"
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Пользователь с данным идентификатором не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Изменить имя, внешний идентификатор и (или) атрибуты пользователя. Поля, отсутствующие в запросе, не меняются",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Изменить пользователя",
+                "operationId": "update-user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Идентификатор пользователя (числовой или внешний)",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Изменяемые поля пользователя",
+                        "name": "User",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.UpdateUserDto"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Пользователь успешно изменен",
+                        "schema": {
+                            "$ref": "#/definitions/dto.UserDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Пользователь с данным идентификатором не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "409": {
+                        "description": "Пользователь с таким внешним идентификатором уже существует или состоит в сегментах",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/{userId}/active": {
+            "get": {
+                "description": "Получить из БД активные сегменты пользователя, в которых он участвует на момент запроса",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Получить активные сегменты пользователя",
+                "operationId": "get-active-segments-of-user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Идентификатор пользователя (числовой или внешний)",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Активные сегменты пользователя успешно получены",
+                        "schema": {
+                            "$ref": "#/definitions/dto.UsersActiveSegments"
+                        }
+                    },
+                    "404": {
+                        "description": "Пользователь с данным идентификатором не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/{userId}/attributes": {
+            "put": {
+                "description": "Заменить атрибуты пользователя, по которым вычисляются правила таргетинга сегментов",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Изменить атрибуты пользователя",
+                "operationId": "set-user-attributes",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Идентификатор пользователя (числовой или внешний)",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Атрибуты пользователя",
+                        "name": "Атрибуты",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.SetUserAttributesDto"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Атрибуты пользователя успешно изменены"
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Пользователь с данным идентификатором не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/{userId}/changeSegmentsOfUser": {
+            "post": {
+                "description": "Добавить и удалить у пользователя указанные сегменты. Изменения применяются в одной транзакции, при dry_run=true только возвращаются планируемые изменения и ошибки проверки",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Изменить сегменты пользователя",
+                "operationId": "change-segments-of-user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Идентификатор пользователя (числовой или внешний)",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Только проверить изменения, не применяя их",
+                        "name": "dry_run",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Информация о добавляемых и удаляемых сегментах",
+                        "name": "сегментах",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.ChangeUserSegmentsDto"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ключ идемпотентности для безопасного повтора запроса",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Сегменты пользователя успешно изменены",
+                        "schema": {
+                            "$ref": "#/definitions/dto.UserSegmentsChangesDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Пользователь или сегмент не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "409": {
+                        "description": "Пользователь уже состоит в другом сегменте того же слоя или входит в контрольную группу",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "422": {
+                        "description": "Ключ идемпотентности уже использован для другого запроса",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "503": {
+                        "description": "Сервис пользователей недоступен",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/{userId}/export": {
+            "get": {
+                "description": "Выгрузить все данные пользователя, хранящиеся в сервисе: сам пользователь, текущие и истекшие привязки к сегментам и полная история. По умолчанию возвращается JSON-документ, при format=zip — ZIP-архив с CSV-файлами user.csv, memberships.csv и history.csv",
+                "produces": [
+                    "application/json",
+                    "application/zip"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Выгрузить данные пользователя",
+                "operationId": "export-user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Идентификатор пользователя",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "json",
+                            "zip"
+                        ],
+                        "type": "string",
+                        "description": "Формат выгрузки",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Данные пользователя успешно выгружены",
+                        "schema": {
+                            "$ref": "#/definitions/dto.UserExportDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Пользователь с данным идентификатором не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/{userId}/segments": {
+            "get": {
+                "description": "Восстановить по истории, в каких сегментах пользователь состоял в указанный момент времени, с учетом дат отключения",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Получить сегменты пользователя на момент времени",
+                "operationId": "get-segments-of-user-as-of",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Идентификатор пользователя (числовой или внешний)",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Момент времени в формате RFC 3339",
+                        "name": "as_of",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Сегменты пользователя успешно получены",
+                        "schema": {
+                            "$ref": "#/definitions/dto.UserSegmentsAsOfDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Пользователь с данным идентификатором не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Привести сегменты пользователя к переданному полному набору. Недостающие сегменты добавляются, лишние удаляются, у остальных обновляется дата отключения. Изменения применяются в одной транзакции, добавления и повторные активации записываются в историю как ADDING, удаления — как REMOVING, изменения даты отключения — как UPDATING. При dry_run=true только возвращаются планируемые изменения и ошибки проверки",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Задать сегменты пользователя",
+                "operationId": "set-segments-of-user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Идентификатор пользователя (числовой или внешний)",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Только проверить изменения, не применяя их",
+                        "name": "dry_run",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Полный набор сегментов пользователя",
+                        "name": "Сегменты",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.SetUserSegmentsDto"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Сегменты пользователя успешно заданы",
+                        "schema": {
+                            "$ref": "#/definitions/dto.UserSegmentsChangesDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Пользователь или сегмент не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "409": {
+                        "description": "Сегменты одного слоя или пользователь входит в контрольную группу",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "503": {
+                        "description": "Сервис пользователей недоступен",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/{userId}/segments/stream": {
+            "get": {
+                "description": "Открыть поток Server-Sent Events с изменениями участия пользователя в сегментах: membership.added, membership.removed, membership.updated и membership.expired. Идентификатор SSE-события — позиция в потоке; при переподключении браузер передает его в заголовке Last-Event-ID, и поток продолжается с пропущенных событий. Без Last-Event-ID поток начинается с новых событий. Пока событий нет, раз в STREAM_HEARTBEAT отправляется комментарий, чтобы соединение не закрывали прокси",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Получить поток изменений сегментов пользователя",
+                "operationId": "stream-segments-of-user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Идентификатор пользователя (числовой или внешний)",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Идентификатор последнего полученного SSE-события",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Поток событий",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Пользователь с данным идентификатором не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/{userId}/segments/{slug}/explain": {
+            "get": {
+                "description": "Объяснить, почему пользователь попал или не попал в сегмент: явная привязка, контрольная группа, слой и результат вычисления правила таргетинга по условиям",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Объяснить принадлежность к сегменту",
+                "operationId": "explain-segment-of-user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Идентификатор пользователя (числовой или внешний)",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Название сегмента",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Объяснение успешно получено",
+                        "schema": {
+                            "$ref": "#/definitions/dto.SegmentExplanationDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Пользователь или сегмент не найден",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhooks": {
+            "get": {
+                "description": "Получить все подписки на события об изменении участия в сегментах. Секреты подписок не возвращаются",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Получить подписки на события",
+                "operationId": "get-webhooks",
+                "responses": {
+                    "200": {
+                        "description": "Подписки успешно получены",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.WebhookDto"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Создать подписку на события об изменении участия пользователей в сегментах: membership.added, membership.removed, membership.updated (изменение даты отключения) и membership.expired (наступление даты отключения). События отправляются POST-запросом с JSON-телом и подписью HMAC-SHA256 в заголовке X-Webhook-Signature. Секрет для проверки подписи возвращается только в ответе на этот запрос",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Подписаться на события",
+                "operationId": "create-webhook",
+                "parameters": [
+                    {
+                        "description": "Параметры подписки",
+                        "name": "Webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.CreateOrUpdateWebhookDto"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ключ идемпотентности для безопасного повтора запроса",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Подписка успешно создана",
+                        "schema": {
+                            "$ref": "#/definitions/dto.WebhookDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "422": {
+                        "description": "Ключ идемпотентности уже использован для другого запроса",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhooks/{id}": {
+            "get": {
+                "description": "Получить подписку на события по идентификатору. Секрет подписки не возвращается",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Получить подписку на события",
+                "operationId": "get-webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Идентификатор подписки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Подписка успешно получена",
+                        "schema": {
+                            "$ref": "#/definitions/dto.WebhookDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Подписка не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Заменить адрес, типы событий и сегменты подписки. Если active не передан, подписка остается включенной или выключенной, если не передан secret — секрет не меняется. Выключенной подписке новые события не отправляются, а ее ожидающие доставки откладываются до включения",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Обновить подписку на события",
+                "operationId": "update-webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Идентификатор подписки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Параметры подписки",
+                        "name": "Webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.CreateOrUpdateWebhookDto"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Подписка успешно обновлена",
+                        "schema": {
+                            "$ref": "#/definitions/dto.WebhookDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Подписка не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Удалить подписку вместе со всеми ее доставками, в том числе недоставленными",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Удалить подписку на события",
+                "operationId": "delete-webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Идентификатор подписки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Подписка успешно удалена"
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Подписка не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhooks/{id}/deliveries": {
+            "get": {
+                "description": "Получить доставки событий подписке от новых к старым. С status=dead возвращаются недоставленные события: доставки, по которым исчерпаны все попытки. Для получения следующей страницы передается next_cursor из предыдущего ответа",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Получить доставки подписки",
+                "operationId": "get-webhook-deliveries",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Идентификатор подписки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "pending",
+                            "delivered",
+                            "dead"
+                        ],
+                        "type": "string",
+                        "description": "Статус доставок",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Размер страницы (по умолчанию 100, не более 1000)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Курсор страницы",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Доставки успешно получены",
+                        "schema": {
+                            "$ref": "#/definitions/dto.WebhookDeliveriesDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Подписка не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhooks/{id}/deliveries/{deliveryId}/redeliver": {
+            "post": {
+                "description": "Вернуть недоставленное событие в очередь: число попыток сбрасывается, и доставка повторяется по обычным правилам",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Повторить недоставленное событие",
+                "operationId": "redeliver-webhook-delivery",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Идентификатор подписки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Идентификатор доставки",
+                        "name": "deliveryId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Доставка возвращена в очередь",
+                        "schema": {
+                            "$ref": "#/definitions/dto.WebhookDeliveryDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Подписка или доставка не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "409": {
+                        "description": "Доставка не находится в недоставленных",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Возникла внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "dto.AnalyticsPeriodDto": {
+            "description": "Показатели сегмента за период",
+            "type": "object",
+            "properties": {
+                "adds": {
+                    "description": "Число добавлений в сегмент",
+                    "type": "integer"
+                },
+                "average_duration_seconds": {
+                    "description": "Средняя длительность завершившихся участий в секундах",
+                    "type": "integer",
+                    "example": 90000
+                },
+                "completed_memberships": {
+                    "description": "Число участий, завершившихся в периоде",
+                    "type": "integer"
+                },
+                "expirations": {
+                    "description": "Число выходов из сегмента по дате отключения",
+                    "type": "integer"
+                },
+                "from": {
+                    "description": "Начало периода",
+                    "type": "string"
+                },
+                "median_duration_seconds": {
+                    "description": "Медианная длительность завершившихся участий в секундах",
+                    "type": "integer",
+                    "example": 86400
+                },
+                "members_end": {
+                    "description": "Число участников в конце периода",
+                    "type": "integer"
+                },
+                "members_start": {
+                    "description": "Число участников в начале периода",
+                    "type": "integer"
+                },
+                "peak_members": {
+                    "description": "Наибольшее число участников одновременно",
+                    "type": "integer"
+                },
+                "removes": {
+                    "description": "Число удалений из сегмента",
+                    "type": "integer"
+                },
+                "to": {
+                    "description": "Конец периода",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.AudienceQueryDto": {
+            "description": "Запрос аудитории по булеву выражению над сегментами",
+            "type": "object",
+            "properties": {
+                "cursor": {
+                    "description": "Курсор страницы из next_cursor предыдущего ответа",
+                    "type": "string"
+                },
+                "expression": {
+                    "description": "Выражение с операторами AND, OR, NOT и скобками",
+                    "type": "string",
+                    "example": "(AVITO_VOICE_MESSAGES OR AVITO_PERFORMANCE_VAS) AND NOT AVITO_DISCOUNT_30"
+                },
+                "limit": {
+                    "description": "Размер страницы (по умолчанию 100, не более 1000)",
+                    "type": "integer",
+                    "example": 100
+                }
+            }
+        },
+        "dto.AudienceResultDto": {
+            "description": "Пользователи, подходящие под выражение над сегментами",
+            "type": "object",
+            "properties": {
+                "count": {
+                    "description": "Общее число подходящих пользователей",
+                    "type": "integer"
+                },
+                "expression": {
+                    "description": "Выражение в каноническом виде",
+                    "type": "string"
+                },
+                "next_cursor": {
+                    "description": "Курсор следующей страницы, если она есть",
+                    "type": "string"
+                },
+                "user_ids": {
+                    "description": "Идентификаторы пользователей на странице по возрастанию",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "dto.BatchActiveSegmentsDto": {
+            "description": "Активные сегменты нескольких пользователей",
+            "type": "object",
+            "properties": {
+                "unknown_user_ids": {
+                    "description": "Идентификаторы из запроса, пользователей с которыми нет в БД или которые некорректны",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "users": {
+                    "description": "Активные сегменты найденных пользователей",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.UsersActiveSegments"
+                    }
+                }
+            }
+        },
+        "dto.BatchGetActiveSegmentsDto": {
+            "description": "Идентификаторы пользователей для получения активных сегментов",
+            "type": "object",
+            "properties": {
+                "user_ids": {
+                    "description": "Числовые или внешние идентификаторы пользователей",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "dto.BatchMembersDto": {
+            "description": "Список пользователей для массового изменения участников сегмента",
+            "type": "object",
+            "properties": {
+                "deadline_date": {
+                    "description": "Дата отключения пользователей от сегмента",
+                    "type": "string"
+                },
+                "user_ids": {
+                    "description": "Числовые или внешние идентификаторы пользователей",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "dto.BatchMembersErrorDto": {
+            "description": "Ошибка массового изменения участников сегмента и итог пачек, примененных до нее",
+            "type": "object",
+            "properties": {
+                "committed": {
+                    "description": "Итог пачек, примененных до ошибки (каждая в своей транзакции)",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/dto.BatchMembersResultDto"
+                        }
+                    ]
+                },
+                "error": {
+                    "description": "Описание ошибки",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.BatchMembersResultDto": {
+            "description": "Итог массового изменения участников сегмента",
+            "type": "object",
+            "properties": {
+                "added": {
+                    "description": "Количество пользователей, которым добавлен сегмент",
+                    "type": "integer"
+                },
+                "chunks": {
+                    "description": "Количество примененных пачек",
+                    "type": "integer"
+                },
+                "dry_run": {
+                    "description": "Был ли запуск пробным (без записи в БД)",
+                    "type": "boolean"
+                },
+                "invalid": {
+                    "description": "Количество строк и идентификаторов, которые не удалось разобрать",
+                    "type": "integer"
+                },
+                "missing": {
+                    "description": "Количество несуществующих пользователей",
+                    "type": "integer"
+                },
+                "reactivated": {
+                    "description": "Количество пользователей, истекшая привязка которых к сегменту активирована повторно",
+                    "type": "integer"
+                },
+                "removed": {
+                    "description": "Количество пользователей, у которых удален сегмент",
+                    "type": "integer"
+                },
+                "skipped": {
+                    "description": "Количество пропущенных пользователей (уже в сегменте, не в сегменте, в контрольной группе или в занятом слое)",
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.ChangeUserSegmentsDto": {
+            "description": "Информация о добавляемых и удаляемых сегментах пользователя",
+            "type": "object",
+            "properties": {
+                "add_to_user": {
+                    "description": "Сегменты, которые будут добавляться пользователю (с датами отключения)",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.SegmentWithDeadlineDate"
+                    }
+                },
+                "take_from_user": {
+                    "description": "Сегменты, которые будут удаляться у пользователя",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "dto.CreateOrUpdateSegmentDto": {
+            "description": "Информация о сегменте при создании",
+            "type": "object",
+            "properties": {
+                "description": {
+                    "description": "Описание сегмента",
+                    "type": "string"
+                },
+                "layer": {
+                    "description": "Слой (группа взаимоисключающих сегментов)",
+                    "type": "string"
+                },
+                "rule": {
+                    "description": "Правило таргетинга по атрибутам пользователя",
+                    "type": "string"
+                },
+                "slug": {
+                    "description": "Название сегмента",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.CreateOrUpdateWebhookDto": {
+            "description": "Параметры подписки на события об изменении участия в сегментах",
+            "type": "object",
+            "properties": {
+                "active": {
+                    "description": "Отправлять ли события (по умолчанию true при создании, без изменений при обновлении)",
+                    "type": "boolean"
+                },
+                "event_types": {
+                    "description": "Типы событий; пустой список — все типы",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "membership.added",
+                        "membership.removed"
+                    ]
+                },
+                "secret": {
+                    "description": "Секрет для подписи; при создании без секрета он генерируется, при обновлении без секрета не меняется",
+                    "type": "string"
+                },
+                "slugs": {
+                    "description": "Сегменты; пустой список — все сегменты",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "url": {
+                    "description": "Адрес, на который отправляются события (http или https)",
+                    "type": "string",
+                    "example": "https://recommendations.example.com/hooks/segments"
+                }
+            }
+        },
+        "dto.CreateReportDto": {
+            "description": "Параметры асинхронного формирования отчета по истории",
+            "type": "object",
+            "properties": {
+                "format": {
+                    "description": "Формат отчета: csv (по умолчанию), xlsx или docx",
+                    "type": "string",
+                    "example": "xlsx"
+                },
+                "from": {
+                    "description": "Начало периода (включительно)",
+                    "type": "string"
+                },
+                "slug": {
+                    "description": "Название сегмента",
+                    "type": "string"
+                },
+                "to": {
+                    "description": "Конец периода (не включительно)",
+                    "type": "string"
+                },
+                "user_id": {
+                    "description": "Числовой или внешний идентификатор пользователя",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.CreateSegmentResponseDto": {
+            "description": "Информация о сегменте при создании",
+            "type": "object",
+            "properties": {
+                "slug": {
+                    "description": "Название сегмента",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.CreateUserDto": {
+            "description": "Информация о пользователе при создании",
+            "type": "object",
+            "properties": {
+                "attributes": {
+                    "description": "Атрибуты пользователя (город, платформа, дата регистрации и т.д.)",
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "external_id": {
+                    "description": "Внешний идентификатор пользователя, например UUID",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Имя пользователя",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.CreateUserResponseDto": {
+            "description": "Информация о пользователе при создании",
+            "type": "object",
+            "properties": {
+                "id": {
+                    "description": "Идентификатор пользователя",
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.DiffEntryDto": {
+            "description": "Пользователь, вошедший в сегмент или вышедший из него",
+            "type": "object",
+            "properties": {
+                "date": {
+                    "description": "Время добавления или выхода",
+                    "type": "string"
+                },
+                "reason": {
+                    "description": "Причина выхода: removed — удаление, expired — наступление даты отключения",
+                    "type": "string"
+                },
+                "user_id": {
+                    "description": "Идентификатор пользователя",
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.ErrorDto": {
+            "description": "Информация об ошибке (DTO)",
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "Ошибка",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.EvaluateRequestDto": {
+            "description": "Информация о пользователе для вычисления сегментов",
+            "type": "object",
+            "properties": {
+                "attributes": {
+                    "description": "Атрибуты пользователя",
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "user_id": {
+                    "description": "Идентификатор пользователя (может отсутствовать в сервисе)",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.EvaluateResponseDto": {
+            "description": "Сегменты, которые получил бы пользователь",
+            "type": "object",
+            "properties": {
+                "known_user": {
+                    "description": "Хранится ли пользователь в сервисе",
+                    "type": "boolean"
+                },
+                "segments": {
+                    "description": "Список сегментов",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.SegmentWithDeadlineDate"
+                    }
+                },
+                "user_id": {
+                    "description": "Идентификатор пользователя",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.ExportedMembershipDto": {
+            "description": "Текущая или истекшая привязка пользователя к сегменту",
+            "type": "object",
+            "properties": {
+                "active": {
+                    "description": "Активна ли привязка на момент выгрузки",
+                    "type": "boolean"
+                },
+                "auto_enrolled": {
+                    "description": "Добавлен ли пользователь при постепенном раскатывании",
+                    "type": "boolean"
+                },
+                "deadline_date": {
+                    "description": "Дата отключения пользователя от сегмента",
+                    "type": "string"
+                },
+                "slug": {
+                    "description": "Название сегмента",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.HistoryEntryDto": {
+            "description": "Запись истории изменения сегментов пользователя",
+            "type": "object",
+            "properties": {
+                "action_date": {
+                    "description": "Дата операции",
+                    "type": "string"
+                },
+                "actor": {
+                    "description": "Источник изменения (api, import, rollout, erasure)",
+                    "type": "string"
+                },
+                "deadline_date": {
+                    "description": "Дата отключения, действующая после операции",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Идентификатор записи",
+                    "type": "integer"
+                },
+                "operation_type": {
+                    "description": "Тип операции (ADDING, REMOVING или UPDATING)",
+                    "type": "string"
+                },
+                "slug": {
+                    "description": "Название сегмента",
+                    "type": "string"
+                },
+                "user_id": {
+                    "description": "Идентификатор пользователя (отсутствует у псевдонимизированных записей)",
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.HistoryPageDto": {
+            "description": "Страница записей истории",
+            "type": "object",
+            "properties": {
+                "next_cursor": {
+                    "description": "Курсор следующей страницы, отсутствует на последней странице",
+                    "type": "string"
+                },
+                "records": {
+                    "description": "Записи истории от новых к старым",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.HistoryEntryDto"
+                    }
+                }
+            }
+        },
+        "dto.HistoryRecordDto": {
+            "description": "Запись истории добавления пользователя в сегмент или удаления из него",
+            "type": "object",
+            "properties": {
+                "action_date": {
+                    "description": "Дата операции",
+                    "type": "string"
+                },
+                "operation_type": {
+                    "description": "Тип операции (ADDING или REMOVING)",
+                    "type": "string"
+                },
+                "slug": {
+                    "description": "Название сегмента",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.ImportErrorDto": {
+            "description": "Ошибка в строке CSV-файла импорта",
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "Описание ошибки",
+                    "type": "string"
+                },
+                "line": {
+                    "description": "Номер строки в файле",
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.ImportReportDto": {
+            "description": "Отчет об импорте пользователей и их сегментов",
+            "type": "object",
+            "properties": {
+                "applied": {
+                    "description": "Количество примененных (при пробном импорте — применимых) строк",
+                    "type": "integer"
+                },
+                "dry_run": {
+                    "description": "Был ли импорт пробным (без записи в БД)",
+                    "type": "boolean"
+                },
+                "errors": {
+                    "description": "Ошибки по строкам",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.ImportErrorDto"
+                    }
+                },
+                "rows": {
+                    "description": "Количество строк с данными",
+                    "type": "integer"
+                },
+                "skipped": {
+                    "description": "Количество строк, не требующих изменений",
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.ReportJobDto": {
+            "description": "Задание на формирование отчета по истории",
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "description": "Время создания задания",
+                    "type": "string"
+                },
+                "download_expires_at": {
+                    "description": "Время, до которого действует ссылка",
+                    "type": "string"
+                },
+                "download_url": {
+                    "description": "Подписанная ссылка на скачивание для статуса done",
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Причина ошибки для статуса failed",
+                    "type": "string"
+                },
+                "finished_at": {
+                    "description": "Время завершения",
+                    "type": "string"
+                },
+                "format": {
+                    "description": "Формат отчета",
+                    "type": "string",
+                    "example": "xlsx"
+                },
+                "from": {
+                    "description": "Начало периода",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Идентификатор задания",
+                    "type": "string"
+                },
+                "progress": {
+                    "description": "Прогресс в процентах",
+                    "type": "integer",
+                    "example": 45
+                },
+                "slug": {
+                    "description": "Название сегмента",
+                    "type": "string"
+                },
+                "started_at": {
+                    "description": "Время начала формирования",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "Статус: pending, running, done или failed",
+                    "type": "string",
+                    "example": "running"
+                },
+                "to": {
+                    "description": "Конец периода",
+                    "type": "string"
+                },
+                "user_id": {
+                    "description": "Идентификатор пользователя",
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.RolloutDto": {
+            "description": "Состояние расписания постепенного раскатывания сегмента",
+            "type": "object",
+            "properties": {
+                "current_percent": {
+                    "description": "Текущий процент пользователей в сегменте",
+                    "type": "number"
+                },
+                "current_step": {
+                    "description": "Номер последнего примененного шага (-1, если ни один шаг не применен)",
+                    "type": "integer"
+                },
+                "paused": {
+                    "description": "Приостановлено ли расписание",
+                    "type": "boolean"
+                },
+                "slug": {
+                    "description": "Название сегмента",
+                    "type": "string"
+                },
+                "steps": {
+                    "description": "Шаги расписания",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.RolloutStepDto"
+                    }
+                }
+            }
+        },
+        "dto.RolloutStepDto": {
+            "description": "Шаг расписания постепенного раскатывания сегмента",
+            "type": "object",
+            "properties": {
+                "percent": {
+                    "description": "Процент пользователей, автоматически добавляемых в сегмент",
+                    "type": "number"
+                },
+                "start_at": {
+                    "description": "Время применения шага",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.SegmentAnalyticsDto": {
+            "description": "Показатели сегмента по периодам",
+            "type": "object",
+            "properties": {
+                "from": {
+                    "description": "Начало интервала",
+                    "type": "string"
+                },
+                "period": {
+                    "description": "Длина периода: day, week или month",
+                    "type": "string",
+                    "example": "month"
+                },
+                "periods": {
+                    "description": "Показатели по периодам",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.AnalyticsPeriodDto"
+                    }
+                },
+                "slug": {
+                    "description": "Название сегмента",
+                    "type": "string"
+                },
+                "to": {
+                    "description": "Конец интервала",
+                    "type": "string"
+                },
+                "total": {
+                    "description": "Показатели за весь интервал",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/dto.AnalyticsPeriodDto"
+                        }
+                    ]
+                }
+            }
+        },
+        "dto.SegmentDiffDto": {
+            "description": "Изменение состава сегмента между двумя моментами времени",
+            "type": "object",
+            "properties": {
+                "from": {
+                    "description": "Начало периода",
+                    "type": "string"
+                },
+                "joined": {
+                    "description": "Пользователи, вошедшие в сегмент",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.DiffEntryDto"
+                    }
+                },
+                "left": {
+                    "description": "Пользователи, вышедшие из сегмента",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.DiffEntryDto"
+                    }
+                },
+                "members_from": {
+                    "description": "Число участников в начале периода",
+                    "type": "integer"
+                },
+                "members_to": {
+                    "description": "Число участников в конце периода",
+                    "type": "integer"
+                },
+                "net_change": {
+                    "description": "Изменение числа участников",
+                    "type": "integer"
+                },
+                "slug": {
+                    "description": "Название сегмента",
+                    "type": "string"
+                },
+                "to": {
+                    "description": "Конец периода",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.SegmentDto": {
+            "description": "Информация о сегменте",
+            "type": "object",
+            "properties": {
+                "description": {
+                    "description": "Описание сегмента",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Идентификатор сегмента",
+                    "type": "integer"
+                },
+                "layer": {
+                    "description": "Слой (группа взаимоисключающих сегментов)",
+                    "type": "string"
+                },
+                "percent": {
+                    "description": "Процент пользователей, автоматически добавляемых в сегмент",
+                    "type": "number"
+                },
+                "rule": {
+                    "description": "Правило таргетинга по атрибутам пользователя",
+                    "type": "string"
+                },
+                "slug": {
+                    "description": "Название сегмента",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.SegmentErrorDto": {
+            "description": "Ошибка проверки изменения сегмента пользователя",
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "Описание ошибки",
+                    "type": "string"
+                },
+                "slug": {
+                    "description": "Название сегмента",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.SegmentExplanationDto": {
+            "description": "Объяснение, почему пользователь попал или не попал в сегмент",
+            "type": "object",
+            "properties": {
+                "in_holdout": {
+                    "description": "Входит ли пользователь в глобальную контрольную группу",
+                    "type": "boolean"
+                },
+                "layer_conflict": {
+                    "description": "Сегмент того же слоя, в котором уже состоит пользователь",
+                    "type": "string"
+                },
+                "matched": {
+                    "description": "Состоит ли пользователь в сегменте",
+                    "type": "boolean"
+                },
+                "rule": {
+                    "description": "Правило таргетинга сегмента",
+                    "type": "string"
+                },
+                "rule_result": {
+                    "description": "Результат вычисления правила по условиям",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/rules.Explanation"
+                        }
+                    ]
+                },
+                "slug": {
+                    "description": "Название сегмента",
+                    "type": "string"
+                },
+                "static_member": {
+                    "description": "Добавлен ли пользователь в сегмент явно",
+                    "type": "boolean"
+                },
+                "user_id": {
+                    "description": "Идентификатор пользователя",
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.SegmentOverlapDto": {
+            "description": "Попарные пересечения активных участников сегментов",
+            "type": "object",
+            "properties": {
+                "matrix": {
+                    "description": "matrix[i][j] — число пользователей, состоящих в сегментах slugs[i] и slugs[j] одновременно",
+                    "type": "array",
+                    "items": {
+                        "type": "array",
+                        "items": {
+                            "type": "integer"
+                        }
+                    }
+                },
+                "sizes": {
+                    "description": "Число активных участников каждого сегмента",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "slugs": {
+                    "description": "Названия сегментов",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "dto.SegmentOverlapRequestDto": {
+            "description": "Сегменты, для которых считаются пересечения",
+            "type": "object",
+            "properties": {
+                "slugs": {
+                    "description": "Названия сегментов (не более 50)",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "AVITO_VOICE_MESSAGES",
+                        "AVITO_PERFORMANCE_VAS"
+                    ]
+                }
+            }
+        },
+        "dto.SegmentUsersAsOfDto": {
+            "description": "Пользователи сегмента на момент времени в прошлом",
+            "type": "object",
+            "properties": {
+                "as_of": {
+                    "description": "Момент времени",
+                    "type": "string"
+                },
+                "slug": {
+                    "description": "Название сегмента",
+                    "type": "string"
+                },
+                "user_ids": {
+                    "description": "Пользователи, которые состояли в сегменте в этот момент",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "dto.SegmentWithDeadlineDate": {
+            "description": "Информация о сегментах с датой отключения пользователя от сегмента",
+            "type": "object",
+            "properties": {
+                "deadline_date": {
+                    "description": "Дата отключения пользователя от сегмента",
+                    "type": "string"
+                },
+                "slug": {
+                    "description": "Название сегмента",
+                    "type": "string"
+                },
+                "source": {
+                    "description": "Источник привязки (rule — по правилу таргетинга)",
+                    "type": "string"
+                }
             }
-        }
-    },
-    "definitions": {
-        "dto.ChangeUserSegmentsDto": {
-            "description": "Информация о добавляемых и удаляемых сегментах пользователя",
+        },
+        "dto.SetRolloutDto": {
+            "description": "Расписание постепенного раскатывания сегмента",
             "type": "object",
             "properties": {
-                "add_to_user": {
-                    "description": "Сегменты, которые будут добавляться пользователю (с датами отключения)",
+                "steps": {
+                    "description": "Шаги расписания в порядке возрастания процента",
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/dto.SegmentWithDeadlineDate"
+                        "$ref": "#/definitions/dto.RolloutStepDto"
                     }
-                },
-                "take_from_user": {
-                    "description": "Сегменты, которые будут удаляться у пользователя",
+                }
+            }
+        },
+        "dto.SetUserAttributesDto": {
+            "description": "Атрибуты пользователя",
+            "type": "object",
+            "properties": {
+                "attributes": {
+                    "description": "Атрибуты пользователя (город, платформа, дата регистрации и т.д.)",
+                    "type": "object",
+                    "additionalProperties": true
+                }
+            }
+        },
+        "dto.SetUserSegmentsDto": {
+            "description": "Полный желаемый набор сегментов пользователя",
+            "type": "object",
+            "properties": {
+                "segments": {
+                    "description": "Сегменты пользователя (с датами отключения)",
                     "type": "array",
                     "items": {
-                        "type": "string"
+                        "$ref": "#/definitions/dto.SegmentWithDeadlineDate"
                     }
                 }
             }
         },
-        "dto.CreateOrUpdateSegmentDto": {
-            "description": "Информация о сегменте при создании",
+        "dto.UpdateSegmentDto": {
+            "description": "Изменяемые поля сегмента: не переданные поля не меняются, пустая строка снимает слой или правило",
             "type": "object",
             "properties": {
                 "description": {
                     "description": "Описание сегмента",
                     "type": "string"
                 },
-                "slug": {
-                    "description": "Название сегмента",
+                "layer": {
+                    "description": "Слой (группа взаимоисключающих сегментов)",
+                    "type": "string"
+                },
+                "rule": {
+                    "description": "Правило таргетинга по атрибутам пользователя",
                     "type": "string"
                 }
             }
         },
-        "dto.CreateSegmentResponseDto": {
-            "description": "Информация о сегменте при создании",
+        "dto.UpdateSegmentResponseDto": {
+            "description": "Информация о сегменте при обновлении",
             "type": "object",
             "properties": {
+                "description": {
+                    "description": "Описание сегмента",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Идентификатор сегмента",
+                    "type": "integer"
+                },
+                "layer": {
+                    "description": "Слой (группа взаимоисключающих сегментов)",
+                    "type": "string"
+                },
+                "rule": {
+                    "description": "Правило таргетинга по атрибутам пользователя",
+                    "type": "string"
+                },
                 "slug": {
                     "description": "Название сегмента",
                     "type": "string"
                 }
             }
         },
-        "dto.CreateUserDto": {
-            "description": "Информация о пользователе при создании",
+        "dto.UpdateUserDto": {
+            "description": "Изменяемые поля пользователя, отсутствующие поля не меняются",
             "type": "object",
             "properties": {
+                "attributes": {
+                    "description": "Атрибуты пользователя (заменяют текущие целиком)",
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "external_id": {
+                    "description": "Внешний идентификатор пользователя, пустая строка удаляет его",
+                    "type": "string"
+                },
                 "name": {
                     "description": "Имя пользователя",
                     "type": "string"
                 }
             }
         },
-        "dto.CreateUserResponseDto": {
-            "description": "Информация о пользователе при создании",
+        "dto.UserDto": {
+            "description": "Информация о пользователе",
             "type": "object",
             "properties": {
+                "attributes": {
+                    "description": "Атрибуты пользователя",
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "external_id": {
+                    "description": "Внешний идентификатор пользователя",
+                    "type": "string"
+                },
                 "id": {
                     "description": "Идентификатор пользователя",
                     "type": "integer"
+                },
+                "name": {
+                    "description": "Имя пользователя",
+                    "type": "string"
                 }
             }
         },
-        "dto.ErrorDto": {
-            "description": "Информация об ошибке (DTO)",
+        "dto.UserExportDto": {
+            "description": "Все данные пользователя, хранящиеся в сервисе",
             "type": "object",
             "properties": {
-                "error": {
-                    "description": "Ошибка",
+                "exported_at": {
+                    "description": "Дата выгрузки",
                     "type": "string"
+                },
+                "history": {
+                    "description": "История добавления в сегменты и удаления из них",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.HistoryRecordDto"
+                    }
+                },
+                "memberships": {
+                    "description": "Текущие и истекшие привязки к сегментам",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.ExportedMembershipDto"
+                    }
+                },
+                "user": {
+                    "description": "Пользователь",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/dto.UserDto"
+                        }
+                    ]
                 }
             }
         },
-        "dto.SegmentDto": {
-            "description": "Информация о сегменте",
+        "dto.UserHoldoutDto": {
+            "description": "Информация о принадлежности пользователя глобальной контрольной группе",
             "type": "object",
             "properties": {
-                "description": {
-                    "description": "Описание сегмента",
+                "in_holdout": {
+                    "description": "Входит ли пользователь в контрольную группу",
+                    "type": "boolean"
+                },
+                "percent": {
+                    "description": "Размер контрольной группы в процентах",
+                    "type": "number"
+                },
+                "user_id": {
+                    "description": "Идентификатор пользователя",
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.UserSegmentsAsOfDto": {
+            "description": "Сегменты пользователя на момент времени в прошлом",
+            "type": "object",
+            "properties": {
+                "as_of": {
+                    "description": "Момент времени",
                     "type": "string"
                 },
-                "id": {
-                    "description": "Идентификатор сегмента",
+                "segments": {
+                    "description": "Сегменты, в которых пользователь состоял в этот момент",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.SegmentWithDeadlineDate"
+                    }
+                },
+                "user_id": {
+                    "description": "Идентификатор пользователя",
                     "type": "integer"
+                }
+            }
+        },
+        "dto.UserSegmentsChangesDto": {
+            "description": "Изменения сегментов пользователя: примененные или, при пробном запуске, планируемые",
+            "type": "object",
+            "properties": {
+                "added": {
+                    "description": "Добавленные сегменты",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
                 },
-                "slug": {
-                    "description": "Название сегмента",
+                "dry_run": {
+                    "description": "Был ли запуск пробным (без записи в БД)",
+                    "type": "boolean"
+                },
+                "errors": {
+                    "description": "Ошибки проверки (возвращаются при пробном запуске)",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.SegmentErrorDto"
+                    }
+                },
+                "ignored": {
+                    "description": "Сегменты, не требующие изменений",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "reactivated": {
+                    "description": "Сегменты, истекшая привязка к которым активирована повторно",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "removed": {
+                    "description": "Удаленные сегменты",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "updated": {
+                    "description": "Сегменты с измененной датой отключения",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "user_id": {
+                    "description": "Идентификатор пользователя",
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.UsersActiveSegments": {
+            "description": "Информация об активных сегментах пользователя",
+            "type": "object",
+            "properties": {
+                "external_id": {
+                    "description": "Внешний идентификатор пользователя, если он задан",
                     "type": "string"
+                },
+                "segments": {
+                    "description": "Список активных сегментов",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.SegmentWithDeadlineDate"
+                    }
+                },
+                "user_id": {
+                    "description": "Идентификатор пользователя",
+                    "type": "integer"
                 }
             }
         },
-        "dto.SegmentWithDeadlineDate": {
-            "description": "Информация о сегментах с датой отключения пользователя от сегмента",
+        "dto.WebhookDeliveriesDto": {
+            "description": "Страница доставок подписки",
             "type": "object",
             "properties": {
-                "deadline_date": {
-                    "description": "Дата отключения пользователя от сегмента",
+                "deliveries": {
+                    "description": "Доставки от новых к старым",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.WebhookDeliveryDto"
+                    }
+                },
+                "next_cursor": {
+                    "description": "Курсор следующей страницы, если она есть",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.WebhookDeliveryDto": {
+            "description": "Доставка события подписке",
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "description": "Число сделанных попыток",
+                    "type": "integer"
+                },
+                "created_at": {
+                    "description": "Время создания доставки",
                     "type": "string"
                 },
-                "slug": {
-                    "description": "Название сегмента",
+                "delivered_at": {
+                    "description": "Время успешной доставки",
+                    "type": "string"
+                },
+                "event": {
+                    "description": "Доставляемое событие",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/dto.WebhookEventDto"
+                        }
+                    ]
+                },
+                "id": {
+                    "description": "Идентификатор доставки",
+                    "type": "integer"
+                },
+                "last_error": {
+                    "description": "Причина последней неудачной попытки",
+                    "type": "string"
+                },
+                "last_status_code": {
+                    "description": "Код последнего ответа получателя",
+                    "type": "integer"
+                },
+                "next_attempt_at": {
+                    "description": "Время следующей попытки для статуса pending",
                     "type": "string"
+                },
+                "status": {
+                    "description": "Статус: pending, delivered или dead",
+                    "type": "string",
+                    "example": "dead"
                 }
             }
         },
-        "dto.UpdateSegmentResponseDto": {
-            "description": "Информация о сегменте при обновлении",
+        "dto.WebhookDto": {
+            "description": "Подписка на события об изменении участия в сегментах",
             "type": "object",
             "properties": {
-                "description": {
-                    "description": "Описание сегмента",
+                "active": {
+                    "description": "Отправляются ли события",
+                    "type": "boolean"
+                },
+                "created_at": {
+                    "description": "Время создания подписки",
                     "type": "string"
                 },
+                "event_types": {
+                    "description": "Типы событий; пустой список — все типы",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "id": {
-                    "description": "Идентификатор сегмента",
+                    "description": "Идентификатор подписки",
                     "type": "integer"
                 },
-                "slug": {
-                    "description": "Название сегмента",
+                "secret": {
+                    "description": "Секрет для проверки подписи; возвращается только при создании",
+                    "type": "string"
+                },
+                "slugs": {
+                    "description": "Сегменты; пустой список — все сегменты",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "url": {
+                    "description": "Адрес, на который отправляются события",
                     "type": "string"
                 }
             }
         },
-        "dto.UserDto": {
-            "description": "Информация о пользователе",
+        "dto.WebhookEventDto": {
+            "description": "Событие об изменении участия пользователя в сегменте",
             "type": "object",
             "properties": {
+                "actor": {
+                    "description": "Источник изменения",
+                    "type": "string",
+                    "example": "api"
+                },
+                "deadline_date": {
+                    "description": "Дата отключения, действующая после изменения",
+                    "type": "string"
+                },
+                "external_id": {
+                    "description": "Внешний идентификатор пользователя",
+                    "type": "string"
+                },
                 "id": {
-                    "description": "Идентификатор пользователя",
+                    "description": "Идентификатор события",
                     "type": "integer"
                 },
-                "name": {
-                    "description": "Имя пользователя",
+                "occurred_at": {
+                    "description": "Время изменения",
+                    "type": "string"
+                },
+                "slug": {
+                    "description": "Название сегмента",
                     "type": "string"
+                },
+                "type": {
+                    "description": "Тип: membership.added, membership.removed, membership.updated или membership.expired",
+                    "type": "string",
+                    "example": "membership.added"
+                },
+                "user_id": {
+                    "description": "Идентификатор пользователя",
+                    "type": "integer"
                 }
             }
         },
-        "dto.UsersActiveSegments": {
-            "description": "Информация об активных сегментах пользователя",
+        "rules.Explanation": {
             "type": "object",
             "properties": {
-                "segments": {
-                    "description": "Список активных сегментов",
+                "actual": {
+                    "description": "Значение атрибута пользователя"
+                },
+                "children": {
+                    "description": "Вложенные условия",
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/dto.SegmentWithDeadlineDate"
+                        "$ref": "#/definitions/rules.Explanation"
                     }
                 },
-                "user_id": {
-                    "description": "Идентификатор пользователя",
-                    "type": "integer"
+                "expression": {
+                    "description": "Часть правила",
+                    "type": "string"
+                },
+                "matched": {
+                    "description": "Результат вычисления",
+                    "type": "boolean"
+                },
+                "reason": {
+                    "description": "Пояснение для несработавшего условия",
+                    "type": "string"
                 }
             }
         }
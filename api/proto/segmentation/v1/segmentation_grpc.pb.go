@@ -0,0 +1,476 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: segmentation/v1/segmentation.proto
+
+package segmentationv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	SegmentationService_ListSegments_FullMethodName           = "/segmentation.v1.SegmentationService/ListSegments"
+	SegmentationService_GetSegment_FullMethodName             = "/segmentation.v1.SegmentationService/GetSegment"
+	SegmentationService_CreateSegment_FullMethodName          = "/segmentation.v1.SegmentationService/CreateSegment"
+	SegmentationService_UpdateSegment_FullMethodName          = "/segmentation.v1.SegmentationService/UpdateSegment"
+	SegmentationService_DeleteSegment_FullMethodName          = "/segmentation.v1.SegmentationService/DeleteSegment"
+	SegmentationService_CreateUser_FullMethodName             = "/segmentation.v1.SegmentationService/CreateUser"
+	SegmentationService_ChangeSegmentsOfUser_FullMethodName   = "/segmentation.v1.SegmentationService/ChangeSegmentsOfUser"
+	SegmentationService_GetActiveSegments_FullMethodName      = "/segmentation.v1.SegmentationService/GetActiveSegments"
+	SegmentationService_BatchGetActiveSegments_FullMethodName = "/segmentation.v1.SegmentationService/BatchGetActiveSegments"
+	SegmentationService_WatchSegmentsOfUser_FullMethodName    = "/segmentation.v1.SegmentationService/WatchSegmentsOfUser"
+)
+
+// SegmentationServiceClient is the client API for SegmentationService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SegmentationServiceClient interface {
+	// Сегменты
+	ListSegments(ctx context.Context, in *ListSegmentsRequest, opts ...grpc.CallOption) (*ListSegmentsResponse, error)
+	GetSegment(ctx context.Context, in *GetSegmentRequest, opts ...grpc.CallOption) (*Segment, error)
+	CreateSegment(ctx context.Context, in *CreateSegmentRequest, opts ...grpc.CallOption) (*CreateSegmentResponse, error)
+	UpdateSegment(ctx context.Context, in *UpdateSegmentRequest, opts ...grpc.CallOption) (*Segment, error)
+	DeleteSegment(ctx context.Context, in *DeleteSegmentRequest, opts ...grpc.CallOption) (*DeleteSegmentResponse, error)
+	// Пользователи
+	CreateUser(ctx context.Context, in *CreateUserRequest, opts ...grpc.CallOption) (*CreateUserResponse, error)
+	ChangeSegmentsOfUser(ctx context.Context, in *ChangeSegmentsOfUserRequest, opts ...grpc.CallOption) (*SegmentChanges, error)
+	GetActiveSegments(ctx context.Context, in *GetActiveSegmentsRequest, opts ...grpc.CallOption) (*ActiveSegments, error)
+	BatchGetActiveSegments(ctx context.Context, in *BatchGetActiveSegmentsRequest, opts ...grpc.CallOption) (*BatchGetActiveSegmentsResponse, error)
+	// Поток изменений участия пользователя в сегментах, аналог GET /api/v1/users/{userId}/segments/stream
+	WatchSegmentsOfUser(ctx context.Context, in *WatchSegmentsOfUserRequest, opts ...grpc.CallOption) (SegmentationService_WatchSegmentsOfUserClient, error)
+}
+
+type segmentationServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSegmentationServiceClient(cc grpc.ClientConnInterface) SegmentationServiceClient {
+	return &segmentationServiceClient{cc}
+}
+
+func (c *segmentationServiceClient) ListSegments(ctx context.Context, in *ListSegmentsRequest, opts ...grpc.CallOption) (*ListSegmentsResponse, error) {
+	out := new(ListSegmentsResponse)
+	err := c.cc.Invoke(ctx, SegmentationService_ListSegments_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentationServiceClient) GetSegment(ctx context.Context, in *GetSegmentRequest, opts ...grpc.CallOption) (*Segment, error) {
+	out := new(Segment)
+	err := c.cc.Invoke(ctx, SegmentationService_GetSegment_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentationServiceClient) CreateSegment(ctx context.Context, in *CreateSegmentRequest, opts ...grpc.CallOption) (*CreateSegmentResponse, error) {
+	out := new(CreateSegmentResponse)
+	err := c.cc.Invoke(ctx, SegmentationService_CreateSegment_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentationServiceClient) UpdateSegment(ctx context.Context, in *UpdateSegmentRequest, opts ...grpc.CallOption) (*Segment, error) {
+	out := new(Segment)
+	err := c.cc.Invoke(ctx, SegmentationService_UpdateSegment_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentationServiceClient) DeleteSegment(ctx context.Context, in *DeleteSegmentRequest, opts ...grpc.CallOption) (*DeleteSegmentResponse, error) {
+	out := new(DeleteSegmentResponse)
+	err := c.cc.Invoke(ctx, SegmentationService_DeleteSegment_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentationServiceClient) CreateUser(ctx context.Context, in *CreateUserRequest, opts ...grpc.CallOption) (*CreateUserResponse, error) {
+	out := new(CreateUserResponse)
+	err := c.cc.Invoke(ctx, SegmentationService_CreateUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentationServiceClient) ChangeSegmentsOfUser(ctx context.Context, in *ChangeSegmentsOfUserRequest, opts ...grpc.CallOption) (*SegmentChanges, error) {
+	out := new(SegmentChanges)
+	err := c.cc.Invoke(ctx, SegmentationService_ChangeSegmentsOfUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentationServiceClient) GetActiveSegments(ctx context.Context, in *GetActiveSegmentsRequest, opts ...grpc.CallOption) (*ActiveSegments, error) {
+	out := new(ActiveSegments)
+	err := c.cc.Invoke(ctx, SegmentationService_GetActiveSegments_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentationServiceClient) BatchGetActiveSegments(ctx context.Context, in *BatchGetActiveSegmentsRequest, opts ...grpc.CallOption) (*BatchGetActiveSegmentsResponse, error) {
+	out := new(BatchGetActiveSegmentsResponse)
+	err := c.cc.Invoke(ctx, SegmentationService_BatchGetActiveSegments_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentationServiceClient) WatchSegmentsOfUser(ctx context.Context, in *WatchSegmentsOfUserRequest, opts ...grpc.CallOption) (SegmentationService_WatchSegmentsOfUserClient, error) {
+	stream, err := c.cc.NewStream(ctx, &SegmentationService_ServiceDesc.Streams[0], SegmentationService_WatchSegmentsOfUser_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &segmentationServiceWatchSegmentsOfUserClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type SegmentationService_WatchSegmentsOfUserClient interface {
+	Recv() (*MembershipEvent, error)
+	grpc.ClientStream
+}
+
+type segmentationServiceWatchSegmentsOfUserClient struct {
+	grpc.ClientStream
+}
+
+func (x *segmentationServiceWatchSegmentsOfUserClient) Recv() (*MembershipEvent, error) {
+	m := new(MembershipEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SegmentationServiceServer is the server API for SegmentationService service.
+// All implementations must embed UnimplementedSegmentationServiceServer
+// for forward compatibility
+type SegmentationServiceServer interface {
+	// Сегменты
+	ListSegments(context.Context, *ListSegmentsRequest) (*ListSegmentsResponse, error)
+	GetSegment(context.Context, *GetSegmentRequest) (*Segment, error)
+	CreateSegment(context.Context, *CreateSegmentRequest) (*CreateSegmentResponse, error)
+	UpdateSegment(context.Context, *UpdateSegmentRequest) (*Segment, error)
+	DeleteSegment(context.Context, *DeleteSegmentRequest) (*DeleteSegmentResponse, error)
+	// Пользователи
+	CreateUser(context.Context, *CreateUserRequest) (*CreateUserResponse, error)
+	ChangeSegmentsOfUser(context.Context, *ChangeSegmentsOfUserRequest) (*SegmentChanges, error)
+	GetActiveSegments(context.Context, *GetActiveSegmentsRequest) (*ActiveSegments, error)
+	BatchGetActiveSegments(context.Context, *BatchGetActiveSegmentsRequest) (*BatchGetActiveSegmentsResponse, error)
+	// Поток изменений участия пользователя в сегментах, аналог GET /api/v1/users/{userId}/segments/stream
+	WatchSegmentsOfUser(*WatchSegmentsOfUserRequest, SegmentationService_WatchSegmentsOfUserServer) error
+	mustEmbedUnimplementedSegmentationServiceServer()
+}
+
+// UnimplementedSegmentationServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedSegmentationServiceServer struct {
+}
+
+func (UnimplementedSegmentationServiceServer) ListSegments(context.Context, *ListSegmentsRequest) (*ListSegmentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSegments not implemented")
+}
+func (UnimplementedSegmentationServiceServer) GetSegment(context.Context, *GetSegmentRequest) (*Segment, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSegment not implemented")
+}
+func (UnimplementedSegmentationServiceServer) CreateSegment(context.Context, *CreateSegmentRequest) (*CreateSegmentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateSegment not implemented")
+}
+func (UnimplementedSegmentationServiceServer) UpdateSegment(context.Context, *UpdateSegmentRequest) (*Segment, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateSegment not implemented")
+}
+func (UnimplementedSegmentationServiceServer) DeleteSegment(context.Context, *DeleteSegmentRequest) (*DeleteSegmentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteSegment not implemented")
+}
+func (UnimplementedSegmentationServiceServer) CreateUser(context.Context, *CreateUserRequest) (*CreateUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateUser not implemented")
+}
+func (UnimplementedSegmentationServiceServer) ChangeSegmentsOfUser(context.Context, *ChangeSegmentsOfUserRequest) (*SegmentChanges, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangeSegmentsOfUser not implemented")
+}
+func (UnimplementedSegmentationServiceServer) GetActiveSegments(context.Context, *GetActiveSegmentsRequest) (*ActiveSegments, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetActiveSegments not implemented")
+}
+func (UnimplementedSegmentationServiceServer) BatchGetActiveSegments(context.Context, *BatchGetActiveSegmentsRequest) (*BatchGetActiveSegmentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGetActiveSegments not implemented")
+}
+func (UnimplementedSegmentationServiceServer) WatchSegmentsOfUser(*WatchSegmentsOfUserRequest, SegmentationService_WatchSegmentsOfUserServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchSegmentsOfUser not implemented")
+}
+func (UnimplementedSegmentationServiceServer) mustEmbedUnimplementedSegmentationServiceServer() {}
+
+// UnsafeSegmentationServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SegmentationServiceServer will
+// result in compilation errors.
+type UnsafeSegmentationServiceServer interface {
+	mustEmbedUnimplementedSegmentationServiceServer()
+}
+
+func RegisterSegmentationServiceServer(s grpc.ServiceRegistrar, srv SegmentationServiceServer) {
+	s.RegisterService(&SegmentationService_ServiceDesc, srv)
+}
+
+func _SegmentationService_ListSegments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSegmentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentationServiceServer).ListSegments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentationService_ListSegments_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentationServiceServer).ListSegments(ctx, req.(*ListSegmentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentationService_GetSegment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSegmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentationServiceServer).GetSegment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentationService_GetSegment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentationServiceServer).GetSegment(ctx, req.(*GetSegmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentationService_CreateSegment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateSegmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentationServiceServer).CreateSegment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentationService_CreateSegment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentationServiceServer).CreateSegment(ctx, req.(*CreateSegmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentationService_UpdateSegment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateSegmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentationServiceServer).UpdateSegment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentationService_UpdateSegment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentationServiceServer).UpdateSegment(ctx, req.(*UpdateSegmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentationService_DeleteSegment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteSegmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentationServiceServer).DeleteSegment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentationService_DeleteSegment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentationServiceServer).DeleteSegment(ctx, req.(*DeleteSegmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentationService_CreateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentationServiceServer).CreateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentationService_CreateUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentationServiceServer).CreateUser(ctx, req.(*CreateUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentationService_ChangeSegmentsOfUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangeSegmentsOfUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentationServiceServer).ChangeSegmentsOfUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentationService_ChangeSegmentsOfUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentationServiceServer).ChangeSegmentsOfUser(ctx, req.(*ChangeSegmentsOfUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentationService_GetActiveSegments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetActiveSegmentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentationServiceServer).GetActiveSegments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentationService_GetActiveSegments_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentationServiceServer).GetActiveSegments(ctx, req.(*GetActiveSegmentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentationService_BatchGetActiveSegments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetActiveSegmentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentationServiceServer).BatchGetActiveSegments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentationService_BatchGetActiveSegments_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentationServiceServer).BatchGetActiveSegments(ctx, req.(*BatchGetActiveSegmentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentationService_WatchSegmentsOfUser_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchSegmentsOfUserRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SegmentationServiceServer).WatchSegmentsOfUser(m, &segmentationServiceWatchSegmentsOfUserServer{stream})
+}
+
+type SegmentationService_WatchSegmentsOfUserServer interface {
+	Send(*MembershipEvent) error
+	grpc.ServerStream
+}
+
+type segmentationServiceWatchSegmentsOfUserServer struct {
+	grpc.ServerStream
+}
+
+func (x *segmentationServiceWatchSegmentsOfUserServer) Send(m *MembershipEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// SegmentationService_ServiceDesc is the grpc.ServiceDesc for SegmentationService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SegmentationService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "segmentation.v1.SegmentationService",
+	HandlerType: (*SegmentationServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListSegments",
+			Handler:    _SegmentationService_ListSegments_Handler,
+		},
+		{
+			MethodName: "GetSegment",
+			Handler:    _SegmentationService_GetSegment_Handler,
+		},
+		{
+			MethodName: "CreateSegment",
+			Handler:    _SegmentationService_CreateSegment_Handler,
+		},
+		{
+			MethodName: "UpdateSegment",
+			Handler:    _SegmentationService_UpdateSegment_Handler,
+		},
+		{
+			MethodName: "DeleteSegment",
+			Handler:    _SegmentationService_DeleteSegment_Handler,
+		},
+		{
+			MethodName: "CreateUser",
+			Handler:    _SegmentationService_CreateUser_Handler,
+		},
+		{
+			MethodName: "ChangeSegmentsOfUser",
+			Handler:    _SegmentationService_ChangeSegmentsOfUser_Handler,
+		},
+		{
+			MethodName: "GetActiveSegments",
+			Handler:    _SegmentationService_GetActiveSegments_Handler,
+		},
+		{
+			MethodName: "BatchGetActiveSegments",
+			Handler:    _SegmentationService_BatchGetActiveSegments_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchSegmentsOfUser",
+			Handler:       _SegmentationService_WatchSegmentsOfUser_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "segmentation/v1/segmentation.proto",
+}
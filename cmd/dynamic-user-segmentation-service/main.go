@@ -1,15 +1,27 @@
 package main
 
 import (
+	"context"
 	"net/http"
 
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 
+	"github.com/TinyMarcus/avito-tech-task/internal/blob"
 	"github.com/TinyMarcus/avito-tech-task/internal/config"
 	"github.com/TinyMarcus/avito-tech-task/internal/db"
+	"github.com/TinyMarcus/avito-tech-task/internal/directory"
+	"github.com/TinyMarcus/avito-tech-task/internal/evaluation"
 	"github.com/TinyMarcus/avito-tech-task/internal/handlers"
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/middlewares"
+	"github.com/TinyMarcus/avito-tech-task/internal/holdout"
+	"github.com/TinyMarcus/avito-tech-task/internal/importer"
 	"github.com/TinyMarcus/avito-tech-task/internal/logger"
+	"github.com/TinyMarcus/avito-tech-task/internal/report"
 	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+	"github.com/TinyMarcus/avito-tech-task/internal/rollout"
+	"github.com/TinyMarcus/avito-tech-task/internal/rpc"
+	"github.com/TinyMarcus/avito-tech-task/internal/stream"
+	"github.com/TinyMarcus/avito-tech-task/internal/webhook"
 )
 
 // @title       Dynamic User Segmentation Service
@@ -44,10 +56,109 @@ func main() {
 		logger.Fatalf("Error while connecting to database: %v", err)
 	}
 
+	err = config.Holdout.Validate()
+	if err != nil {
+		logger.Fatalf("Something went wrong with config: %v", err)
+	}
+
+	err = config.Rollout.Validate()
+	if err != nil {
+		logger.Fatalf("Something went wrong with config: %v", err)
+	}
+
+	err = config.Batch.Validate()
+	if err != nil {
+		logger.Fatalf("Something went wrong with config: %v", err)
+	}
+
+	err = config.Idempotency.Validate()
+	if err != nil {
+		logger.Fatalf("Something went wrong with config: %v", err)
+	}
+
+	err = config.Erasure.Validate()
+	if err != nil {
+		logger.Fatalf("Something went wrong with config: %v", err)
+	}
+
+	err = config.Users.Validate()
+	if err != nil {
+		logger.Fatalf("Something went wrong with config: %v", err)
+	}
+
+	err = config.Blob.Validate()
+	if err != nil {
+		logger.Fatalf("Something went wrong with config: %v", err)
+	}
+
+	err = config.Webhooks.Validate()
+	if err != nil {
+		logger.Fatalf("Something went wrong with config: %v", err)
+	}
+
+	err = config.Stream.Validate()
+	if err != nil {
+		logger.Fatalf("Something went wrong with config: %v", err)
+	}
+
+	err = config.Reports.Validate()
+	if err != nil {
+		logger.Fatalf("Something went wrong with config: %v", err)
+	}
+
+	err = config.Grpc.Validate()
+	if err != nil {
+		logger.Fatalf("Something went wrong with config: %v", err)
+	}
+
+	bs, err := blob.New(config.Blob)
+	if err != nil {
+		logger.Fatalf("Error while creating blob store: %v", err)
+	}
+
+	ho := holdout.New(config.Holdout)
 	hr := repositories.NewHistoryRepository(db)
-	ur := repositories.NewUserRepository(db, hr)
+	ev := evaluation.NewEvaluator(ho)
+	up := directory.NewProvisioner(config.Users)
+	ur := repositories.NewUserRepository(db, hr, ho, ev, config.Erasure, up)
 	sr := repositories.NewSegmentRepository(db)
-	r := handlers.Router(logger, ur, sr)
+	rr := repositories.NewRolloutRepository(db, hr)
+	mr := repositories.NewMembershipRepository(db, hr, ho, up)
+	im := importer.New(repositories.NewImportRepository(db, hr, ho, up))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rs := rollout.NewScheduler(rr, ho, config.Rollout, logger)
+	go rs.Run(ctx)
+
+	rj := repositories.NewReportJobRepository(db)
+	rn := report.NewRunner(rj, hr, bs, report.Default(), config.Reports, logger)
+	go rn.Run(ctx)
+
+	ob := repositories.NewOutboxRepository(db)
+	wd := webhook.NewDispatcher(ob, config.Webhooks, logger)
+	go wd.Run(ctx)
+
+	is := repositories.NewIdempotencyRepository(db)
+	go middlewares.PurgeIdempotencyKeys(ctx, is, config.Idempotency, logger)
+
+	sh := stream.NewHub(config.Db.DSN(), logger)
+	go sh.Run(ctx)
+
+	r := handlers.Router(logger, ur, sr, ho, rr, rs, ur, mr, config.Batch, im,
+		hr, is, config.Idempotency, rj, rn, bs,
+		repositories.NewAudienceRepository(db), repositories.NewWebhookRepository(db), wd,
+		ob, sh, config.Stream)
+
+	gs := rpc.NewServer(sr, ur, ob, sh, config.Batch, config.Stream, logger)
+	go func() {
+		logger.Info("gRPC server is started on port ", config.Grpc.Port)
+		err := gs.ListenAndServe(":" + config.Grpc.Port)
+		if err != nil {
+			logger.Fatalf("Error while starting gRPC server: %v", err)
+		}
+	}()
 
 	port := config.Port
 	logger.Info("Server is started on port ", port)
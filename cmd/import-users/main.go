@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/config"
+	"github.com/TinyMarcus/avito-tech-task/internal/db"
+	"github.com/TinyMarcus/avito-tech-task/internal/directory"
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+	"github.com/TinyMarcus/avito-tech-task/internal/holdout"
+	"github.com/TinyMarcus/avito-tech-task/internal/importer"
+	"github.com/TinyMarcus/avito-tech-task/internal/logger"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+// Импорт пользователей и их сегментов из CSV-файла со строками вида user_id[,slug,deadline].
+// Отчет выводится в stdout в том же формате, что и у POST /api/v1/import;
+// если в файле есть ошибочные строки, команда завершается с кодом 2.
+//
+//	import-users -file cohort.csv -dry-run
+func main() {
+	file := flag.String("file", "-", "путь к CSV-файлу, - для чтения из stdin")
+	dryRun := flag.Bool("dry-run", false, "только проверить файл, не применяя изменения")
+	flag.Parse()
+
+	config, err := config.New()
+	logger := logger.CreateLogger(config.Log)
+
+	defer func() {
+		err := logger.Sync()
+		if err != nil {
+			logger.Errorf("Error while syncing logger: %v", err)
+		}
+	}()
+
+	if err != nil {
+		logger.Errorf("Something went wrong with config: %v", err)
+	}
+
+	var input io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			logger.Fatalf("Error while opening file: %v", err)
+		}
+		defer f.Close()
+		input = f
+	}
+
+	db, err := db.CreateConnection(config.Db)
+	if err != nil {
+		logger.Fatalf("Error while connecting to database: %v", err)
+	}
+	defer db.Close()
+
+	err = config.Holdout.Validate()
+	if err != nil {
+		logger.Fatalf("Something went wrong with config: %v", err)
+	}
+
+	err = config.Users.Validate()
+	if err != nil {
+		logger.Fatalf("Something went wrong with config: %v", err)
+	}
+
+	ho := holdout.New(config.Holdout)
+	hr := repositories.NewHistoryRepository(db)
+	im := importer.New(repositories.NewImportRepository(db, hr, ho, directory.NewProvisioner(config.Users)))
+
+	report, err := im.Import(input, *dryRun)
+	if err != nil {
+		logger.Fatalf("Error while importing users: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "    ")
+	err = encoder.Encode(dto.ConvertImportReportToImportReportDto(report))
+	if err != nil {
+		logger.Fatalf("Error while writing report: %v", err)
+	}
+
+	if len(report.Errors) > 0 {
+		db.Close()    //nolint:errcheck
+		logger.Sync() //nolint:errcheck
+		os.Exit(2)
+	}
+}
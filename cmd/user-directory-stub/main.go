@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/directory"
+)
+
+// Локальная замена сервиса пользователей для режима USERS_MODE=directory.
+// Существующими считаются пользователи с внешними идентификаторами из списка -users.
+//
+//	user-directory-stub -addr :8090 -users alice,bob,3f1c2a9e-7b4d-4e8a-9c1f-5d6e7f8a9b0c
+func main() {
+	addr := flag.String("addr", ":8090", "адрес, на котором принимаются запросы")
+	users := flag.String("users", "", "существующие пользователи: внешние идентификаторы через запятую")
+	flag.Parse()
+
+	ids, err := directory.ParseExternalIds(*users)
+	if err != nil {
+		log.Fatalf("Error while parsing users: %v", err)
+	}
+
+	log.Printf("User directory stub with %d users is started on %s", len(ids), *addr)
+	err = http.ListenAndServe(*addr, directory.NewStub(ids))
+	if err != nil {
+		log.Fatalf("Error while starting server: %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package analytics
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+// membership — непрерывное участие пользователя в сегменте [start, end). Нулевой start означает, что начало
+// участия неизвестно (пользователь состоит в сегменте, но в истории о нем нет записей), нулевой end — что
+// участие продолжается.
+type membership struct {
+	start   time.Time
+	end     time.Time
+	expired bool
+}
+
+// activeBefore проверяет, состоял ли пользователь в сегменте непосредственно перед моментом moment. Так число
+// участников в конце периода совпадает с числом в начале следующего и равно числу в начале периода
+// плюс добавления минус выходы за период.
+func (m *membership) activeBefore(moment time.Time) bool {
+	return m.start.Before(moment) && (m.end.IsZero() || !m.end.Before(moment))
+}
+
+// Build считает показатели сегмента за [from, to) по периодам длины period. Участие, у которого наступила
+// дата отключения, считается завершенным в эту дату, но не позже now: будущие даты отключения еще не наступили.
+func Build(slug string, timeline *models.SegmentTimeline, from, to, now time.Time, period string) *models.SegmentAnalytics {
+	horizon := to
+	if now.Before(horizon) {
+		horizon = now
+	}
+
+	memberships := reconstruct(timeline, horizon)
+	analytics := &models.SegmentAnalytics{
+		Slug:   slug,
+		From:   from,
+		To:     to,
+		Period: period,
+		Total:  aggregate(memberships, from, to),
+	}
+	for _, bounds := range Periods(from, to, period) {
+		analytics.Periods = append(analytics.Periods, aggregate(memberships, bounds[0], bounds[1]))
+	}
+
+	return analytics
+}
+
+// Periods делит интервал [from, to) на периоды по границам календарных дней, недель (с понедельника)
+// или месяцев по UTC; первый и последний периоды могут быть неполными
+func Periods(from, to time.Time, period string) [][2]time.Time {
+	var periods [][2]time.Time
+	for start := from; start.Before(to); {
+		end := nextBoundary(start.UTC(), period)
+		if end.After(to) {
+			end = to
+		}
+
+		periods = append(periods, [2]time.Time{start, end})
+		start = end
+	}
+
+	return periods
+}
+
+func nextBoundary(moment time.Time, period string) time.Time {
+	day := time.Date(moment.Year(), moment.Month(), moment.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case models.AnalyticsPeriodDay:
+		return day.AddDate(0, 0, 1)
+	case models.AnalyticsPeriodWeek:
+		daysToMonday := (8 - int(day.Weekday())) % 7
+		if daysToMonday == 0 {
+			daysToMonday = 7
+		}
+		return day.AddDate(0, 0, daysToMonday)
+	default:
+		return time.Date(moment.Year(), moment.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// reconstruct восстанавливает участия пользователей по истории. Записи, сделанные до того, как в историю
+// начала сохраняться дата отключения, не содержат ее — для продолжающихся участий она берется из users_segments.
+func reconstruct(timeline *models.SegmentTimeline, horizon time.Time) []*membership {
+	var memberships []*membership
+	withHistory := make(map[int]bool)
+
+	var current *membership
+	var deadline sql.NullTime
+	closeExpired := func(moment time.Time) {
+		if current != nil && deadline.Valid && !deadline.Time.After(moment) {
+			current.end, current.expired = deadline.Time, true
+			memberships = append(memberships, current)
+			current = nil
+		}
+	}
+	finish := func(userId int) {
+		if current != nil && !deadline.Valid {
+			deadline = timeline.Members[userId]
+		}
+		closeExpired(horizon)
+		if current != nil {
+			memberships = append(memberships, current)
+		}
+		current, deadline = nil, sql.NullTime{}
+	}
+
+	for i, record := range timeline.Records {
+		if i > 0 && timeline.Records[i-1].UserId != record.UserId {
+			finish(timeline.Records[i-1].UserId)
+		}
+		withHistory[record.UserId] = true
+
+		closeExpired(record.ActionDate)
+		switch record.OperationType {
+		case repositories.OperationRemoving:
+			if current != nil {
+				current.end = record.ActionDate
+				memberships = append(memberships, current)
+				current = nil
+			}
+		default:
+			if current == nil {
+				current = &membership{start: record.ActionDate}
+			}
+			deadline = record.DeadlineDate
+		}
+	}
+	if len(timeline.Records) > 0 {
+		finish(timeline.Records[len(timeline.Records)-1].UserId)
+	}
+
+	for userId, memberDeadline := range timeline.Members {
+		if withHistory[userId] {
+			continue
+		}
+
+		current, deadline = &membership{}, memberDeadline
+		finish(userId)
+	}
+
+	return memberships
+}
+
+func aggregate(memberships []*membership, from, to time.Time) *models.AnalyticsPeriod {
+	period := &models.AnalyticsPeriod{
+		From: from,
+		To:   to,
+	}
+
+	type event struct {
+		moment time.Time
+		delta  int
+	}
+	var events []event
+	var durations []time.Duration
+
+	inPeriod := func(moment time.Time) bool {
+		return !moment.IsZero() && !moment.Before(from) && moment.Before(to)
+	}
+
+	for _, m := range memberships {
+		if m.activeBefore(from) {
+			period.MembersStart++
+		}
+		if m.activeBefore(to) {
+			period.MembersEnd++
+		}
+
+		if inPeriod(m.start) {
+			period.Adds++
+			events = append(events, event{m.start, 1})
+		}
+
+		if inPeriod(m.end) {
+			if m.expired {
+				period.Expirations++
+			} else {
+				period.Removes++
+			}
+			events = append(events, event{m.end, -1})
+			if !m.start.IsZero() {
+				durations = append(durations, m.end.Sub(m.start))
+			}
+		}
+	}
+
+	// число участников сравнивается только после всех событий одного момента, чтобы одновременные
+	// выход и вход не давали ложного пика
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].moment.Before(events[j].moment)
+	})
+
+	members := period.MembersStart
+	if len(events) == 0 || events[0].moment.After(from) {
+		period.PeakMembers = members
+	}
+	for i, e := range events {
+		members += e.delta
+		if (i == len(events)-1 || !events[i+1].moment.Equal(e.moment)) && members > period.PeakMembers {
+			period.PeakMembers = members
+		}
+	}
+
+	period.Completed = len(durations)
+	if len(durations) > 0 {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+		middle := len(durations) / 2
+		period.MedianDuration = durations[middle]
+		if len(durations)%2 == 0 {
+			period.MedianDuration = (durations[middle-1] + durations[middle]) / 2
+		}
+
+		var sum time.Duration
+		for _, d := range durations {
+			sum += d
+		}
+		period.AverageDuration = sum / time.Duration(len(durations))
+	}
+
+	return period
+}
@@ -0,0 +1,293 @@
+package analytics
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+func day(month time.Month, d int) time.Time {
+	return time.Date(2023, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func until(moment time.Time) sql.NullTime {
+	return sql.NullTime{Time: moment, Valid: true}
+}
+
+func record(userId int, operation string, actionDate time.Time, deadline sql.NullTime) *models.HistoryRecord {
+	return &models.HistoryRecord{UserId: userId, Slug: "AVITO", OperationType: operation, ActionDate: actionDate,
+		DeadlineDate: deadline}
+}
+
+func TestReconstruct(t *testing.T) {
+	horizon := day(time.March, 1)
+
+	tests := []struct {
+		name     string
+		timeline *models.SegmentTimeline
+		want     []membership
+	}{
+		{name: "empty", timeline: &models.SegmentTimeline{}},
+		{
+			name: "added and removed",
+			timeline: &models.SegmentTimeline{Records: []*models.HistoryRecord{
+				record(1, repositories.OperationAdding, day(time.January, 1), sql.NullTime{}),
+				record(1, repositories.OperationRemoving, day(time.January, 10), sql.NullTime{}),
+			}},
+			want: []membership{{start: day(time.January, 1), end: day(time.January, 10)}},
+		},
+		{
+			name: "deadline before horizon",
+			timeline: &models.SegmentTimeline{Records: []*models.HistoryRecord{
+				record(1, repositories.OperationAdding, day(time.January, 1), until(day(time.February, 1))),
+			}},
+			want: []membership{{start: day(time.January, 1), end: day(time.February, 1), expired: true}},
+		},
+		{
+			name: "deadline after horizon",
+			timeline: &models.SegmentTimeline{
+				Records: []*models.HistoryRecord{
+					record(1, repositories.OperationAdding, day(time.January, 1), until(day(time.April, 1))),
+				},
+				Members: map[int]sql.NullTime{1: until(day(time.April, 1))},
+			},
+			want: []membership{{start: day(time.January, 1)}},
+		},
+		{
+			name: "deadline is taken from members for legacy records",
+			timeline: &models.SegmentTimeline{
+				Records: []*models.HistoryRecord{
+					record(1, repositories.OperationAdding, day(time.January, 1), sql.NullTime{}),
+				},
+				Members: map[int]sql.NullTime{1: until(day(time.February, 1))},
+			},
+			want: []membership{{start: day(time.January, 1), end: day(time.February, 1), expired: true}},
+		},
+		{
+			name: "updated deadline",
+			timeline: &models.SegmentTimeline{Records: []*models.HistoryRecord{
+				record(1, repositories.OperationAdding, day(time.January, 1), until(day(time.February, 1))),
+				record(1, repositories.OperationUpdating, day(time.January, 20), until(day(time.February, 10))),
+			}},
+			want: []membership{{start: day(time.January, 1), end: day(time.February, 10), expired: true}},
+		},
+		{
+			name: "added again after expiration",
+			timeline: &models.SegmentTimeline{Records: []*models.HistoryRecord{
+				record(1, repositories.OperationAdding, day(time.January, 1), until(day(time.January, 5))),
+				record(1, repositories.OperationAdding, day(time.January, 10), sql.NullTime{}),
+			}},
+			want: []membership{
+				{start: day(time.January, 1), end: day(time.January, 5), expired: true},
+				{start: day(time.January, 10)},
+			},
+		},
+		{
+			name: "removal without membership is ignored",
+			timeline: &models.SegmentTimeline{Records: []*models.HistoryRecord{
+				record(1, repositories.OperationRemoving, day(time.January, 1), sql.NullTime{}),
+			}},
+		},
+		{
+			name: "users are reconstructed separately",
+			timeline: &models.SegmentTimeline{Records: []*models.HistoryRecord{
+				record(1, repositories.OperationAdding, day(time.January, 1), until(day(time.April, 1))),
+				record(2, repositories.OperationAdding, day(time.January, 2), sql.NullTime{}),
+				record(2, repositories.OperationRemoving, day(time.January, 3), sql.NullTime{}),
+			}},
+			want: []membership{
+				{start: day(time.January, 1)},
+				{start: day(time.January, 2), end: day(time.January, 3)},
+			},
+		},
+		{
+			name:     "member without history",
+			timeline: &models.SegmentTimeline{Members: map[int]sql.NullTime{1: {}}},
+			want:     []membership{{}},
+		},
+		{
+			name:     "expired member without history",
+			timeline: &models.SegmentTimeline{Members: map[int]sql.NullTime{1: until(day(time.February, 1))}},
+			want:     []membership{{end: day(time.February, 1), expired: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := reconstruct(tt.timeline, horizon)
+			if len(got) != len(tt.want) {
+				t.Fatalf("reconstruct() returned %d memberships, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if *got[i] != tt.want[i] {
+					t.Errorf("reconstruct()[%d] = %+v, want %+v", i, *got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	from, to := day(time.January, 1), day(time.February, 1)
+
+	tests := []struct {
+		name        string
+		memberships []*membership
+		want        models.AnalyticsPeriod
+	}{
+		{name: "empty", want: models.AnalyticsPeriod{From: from, To: to}},
+		{
+			name: "period",
+			memberships: []*membership{
+				{start: day(time.January, 1).AddDate(0, -1, 0)},
+				{},
+				{start: day(time.January, 1).AddDate(0, 0, -12), end: day(time.January, 5)},
+				{start: day(time.January, 10), end: day(time.January, 20)},
+				{start: day(time.January, 15), end: day(time.January, 30), expired: true},
+			},
+			want: models.AnalyticsPeriod{
+				From:            from,
+				To:              to,
+				Adds:            2,
+				Removes:         2,
+				Expirations:     1,
+				MembersStart:    3,
+				MembersEnd:      2,
+				PeakMembers:     4,
+				Completed:       3,
+				MedianDuration:  15 * 24 * time.Hour,
+				AverageDuration: (16 + 10 + 15) * 24 * time.Hour / 3,
+			},
+		},
+		{
+			name: "simultaneous exit and entry",
+			memberships: []*membership{
+				{start: day(time.January, 1).AddDate(0, 0, -10), end: day(time.January, 10)},
+				{start: day(time.January, 10)},
+			},
+			want: models.AnalyticsPeriod{
+				From:            from,
+				To:              to,
+				Adds:            1,
+				Removes:         1,
+				MembersStart:    1,
+				MembersEnd:      1,
+				PeakMembers:     1,
+				Completed:       1,
+				MedianDuration:  19 * 24 * time.Hour,
+				AverageDuration: 19 * 24 * time.Hour,
+			},
+		},
+		{
+			name: "even number of durations",
+			memberships: []*membership{
+				{start: day(time.January, 2), end: day(time.January, 3)},
+				{start: day(time.January, 2), end: day(time.January, 5)},
+			},
+			want: models.AnalyticsPeriod{
+				From:            from,
+				To:              to,
+				Adds:            2,
+				Removes:         2,
+				PeakMembers:     2,
+				Completed:       2,
+				MedianDuration:  2 * 24 * time.Hour,
+				AverageDuration: 2 * 24 * time.Hour,
+			},
+		},
+		{
+			name: "entry at period start",
+			memberships: []*membership{
+				{start: from},
+			},
+			want: models.AnalyticsPeriod{From: from, To: to, Adds: 1, MembersEnd: 1, PeakMembers: 1},
+		},
+		{
+			name: "exit at period start",
+			memberships: []*membership{
+				{start: day(time.January, 1).AddDate(0, 0, -1), end: from, expired: true},
+			},
+			want: models.AnalyticsPeriod{From: from, To: to, Expirations: 1, MembersStart: 1, Completed: 1,
+				MedianDuration: 24 * time.Hour, AverageDuration: 24 * time.Hour},
+		},
+		{
+			name: "outside period",
+			memberships: []*membership{
+				{start: day(time.February, 1), end: day(time.February, 10)},
+				{start: day(time.January, 1).AddDate(0, 0, -10), end: day(time.January, 1).AddDate(0, 0, -5)},
+			},
+			want: models.AnalyticsPeriod{From: from, To: to},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := aggregate(tt.memberships, from, to); *got != tt.want {
+				t.Errorf("aggregate() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeriods(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   time.Time
+		to     time.Time
+		period string
+		want   []time.Time
+	}{
+		{name: "empty", from: day(time.January, 1), to: day(time.January, 1), period: models.AnalyticsPeriodDay},
+		{
+			name:   "days",
+			from:   day(time.January, 1).Add(12 * time.Hour),
+			to:     day(time.January, 3),
+			period: models.AnalyticsPeriodDay,
+			want:   []time.Time{day(time.January, 1).Add(12 * time.Hour), day(time.January, 2), day(time.January, 3)},
+		},
+		{
+			name:   "weeks start on monday",
+			from:   day(time.January, 4),
+			to:     day(time.January, 20),
+			period: models.AnalyticsPeriodWeek,
+			want:   []time.Time{day(time.January, 4), day(time.January, 9), day(time.January, 16), day(time.January, 20)},
+		},
+		{
+			name:   "week from monday",
+			from:   day(time.January, 2),
+			to:     day(time.January, 10),
+			period: models.AnalyticsPeriodWeek,
+			want:   []time.Time{day(time.January, 2), day(time.January, 9), day(time.January, 10)},
+		},
+		{
+			name:   "months",
+			from:   day(time.January, 15),
+			to:     day(time.March, 1),
+			period: models.AnalyticsPeriodMonth,
+			want:   []time.Time{day(time.January, 15), day(time.February, 1), day(time.March, 1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Periods(tt.from, tt.to, tt.period)
+			if len(tt.want) == 0 {
+				if len(got) != 0 {
+					t.Fatalf("Periods() = %v, want none", got)
+				}
+				return
+			}
+			if len(got) != len(tt.want)-1 {
+				t.Fatalf("Periods() = %v, want bounds %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i][0].Equal(tt.want[i]) || !got[i][1].Equal(tt.want[i+1]) {
+					t.Errorf("Periods()[%d] = %v, want [%s, %s)", i, got[i], tt.want[i], tt.want[i+1])
+				}
+			}
+		})
+	}
+}
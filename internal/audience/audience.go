@@ -0,0 +1,322 @@
+package audience
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Expression — булево выражение над сегментами, например `A AND NOT B` или `(A OR B) AND C`.
+// Операторы можно писать как AND, OR, NOT (без учета регистра) или как &&, || и !. Названия сегментов
+// с пробелами, скобками и другими служебными символами записываются в кавычках.
+type Expression struct {
+	root node
+}
+
+type node interface {
+	compile(leaf func(slug string) string) string
+	collect(slugs map[string]bool, ordered *[]string)
+	String() string
+}
+
+// Parse разбирает выражение
+func Parse(source string) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", t.text, t.pos)
+	}
+
+	return &Expression{root: root}, nil
+}
+
+// String возвращает выражение в каноническом виде со скобками вокруг каждой операции
+func (e *Expression) String() string {
+	return e.root.String()
+}
+
+// Slugs возвращает названия сегментов из выражения в порядке первого упоминания
+func (e *Expression) Slugs() []string {
+	var ordered []string
+	e.root.collect(make(map[string]bool), &ordered)
+	return ordered
+}
+
+// Compile переводит выражение в условие с операторами AND, OR и NOT, подставляя вместо каждого сегмента
+// условие leaf — например, условие SQL о том, что пользователь состоит в сегменте
+func (e *Expression) Compile(leaf func(slug string) string) string {
+	return e.root.compile(leaf)
+}
+
+type segmentNode struct {
+	slug string
+}
+
+func (n *segmentNode) compile(leaf func(slug string) string) string {
+	return leaf(n.slug)
+}
+
+func (n *segmentNode) collect(slugs map[string]bool, ordered *[]string) {
+	if !slugs[n.slug] {
+		slugs[n.slug] = true
+		*ordered = append(*ordered, n.slug)
+	}
+}
+
+func (n *segmentNode) String() string {
+	if strings.IndexFunc(n.slug, isSpecial) >= 0 || isKeyword(n.slug) {
+		return `"` + strings.ReplaceAll(strings.ReplaceAll(n.slug, `\`, `\\`), `"`, `\"`) + `"`
+	}
+
+	return n.slug
+}
+
+type logicalNode struct {
+	op    string
+	left  node
+	right node
+}
+
+func (n *logicalNode) compile(leaf func(slug string) string) string {
+	return "(" + n.left.compile(leaf) + " " + strings.ToUpper(n.op) + " " + n.right.compile(leaf) + ")"
+}
+
+func (n *logicalNode) collect(slugs map[string]bool, ordered *[]string) {
+	n.left.collect(slugs, ordered)
+	n.right.collect(slugs, ordered)
+}
+
+func (n *logicalNode) String() string {
+	return "(" + n.left.String() + " " + strings.ToUpper(n.op) + " " + n.right.String() + ")"
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n *notNode) compile(leaf func(slug string) string) string {
+	return "(NOT " + n.operand.compile(leaf) + ")"
+}
+
+func (n *notNode) collect(slugs map[string]bool, ordered *[]string) {
+	n.operand.collect(slugs, ordered)
+}
+
+func (n *notNode) String() string {
+	return "NOT " + n.operand.String()
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenSegment
+	tokenOperator
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func isSpecial(c rune) bool {
+	return unicode.IsSpace(c) || strings.ContainsRune(`()!&|"'\`, c)
+}
+
+func isKeyword(word string) bool {
+	switch strings.ToLower(word) {
+	case "and", "or", "not":
+		return true
+	}
+
+	return false
+}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case c == '!':
+			tokens = append(tokens, token{kind: tokenOperator, text: "not", pos: i})
+			i++
+		case c == '&' || c == '|':
+			if i+1 >= len(runes) || runes[i+1] != c {
+				return nil, fmt.Errorf("unknown operator %q at position %d", c, i)
+			}
+			op := "and"
+			if c == '|' {
+				op = "or"
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+			i += 2
+		case c == '"' || c == '\'':
+			end := i + 1
+			var sb strings.Builder
+			for end < len(runes) && runes[end] != c {
+				if runes[end] == '\\' && end+1 < len(runes) {
+					end++
+				}
+				sb.WriteRune(runes[end])
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, token{kind: tokenSegment, text: sb.String(), pos: i})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !isSpecial(runes[end]) {
+				end++
+			}
+			word := string(runes[i:end])
+			if isKeyword(word) {
+				tokens = append(tokens, token{kind: tokenOperator, text: strings.ToLower(word), pos: i})
+			} else {
+				tokens = append(tokens, token{kind: tokenSegment, text: word, pos: i})
+			}
+			i = end
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, text: "end of expression", pos: len(runes)}), nil
+}
+
+// maxDepth ограничивает вложенность скобок и отрицаний, чтобы разбор выражения не исчерпал стек,
+// а составленное по нему условие SQL оставалось разумного размера
+const maxDepth = 64
+
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isOperator(op string) bool {
+	t := p.peek()
+	return t.kind == tokenOperator && t.text == op
+}
+
+// descend увеличивает глубину вложенности; вызывающий уменьшает ее, выйдя из вложенного выражения
+func (p *parser) descend(pos int) error {
+	p.depth++
+	if p.depth > maxDepth {
+		return fmt.Errorf("expression is nested deeper than %d levels at position %d", maxDepth, pos)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "or", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "and", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.isOperator("not") {
+		if err := p.descend(p.next().pos); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenLParen:
+		if err := p.descend(t.pos); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, fmt.Errorf("expected ) at position %d", closing.pos)
+		}
+		return inner, nil
+	case tokenSegment:
+		if t.text == "" {
+			return nil, fmt.Errorf("empty segment name at position %d", t.pos)
+		}
+		return &segmentNode{slug: t.text}, nil
+	default:
+		return nil, fmt.Errorf("expected segment name or ( at position %d, got %s", t.pos, t.text)
+	}
+}
@@ -0,0 +1,98 @@
+package audience
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		want      string
+		wantSlugs []string
+		wantErr   string
+	}{
+		{name: "single segment", source: "AVITO_VOICE", want: "AVITO_VOICE", wantSlugs: []string{"AVITO_VOICE"}},
+		{name: "keywords", source: "A and not B", want: "(A AND NOT B)", wantSlugs: []string{"A", "B"}},
+		{name: "symbols", source: "A && !B || C", want: "((A AND NOT B) OR C)", wantSlugs: []string{"A", "B", "C"}},
+		{name: "precedence", source: "A OR B AND C", want: "(A OR (B AND C))", wantSlugs: []string{"A", "B", "C"}},
+		{name: "parens", source: "(A OR B) AND C", want: "((A OR B) AND C)", wantSlugs: []string{"A", "B", "C"}},
+		{name: "repeated segment", source: "A OR (B AND A)", want: "(A OR (B AND A))", wantSlugs: []string{"A", "B"}},
+		{name: "quoted", source: `"with space" AND 'or'`, want: `("with space" AND "or")`, wantSlugs: []string{"with space", "or"}},
+		{name: "escaped quote", source: `"a\"b"`, want: `"a\"b"`, wantSlugs: []string{`a"b`}},
+		{name: "non-ASCII", source: "Голосовые AND NOT Видео", want: "(Голосовые AND NOT Видео)",
+			wantSlugs: []string{"Голосовые", "Видео"}},
+		{name: "empty", source: "", wantErr: "expected segment name or ( at position 0"},
+		{name: "single ampersand", source: "A & B", wantErr: `unknown operator '&' at position 2`},
+		{name: "unterminated string", source: `"A`, wantErr: "unterminated string at position 0"},
+		{name: "empty quoted", source: `""`, wantErr: "empty segment name at position 0"},
+		{name: "unclosed paren", source: "(A OR B", wantErr: "expected ) at position 7"},
+		{name: "dangling operator", source: "A AND", wantErr: "expected segment name or ( at position 5, got end of expression"},
+		{name: "trailing segment", source: "A B", wantErr: "unexpected B at position 2"},
+		{name: "non-ASCII position", source: "Видео )", wantErr: "unexpected ) at position 6"},
+		{name: "max depth", source: strings.Repeat("(", maxDepth) + "A" + strings.Repeat(")", maxDepth),
+			want: "A", wantSlugs: []string{"A"}},
+		{name: "too deep", source: strings.Repeat("(", maxDepth+1) + "A" + strings.Repeat(")", maxDepth+1),
+			wantErr: "expression is nested deeper than 64 levels at position 64"},
+		{name: "too deep negations", source: strings.Repeat("!", maxDepth+1) + "A",
+			wantErr: "expression is nested deeper than 64 levels at position 64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expression, err := Parse(tt.source)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse(%q) error = %v, want %q", tt.source, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.source, err)
+			}
+			if got := expression.String(); got != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.source, got, tt.want)
+			}
+			if got := expression.Slugs(); !reflect.DeepEqual(got, tt.wantSlugs) {
+				t.Errorf("Slugs(%q) = %v, want %v", tt.source, got, tt.wantSlugs)
+			}
+
+			// каноническая запись разбирается в то же выражение
+			reparsed, err := Parse(expression.String())
+			if err != nil || reparsed.String() != tt.want {
+				t.Errorf("Parse(%q) = %v, %v, want %s", expression.String(), reparsed, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompile(t *testing.T) {
+	leaf := func(slug string) string {
+		return "member('" + slug + "')"
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{name: "single segment", source: "A", want: "member('A')"},
+		{name: "and not", source: "A AND NOT B", want: "(member('A') AND (NOT member('B')))"},
+		{name: "or of and", source: "(A || B) && C", want: "((member('A') OR member('B')) AND member('C'))"},
+		{name: "double negation", source: "!!A", want: "(NOT (NOT member('A')))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expression, err := Parse(tt.source)
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.source, err)
+			}
+			if got := expression.Compile(leaf); got != tt.want {
+				t.Errorf("Compile(%q) = %s, want %s", tt.source, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package blob
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	StoreFS = "fs"
+	StoreS3 = "s3"
+)
+
+// maxS3LinkTTL — наибольший срок действия подписанной ссылки, который допускает S3
+const maxS3LinkTTL = 7 * 24 * time.Hour
+
+var (
+	ErrBlobNotFound     = errors.New("Blob not found")
+	ErrInvalidSignature = errors.New("Signed link is invalid or expired")
+)
+
+// BlobConfig задает хранилище готовых файлов: fs — каталог на диске, файлы из которого отдает сам сервис,
+// s3 — S3-совместимое объектное хранилище (AWS S3, MinIO и т. п.)
+type BlobConfig struct {
+	Store   string        `envconfig:"STORE" default:"fs"`
+	LinkTTL time.Duration `envconfig:"LINK_TTL" default:"15m"`
+
+	Dir        string `envconfig:"DIR" default:"data/blobs"`
+	PublicURL  string `envconfig:"PUBLIC_URL" default:"http://localhost:8080"`
+	SigningKey string `envconfig:"SIGNING_KEY"`
+
+	S3Endpoint       string `envconfig:"S3_ENDPOINT"`
+	S3PublicEndpoint string `envconfig:"S3_PUBLIC_ENDPOINT"`
+	S3Region         string `envconfig:"S3_REGION" default:"us-east-1"`
+	S3Bucket         string `envconfig:"S3_BUCKET"`
+	S3AccessKey      string `envconfig:"S3_ACCESS_KEY"`
+	S3SecretKey      string `envconfig:"S3_SECRET_KEY"`
+}
+
+func (c BlobConfig) Validate() error {
+	if c.LinkTTL <= 0 {
+		return errors.New("blob link TTL must be positive")
+	}
+
+	switch c.Store {
+	case StoreFS:
+		if c.Dir == "" || c.PublicURL == "" {
+			return errors.New("blob dir and public URL are required for fs store")
+		}
+		return nil
+	case StoreS3:
+		if c.S3Endpoint == "" || c.S3Bucket == "" || c.S3AccessKey == "" || c.S3SecretKey == "" {
+			return errors.New("S3 endpoint, bucket and credentials are required for s3 store")
+		}
+		if c.LinkTTL > maxS3LinkTTL {
+			return errors.New("blob link TTL must not exceed 7 days for s3 store")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown blob store %q", c.Store)
+}
+
+// Download описывает, как браузер должен сохранить файл, скачанный по ссылке
+type Download struct {
+	Filename    string
+	ContentType string
+}
+
+// BlobStore хранит готовые файлы и выдает на них ссылки для скачивания с ограниченным сроком действия
+type BlobStore interface {
+	// Put сохраняет объект под ключом key; тело читается до конца
+	Put(ctx context.Context, key, contentType string, body io.ReadSeeker) error
+	// SignedURL возвращает подписанную ссылку на скачивание объекта и время, до которого она действует
+	SignedURL(key string, download Download) (string, time.Time, error)
+}
+
+// New создает хранилище по конфигурации. Если для fs не задан ключ подписи, генерируется случайный —
+// тогда выданные ссылки перестают действовать после перезапуска сервиса.
+func New(cfg BlobConfig) (BlobStore, error) {
+	switch cfg.Store {
+	case StoreS3:
+		return NewS3Store(cfg)
+	default:
+		key := []byte(cfg.SigningKey)
+		if len(key) == 0 {
+			key = make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return nil, err
+			}
+		}
+
+		return NewFSStore(cfg.Dir, cfg.PublicURL, key, cfg.LinkTTL)
+	}
+}
@@ -0,0 +1,142 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	goErrors "errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DownloadPath — путь, по которому сервис отдает файлы из локального хранилища
+const DownloadPath = "/api/v1/blobs/"
+
+// FSStore хранит файлы в каталоге на диске. Ссылки на скачивание ведут на сам сервис и подписываются
+// HMAC-SHA256 от ключа объекта, имени файла, типа содержимого и срока действия ссылки.
+type FSStore struct {
+	dir        string
+	publicURL  string
+	signingKey []byte
+	linkTTL    time.Duration
+}
+
+func NewFSStore(dir, publicURL string, signingKey []byte, linkTTL time.Duration) (*FSStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	return &FSStore{
+		dir:        dir,
+		publicURL:  strings.TrimRight(publicURL, "/"),
+		signingKey: signingKey,
+		linkTTL:    linkTTL,
+	}, nil
+}
+
+// Put записывает объект во временный файл и переименовывает его, чтобы по ссылке никогда
+// не отдавался недописанный файл
+func (s *FSStore) Put(ctx context.Context, key, contentType string, body io.ReadSeeker) error {
+	name := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0o750); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	if _, err = io.Copy(tmp, body); err != nil {
+		tmp.Close() //nolint:errcheck
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+func (s *FSStore) SignedURL(key string, download Download) (string, time.Time, error) {
+	expires := time.Now().Add(s.linkTTL).Truncate(time.Second)
+
+	query := url.Values{}
+	query.Set("filename", download.Filename)
+	query.Set("content_type", download.ContentType)
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", s.sign(key, download, expires.Unix()))
+
+	return s.publicURL + DownloadPath + escapeKey(key) + "?" + query.Encode(), expires, nil
+}
+
+// Open проверяет подпись ссылки и открывает объект. Ключ объекта берется из пути ссылки,
+// остальные подписанные параметры — из ее query.
+func (s *FSStore) Open(key string, query url.Values) (*os.File, *Download, error) {
+	download := &Download{
+		Filename:    query.Get("filename"),
+		ContentType: query.Get("content_type"),
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return nil, nil, ErrInvalidSignature
+	}
+
+	signature, err := hex.DecodeString(query.Get("signature"))
+	if err != nil {
+		return nil, nil, ErrInvalidSignature
+	}
+
+	expected, _ := hex.DecodeString(s.sign(key, *download, expires))
+	if !hmac.Equal(signature, expected) {
+		return nil, nil, ErrInvalidSignature
+	}
+
+	file, err := os.Open(s.path(key))
+	if err != nil {
+		if goErrors.Is(err, fs.ErrNotExist) {
+			return nil, nil, ErrBlobNotFound
+		}
+
+		return nil, nil, err
+	}
+
+	return file, download, nil
+}
+
+func (s *FSStore) sign(key string, download Download, expires int64) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	for _, part := range []string{key, download.Filename, download.ContentType, strconv.FormatInt(expires, 10)} {
+		mac.Write([]byte(part))
+		mac.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// path возвращает путь к файлу объекта; ключ очищается от "..", чтобы не выйти за пределы каталога
+func (s *FSStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
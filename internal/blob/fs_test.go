@@ -0,0 +1,151 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFSStoreSignedURL(t *testing.T) {
+	store, err := NewFSStore(t.TempDir(), "http://localhost:8080/", []byte("key"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		download Download
+		wantPath string
+	}{
+		{
+			name:     "plain key",
+			key:      "reports/job.csv",
+			download: Download{Filename: "report.csv", ContentType: "text/csv"},
+			wantPath: "/api/v1/blobs/reports/job.csv",
+		},
+		{
+			name:     "escaped segments",
+			key:      "reports/отчет за май.csv",
+			download: Download{Filename: "отчет.csv", ContentType: "text/csv; charset=utf-8"},
+			wantPath: "/api/v1/blobs/reports/%D0%BE%D1%82%D1%87%D0%B5%D1%82%20%D0%B7%D0%B0%20%D0%BC%D0%B0%D0%B9.csv",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now()
+			link, expires, err := store.SignedURL(tt.key, tt.download)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, err := url.Parse(link)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Host != "localhost:8080" || parsed.EscapedPath() != tt.wantPath {
+				t.Errorf("SignedURL() = %s, want path %s", link, tt.wantPath)
+			}
+
+			query := parsed.Query()
+			if query.Get("filename") != tt.download.Filename || query.Get("content_type") != tt.download.ContentType {
+				t.Errorf("SignedURL() query = %v, want %+v", query, tt.download)
+			}
+			if expires.Before(before.Add(time.Minute-time.Second)) || expires.After(before.Add(time.Minute)) {
+				t.Errorf("SignedURL() expires = %s, want about a minute after %s", expires, before)
+			}
+		})
+	}
+}
+
+func TestFSStoreOpen(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFSStore(dir, "http://localhost:8080", []byte("key"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := NewFSStore(dir, "http://localhost:8080", []byte("key"), -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := NewFSStore(dir, "http://localhost:8080", []byte("other"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const key = "reports/job.csv"
+	download := Download{Filename: "report.csv", ContentType: "text/csv"}
+	if err = store.Put(context.Background(), key, download.ContentType, strings.NewReader("a,b\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	signed := func(s *FSStore, key string) url.Values {
+		link, _, err := s.SignedURL(key, download)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := url.Parse(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.Query()
+	}
+	with := func(query url.Values, name, value string) url.Values {
+		changed := url.Values{}
+		for k, v := range query {
+			changed[k] = v
+		}
+		changed.Set(name, value)
+		return changed
+	}
+
+	valid := signed(store, key)
+	tests := []struct {
+		name    string
+		key     string
+		query   url.Values
+		wantErr error
+	}{
+		{name: "valid", key: key, query: valid},
+		{name: "expired", key: key, query: signed(expired, key), wantErr: ErrInvalidSignature},
+		{name: "other signing key", key: key, query: signed(otherKey, key), wantErr: ErrInvalidSignature},
+		{name: "tampered key", key: "reports/other.csv", query: valid, wantErr: ErrInvalidSignature},
+		{name: "tampered filename", key: key, query: with(valid, "filename", "evil.html"), wantErr: ErrInvalidSignature},
+		{name: "tampered content type", key: key, query: with(valid, "content_type", "text/html"), wantErr: ErrInvalidSignature},
+		{name: "extended expiry", key: key, query: with(valid, "expires", "99999999999"), wantErr: ErrInvalidSignature},
+		{name: "malformed expiry", key: key, query: with(valid, "expires", "soon"), wantErr: ErrInvalidSignature},
+		{name: "malformed signature", key: key, query: with(valid, "signature", "not-hex"), wantErr: ErrInvalidSignature},
+		{name: "missing signature", key: key, query: with(valid, "signature", ""), wantErr: ErrInvalidSignature},
+		{name: "missing object", key: "reports/missing.csv", query: signed(store, "reports/missing.csv"), wantErr: ErrBlobNotFound},
+		{name: "path traversal", key: "../reports/job.csv", query: signed(store, "../reports/job.csv")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, got, err := store.Open(tt.key, tt.query)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Open() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Open() unexpected error: %v", err)
+			}
+			defer file.Close()
+
+			body, err := io.ReadAll(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != "a,b\n" || *got != download {
+				t.Errorf("Open() = %q, %+v, want %q, %+v", body, *got, "a,b\n", download)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm      = "AWS4-HMAC-SHA256"
+	s3Service        = "s3"
+	s3UnsignedBody   = "UNSIGNED-PAYLOAD"
+	s3DateFormat     = "20060102"
+	s3DateTimeFormat = "20060102T150405Z"
+)
+
+// S3Store хранит файлы в бакете S3-совместимого хранилища. Запросы подписываются по схеме AWS Signature
+// Version 4, бакет адресуется в пути (path-style), как того требует MinIO без настроенного домена.
+// Ссылки на скачивание — presigned URL самого хранилища, поэтому файлы отдаются в обход сервиса.
+type S3Store struct {
+	endpoint       *url.URL
+	publicEndpoint *url.URL
+	region         string
+	bucket         string
+	accessKey      string
+	secretKey      string
+	linkTTL        time.Duration
+	client         *http.Client
+}
+
+// NewS3Store создает хранилище. Если задан S3PublicEndpoint, ссылки на скачивание строятся на него —
+// это нужно, когда сервис обращается к хранилищу по внутреннему адресу, недоступному клиентам.
+func NewS3Store(cfg BlobConfig) (*S3Store, error) {
+	endpoint, err := url.Parse(strings.TrimRight(cfg.S3Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	publicEndpoint := endpoint
+	if cfg.S3PublicEndpoint != "" {
+		if publicEndpoint, err = url.Parse(strings.TrimRight(cfg.S3PublicEndpoint, "/")); err != nil {
+			return nil, err
+		}
+	}
+
+	return &S3Store{
+		endpoint:       endpoint,
+		publicEndpoint: publicEndpoint,
+		region:         cfg.S3Region,
+		bucket:         cfg.S3Bucket,
+		accessKey:      cfg.S3AccessKey,
+		secretKey:      cfg.S3SecretKey,
+		linkTTL:        cfg.LinkTTL,
+		client:         &http.Client{},
+	}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key, contentType string, body io.ReadSeeker) error {
+	hash := sha256.New()
+	size, err := io.Copy(hash, body)
+	if err != nil {
+		return err
+	}
+	if _, err = body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	objectURL := s.objectURL(s.endpoint, key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL.String(), io.NopCloser(body))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	payloadHash := hex.EncodeToString(hash.Sum(nil))
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("X-Amz-Date", now.Format(s3DateTimeFormat))
+
+	headers := map[string]string{
+		"content-type":         contentType,
+		"host":                 objectURL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           now.Format(s3DateTimeFormat),
+	}
+	signedHeaders, signature := s.sign(http.MethodPut, objectURL, url.Values{}, headers, payloadHash, now)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.accessKey, s.scope(now), signedHeaders, signature))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("object storage responded with status %d: %s", resp.StatusCode, message)
+	}
+
+	return nil
+}
+
+func (s *S3Store) SignedURL(key string, download Download) (string, time.Time, error) {
+	now := time.Now().UTC()
+	expires := now.Add(s.linkTTL).Truncate(time.Second)
+
+	objectURL := s.objectURL(s.publicEndpoint, key)
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(s3DateTimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(s.linkTTL.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if download.ContentType != "" {
+		query.Set("response-content-type", download.ContentType)
+	}
+	if download.Filename != "" {
+		query.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": download.Filename}))
+	}
+
+	_, signature := s.sign(http.MethodGet, objectURL, query, map[string]string{"host": objectURL.Host}, s3UnsignedBody, now)
+	query.Set("X-Amz-Signature", signature)
+	objectURL.RawQuery = canonicalQuery(query)
+
+	return objectURL.String(), expires, nil
+}
+
+func (s *S3Store) objectURL(endpoint *url.URL, key string) *url.URL {
+	objectURL := *endpoint
+	objectURL.Path = endpoint.Path + "/" + s.bucket + "/" + key
+	objectURL.RawPath = uriEncode(endpoint.Path, false) + "/" + uriEncode(s.bucket, true) + "/" + uriEncode(key, false)
+	return &objectURL
+}
+
+func (s *S3Store) scope(now time.Time) string {
+	return strings.Join([]string{now.Format(s3DateFormat), s.region, s3Service, "aws4_request"}, "/")
+}
+
+// sign формирует канонический запрос и возвращает список подписанных заголовков и подпись
+func (s *S3Store) sign(method string, u *url.URL, query url.Values, headers map[string]string, payloadHash string, now time.Time) (string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		canonicalQuery(query),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format(s3DateTimeFormat),
+		s.scope(now),
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format(s3DateFormat))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+
+	return signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery кодирует параметры так, как требует Signature Version 4: с сортировкой по имени
+// и кодированием всех символов, кроме A-Z, a-z, 0-9, '-', '.', '_' и '~'
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		for _, value := range query[name] {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+func uriEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '.', b == '_', b == '~', b == '/' && !encodeSlash:
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+
+	return encoded.String()
+}
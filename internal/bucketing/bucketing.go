@@ -0,0 +1,20 @@
+package bucketing
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// Buckets — количество корзин, на которые делятся пользователи (шаг в 0.01%)
+const Buckets = 10000
+
+// Bucket детерминированно определяет корзину пользователя для заданной соли
+func Bucket(salt, key string) int {
+	sum := sha256.Sum256([]byte(salt + ":" + key))
+	return int(binary.BigEndian.Uint64(sum[:8]) % Buckets)
+}
+
+// InPercent проверяет, попадает ли пользователь в заданный процент для соли
+func InPercent(salt, key string, percent float64) bool {
+	return float64(Bucket(salt, key)) < percent*Buckets/100
+}
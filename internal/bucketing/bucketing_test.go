@@ -0,0 +1,61 @@
+package bucketing
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestInPercent(t *testing.T) {
+	// корзины: s:1 — 9035, s:2 — 1419, AVITO:42 — 9865, holdout:user-7 — 6294
+	tests := []struct {
+		name    string
+		salt    string
+		key     string
+		percent float64
+		want    bool
+	}{
+		{name: "zero percent", salt: "s", key: "2", percent: 0, want: false},
+		{name: "full percent", salt: "s", key: "1", percent: 100, want: true},
+		{name: "below bucket", salt: "s", key: "1", percent: 90.35, want: false},
+		{name: "just above bucket", salt: "s", key: "1", percent: 90.36, want: true},
+		{name: "small bucket", salt: "s", key: "2", percent: 14.2, want: true},
+		{name: "small bucket excluded", salt: "s", key: "2", percent: 14.19, want: false},
+		{name: "other salt", salt: "AVITO", key: "42", percent: 50, want: false},
+		{name: "external id", salt: "holdout", key: "user-7", percent: 63, want: true},
+		{name: "negative percent", salt: "s", key: "2", percent: -1, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := InPercent(tt.salt, tt.key, tt.percent); got != tt.want {
+				t.Errorf("InPercent(%q, %q, %v) = %v, want %v", tt.salt, tt.key, tt.percent, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInPercentMonotonic(t *testing.T) {
+	percents := []float64{1, 5, 25, 100}
+	counts := make([]int, len(percents))
+
+	for id := 1; id <= 10000; id++ {
+		key := strconv.Itoa(id)
+		for i, percent := range percents {
+			in := InPercent("rollout", key, percent)
+			if in {
+				counts[i]++
+			}
+			// пользователь, попавший в меньший процент, остается и в большем
+			if i > 0 && InPercent("rollout", key, percents[i-1]) && !in {
+				t.Fatalf("user %s is in %v%% but not in %v%%", key, percents[i-1], percent)
+			}
+		}
+	}
+
+	for i, percent := range percents {
+		expected := percent * 100
+		if diff := float64(counts[i]) - expected; diff > expected*0.2+30 || diff < -expected*0.2-30 {
+			t.Errorf("%v%% selected %d of 10000 users, want about %v", percent, counts[i], expected)
+		}
+	}
+}
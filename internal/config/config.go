@@ -3,14 +3,34 @@ package config
 import (
 	"github.com/kelseyhightower/envconfig"
 
+	"github.com/TinyMarcus/avito-tech-task/internal/blob"
 	"github.com/TinyMarcus/avito-tech-task/internal/db"
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers"
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/middlewares"
+	"github.com/TinyMarcus/avito-tech-task/internal/holdout"
 	"github.com/TinyMarcus/avito-tech-task/internal/logger"
+	"github.com/TinyMarcus/avito-tech-task/internal/report"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+	"github.com/TinyMarcus/avito-tech-task/internal/rollout"
+	"github.com/TinyMarcus/avito-tech-task/internal/rpc"
+	"github.com/TinyMarcus/avito-tech-task/internal/webhook"
 )
 
 type Config struct {
-	Log  logger.LogConfig  `envconfig:"LOG"`
-	Db   db.DatabaseConfig `envconfig:"DB"`
-	Port string            `envconfig:"PORT"`
+	Log         logger.LogConfig              `envconfig:"LOG"`
+	Db          db.DatabaseConfig             `envconfig:"DB"`
+	Holdout     holdout.HoldoutConfig         `envconfig:"HOLDOUT"`
+	Rollout     rollout.RolloutConfig         `envconfig:"ROLLOUT"`
+	Batch       handlers.BatchConfig          `envconfig:"BATCH"`
+	Idempotency middlewares.IdempotencyConfig `envconfig:"IDEMPOTENCY"`
+	Erasure     repositories.ErasureConfig    `envconfig:"ERASURE"`
+	Users       repositories.UsersConfig      `envconfig:"USERS"`
+	Blob        blob.BlobConfig               `envconfig:"BLOB"`
+	Reports     report.JobsConfig             `envconfig:"REPORTS"`
+	Webhooks    webhook.WebhookConfig         `envconfig:"WEBHOOKS"`
+	Stream      handlers.StreamConfig         `envconfig:"STREAM"`
+	Grpc        rpc.GrpcConfig                `envconfig:"GRPC"`
+	Port        string                        `envconfig:"PORT"`
 }
 
 func New() (*Config, error) {
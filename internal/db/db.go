@@ -15,10 +15,14 @@ type DatabaseConfig struct {
 	DbPass string `envconfig:"PASS"`
 }
 
+// DSN возвращает строку подключения к БД, например для отдельного соединения под LISTEN
+func (c DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
+		c.DbHost, c.DbUser, c.DbPass, c.DbName, c.DbPort)
+}
+
 func CreateConnection(config DatabaseConfig) (*sqlx.DB, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		config.DbHost, config.DbUser, config.DbPass, config.DbName, config.DbPort)
-	db, err := sqlx.Open("postgres", dsn)
+	db, err := sqlx.Open("postgres", config.DSN())
 	if err != nil {
 		return nil, err
 	}
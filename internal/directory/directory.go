@@ -0,0 +1,71 @@
+package directory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+// ExistsPath — путь метода сервиса пользователей, проверяющего существование пользователей
+const ExistsPath = "/users:exists"
+
+// UsersDto — тело запроса и ответа метода проверки существования пользователей
+type UsersDto struct {
+	ExternalIds []string `json:"external_ids"`
+}
+
+// HTTPDirectory проверяет существование пользователей через HTTP API сервиса пользователей:
+// на POST {url}/users:exists со списком внешних идентификаторов сервис отвечает списком существующих из них
+type HTTPDirectory struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPDirectory(url string, timeout time.Duration) *HTTPDirectory {
+	return &HTTPDirectory{
+		url: strings.TrimRight(url, "/"),
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+func (d *HTTPDirectory) ExistingUsers(externalIds []string) ([]string, error) {
+	body, err := json.Marshal(&UsersDto{ExternalIds: externalIds})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := d.client.Post(d.url+ExistsPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("user directory responded with status %d", resp.StatusCode)
+	}
+
+	var existing UsersDto
+	if err = json.NewDecoder(resp.Body).Decode(&existing); err != nil {
+		return nil, err
+	}
+
+	return existing.ExternalIds, nil
+}
+
+// NewProvisioner создает UserProvisioner для режима из конфигурации; в режиме directory
+// существование пользователей проверяется через HTTPDirectory
+func NewProvisioner(cfg repositories.UsersConfig) *repositories.UserProvisioner {
+	var directory repositories.UserDirectory
+	if cfg.Mode == repositories.UsersModeDirectory {
+		directory = NewHTTPDirectory(cfg.DirectoryURL, cfg.DirectoryTimeout)
+	}
+
+	return repositories.NewUserProvisioner(cfg.Mode, directory)
+}
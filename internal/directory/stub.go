@@ -0,0 +1,71 @@
+package directory
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+// Stub — локальная замена сервиса пользователей для тестов и разработки: отвечает на запросы
+// HTTPDirectory, считая существующими пользователей из заданного списка
+type Stub struct {
+	users map[string]bool
+}
+
+func NewStub(externalIds []string) *Stub {
+	users := make(map[string]bool, len(externalIds))
+	for _, externalId := range externalIds {
+		users[externalId] = true
+	}
+
+	return &Stub{
+		users: users,
+	}
+}
+
+func (s *Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != ExistsPath || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+
+	var request UsersDto
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	existing := UsersDto{ExternalIds: []string{}}
+	for _, externalId := range request.ExternalIds {
+		if s.users[externalId] {
+			existing.ExternalIds = append(existing.ExternalIds, externalId)
+		}
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&existing); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ParseExternalIds разбирает список внешних идентификаторов через запятую
+func ParseExternalIds(value string) ([]string, error) {
+	var externalIds []string
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if !models.IsValidExternalId(part) {
+			return nil, fmt.Errorf("invalid external user id %q", part)
+		}
+
+		externalIds = append(externalIds, part)
+	}
+
+	return externalIds, nil
+}
@@ -0,0 +1,166 @@
+package evaluation
+
+import (
+	"sync"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/bucketing"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+	"github.com/TinyMarcus/avito-tech-task/internal/rules"
+)
+
+const (
+	SourceRule       = "rule"
+	SourcePercentage = "percentage"
+)
+
+type Holdout interface {
+	ContainsKey(key string) bool
+}
+
+// Evaluator вычисляет сегменты пользователя: к статическим привязкам из users_segments
+// добавляются сегменты, правила таргетинга которых выполняются для атрибутов пользователя,
+// а для пользователей, которых нет в БД, — также сегменты, в процент которых попадает пользователь
+type Evaluator struct {
+	holdout Holdout
+	rules   sync.Map
+}
+
+func NewEvaluator(h Holdout) *Evaluator {
+	return &Evaluator{
+		holdout: h,
+	}
+}
+
+// Subject — пользователь, для которого вычисляются сегменты
+type Subject struct {
+	UserId      int
+	Key         string
+	Attributes  models.Attributes
+	Memberships []*models.UserSegment
+	// Stored равно true для пользователей из БД: для них попадание в процентные сегменты уже
+	// сохранено в users_segments планировщиком раскатывания и повторно не вычисляется
+	Stored bool
+}
+
+// Explanation описывает, почему пользователь попал или не попал в сегмент
+type Explanation struct {
+	Matched       bool
+	StaticMember  bool
+	InHoldout     bool
+	LayerConflict string
+	Rule          string
+	RuleResult    *rules.Explanation
+}
+
+// Evaluate возвращает активные сегменты пользователя. Динамические сегменты не назначаются пользователям
+// из контрольной группы и пропускаются, если пользователь уже состоит в другом сегменте того же слоя.
+func (e *Evaluator) Evaluate(subject *Subject, segments []*models.Segment) []*models.UserSegment {
+	result := append([]*models.UserSegment{}, subject.Memberships...)
+
+	if e.holdout.ContainsKey(subject.Key) {
+		return result
+	}
+
+	occupied := occupiedLayers(subject.Memberships, segments)
+	for _, segment := range segments {
+		if hasMembership(result, segment.Slug) {
+			continue
+		}
+
+		if segment.Layer.Valid && occupied[segment.Layer.String] != "" {
+			continue
+		}
+
+		source := e.match(subject, segment)
+		if source == "" {
+			continue
+		}
+
+		result = append(result, &models.UserSegment{
+			UserId: subject.UserId,
+			Slug:   segment.Slug,
+			Source: source,
+		})
+
+		if segment.Layer.Valid {
+			occupied[segment.Layer.String] = segment.Slug
+		}
+	}
+
+	return result
+}
+
+// Explain объясняет, почему пользователь попал или не попал в сегмент
+func (e *Evaluator) Explain(subject *Subject, segments []*models.Segment, segment *models.Segment) *Explanation {
+	explanation := &Explanation{
+		StaticMember: hasMembership(subject.Memberships, segment.Slug),
+		InHoldout:    e.holdout.ContainsKey(subject.Key),
+		Rule:         segment.Rule.String,
+	}
+
+	if segment.Rule.Valid {
+		if rule, err := e.rule(segment.Rule.String); err == nil {
+			explanation.RuleResult = rule.Explain(subject.Attributes)
+		}
+	}
+
+	if segment.Layer.Valid {
+		if occupant := occupiedLayers(subject.Memberships, segments)[segment.Layer.String]; occupant != segment.Slug {
+			explanation.LayerConflict = occupant
+		}
+	}
+
+	explanation.Matched = hasMembership(e.Evaluate(subject, segments), segment.Slug)
+
+	return explanation
+}
+
+func (e *Evaluator) match(subject *Subject, segment *models.Segment) string {
+	if segment.Rule.Valid {
+		if rule, err := e.rule(segment.Rule.String); err == nil && rule.Match(subject.Attributes) {
+			return SourceRule
+		}
+	}
+
+	if !subject.Stored && segment.Percent.Valid &&
+		bucketing.InPercent(segment.Slug, subject.Key, segment.Percent.Float64) {
+		return SourcePercentage
+	}
+
+	return ""
+}
+
+func (e *Evaluator) rule(source string) (*rules.Rule, error) {
+	if cached, ok := e.rules.Load(source); ok {
+		return cached.(*rules.Rule), nil
+	}
+
+	rule, err := rules.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	e.rules.Store(source, rule)
+	return rule, nil
+}
+
+func occupiedLayers(memberships []*models.UserSegment, segments []*models.Segment) map[string]string {
+	layers := make(map[string]string)
+	for _, segment := range segments {
+		if segment.Layer.Valid && hasMembership(memberships, segment.Slug) {
+			layers[segment.Layer.String] = segment.Slug
+		}
+	}
+
+	return layers
+}
+
+func hasMembership(memberships []*models.UserSegment, slug string) bool {
+	for _, membership := range memberships {
+		if membership.Slug == slug {
+			return true
+		}
+	}
+
+	return false
+}
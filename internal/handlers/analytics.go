@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/analytics"
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+// maxAnalyticsPeriods ограничивает число периодов в ответе, например дневную разбивку за много лет
+const maxAnalyticsPeriods = 1000
+
+// GetSegmentAnalyticsHandler godoc
+//
+//	@Summary		Получить аналитику сегмента
+//	@Description	Получить показатели сегмента по периодам (дням, неделям или месяцам) и за весь интервал: число добавлений, удалений и выходов по дате отключения, число участников в начале и в конце периода, наибольшее число участников одновременно, медианную и среднюю длительность участий, завершившихся в периоде. Показатели считаются по истории сегмента и текущим участникам. При format=csv возвращается CSV-файл с одной строкой на период
+//	@ID				get-segment-analytics
+//	@Tags			segments
+//	@Produce		json
+//	@Produce		text/csv
+//	@Param			slug	path		string					true	"Название сегмента"
+//	@Param			from	query		string					true	"Начало интервала в формате RFC 3339 (включительно)"
+//	@Param			to		query		string					true	"Конец интервала в формате RFC 3339 (не включительно)"
+//	@Param			period	query		string					false	"Длина периода (по умолчанию month)"	Enums(day, week, month)
+//	@Param			format	query		string					false	"Формат ответа"	Enums(json, csv)
+//	@Success		200		{object}	dto.SegmentAnalyticsDto	"Аналитика сегмента успешно получена"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Сегмент с данным названием не найден"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/segments/{slug}/analytics [get]
+func (h *HistoryHandler) GetSegmentAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	slug := params["slug"]
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = formatJson
+	}
+	period := query.Get("period")
+	if period == "" {
+		period = models.AnalyticsPeriodMonth
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	from, fromErr := timeParam(r, "from")
+	to, toErr := timeParam(r, "to")
+	validPeriod := period == models.AnalyticsPeriodDay || period == models.AnalyticsPeriodWeek || period == models.AnalyticsPeriodMonth
+	if fromErr != nil || toErr != nil || !from.Before(to) || !validPeriod || (format != formatJson && format != formatCsv) {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректные входные данные",
+		}
+		err := json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	if len(analytics.Periods(from, to, period)) > maxAnalyticsPeriods {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: fmt.Sprintf("Слишком много периодов: не более %d, выберите период длиннее", maxAnalyticsPeriods),
+		}
+		err := json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	timeline, err := h.repository.GetSegmentTimeline(slug, to)
+	if err != nil {
+		status, message := http.StatusInternalServerError, "Возникла внутренняя ошибка при запросе истории сегмента"
+		if errors.Is(err, repositories.ErrSegmentNotFound) {
+			status, message = http.StatusNotFound, "Сегмент с таким названием не найден"
+		}
+
+		w.WriteHeader(status)
+		errorDto := &dto.ErrorDto{
+			Error: message,
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	analyticsDto := dto.ConvertSegmentAnalyticsToSegmentAnalyticsDto(analytics.Build(slug, timeline, from, to, time.Now(), period))
+	if format == formatCsv {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", slug+"-analytics.csv"))
+		w.WriteHeader(http.StatusOK)
+		_ = writeSegmentAnalyticsCsv(w, analyticsDto)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(analyticsDto)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// writeSegmentAnalyticsCsv записывает строку на каждый период; итог за весь интервал не записывается,
+// так как пиковое число участников и медиана не складываются из значений по периодам
+func writeSegmentAnalyticsCsv(w io.Writer, analytics *dto.SegmentAnalyticsDto) error {
+	writer := csv.NewWriter(w)
+	header := []string{"period_start", "period_end", "adds", "removes", "expirations", "members_start", "members_end",
+		"peak_members", "completed_memberships", "median_duration_seconds", "average_duration_seconds"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	optional := func(value *int64) string {
+		if value == nil {
+			return ""
+		}
+		return strconv.FormatInt(*value, 10)
+	}
+
+	for _, period := range analytics.Periods {
+		record := []string{
+			period.From.Format(time.RFC3339),
+			period.To.Format(time.RFC3339),
+			strconv.Itoa(period.Adds),
+			strconv.Itoa(period.Removes),
+			strconv.Itoa(period.Expirations),
+			strconv.Itoa(period.MembersStart),
+			strconv.Itoa(period.MembersEnd),
+			strconv.Itoa(period.PeakMembers),
+			strconv.Itoa(period.CompletedMemberships),
+			optional(period.MedianDurationSeconds),
+			optional(period.AverageDurationSeconds),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/audience"
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+const (
+	defaultAudienceLimit = 100
+	maxAudienceLimit     = 1000
+	maxOverlapSegments   = 50
+)
+
+type AudiencesHandler struct {
+	repository AudienceRepository
+}
+
+func NewAudiencesHandler(r AudienceRepository) *AudiencesHandler {
+	return &AudiencesHandler{
+		repository: r,
+	}
+}
+
+type AudienceRepository interface {
+	QueryAudience(expression *audience.Expression, after, limit int) (*models.AudienceResult, error)
+	GetSegmentOverlap(slugs []string) (*models.SegmentOverlap, error)
+}
+
+// QueryAudienceHandler godoc
+//
+//	@Summary		Запросить аудиторию по выражению над сегментами
+//	@Description	Найти пользователей по булеву выражению над сегментами, например "A AND NOT B" или "(A OR B) AND C". Операторы AND, OR, NOT (или &&, ||, !), названия сегментов со служебными символами пишутся в кавычках. Учитываются только активные участия; NOT отбирает всех пользователей, не состоящих в сегменте. Возвращаются общее число пользователей и страница их идентификаторов по возрастанию
+//	@ID				query-audience
+//	@Tags			audiences
+//	@Accept			json
+//	@Produce		json
+//	@Param			Query	body		dto.AudienceQueryDto	true	"Выражение и параметры страницы"
+//	@Success		200		{object}	dto.AudienceResultDto	"Аудитория успешно получена"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Сегменты из выражения не найдены"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/audiences/query [post]
+func (h *AudiencesHandler) QueryAudienceHandler(w http.ResponseWriter, r *http.Request) {
+	var query dto.AudienceQueryDto
+
+	w.Header().Add("Content-Type", "application/json")
+	err := json.NewDecoder(r.Body).Decode(&query)
+	if query.Limit == 0 {
+		query.Limit = defaultAudienceLimit
+	}
+
+	var after int64
+	if err == nil && query.Cursor != "" {
+		after, err = decodeCursor(query.Cursor)
+	}
+	if err != nil || query.Limit < 0 || query.Limit > maxAudienceLimit {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректные входные данные",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	expression, err := audience.Parse(query.Expression)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: fmt.Sprintf("Некорректное выражение: %v", err),
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	result, err := h.repository.QueryAudience(expression, int(after), query.Limit)
+	if err != nil {
+		writeAudienceError(w, err, "Возникла внутренняя ошибка при запросе аудитории")
+		return
+	}
+
+	resultDto := &dto.AudienceResultDto{
+		Expression: expression.String(),
+		Count:      result.Count,
+		UserIds:    result.UserIds,
+	}
+	if resultDto.UserIds == nil {
+		resultDto.UserIds = []int{}
+	}
+	if len(result.UserIds) == query.Limit {
+		resultDto.NextCursor = encodeCursor(int64(result.UserIds[len(result.UserIds)-1]))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(resultDto)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// GetSegmentOverlapHandler godoc
+//
+//	@Summary		Получить матрицу пересечений сегментов
+//	@Description	Посчитать для набора сегментов число активных участников каждого и число пользователей, состоящих в каждой паре сегментов одновременно. Помогает проверить, не пересекаются ли аудитории экспериментов
+//	@ID				get-segment-overlap
+//	@Tags			audiences
+//	@Accept			json
+//	@Produce		json
+//	@Param			Segments	body		dto.SegmentOverlapRequestDto	true	"Названия сегментов"
+//	@Success		200		{object}	dto.SegmentOverlapDto	"Пересечения успешно посчитаны"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Сегменты не найдены"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/audiences/overlap [post]
+func (h *AudiencesHandler) GetSegmentOverlapHandler(w http.ResponseWriter, r *http.Request) {
+	var request dto.SegmentOverlapRequestDto
+
+	w.Header().Add("Content-Type", "application/json")
+	err := json.NewDecoder(r.Body).Decode(&request)
+
+	// повторы убираются, порядок сегментов в ответе совпадает с порядком в запросе
+	var slugs []string
+	seen := make(map[string]bool)
+	for _, slug := range request.Slugs {
+		if slug != "" && !seen[slug] {
+			seen[slug] = true
+			slugs = append(slugs, slug)
+		}
+	}
+
+	if err != nil || len(slugs) == 0 || len(slugs) > maxOverlapSegments {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: fmt.Sprintf("Некорректные входные данные: нужно от 1 до %d сегментов", maxOverlapSegments),
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	overlap, err := h.repository.GetSegmentOverlap(slugs)
+	if err != nil {
+		writeAudienceError(w, err, "Возникла внутренняя ошибка при подсчете пересечений сегментов")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(dto.ConvertSegmentOverlapToSegmentOverlapDto(overlap))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func writeAudienceError(w http.ResponseWriter, err error, internalMessage string) {
+	status, message := http.StatusInternalServerError, internalMessage
+
+	var unknown *repositories.UnknownSegmentsError
+	if errors.As(err, &unknown) {
+		status, message = http.StatusNotFound, "Сегменты не найдены: "+strings.Join(unknown.Slugs, ", ")
+	}
+
+	w.WriteHeader(status)
+	errorDto := &dto.ErrorDto{
+		Error: message,
+	}
+	err = json.NewEncoder(w).Encode(errorDto)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
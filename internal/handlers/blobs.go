@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/blob"
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+)
+
+// BlobsHandler отдает файлы из локального хранилища по подписанным ссылкам. Для S3-хранилища
+// не используется: ссылки на него ведут прямо в хранилище.
+type BlobsHandler struct {
+	store LocalBlobStore
+}
+
+func NewBlobsHandler(s LocalBlobStore) *BlobsHandler {
+	return &BlobsHandler{
+		store: s,
+	}
+}
+
+type LocalBlobStore interface {
+	Open(key string, query url.Values) (*os.File, *blob.Download, error)
+}
+
+// DownloadBlobHandler godoc
+//
+//	@Summary		Скачать файл по подписанной ссылке
+//	@Description	Скачать файл из локального хранилища. Ссылку со всеми параметрами выдает сервис, например в download_url готового отчета; после истечения срока действия ссылка перестает работать
+//	@ID				download-blob
+//	@Tags			history
+//	@Produce		octet-stream
+//	@Param			key				path		string					true	"Ключ объекта"
+//	@Param			filename		query		string					true	"Имя файла"
+//	@Param			content_type	query		string					true	"Тип содержимого"
+//	@Param			expires			query		int						true	"Срок действия ссылки (Unix time)"
+//	@Param			signature		query		string					true	"Подпись ссылки"
+//	@Success		200		{file}		file					"Файл"
+//	@Failure		403		{object}	dto.ErrorDto			"Ссылка недействительна или истек срок ее действия"
+//	@Failure		404		{object}	dto.ErrorDto			"Файл не найден"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/blobs/{key} [get]
+func (h *BlobsHandler) DownloadBlobHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	key := params["key"]
+
+	file, download, err := h.store.Open(key, r.URL.Query())
+	if err != nil {
+		w.Header().Add("Content-Type", "application/json")
+		switch err {
+		case blob.ErrInvalidSignature:
+			w.WriteHeader(http.StatusForbidden)
+			errorDto := &dto.ErrorDto{
+				Error: "Ссылка недействительна или истек срок ее действия",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		case blob.ErrBlobNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			errorDto := &dto.ErrorDto{
+				Error: "Файл не найден",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			errorDto := &dto.ErrorDto{
+				Error: "Возникла внутренняя ошибка при чтении файла",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+
+		return
+	}
+	defer file.Close()
+
+	contentType := download.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if download.Filename != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", download.Filename))
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.Copy(w, file)
+}
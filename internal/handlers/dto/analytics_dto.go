@@ -0,0 +1,73 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+// SegmentAnalyticsDto model info
+// @Description Показатели сегмента по периодам
+type SegmentAnalyticsDto struct {
+	Slug    string                `json:"slug"`                   // Название сегмента
+	From    time.Time             `json:"from"`                   // Начало интервала
+	To      time.Time             `json:"to"`                     // Конец интервала
+	Period  string                `json:"period" example:"month"` // Длина периода: day, week или month
+	Total   *AnalyticsPeriodDto   `json:"total"`                  // Показатели за весь интервал
+	Periods []*AnalyticsPeriodDto `json:"periods"`                // Показатели по периодам
+}
+
+// AnalyticsPeriodDto model info
+// @Description Показатели сегмента за период
+type AnalyticsPeriodDto struct {
+	From                   time.Time `json:"from"`                                               // Начало периода
+	To                     time.Time `json:"to"`                                                 // Конец периода
+	Adds                   int       `json:"adds"`                                               // Число добавлений в сегмент
+	Removes                int       `json:"removes"`                                            // Число удалений из сегмента
+	Expirations            int       `json:"expirations"`                                        // Число выходов из сегмента по дате отключения
+	MembersStart           int       `json:"members_start"`                                      // Число участников в начале периода
+	MembersEnd             int       `json:"members_end"`                                        // Число участников в конце периода
+	PeakMembers            int       `json:"peak_members"`                                       // Наибольшее число участников одновременно
+	CompletedMemberships   int       `json:"completed_memberships"`                              // Число участий, завершившихся в периоде
+	MedianDurationSeconds  *int64    `json:"median_duration_seconds,omitempty" example:"86400"`  // Медианная длительность завершившихся участий в секундах
+	AverageDurationSeconds *int64    `json:"average_duration_seconds,omitempty" example:"90000"` // Средняя длительность завершившихся участий в секундах
+}
+
+func ConvertSegmentAnalyticsToSegmentAnalyticsDto(analytics *models.SegmentAnalytics) *SegmentAnalyticsDto {
+	periods := make([]*AnalyticsPeriodDto, 0, len(analytics.Periods))
+	for _, period := range analytics.Periods {
+		periods = append(periods, convertAnalyticsPeriod(period))
+	}
+
+	return &SegmentAnalyticsDto{
+		Slug:    analytics.Slug,
+		From:    analytics.From,
+		To:      analytics.To,
+		Period:  analytics.Period,
+		Total:   convertAnalyticsPeriod(analytics.Total),
+		Periods: periods,
+	}
+}
+
+func convertAnalyticsPeriod(period *models.AnalyticsPeriod) *AnalyticsPeriodDto {
+	periodDto := &AnalyticsPeriodDto{
+		From:                 period.From,
+		To:                   period.To,
+		Adds:                 period.Adds,
+		Removes:              period.Removes,
+		Expirations:          period.Expirations,
+		MembersStart:         period.MembersStart,
+		MembersEnd:           period.MembersEnd,
+		PeakMembers:          period.PeakMembers,
+		CompletedMemberships: period.Completed,
+	}
+
+	if period.Completed > 0 {
+		median := int64(period.MedianDuration.Seconds())
+		average := int64(period.AverageDuration.Seconds())
+		periodDto.MedianDurationSeconds = &median
+		periodDto.AverageDurationSeconds = &average
+	}
+
+	return periodDto
+}
@@ -0,0 +1,42 @@
+package dto
+
+import "github.com/TinyMarcus/avito-tech-task/internal/models"
+
+// AudienceQueryDto model info
+// @Description Запрос аудитории по булеву выражению над сегментами
+type AudienceQueryDto struct {
+	Expression string `json:"expression" example:"(AVITO_VOICE_MESSAGES OR AVITO_PERFORMANCE_VAS) AND NOT AVITO_DISCOUNT_30"` // Выражение с операторами AND, OR, NOT и скобками
+	Limit      int    `json:"limit,omitempty" example:"100"`                                                                  // Размер страницы (по умолчанию 100, не более 1000)
+	Cursor     string `json:"cursor,omitempty"`                                                                               // Курсор страницы из next_cursor предыдущего ответа
+}
+
+// AudienceResultDto model info
+// @Description Пользователи, подходящие под выражение над сегментами
+type AudienceResultDto struct {
+	Expression string `json:"expression"`            // Выражение в каноническом виде
+	Count      int    `json:"count"`                 // Общее число подходящих пользователей
+	UserIds    []int  `json:"user_ids"`              // Идентификаторы пользователей на странице по возрастанию
+	NextCursor string `json:"next_cursor,omitempty"` // Курсор следующей страницы, если она есть
+}
+
+// SegmentOverlapRequestDto model info
+// @Description Сегменты, для которых считаются пересечения
+type SegmentOverlapRequestDto struct {
+	Slugs []string `json:"slugs" example:"AVITO_VOICE_MESSAGES,AVITO_PERFORMANCE_VAS"` // Названия сегментов (не более 50)
+}
+
+// SegmentOverlapDto model info
+// @Description Попарные пересечения активных участников сегментов
+type SegmentOverlapDto struct {
+	Slugs  []string `json:"slugs"`  // Названия сегментов
+	Sizes  []int    `json:"sizes"`  // Число активных участников каждого сегмента
+	Matrix [][]int  `json:"matrix"` // matrix[i][j] — число пользователей, состоящих в сегментах slugs[i] и slugs[j] одновременно
+}
+
+func ConvertSegmentOverlapToSegmentOverlapDto(overlap *models.SegmentOverlap) *SegmentOverlapDto {
+	return &SegmentOverlapDto{
+		Slugs:  overlap.Slugs,
+		Sizes:  overlap.Sizes,
+		Matrix: overlap.Matrix,
+	}
+}
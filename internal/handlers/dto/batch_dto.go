@@ -0,0 +1,39 @@
+package dto
+
+import "github.com/TinyMarcus/avito-tech-task/internal/models"
+
+// BatchMembersDto model info
+// @Description Список пользователей для массового изменения участников сегмента
+type BatchMembersDto struct {
+	UserIds      []UserKey `json:"user_ids" swaggertype:"array,string"` // Числовые или внешние идентификаторы пользователей
+	DeadlineDate string    `json:"deadline_date,omitempty"`             // Дата отключения пользователей от сегмента
+}
+
+// BatchMembersResultDto model info
+// @Description Итог массового изменения участников сегмента
+type BatchMembersResultDto struct {
+	DryRun      bool `json:"dry_run"`     // Был ли запуск пробным (без записи в БД)
+	Added       int  `json:"added"`       // Количество пользователей, которым добавлен сегмент
+	Reactivated int  `json:"reactivated"` // Количество пользователей, истекшая привязка которых к сегменту активирована повторно
+	Removed     int  `json:"removed"`     // Количество пользователей, у которых удален сегмент
+	Skipped     int  `json:"skipped"`     // Количество пропущенных пользователей (уже в сегменте, не в сегменте, в контрольной группе или в занятом слое)
+	Missing     int  `json:"missing"`     // Количество несуществующих пользователей
+	Invalid     int  `json:"invalid"`     // Количество строк и идентификаторов, которые не удалось разобрать
+	Chunks      int  `json:"chunks"`      // Количество примененных пачек
+}
+
+func (r *BatchMembersResultDto) Add(result *models.BatchResult) {
+	r.Added += result.Added
+	r.Reactivated += result.Reactivated
+	r.Removed += result.Removed
+	r.Skipped += result.Skipped
+	r.Missing += result.Missing
+	r.Chunks++
+}
+
+// BatchMembersErrorDto model info
+// @Description Ошибка массового изменения участников сегмента и итог пачек, примененных до нее
+type BatchMembersErrorDto struct {
+	Error     string                 `json:"error"`               // Описание ошибки
+	Committed *BatchMembersResultDto `json:"committed,omitempty"` // Итог пачек, примененных до ошибки (каждая в своей транзакции)
+}
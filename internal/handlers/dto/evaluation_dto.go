@@ -0,0 +1,62 @@
+package dto
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+// UserKey — идентификатор пользователя, который может быть передан как числом, так и строкой
+type UserKey string
+
+func (k *UserKey) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		var key string
+		if err := json.Unmarshal(data, &key); err != nil {
+			return err
+		}
+		*k = UserKey(key)
+		return nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return err
+	}
+	*k = UserKey(number.String())
+	return nil
+}
+
+// EvaluateRequestDto model info
+// @Description Информация о пользователе для вычисления сегментов
+type EvaluateRequestDto struct {
+	UserId     UserKey                `json:"user_id" swaggertype:"string"` // Идентификатор пользователя (может отсутствовать в сервисе)
+	Attributes map[string]interface{} `json:"attributes,omitempty"`         // Атрибуты пользователя
+}
+
+// EvaluateResponseDto model info
+// @Description Сегменты, которые получил бы пользователь
+type EvaluateResponseDto struct {
+	UserId    string                     `json:"user_id"`    // Идентификатор пользователя
+	KnownUser bool                       `json:"known_user"` // Хранится ли пользователь в сервисе
+	Segments  []*SegmentWithDeadlineDate `json:"segments"`   // Список сегментов
+}
+
+func ConvertUserSegmentsToEvaluateResponseDto(userId string, knownUser bool, userSegments []*models.UserSegment) *EvaluateResponseDto {
+	segments := []*SegmentWithDeadlineDate{}
+
+	for _, val := range userSegments {
+		segments = append(segments, &SegmentWithDeadlineDate{
+			Slug:         val.Slug,
+			DeadlineDate: val.DeadlineDate.String,
+			Source:       val.Source,
+		})
+	}
+
+	return &EvaluateResponseDto{
+		UserId:    userId,
+		KnownUser: knownUser,
+		Segments:  segments,
+	}
+}
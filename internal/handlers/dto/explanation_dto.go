@@ -0,0 +1,32 @@
+package dto
+
+import (
+	"github.com/TinyMarcus/avito-tech-task/internal/evaluation"
+	"github.com/TinyMarcus/avito-tech-task/internal/rules"
+)
+
+// SegmentExplanationDto model info
+// @Description Объяснение, почему пользователь попал или не попал в сегмент
+type SegmentExplanationDto struct {
+	UserId        int                `json:"user_id"`                  // Идентификатор пользователя
+	Slug          string             `json:"slug"`                     // Название сегмента
+	Matched       bool               `json:"matched"`                  // Состоит ли пользователь в сегменте
+	StaticMember  bool               `json:"static_member"`            // Добавлен ли пользователь в сегмент явно
+	InHoldout     bool               `json:"in_holdout"`               // Входит ли пользователь в глобальную контрольную группу
+	LayerConflict string             `json:"layer_conflict,omitempty"` // Сегмент того же слоя, в котором уже состоит пользователь
+	Rule          string             `json:"rule,omitempty"`           // Правило таргетинга сегмента
+	RuleResult    *rules.Explanation `json:"rule_result,omitempty"`    // Результат вычисления правила по условиям
+}
+
+func ConvertExplanationToSegmentExplanationDto(userId int, slug string, explanation *evaluation.Explanation) *SegmentExplanationDto {
+	return &SegmentExplanationDto{
+		UserId:        userId,
+		Slug:          slug,
+		Matched:       explanation.Matched,
+		StaticMember:  explanation.StaticMember,
+		InHoldout:     explanation.InHoldout,
+		LayerConflict: explanation.LayerConflict,
+		Rule:          explanation.Rule,
+		RuleResult:    explanation.RuleResult,
+	}
+}
@@ -0,0 +1,61 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+// ExportedMembershipDto model info
+// @Description Текущая или истекшая привязка пользователя к сегменту
+type ExportedMembershipDto struct {
+	Slug         string `json:"slug"`                    // Название сегмента
+	DeadlineDate string `json:"deadline_date,omitempty"` // Дата отключения пользователя от сегмента
+	AutoEnrolled bool   `json:"auto_enrolled"`           // Добавлен ли пользователь при постепенном раскатывании
+	Active       bool   `json:"active"`                  // Активна ли привязка на момент выгрузки
+}
+
+// HistoryRecordDto model info
+// @Description Запись истории добавления пользователя в сегмент или удаления из него
+type HistoryRecordDto struct {
+	Slug          string `json:"slug"`           // Название сегмента
+	ActionDate    string `json:"action_date"`    // Дата операции
+	OperationType string `json:"operation_type"` // Тип операции (ADDING или REMOVING)
+}
+
+// UserExportDto model info
+// @Description Все данные пользователя, хранящиеся в сервисе
+type UserExportDto struct {
+	ExportedAt  string                   `json:"exported_at"` // Дата выгрузки
+	User        *UserDto                 `json:"user"`        // Пользователь
+	Memberships []*ExportedMembershipDto `json:"memberships"` // Текущие и истекшие привязки к сегментам
+	History     []*HistoryRecordDto      `json:"history"`     // История добавления в сегменты и удаления из них
+}
+
+func ConvertUserExportToUserExportDto(export *models.UserExport) *UserExportDto {
+	exportDto := &UserExportDto{
+		ExportedAt:  export.ExportedAt.Format(time.RFC3339),
+		User:        ConvertUserToUserDto(export.User),
+		Memberships: []*ExportedMembershipDto{},
+		History:     []*HistoryRecordDto{},
+	}
+
+	for _, membership := range export.Memberships {
+		exportDto.Memberships = append(exportDto.Memberships, &ExportedMembershipDto{
+			Slug:         membership.Slug,
+			DeadlineDate: membership.DeadlineDate.String,
+			AutoEnrolled: membership.AutoEnrolled,
+			Active:       membership.Active,
+		})
+	}
+
+	for _, record := range export.History {
+		exportDto.History = append(exportDto.History, &HistoryRecordDto{
+			Slug:          record.Slug,
+			ActionDate:    record.ActionDate.Format(time.RFC3339),
+			OperationType: record.OperationType,
+		})
+	}
+
+	return exportDto
+}
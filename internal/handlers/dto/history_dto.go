@@ -0,0 +1,121 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+// UserSegmentsAsOfDto model info
+// @Description Сегменты пользователя на момент времени в прошлом
+type UserSegmentsAsOfDto struct {
+	UserId   int                        `json:"user_id"`  // Идентификатор пользователя
+	AsOf     time.Time                  `json:"as_of"`    // Момент времени
+	Segments []*SegmentWithDeadlineDate `json:"segments"` // Сегменты, в которых пользователь состоял в этот момент
+}
+
+// SegmentUsersAsOfDto model info
+// @Description Пользователи сегмента на момент времени в прошлом
+type SegmentUsersAsOfDto struct {
+	Slug    string    `json:"slug"`     // Название сегмента
+	AsOf    time.Time `json:"as_of"`    // Момент времени
+	UserIds []int     `json:"user_ids"` // Пользователи, которые состояли в сегменте в этот момент
+}
+
+func ConvertUserSegmentsToUserSegmentsAsOfDto(userId int, asOf time.Time, userSegments []*models.UserSegment) *UserSegmentsAsOfDto {
+	segments := make([]*SegmentWithDeadlineDate, 0, len(userSegments))
+	for _, val := range userSegments {
+		segments = append(segments, &SegmentWithDeadlineDate{
+			Slug:         val.Slug,
+			DeadlineDate: val.DeadlineDate.String,
+		})
+	}
+
+	return &UserSegmentsAsOfDto{
+		UserId:   userId,
+		AsOf:     asOf,
+		Segments: segments,
+	}
+}
+
+// SegmentDiffDto model info
+// @Description Изменение состава сегмента между двумя моментами времени
+type SegmentDiffDto struct {
+	Slug        string          `json:"slug"`         // Название сегмента
+	From        time.Time       `json:"from"`         // Начало периода
+	To          time.Time       `json:"to"`           // Конец периода
+	MembersFrom int             `json:"members_from"` // Число участников в начале периода
+	MembersTo   int             `json:"members_to"`   // Число участников в конце периода
+	NetChange   int             `json:"net_change"`   // Изменение числа участников
+	Joined      []*DiffEntryDto `json:"joined"`       // Пользователи, вошедшие в сегмент
+	Left        []*DiffEntryDto `json:"left"`         // Пользователи, вышедшие из сегмента
+}
+
+// DiffEntryDto model info
+// @Description Пользователь, вошедший в сегмент или вышедший из него
+type DiffEntryDto struct {
+	UserId int       `json:"user_id"`          // Идентификатор пользователя
+	Reason string    `json:"reason,omitempty"` // Причина выхода: removed — удаление, expired — наступление даты отключения
+	Date   time.Time `json:"date"`             // Время добавления или выхода
+}
+
+func ConvertSegmentDiffToSegmentDiffDto(diff *models.SegmentDiff) *SegmentDiffDto {
+	convert := func(entries []*models.DiffEntry) []*DiffEntryDto {
+		dtos := make([]*DiffEntryDto, 0, len(entries))
+		for _, entry := range entries {
+			dtos = append(dtos, &DiffEntryDto{
+				UserId: entry.UserId,
+				Reason: entry.Reason,
+				Date:   entry.Date,
+			})
+		}
+		return dtos
+	}
+
+	return &SegmentDiffDto{
+		Slug:        diff.Slug,
+		From:        diff.From,
+		To:          diff.To,
+		MembersFrom: diff.MembersFrom,
+		MembersTo:   diff.MembersTo,
+		NetChange:   diff.MembersTo - diff.MembersFrom,
+		Joined:      convert(diff.Joined),
+		Left:        convert(diff.Left),
+	}
+}
+
+// HistoryEntryDto model info
+// @Description Запись истории изменения сегментов пользователя
+type HistoryEntryDto struct {
+	Id            int64      `json:"id"`                      // Идентификатор записи
+	UserId        int        `json:"user_id,omitempty"`       // Идентификатор пользователя (отсутствует у псевдонимизированных записей)
+	Slug          string     `json:"slug"`                    // Название сегмента
+	ActionDate    time.Time  `json:"action_date"`             // Дата операции
+	OperationType string     `json:"operation_type"`          // Тип операции (ADDING, REMOVING или UPDATING)
+	DeadlineDate  *time.Time `json:"deadline_date,omitempty"` // Дата отключения, действующая после операции
+	Actor         string     `json:"actor,omitempty"`         // Источник изменения (api, import, rollout, erasure)
+}
+
+// HistoryPageDto model info
+// @Description Страница записей истории
+type HistoryPageDto struct {
+	Records    []*HistoryEntryDto `json:"records"`               // Записи истории от новых к старым
+	NextCursor string             `json:"next_cursor,omitempty"` // Курсор следующей страницы, отсутствует на последней странице
+}
+
+func ConvertHistoryRecordToHistoryEntryDto(record *models.HistoryRecord) *HistoryEntryDto {
+	entry := &HistoryEntryDto{
+		Id:            record.Id,
+		UserId:        record.UserId,
+		Slug:          record.Slug,
+		ActionDate:    record.ActionDate,
+		OperationType: record.OperationType,
+		Actor:         record.Actor.String,
+	}
+
+	if record.DeadlineDate.Valid {
+		entry.DeadlineDate = &record.DeadlineDate.Time
+	}
+
+	return entry
+}
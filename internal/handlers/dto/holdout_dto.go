@@ -0,0 +1,9 @@
+package dto
+
+// UserHoldoutDto model info
+// @Description Информация о принадлежности пользователя глобальной контрольной группе
+type UserHoldoutDto struct {
+	UserId    int     `json:"user_id"`    // Идентификатор пользователя
+	InHoldout bool    `json:"in_holdout"` // Входит ли пользователь в контрольную группу
+	Percent   float64 `json:"percent"`    // Размер контрольной группы в процентах
+}
@@ -0,0 +1,38 @@
+package dto
+
+import "github.com/TinyMarcus/avito-tech-task/internal/models"
+
+// ImportErrorDto model info
+// @Description Ошибка в строке CSV-файла импорта
+type ImportErrorDto struct {
+	Line  int    `json:"line"`  // Номер строки в файле
+	Error string `json:"error"` // Описание ошибки
+}
+
+// ImportReportDto model info
+// @Description Отчет об импорте пользователей и их сегментов
+type ImportReportDto struct {
+	DryRun  bool              `json:"dry_run"` // Был ли импорт пробным (без записи в БД)
+	Rows    int               `json:"rows"`    // Количество строк с данными
+	Applied int               `json:"applied"` // Количество примененных (при пробном импорте — применимых) строк
+	Skipped int               `json:"skipped"` // Количество строк, не требующих изменений
+	Errors  []*ImportErrorDto `json:"errors"`  // Ошибки по строкам
+}
+
+func ConvertImportReportToImportReportDto(report *models.ImportReport) *ImportReportDto {
+	errors := make([]*ImportErrorDto, 0, len(report.Errors))
+	for _, importError := range report.Errors {
+		errors = append(errors, &ImportErrorDto{
+			Line:  importError.Line,
+			Error: importError.Error,
+		})
+	}
+
+	return &ImportReportDto{
+		DryRun:  report.DryRun,
+		Rows:    report.Rows,
+		Applied: report.Applied,
+		Skipped: report.Skipped,
+		Errors:  errors,
+	}
+}
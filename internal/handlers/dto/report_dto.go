@@ -0,0 +1,60 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+// CreateReportDto model info
+// @Description Параметры асинхронного формирования отчета по истории
+type CreateReportDto struct {
+	Format string    `json:"format" example:"xlsx"` // Формат отчета: csv (по умолчанию), xlsx или docx
+	From   time.Time `json:"from"`                  // Начало периода (включительно)
+	To     time.Time `json:"to"`                    // Конец периода (не включительно)
+	UserId string    `json:"user_id,omitempty"`     // Числовой или внешний идентификатор пользователя
+	Slug   string    `json:"slug,omitempty"`        // Название сегмента
+}
+
+// ReportJobDto model info
+// @Description Задание на формирование отчета по истории
+type ReportJobDto struct {
+	Id                string     `json:"id"`                            // Идентификатор задания
+	Status            string     `json:"status" example:"running"`      // Статус: pending, running, done или failed
+	Progress          int        `json:"progress" example:"45"`         // Прогресс в процентах
+	Format            string     `json:"format" example:"xlsx"`         // Формат отчета
+	From              time.Time  `json:"from"`                          // Начало периода
+	To                time.Time  `json:"to"`                            // Конец периода
+	UserId            int        `json:"user_id,omitempty"`             // Идентификатор пользователя
+	Slug              string     `json:"slug,omitempty"`                // Название сегмента
+	CreatedAt         time.Time  `json:"created_at"`                    // Время создания задания
+	StartedAt         *time.Time `json:"started_at,omitempty"`          // Время начала формирования
+	FinishedAt        *time.Time `json:"finished_at,omitempty"`         // Время завершения
+	Error             string     `json:"error,omitempty"`               // Причина ошибки для статуса failed
+	DownloadUrl       string     `json:"download_url,omitempty"`        // Подписанная ссылка на скачивание для статуса done
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty"` // Время, до которого действует ссылка
+}
+
+func ConvertReportJobToReportJobDto(job *models.ReportJob) *ReportJobDto {
+	jobDto := &ReportJobDto{
+		Id:        job.Id,
+		Status:    job.Status,
+		Progress:  job.Progress,
+		Format:    job.Format,
+		From:      job.From,
+		To:        job.To,
+		UserId:    job.UserId,
+		Slug:      job.Slug,
+		CreatedAt: job.CreatedAt,
+		Error:     job.Error.String,
+	}
+
+	if job.StartedAt.Valid {
+		jobDto.StartedAt = &job.StartedAt.Time
+	}
+	if job.FinishedAt.Valid {
+		jobDto.FinishedAt = &job.FinishedAt.Time
+	}
+
+	return jobDto
+}
@@ -0,0 +1,54 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+// RolloutStepDto model info
+// @Description Шаг расписания постепенного раскатывания сегмента
+type RolloutStepDto struct {
+	Percent float64   `json:"percent"`  // Процент пользователей, автоматически добавляемых в сегмент
+	StartAt time.Time `json:"start_at"` // Время применения шага
+}
+
+// SetRolloutDto model info
+// @Description Расписание постепенного раскатывания сегмента
+type SetRolloutDto struct {
+	Steps []RolloutStepDto `json:"steps"` // Шаги расписания в порядке возрастания процента
+}
+
+// RolloutDto model info
+// @Description Состояние расписания постепенного раскатывания сегмента
+type RolloutDto struct {
+	Slug           string            `json:"slug"`            // Название сегмента
+	Paused         bool              `json:"paused"`          // Приостановлено ли расписание
+	CurrentStep    int               `json:"current_step"`    // Номер последнего примененного шага (-1, если ни один шаг не применен)
+	CurrentPercent float64           `json:"current_percent"` // Текущий процент пользователей в сегменте
+	Steps          []*RolloutStepDto `json:"steps"`           // Шаги расписания
+}
+
+func ConvertRolloutToRolloutDto(rollout *models.Rollout) *RolloutDto {
+	steps := []*RolloutStepDto{}
+	var currentPercent float64
+
+	for _, val := range rollout.Steps {
+		steps = append(steps, &RolloutStepDto{
+			Percent: val.Percent,
+			StartAt: val.StartAt,
+		})
+
+		if val.Step == rollout.CurrentStep {
+			currentPercent = val.Percent
+		}
+	}
+
+	return &RolloutDto{
+		Slug:           rollout.Slug,
+		Paused:         rollout.Paused,
+		CurrentStep:    rollout.CurrentStep,
+		CurrentPercent: currentPercent,
+		Steps:          steps,
+	}
+}
@@ -5,9 +5,12 @@ import "github.com/TinyMarcus/avito-tech-task/internal/models"
 // SegmentDto model info
 // @Description Информация о сегменте
 type SegmentDto struct {
-	Id          int    `json:"id,omitempty"`          // Идентификатор сегмента
-	Slug        string `json:"slug"`                  // Название сегмента
-	Description string `json:"description,omitempty"` // Описание сегмента
+	Id          int      `json:"id,omitempty"`          // Идентификатор сегмента
+	Slug        string   `json:"slug"`                  // Название сегмента
+	Description string   `json:"description,omitempty"` // Описание сегмента
+	Layer       string   `json:"layer,omitempty"`       // Слой (группа взаимоисключающих сегментов)
+	Percent     *float64 `json:"percent,omitempty"`     // Процент пользователей, автоматически добавляемых в сегмент
+	Rule        string   `json:"rule,omitempty"`        // Правило таргетинга по атрибутам пользователя
 }
 
 // CreateOrUpdateSegmentDto model info
@@ -15,6 +18,16 @@ type SegmentDto struct {
 type CreateOrUpdateSegmentDto struct {
 	Slug        string `json:"slug"`                  // Название сегмента
 	Description string `json:"description,omitempty"` // Описание сегмента
+	Layer       string `json:"layer,omitempty"`       // Слой (группа взаимоисключающих сегментов)
+	Rule        string `json:"rule,omitempty"`        // Правило таргетинга по атрибутам пользователя
+}
+
+// UpdateSegmentDto model info
+// @Description Изменяемые поля сегмента: не переданные поля не меняются, пустая строка снимает слой или правило
+type UpdateSegmentDto struct {
+	Description *string `json:"description,omitempty"` // Описание сегмента
+	Layer       *string `json:"layer,omitempty"`       // Слой (группа взаимоисключающих сегментов)
+	Rule        *string `json:"rule,omitempty"`        // Правило таргетинга по атрибутам пользователя
 }
 
 // CreateSegmentResponseDto model info
@@ -29,6 +42,8 @@ type UpdateSegmentResponseDto struct {
 	Id          int    `json:"id,omitempty"`          // Идентификатор сегмента
 	Slug        string `json:"slug"`                  // Название сегмента
 	Description string `json:"description,omitempty"` // Описание сегмента
+	Layer       string `json:"layer,omitempty"`       // Слой (группа взаимоисключающих сегментов)
+	Rule        string `json:"rule,omitempty"`        // Правило таргетинга по атрибутам пользователя
 }
 
 // SegmentWithDeadlineDate model info
@@ -36,6 +51,7 @@ type UpdateSegmentResponseDto struct {
 type SegmentWithDeadlineDate struct {
 	Slug         string `json:"slug"`                    // Название сегмента
 	DeadlineDate string `json:"deadline_date,omitempty"` // Дата отключения пользователя от сегмента
+	Source       string `json:"source,omitempty"`        // Источник привязки (rule — по правилу таргетинга)
 }
 
 // ChangeUserSegmentsDto model info
@@ -48,8 +64,9 @@ type ChangeUserSegmentsDto struct {
 // UsersActiveSegments model info
 // @Description Информация об активных сегментах пользователя
 type UsersActiveSegments struct {
-	UserId   int                        `json:"user_id"`  // Идентификатор пользователя
-	Segments []*SegmentWithDeadlineDate `json:"segments"` // Список активных сегментов
+	UserId     int                        `json:"user_id"`               // Идентификатор пользователя
+	ExternalId string                     `json:"external_id,omitempty"` // Внешний идентификатор пользователя, если он задан
+	Segments   []*SegmentWithDeadlineDate `json:"segments"`              // Список активных сегментов
 }
 
 func ConvertUserSegmentToUsersActiveSegments(userId int, userSegments []*models.UserSegment) *UsersActiveSegments {
@@ -59,6 +76,7 @@ func ConvertUserSegmentToUsersActiveSegments(userId int, userSegments []*models.
 		segmentWithDeadlineDate := &SegmentWithDeadlineDate{
 			Slug:         val.Slug,
 			DeadlineDate: val.DeadlineDate.String,
+			Source:       val.Source,
 		}
 		segments = append(segments, segmentWithDeadlineDate)
 	}
@@ -74,9 +92,55 @@ func ConvertUserSegmentToUsersActiveSegments(userId int, userSegments []*models.
 }
 
 func ConvertSegmentToSegmentDto(segment *models.Segment) *SegmentDto {
-	return &SegmentDto{
+	segmentDto := &SegmentDto{
 		Id:          segment.Id,
 		Slug:        segment.Slug,
 		Description: segment.Description,
+		Layer:       segment.Layer.String,
+		Rule:        segment.Rule.String,
+	}
+
+	if segment.Percent.Valid {
+		segmentDto.Percent = &segment.Percent.Float64
+	}
+
+	return segmentDto
+}
+
+// SetUserSegmentsDto model info
+// @Description Полный желаемый набор сегментов пользователя
+type SetUserSegmentsDto struct {
+	Segments []SegmentWithDeadlineDate `json:"segments"` // Сегменты пользователя (с датами отключения)
+}
+
+// SegmentErrorDto model info
+// @Description Ошибка проверки изменения сегмента пользователя
+type SegmentErrorDto struct {
+	Slug  string `json:"slug"`  // Название сегмента
+	Error string `json:"error"` // Описание ошибки
+}
+
+// UserSegmentsChangesDto model info
+// @Description Изменения сегментов пользователя: примененные или, при пробном запуске, планируемые
+type UserSegmentsChangesDto struct {
+	UserId      int                `json:"user_id"`          // Идентификатор пользователя
+	DryRun      bool               `json:"dry_run"`          // Был ли запуск пробным (без записи в БД)
+	Added       []string           `json:"added"`            // Добавленные сегменты
+	Removed     []string           `json:"removed"`          // Удаленные сегменты
+	Updated     []string           `json:"updated"`          // Сегменты с измененной датой отключения
+	Reactivated []string           `json:"reactivated"`      // Сегменты, истекшая привязка к которым активирована повторно
+	Ignored     []string           `json:"ignored"`          // Сегменты, не требующие изменений
+	Errors      []*SegmentErrorDto `json:"errors,omitempty"` // Ошибки проверки (возвращаются при пробном запуске)
+}
+
+func ConvertSegmentChangesToUserSegmentsChangesDto(userId int, dryRun bool, changes *models.SegmentChanges) *UserSegmentsChangesDto {
+	return &UserSegmentsChangesDto{
+		UserId:      userId,
+		DryRun:      dryRun,
+		Added:       append([]string{}, changes.Added...),
+		Removed:     append([]string{}, changes.Removed...),
+		Updated:     append([]string{}, changes.Updated...),
+		Reactivated: append([]string{}, changes.Reactivated...),
+		Ignored:     append([]string{}, changes.Ignored...),
 	}
 }
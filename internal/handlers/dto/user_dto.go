@@ -5,14 +5,32 @@ import "github.com/TinyMarcus/avito-tech-task/internal/models"
 // UserDto model info
 // @Description Информация о пользователе
 type UserDto struct {
-	Id   int    `json:"id"`   // Идентификатор пользователя
-	Name string `json:"name"` // Имя пользователя
+	Id         int                    `json:"id"`                    // Идентификатор пользователя
+	ExternalId string                 `json:"external_id,omitempty"` // Внешний идентификатор пользователя
+	Name       string                 `json:"name"`                  // Имя пользователя
+	Attributes map[string]interface{} `json:"attributes,omitempty"`  // Атрибуты пользователя
 }
 
 // CreateUserDto model info
 // @Description Информация о пользователе при создании
 type CreateUserDto struct {
-	Name string `json:"name"` // Имя пользователя
+	ExternalId string                 `json:"external_id,omitempty"` // Внешний идентификатор пользователя, например UUID
+	Name       string                 `json:"name"`                  // Имя пользователя
+	Attributes map[string]interface{} `json:"attributes,omitempty"`  // Атрибуты пользователя (город, платформа, дата регистрации и т.д.)
+}
+
+// SetUserAttributesDto model info
+// @Description Атрибуты пользователя
+type SetUserAttributesDto struct {
+	Attributes map[string]interface{} `json:"attributes"` // Атрибуты пользователя (город, платформа, дата регистрации и т.д.)
+}
+
+// UpdateUserDto model info
+// @Description Изменяемые поля пользователя, отсутствующие поля не меняются
+type UpdateUserDto struct {
+	Name       *string                `json:"name,omitempty"`        // Имя пользователя
+	ExternalId *string                `json:"external_id,omitempty"` // Внешний идентификатор пользователя, пустая строка удаляет его
+	Attributes map[string]interface{} `json:"attributes,omitempty"`  // Атрибуты пользователя (заменяют текущие целиком)
 }
 
 // CreateUserResponseDto model info
@@ -21,9 +39,24 @@ type CreateUserResponseDto struct {
 	Id int `json:"id"` // Идентификатор пользователя
 }
 
+// BatchGetActiveSegmentsDto model info
+// @Description Идентификаторы пользователей для получения активных сегментов
+type BatchGetActiveSegmentsDto struct {
+	UserIds []UserKey `json:"user_ids" swaggertype:"array,string"` // Числовые или внешние идентификаторы пользователей
+}
+
+// BatchActiveSegmentsDto model info
+// @Description Активные сегменты нескольких пользователей
+type BatchActiveSegmentsDto struct {
+	Users          []*UsersActiveSegments `json:"users"`            // Активные сегменты найденных пользователей
+	UnknownUserIds []string               `json:"unknown_user_ids"` // Идентификаторы из запроса, пользователей с которыми нет в БД или которые некорректны
+}
+
 func ConvertUserToUserDto(user *models.User) *UserDto {
 	return &UserDto{
-		Id:   user.Id,
-		Name: user.Name,
+		Id:         user.Id,
+		ExternalId: user.ExternalId.String,
+		Name:       user.Name,
+		Attributes: user.Attributes,
 	}
 }
@@ -0,0 +1,116 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+// CreateOrUpdateWebhookDto model info
+// @Description Параметры подписки на события об изменении участия в сегментах
+type CreateOrUpdateWebhookDto struct {
+	Url        string   `json:"url" example:"https://recommendations.example.com/hooks/segments"`    // Адрес, на который отправляются события (http или https)
+	EventTypes []string `json:"event_types,omitempty" example:"membership.added,membership.removed"` // Типы событий; пустой список — все типы
+	Slugs      []string `json:"slugs,omitempty"`                                                     // Сегменты; пустой список — все сегменты
+	Active     *bool    `json:"active,omitempty"`                                                    // Отправлять ли события (по умолчанию true при создании, без изменений при обновлении)
+	Secret     string   `json:"secret,omitempty"`                                                    // Секрет для подписи; при создании без секрета он генерируется, при обновлении без секрета не меняется
+}
+
+// WebhookDto model info
+// @Description Подписка на события об изменении участия в сегментах
+type WebhookDto struct {
+	Id         int       `json:"id"`               // Идентификатор подписки
+	Url        string    `json:"url"`              // Адрес, на который отправляются события
+	EventTypes []string  `json:"event_types"`      // Типы событий; пустой список — все типы
+	Slugs      []string  `json:"slugs"`            // Сегменты; пустой список — все сегменты
+	Active     bool      `json:"active"`           // Отправляются ли события
+	CreatedAt  time.Time `json:"created_at"`       // Время создания подписки
+	Secret     string    `json:"secret,omitempty"` // Секрет для проверки подписи; возвращается только при создании
+}
+
+// WebhookEventDto model info
+// @Description Событие об изменении участия пользователя в сегменте
+type WebhookEventDto struct {
+	Id           int64      `json:"id"`                              // Идентификатор события
+	Type         string     `json:"type" example:"membership.added"` // Тип: membership.added, membership.removed, membership.updated или membership.expired
+	UserId       int        `json:"user_id"`                         // Идентификатор пользователя
+	ExternalId   string     `json:"external_id,omitempty"`           // Внешний идентификатор пользователя
+	Slug         string     `json:"slug"`                            // Название сегмента
+	DeadlineDate *time.Time `json:"deadline_date,omitempty"`         // Дата отключения, действующая после изменения
+	Actor        string     `json:"actor,omitempty" example:"api"`   // Источник изменения
+	OccurredAt   time.Time  `json:"occurred_at"`                     // Время изменения
+}
+
+// WebhookDeliveryDto model info
+// @Description Доставка события подписке
+type WebhookDeliveryDto struct {
+	Id             int64            `json:"id"`                         // Идентификатор доставки
+	Status         string           `json:"status" example:"dead"`      // Статус: pending, delivered или dead
+	Attempts       int              `json:"attempts"`                   // Число сделанных попыток
+	NextAttemptAt  *time.Time       `json:"next_attempt_at,omitempty"`  // Время следующей попытки для статуса pending
+	LastStatusCode int              `json:"last_status_code,omitempty"` // Код последнего ответа получателя
+	LastError      string           `json:"last_error,omitempty"`       // Причина последней неудачной попытки
+	CreatedAt      time.Time        `json:"created_at"`                 // Время создания доставки
+	DeliveredAt    *time.Time       `json:"delivered_at,omitempty"`     // Время успешной доставки
+	Event          *WebhookEventDto `json:"event"`                      // Доставляемое событие
+}
+
+// WebhookDeliveriesDto model info
+// @Description Страница доставок подписки
+type WebhookDeliveriesDto struct {
+	Deliveries []*WebhookDeliveryDto `json:"deliveries"`            // Доставки от новых к старым
+	NextCursor string                `json:"next_cursor,omitempty"` // Курсор следующей страницы, если она есть
+}
+
+func ConvertWebhookToWebhookDto(webhook *models.Webhook) *WebhookDto {
+	webhookDto := &WebhookDto{
+		Id:         webhook.Id,
+		Url:        webhook.Url,
+		EventTypes: webhook.EventTypes,
+		Slugs:      webhook.Slugs,
+		Active:     webhook.Active,
+		CreatedAt:  webhook.CreatedAt,
+	}
+
+	if webhookDto.EventTypes == nil {
+		webhookDto.EventTypes = []string{}
+	}
+	if webhookDto.Slugs == nil {
+		webhookDto.Slugs = []string{}
+	}
+
+	return webhookDto
+}
+
+func ConvertWebhookDeliveryToWebhookDeliveryDto(delivery *models.WebhookDelivery) *WebhookDeliveryDto {
+	event := delivery.Event
+	deliveryDto := &WebhookDeliveryDto{
+		Id:             delivery.Id,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		LastStatusCode: int(delivery.LastStatusCode.Int32),
+		LastError:      delivery.LastError.String,
+		CreatedAt:      delivery.CreatedAt,
+		Event: &WebhookEventDto{
+			Id:         event.Id,
+			Type:       event.Type,
+			UserId:     event.UserId,
+			ExternalId: event.ExternalId.String,
+			Slug:       event.Slug,
+			Actor:      event.Actor.String,
+			OccurredAt: event.OccurredAt,
+		},
+	}
+
+	if delivery.Status == "pending" {
+		deliveryDto.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	if delivery.DeliveredAt.Valid {
+		deliveryDto.DeliveredAt = &delivery.DeliveredAt.Time
+	}
+	if event.DeadlineDate.Valid {
+		deliveryDto.Event.DeadlineDate = &event.DeadlineDate.Time
+	}
+
+	return deliveryDto
+}
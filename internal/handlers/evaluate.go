@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+type EvaluateHandler struct {
+	repository EvaluationRepository
+}
+
+func NewEvaluateHandler(r EvaluationRepository) *EvaluateHandler {
+	return &EvaluateHandler{
+		repository: r,
+	}
+}
+
+type EvaluationRepository interface {
+	EvaluateUser(key string, attributes models.Attributes) ([]*models.UserSegment, bool, error)
+}
+
+// EvaluateHandler godoc
+//
+//		@Summary		Вычислить сегменты пользователя
+//		@Description	Вычислить сегменты пользователя по идентификатору и атрибутам без сохранения пользователя в сервисе: учитываются сохраненные привязки, процентные сегменты и правила таргетинга
+//		@ID				evaluate
+//		@Tags			evaluation
+//		@Accept			json
+//		@Produce		json
+//	 	@Param			Пользователь	body	dto.EvaluateRequestDto	    true	"Идентификатор и атрибуты пользователя"
+//		@Success		200		{object}	dto.EvaluateResponseDto		"Сегменты пользователя успешно вычислены"
+//		@Failure		400		{object}	dto.ErrorDto				"Некорректные входные данные или числовой идентификатор вне диапазона"
+//		@Failure		500	    {object}	dto.ErrorDto				"Возникла внутренняя ошибка сервера"
+//		@Router			/api/v1/evaluate [post]
+func (h *EvaluateHandler) EvaluateHandler(w http.ResponseWriter, r *http.Request) {
+	var request dto.EvaluateRequestDto
+
+	w.Header().Add("Content-Type", "application/json")
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.UserId == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректные входные данные",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	// анонимный пользователь может иметь произвольный строковый идентификатор, но числовой должен
+	// помещаться в столбец users.id
+	if _, _, ok := models.ParseUserKey(string(request.UserId)); !ok && isNumericKey(string(request.UserId)) {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректный идентификатор пользователя: ожидается число от 1 до 2147483647",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	segments, knownUser, err := h.repository.EvaluateUser(string(request.UserId), request.Attributes)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorDto := &dto.ErrorDto{
+			Error: "Возникла внутренняя ошибка при вычислении сегментов пользователя",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(dto.ConvertUserSegmentsToEvaluateResponseDto(string(request.UserId), knownUser, segments))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// isNumericKey сообщает, что идентификатор — целое число, возможно со знаком
+func isNumericKey(key string) bool {
+	digits := strings.TrimPrefix(key, "-")
+	if digits == "" {
+		return false
+	}
+
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
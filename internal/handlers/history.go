@@ -0,0 +1,497 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+	"github.com/TinyMarcus/avito-tech-task/internal/report"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+const (
+	formatJson = "json"
+	formatCsv  = "csv"
+)
+
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+type HistoryHandler struct {
+	repository HistoryReader
+	users      UserResolver
+	formatters *report.Formatters
+}
+
+func NewHistoryHandler(r HistoryReader, users UserResolver, formatters *report.Formatters) *HistoryHandler {
+	return &HistoryHandler{
+		repository: r,
+		users:      users,
+		formatters: formatters,
+	}
+}
+
+type HistoryReader interface {
+	GetSegmentsOfUserAsOf(userId int, asOf time.Time) ([]*models.UserSegment, error)
+	GetUsersOfSegmentAsOf(slug string, asOf time.Time) ([]int, error)
+	GetSegmentDiff(slug string, from, to time.Time) (*models.SegmentDiff, error)
+	GetHistory(filter *models.HistoryFilter) ([]*models.HistoryRecord, error)
+	GetHistoryReport(userId int, slug string, from, to time.Time) (*models.HistoryReport, error)
+	GetSegmentTimeline(slug string, to time.Time) (*models.SegmentTimeline, error)
+}
+
+// GetSegmentsOfUserAsOfHandler godoc
+//
+//	@Summary		Получить сегменты пользователя на момент времени
+//	@Description	Восстановить по истории, в каких сегментах пользователь состоял в указанный момент времени, с учетом дат отключения
+//	@ID				get-segments-of-user-as-of
+//	@Tags			users
+//	@Produce		json
+//	@Param			userId	path		string					true	"Идентификатор пользователя (числовой или внешний)"
+//	@Param			as_of	query		string					true	"Момент времени в формате RFC 3339"
+//	@Success		200		{object}	dto.UserSegmentsAsOfDto	"Сегменты пользователя успешно получены"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Пользователь с данным идентификатором не найден"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/users/{userId}/segments [get]
+func (h *HistoryHandler) GetSegmentsOfUserAsOfHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	asOf, err := timeParam(r, "as_of")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректное значение параметра as_of",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	userId, ok := userIdParam(w, r, h.users)
+	if !ok {
+		return
+	}
+
+	segments, err := h.repository.GetSegmentsOfUserAsOf(userId, asOf)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorDto := &dto.ErrorDto{
+			Error: "Возникла внутренняя ошибка при запросе истории сегментов пользователя",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(dto.ConvertUserSegmentsToUserSegmentsAsOfDto(userId, asOf, segments))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// GetUsersOfSegmentAsOfHandler godoc
+//
+//	@Summary		Получить пользователей сегмента на момент времени
+//	@Description	Восстановить по истории, какие пользователи состояли в сегменте в указанный момент времени, с учетом дат отключения
+//	@ID				get-users-of-segment-as-of
+//	@Tags			segments
+//	@Produce		json
+//	@Param			slug	path		string					true	"Название сегмента"
+//	@Param			as_of	query		string					true	"Момент времени в формате RFC 3339"
+//	@Success		200		{object}	dto.SegmentUsersAsOfDto	"Пользователи сегмента успешно получены"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Сегмент с данным названием не найден"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/segments/{slug}/users [get]
+func (h *HistoryHandler) GetUsersOfSegmentAsOfHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	slug := params["slug"]
+
+	w.Header().Add("Content-Type", "application/json")
+	asOf, err := timeParam(r, "as_of")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректное значение параметра as_of",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	userIds, err := h.repository.GetUsersOfSegmentAsOf(slug, asOf)
+	if err != nil {
+		status, message := http.StatusInternalServerError, "Возникла внутренняя ошибка при запросе истории сегмента"
+		if errors.Is(err, repositories.ErrSegmentNotFound) {
+			status, message = http.StatusNotFound, "Сегмент с таким названием не найден"
+		}
+
+		w.WriteHeader(status)
+		errorDto := &dto.ErrorDto{
+			Error: message,
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	if userIds == nil {
+		userIds = []int{}
+	}
+
+	segmentUsersAsOfDto := &dto.SegmentUsersAsOfDto{
+		Slug:    slug,
+		AsOf:    asOf,
+		UserIds: userIds,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(segmentUsersAsOfDto)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// GetSegmentDiffHandler godoc
+//
+//	@Summary		Получить изменение состава сегмента за период
+//	@Description	Сравнить состав сегмента в начале и в конце периода: пользователи, вошедшие в сегмент, вышедшие из него (удаленные вручную или по наступлению даты отключения) и изменение числа участников. При format=csv возвращается CSV-файл с колонками user_id, change, reason, date
+//	@ID				get-segment-diff
+//	@Tags			segments
+//	@Produce		json
+//	@Produce		text/csv
+//	@Param			slug	path		string					true	"Название сегмента"
+//	@Param			from	query		string					true	"Начало периода в формате RFC 3339"
+//	@Param			to		query		string					true	"Конец периода в формате RFC 3339"
+//	@Param			format	query		string					false	"Формат ответа"	Enums(json, csv)
+//	@Success		200		{object}	dto.SegmentDiffDto		"Изменение состава сегмента успешно получено"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Сегмент с данным названием не найден"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/segments/{slug}/diff [get]
+func (h *HistoryHandler) GetSegmentDiffHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	slug := params["slug"]
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatJson
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	from, fromErr := timeParam(r, "from")
+	to, toErr := timeParam(r, "to")
+	if fromErr != nil || toErr != nil || to.Before(from) || (format != formatJson && format != formatCsv) {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректные входные данные",
+		}
+		err := json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	diff, err := h.repository.GetSegmentDiff(slug, from, to)
+	if err != nil {
+		status, message := http.StatusInternalServerError, "Возникла внутренняя ошибка при запросе истории сегмента"
+		if errors.Is(err, repositories.ErrSegmentNotFound) {
+			status, message = http.StatusNotFound, "Сегмент с таким названием не найден"
+		}
+
+		w.WriteHeader(status)
+		errorDto := &dto.ErrorDto{
+			Error: message,
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	diffDto := dto.ConvertSegmentDiffToSegmentDiffDto(diff)
+	if format == formatCsv {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", slug+"-diff.csv"))
+		w.WriteHeader(http.StatusOK)
+		_ = writeSegmentDiffCsv(w, diffDto)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(diffDto)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func writeSegmentDiffCsv(w io.Writer, diff *dto.SegmentDiffDto) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"user_id", "change", "reason", "date"}); err != nil {
+		return err
+	}
+
+	changes := []struct {
+		name    string
+		entries []*dto.DiffEntryDto
+	}{
+		{"joined", diff.Joined},
+		{"left", diff.Left},
+	}
+
+	for _, change := range changes {
+		for _, entry := range change.entries {
+			record := []string{strconv.Itoa(entry.UserId), change.name, entry.Reason, entry.Date.Format(time.RFC3339)}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// GetHistoryHandler godoc
+//
+//	@Summary		Получить историю изменений сегментов
+//	@Description	Получить записи истории добавления пользователей в сегменты и удаления из них с фильтрами. Записи возвращаются от новых к старым страницами; для получения следующей страницы передается next_cursor из предыдущего ответа
+//	@ID				get-history
+//	@Tags			history
+//	@Produce		json
+//	@Param			user_id			query		string				false	"Идентификатор пользователя (числовой или внешний)"
+//	@Param			slug			query		string				false	"Название сегмента"
+//	@Param			operation_type	query		string				false	"Тип операции"	Enums(ADDING, REMOVING, UPDATING)
+//	@Param			actor			query		string				false	"Источник изменения"	Enums(api, import, rollout, erasure)
+//	@Param			from			query		string				false	"Начало периода в формате RFC 3339 (включительно)"
+//	@Param			to				query		string				false	"Конец периода в формате RFC 3339 (не включительно)"
+//	@Param			limit			query		int					false	"Размер страницы (по умолчанию 100, не более 1000)"
+//	@Param			cursor			query		string				false	"Курсор страницы"
+//	@Success		200		{object}	dto.HistoryPageDto		"Записи истории успешно получены"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Пользователь с данным идентификатором не найден"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/history [get]
+func (h *HistoryHandler) GetHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	w.Header().Add("Content-Type", "application/json")
+	filter, err := parseHistoryFilter(query)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректные входные данные",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	if key := query.Get("user_id"); key != "" {
+		var ok bool
+		if filter.UserId, ok = resolveUserId(w, h.users, key); !ok {
+			return
+		}
+	}
+
+	records, err := h.repository.GetHistory(filter)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorDto := &dto.ErrorDto{
+			Error: "Возникла внутренняя ошибка при запросе истории",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	historyPageDto := &dto.HistoryPageDto{
+		Records: make([]*dto.HistoryEntryDto, 0, len(records)),
+	}
+	for _, record := range records {
+		historyPageDto.Records = append(historyPageDto.Records, dto.ConvertHistoryRecordToHistoryEntryDto(record))
+	}
+	if len(records) == filter.Limit {
+		historyPageDto.NextCursor = encodeCursor(records[len(records)-1].Id)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(historyPageDto)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func parseHistoryFilter(query url.Values) (*models.HistoryFilter, error) {
+	filter := &models.HistoryFilter{
+		Slug:          query.Get("slug"),
+		OperationType: query.Get("operation_type"),
+		Actor:         query.Get("actor"),
+		Limit:         defaultHistoryLimit,
+	}
+
+	switch filter.OperationType {
+	case "", repositories.OperationAdding, repositories.OperationRemoving, repositories.OperationUpdating:
+	default:
+		return nil, errInvalidFilter
+	}
+
+	var err error
+	if value := query.Get("from"); value != "" {
+		if filter.From, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, errInvalidFilter
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if filter.To, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, errInvalidFilter
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil || filter.Limit <= 0 || filter.Limit > maxHistoryLimit {
+			return nil, errInvalidFilter
+		}
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		if filter.After, err = decodeCursor(value); err != nil {
+			return nil, errInvalidFilter
+		}
+	}
+
+	return filter, nil
+}
+
+var errInvalidFilter = errors.New("invalid history filter")
+
+// GetHistoryReportHandler godoc
+//
+//	@Summary		Получить отчет по истории
+//	@Description	Получить отчет по истории изменений сегментов за период. Формат выбирается параметром format или заголовком Accept: CSV (по умолчанию) — запись истории в строке, XLSX — по листу на каждый месяц с автофильтром, DOCX — сводная таблица по сегментам
+//	@ID				get-history-report
+//	@Tags			history
+//	@Produce		text/csv
+//	@Produce		application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+//	@Produce		application/vnd.openxmlformats-officedocument.wordprocessingml.document
+//	@Param			from		query		string				true	"Начало периода в формате RFC 3339 (включительно)"
+//	@Param			to			query		string				true	"Конец периода в формате RFC 3339 (не включительно)"
+//	@Param			user_id		query		string				false	"Идентификатор пользователя (числовой или внешний)"
+//	@Param			slug		query		string				false	"Название сегмента"
+//	@Param			format		query		string				false	"Формат отчета"	Enums(csv, xlsx, docx)
+//	@Success		200		{file}		file					"Отчет успешно сформирован"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Пользователь с данным идентификатором не найден"
+//	@Failure		406		{object}	dto.ErrorDto			"Неподдерживаемый формат отчета"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/history/report [get]
+func (h *HistoryHandler) GetHistoryReportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	w.Header().Add("Content-Type", "application/json")
+	formatter, ok := h.formatters.Select(query.Get("format"), r.Header.Get("Accept"))
+	if !ok {
+		w.WriteHeader(http.StatusNotAcceptable)
+		errorDto := &dto.ErrorDto{
+			Error: "Неподдерживаемый формат отчета",
+		}
+		err := json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	from, fromErr := timeParam(r, "from")
+	to, toErr := timeParam(r, "to")
+	if fromErr != nil || toErr != nil || !from.Before(to) {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректные входные данные",
+		}
+		err := json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	var userId int
+	if key := query.Get("user_id"); key != "" {
+		if userId, ok = resolveUserId(w, h.users, key); !ok {
+			return
+		}
+	}
+
+	historyReport, err := h.repository.GetHistoryReport(userId, query.Get("slug"), from, to)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorDto := &dto.ErrorDto{
+			Error: "Возникла внутренняя ошибка при формировании отчета",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	// отчет собирается в памяти, чтобы ошибку формирования можно было вернуть до начала ответа
+	var buf bytes.Buffer
+	if err = formatter.Format(&buf, historyReport); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorDto := &dto.ErrorDto{
+			Error: "Возникла внутренняя ошибка при формировании отчета",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", formatter.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", report.Filename(from, to, formatter)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = buf.WriteTo(w)
+}
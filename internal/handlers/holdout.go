@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+type HoldoutHandler struct {
+	holdout    Holdout
+	repository UserRepository
+}
+
+func NewHoldoutHandler(h Holdout, r UserRepository) *HoldoutHandler {
+	return &HoldoutHandler{
+		holdout:    h,
+		repository: r,
+	}
+}
+
+type Holdout interface {
+	ContainsKey(key string) bool
+	Percent() float64
+}
+
+// GetUserHoldoutHandler godoc
+//
+//	@Summary		Проверить принадлежность к контрольной группе
+//	@Description	Проверить, входит ли пользователь в глобальную контрольную группу, исключенную из всех экспериментов
+//	@ID				get-user-holdout
+//	@Tags			holdout
+//	@Accept			json
+//	@Produce		json
+//	@Param			userId	path		string					true	"Идентификатор пользователя"
+//	@Success		200		{object}	dto.UserHoldoutDto		"Принадлежность к контрольной группе успешно получена"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Пользователь с данным идентификатором не найден"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/holdout/users/{userId} [get]
+func (h *HoldoutHandler) GetUserHoldoutHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	userId, ok := userIdParam(w, r, h.repository)
+	if !ok {
+		return
+	}
+
+	user, err := h.repository.GetUserById(userId)
+	if err != nil {
+		switch err {
+		case repositories.ErrRecordNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			errorDto := &dto.ErrorDto{
+				Error: "Пользователь с таким идентификатором не найден",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			errorDto := &dto.ErrorDto{
+				Error: "Возникла внутренняя ошибка при запросе пользователя",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+
+		return
+	}
+
+	userHoldoutDto := &dto.UserHoldoutDto{
+		UserId:    userId,
+		InHoldout: h.holdout.ContainsKey(user.BucketingKey()),
+		Percent:   h.holdout.Percent(),
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(userHoldoutDto)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
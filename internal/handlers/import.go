@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+	"github.com/TinyMarcus/avito-tech-task/internal/importer"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+type ImportHandler struct {
+	importer Importer
+}
+
+func NewImportHandler(i Importer) *ImportHandler {
+	return &ImportHandler{
+		importer: i,
+	}
+}
+
+type Importer interface {
+	Import(r io.Reader, dryRun bool) (*models.ImportReport, error)
+}
+
+// ImportUsersHandler godoc
+//
+//	@Summary		Импортировать пользователей и их сегменты
+//	@Description	Импортировать пользователей и их сегменты из CSV-файла со строками вида user_id[,slug,deadline], где user_id — числовой или внешний идентификатор. Строка только с внешним идентификатором создает пользователя, строка со слагом добавляет пользователю сегмент. Строки с ошибками не применяются и попадают в отчет, при dry_run=true ничего не записывается
+//	@ID				import-users
+//	@Tags			users
+//	@Accept			text/csv
+//	@Produce		json
+//	@Param			dry_run	query		bool					false	"Только проверить файл, не применяя изменения"
+//	@Param			file	body		string					true	"CSV-файл"
+//	@Success		200		{object}	dto.ImportReportDto		"Файл успешно обработан"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		409		{object}	dto.ErrorDto			"Параллельный запрос добавил пользователя в другой сегмент слоя"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Failure		503	    {object}	dto.ErrorDto			"Сервис пользователей недоступен"
+//	@Router			/api/v1/import [post]
+func (h *ImportHandler) ImportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+
+	dryRun, err := dryRunParam(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректное значение параметра dry_run",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	report, err := h.importer.Import(r.Body, dryRun)
+	if err != nil {
+		status, message := http.StatusInternalServerError, "Возникла внутренняя ошибка при импорте пользователей"
+		switch {
+		case errors.Is(err, importer.ErrInvalidFile):
+			status, message = http.StatusBadRequest, "Не удалось прочитать CSV-файл"
+		case errors.Is(err, repositories.ErrUserDirectoryUnavailable):
+			status, message = http.StatusServiceUnavailable, "Сервис пользователей недоступен, повторите запрос позже"
+		case errors.Is(err, repositories.ErrInvalidDeadline):
+			status, message = http.StatusBadRequest, "Некорректная дата отключения от сегмента"
+		case errors.Is(err, repositories.ErrLayerConflict):
+			status, message = http.StatusConflict, "Параллельный запрос добавил пользователя в другой сегмент того же слоя, повторите импорт"
+		}
+
+		w.WriteHeader(status)
+		errorDto := &dto.ErrorDto{
+			Error: message,
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(dto.ConvertImportReportToImportReportDto(report))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+type BatchConfig struct {
+	ChunkSize int `envconfig:"CHUNK_SIZE" default:"1000"`
+	// ReadLimit — наибольшее число пользователей в одном запросе активных сегментов
+	ReadLimit int `envconfig:"READ_LIMIT" default:"1000"`
+}
+
+func (c BatchConfig) Validate() error {
+	if c.ChunkSize < 1 || c.ReadLimit < 1 {
+		return fmt.Errorf("batch chunk size and read limit must be at least 1, got %d and %d", c.ChunkSize, c.ReadLimit)
+	}
+
+	return nil
+}
+
+type MembersHandler struct {
+	repository MembershipRepository
+	chunkSize  int
+}
+
+func NewMembersHandler(r MembershipRepository, cfg BatchConfig) *MembersHandler {
+	return &MembersHandler{
+		repository: r,
+		chunkSize:  cfg.ChunkSize,
+	}
+}
+
+type MembershipRepository interface {
+	CheckIfSegmentExists(slug string) (bool, error)
+	CheckDeadline(ttl string) error
+	AddSegmentToUsers(slug string, keys []string, ttl string, dryRun bool) (*models.BatchResult, error)
+	TakeSegmentFromUsers(slug string, keys []string, dryRun bool) (*models.BatchResult, error)
+}
+
+var errInvalidBody = errors.New("invalid request body")
+
+// BatchAddMembersHandler godoc
+//
+//		@Summary		Добавить сегмент пользователям
+//		@Description	Добавить сегмент множеству пользователей. Числовые или внешние идентификаторы передаются JSON-списком, потоком NDJSON (application/x-ndjson) или CSV (text/csv, идентификатор в первой колонке). Изменения применяются пачками, каждая в своей транзакции
+//		@ID				batch-add-members
+//		@Tags			segments
+//		@Accept			json
+//		@Accept			text/csv
+//		@Accept			application/x-ndjson
+//		@Produce		json
+//		@Param			slug			path		string					true	"Название сегмента"
+//		@Param			deadline_date	query		string					false	"Дата отключения пользователей от сегмента"
+//		@Param			dry_run			query		bool					false	"Только подсчитать изменения, не применяя их"
+//	 	@Param			Пользователи	body		dto.BatchMembersDto		true	"Идентификаторы пользователей"
+//		@Success		200		{object}	dto.BatchMembersResultDto		"Сегмент успешно добавлен пользователям"
+//		@Failure		400		{object}	dto.BatchMembersErrorDto		"Некорректные входные данные или дата отключения"
+//		@Failure		404		{object}	dto.ErrorDto					"Сегмент с данным названием не найден"
+//		@Failure		409		{object}	dto.BatchMembersErrorDto		"Параллельный запрос добавил пользователя в другой сегмент слоя"
+//		@Failure		500	    {object}	dto.BatchMembersErrorDto		"Возникла внутренняя ошибка сервера"
+//		@Failure		503	    {object}	dto.BatchMembersErrorDto		"Сервис пользователей недоступен"
+//		@Router			/api/v1/segments/{slug}/members:batchAdd [post]
+func (h *MembersHandler) BatchAddMembersHandler(w http.ResponseWriter, r *http.Request) {
+	h.batch(w, r, func(slug string, keys []string, ttl string, dryRun bool) (*models.BatchResult, error) {
+		return h.repository.AddSegmentToUsers(slug, keys, ttl, dryRun)
+	})
+}
+
+// BatchRemoveMembersHandler godoc
+//
+//		@Summary		Удалить сегмент у пользователей
+//		@Description	Удалить сегмент у множества пользователей. Числовые или внешние идентификаторы передаются JSON-списком, потоком NDJSON (application/x-ndjson) или CSV (text/csv, идентификатор в первой колонке). Изменения применяются пачками, каждая в своей транзакции
+//		@ID				batch-remove-members
+//		@Tags			segments
+//		@Accept			json
+//		@Accept			text/csv
+//		@Accept			application/x-ndjson
+//		@Produce		json
+//		@Param			slug			path		string					true	"Название сегмента"
+//		@Param			dry_run			query		bool					false	"Только подсчитать изменения, не применяя их"
+//	 	@Param			Пользователи	body		dto.BatchMembersDto		true	"Идентификаторы пользователей"
+//		@Success		200		{object}	dto.BatchMembersResultDto		"Сегмент успешно удален у пользователей"
+//		@Failure		400		{object}	dto.BatchMembersErrorDto		"Некорректные входные данные"
+//		@Failure		404		{object}	dto.ErrorDto					"Сегмент с данным названием не найден"
+//		@Failure		500	    {object}	dto.BatchMembersErrorDto		"Возникла внутренняя ошибка сервера"
+//		@Failure		503	    {object}	dto.BatchMembersErrorDto		"Сервис пользователей недоступен"
+//		@Router			/api/v1/segments/{slug}/members:batchRemove [post]
+func (h *MembersHandler) BatchRemoveMembersHandler(w http.ResponseWriter, r *http.Request) {
+	h.batch(w, r, func(slug string, keys []string, _ string, dryRun bool) (*models.BatchResult, error) {
+		return h.repository.TakeSegmentFromUsers(slug, keys, dryRun)
+	})
+}
+
+func (h *MembersHandler) batch(w http.ResponseWriter, r *http.Request,
+	apply func(slug string, keys []string, ttl string, dryRun bool) (*models.BatchResult, error)) {
+	params := mux.Vars(r)
+	slug := params["slug"]
+	ttl := r.URL.Query().Get("deadline_date")
+
+	w.Header().Add("Content-Type", "application/json")
+	dryRun, err := dryRunParam(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректное значение параметра dry_run",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	exists, err := h.repository.CheckIfSegmentExists(slug)
+	if err != nil || !exists {
+		status, message := http.StatusNotFound, "Запись с таким названием в таблице сегментов не найдена"
+		if err != nil {
+			status, message = http.StatusInternalServerError, "Возникла внутренняя ошибка при запросе сегмента по названию"
+		}
+
+		w.WriteHeader(status)
+		errorDto := &dto.ErrorDto{
+			Error: message,
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	result := &dto.BatchMembersResultDto{DryRun: dryRun}
+	deadlineChecked := false
+	processChunk := func(keys []string) error {
+		// дата из JSON-тела известна только после его разбора, поэтому она проверяется перед первой пачкой:
+		// некорректная дата не должна обнаружиться после того, как часть пачек уже применена
+		if !deadlineChecked && ttl != "" {
+			if err := h.repository.CheckDeadline(ttl); err != nil {
+				return err
+			}
+		}
+		deadlineChecked = true
+
+		chunkResult, err := apply(slug, keys, ttl, dryRun)
+		if err != nil {
+			return err
+		}
+
+		result.Add(chunkResult)
+		return nil
+	}
+
+	invalid, err := readUserKeys(r, h.chunkSize, &ttl, processChunk)
+	result.Invalid = invalid
+	if err != nil {
+		status, message := http.StatusInternalServerError, "Возникла внутренняя ошибка при изменении участников сегмента"
+		switch {
+		case errors.Is(err, errInvalidBody):
+			status, message = http.StatusBadRequest, "Некорректные входные данные"
+		case errors.Is(err, repositories.ErrInvalidDeadline):
+			status, message = http.StatusBadRequest, "Некорректная дата отключения от сегмента"
+		case errors.Is(err, repositories.ErrLayerConflict):
+			// параллельный запрос добавил пользователя пачки в другой сегмент слоя, повтор пропустит его
+			status, message = http.StatusConflict, "Пользователь уже состоит в другом сегменте того же слоя, повторите запрос"
+		case errors.Is(err, repositories.ErrUserDirectoryUnavailable):
+			status, message = http.StatusServiceUnavailable, "Сервис пользователей недоступен, повторите запрос позже"
+		}
+
+		// пачки, примененные до ошибки, уже зафиксированы, поэтому их итог возвращается вместе с ошибкой
+		w.WriteHeader(status)
+		errorDto := &dto.BatchMembersErrorDto{
+			Error: message,
+		}
+		if result.Chunks > 0 {
+			errorDto.Committed = result
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// csvUserHeaders — заголовки первой колонки CSV, которые не считаются идентификатором пользователя
+var csvUserHeaders = map[string]bool{"id": true, "user_id": true, "userid": true, "external_id": true}
+
+// readUserKeys читает числовые и внешние идентификаторы пользователей из тела запроса и передает их пачками
+// по chunkSize. Для JSON-тела дата отключения может быть передана в поле deadline_date. Возвращает число строк
+// и идентификаторов, которые не удалось разобрать (они пропускаются).
+func readUserKeys(r *http.Request, chunkSize int, ttl *string, process func([]string) error) (int, error) {
+	var invalid int
+	chunk := make([]string, 0, chunkSize)
+	push := func(key string) error {
+		if _, _, ok := models.ParseUserKey(key); !ok {
+			invalid++
+			return nil
+		}
+
+		chunk = append(chunk, key)
+		if len(chunk) < chunkSize {
+			return nil
+		}
+
+		err := process(chunk)
+		chunk = chunk[:0]
+		return err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "application/x-ndjson", "application/jsonl":
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+
+			key, err := parseNdjsonUserKey(line)
+			if err != nil {
+				invalid++
+				continue
+			}
+
+			if err = push(key); err != nil {
+				return invalid, err
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			return invalid, errInvalidBody
+		}
+	case "text/csv":
+		reader := csv.NewReader(r.Body)
+		reader.FieldsPerRecord = -1
+		for line := 0; ; line++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return invalid, errInvalidBody
+			}
+
+			key := strings.TrimSpace(record[0])
+			// первая строка может быть заголовком
+			if _, _, ok := models.ParseUserKey(key); line == 0 && (!ok || csvUserHeaders[strings.ToLower(key)]) {
+				continue
+			}
+
+			if err = push(key); err != nil {
+				return invalid, err
+			}
+		}
+	default:
+		var body dto.BatchMembersDto
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return 0, errInvalidBody
+		}
+
+		if body.DeadlineDate != "" {
+			*ttl = body.DeadlineDate
+		}
+
+		for _, key := range body.UserIds {
+			if err := push(string(key)); err != nil {
+				return invalid, err
+			}
+		}
+	}
+
+	if len(chunk) > 0 {
+		return invalid, process(chunk)
+	}
+
+	return invalid, nil
+}
+
+// parseNdjsonUserKey разбирает строку NDJSON: объект с полем user_id, число или строку в кавычках
+func parseNdjsonUserKey(line string) (string, error) {
+	if strings.HasPrefix(line, "{") {
+		var member struct {
+			UserId dto.UserKey `json:"user_id"`
+		}
+		err := json.Unmarshal([]byte(line), &member)
+		return string(member.UserId), err
+	}
+
+	var key dto.UserKey
+	if err := json.Unmarshal([]byte(line), &key); err != nil {
+		// строка без кавычек — внешний идентификатор
+		return line, nil
+	}
+
+	return string(key), nil
+}
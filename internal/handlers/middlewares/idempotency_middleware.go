@@ -0,0 +1,206 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	idempotencyPurgeInterval = time.Hour
+)
+
+// IdempotencyConfig задает, сколько хранится ответ на запрос с ключом идемпотентности (TTL), через сколько ключ
+// запроса, который так и не завершился, например из-за падения сервиса, может занять повтор (Lease),
+// и наибольший размер тела такого запроса (MaxBody)
+type IdempotencyConfig struct {
+	TTL     time.Duration `envconfig:"TTL" default:"24h"`
+	Lease   time.Duration `envconfig:"LEASE" default:"5m"`
+	MaxBody int64         `envconfig:"MAX_BODY" default:"1048576"`
+}
+
+func (c IdempotencyConfig) Validate() error {
+	switch {
+	case c.TTL <= 0 || c.Lease <= 0:
+		return errors.New("idempotency TTL and lease must be positive")
+	case c.Lease > c.TTL:
+		return errors.New("idempotency lease must not exceed TTL")
+	case c.MaxBody < 1:
+		return errors.New("idempotency max body must be at least 1")
+	}
+
+	return nil
+}
+
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(key, fingerprint string, reservedAt, expiredBefore, leaseExpiredBefore time.Time) (*models.IdempotencyRecord, bool, error)
+	CompleteIdempotencyKey(key string, reservedAt time.Time, statusCode int, contentType string, body []byte) error
+	ReleaseIdempotencyKey(key string, reservedAt time.Time) error
+	PurgeIdempotencyKeys(before time.Time) (int, error)
+}
+
+// IdempotencyMiddleware сохраняет ответы на изменяющие запросы с заголовком Idempotency-Key. Повтор запроса
+// с тем же ключом в течение TTL возвращает сохраненный ответ, тот же ключ с другим запросом отклоняется с кодом 422.
+// Ответы с кодом 5xx не сохраняются, чтобы запрос можно было повторить. Тело запроса читается в память целиком,
+// поэтому middleware подключается только к маршрутам с небольшим JSON-телом, а не к потоковым загрузкам.
+func IdempotencyMiddleware(store IdempotencyStore, cfg IdempotencyConfig, log *zap.SugaredLogger) mux.MiddlewareFunc {
+	log = log.With(zap.String("comp", "idempotency middleware"))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > maxIdempotencyKeyLength {
+				writeError(w, http.StatusBadRequest, "Слишком длинный ключ идемпотентности")
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBody))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					writeError(w, http.StatusRequestEntityTooLarge, "Слишком большое тело запроса с ключом идемпотентности")
+					return
+				}
+
+				writeError(w, http.StatusBadRequest, "Некорректные входные данные")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			// время резервирования служит токеном: ответ сохраняется, только если ключ не занял повтор после
+			// истечения Lease. Точность снижается до микросекунд, с которой время хранит PostgreSQL.
+			now := time.Now().Truncate(time.Microsecond)
+			fingerprint := requestFingerprint(r, body)
+			record, reserved, err := store.ReserveIdempotencyKey(key, fingerprint, now, now.Add(-cfg.TTL), now.Add(-cfg.Lease))
+			if err != nil {
+				log.Errorf("Error while reserving idempotency key: %v", err)
+				writeError(w, http.StatusInternalServerError, "Возникла внутренняя ошибка при проверке ключа идемпотентности")
+				return
+			}
+
+			if !reserved {
+				switch {
+				case record.Fingerprint != fingerprint:
+					writeError(w, http.StatusUnprocessableEntity, "Ключ идемпотентности уже использован для другого запроса")
+				case !record.StatusCode.Valid:
+					writeError(w, http.StatusConflict, "Запрос с этим ключом идемпотентности еще выполняется")
+				default:
+					if record.ContentType.Valid {
+						w.Header().Set("Content-Type", record.ContentType.String)
+					}
+					w.Header().Set(IdempotentReplayedHeader, "true")
+					w.WriteHeader(int(record.StatusCode.Int64))
+					_, _ = w.Write(record.ResponseBody)
+				}
+
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+
+			status := recorder.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			if status >= http.StatusInternalServerError {
+				err = store.ReleaseIdempotencyKey(key, now)
+			} else {
+				err = store.CompleteIdempotencyKey(key, now, status, w.Header().Get("Content-Type"), recorder.body.Bytes())
+			}
+			if err != nil {
+				log.Errorf("Error while saving idempotency key: %v", err)
+			}
+		})
+	}
+}
+
+// PurgeIdempotencyKeys раз в час удаляет ключи идемпотентности старше TTL, пока не отменен ctx
+func PurgeIdempotencyKeys(ctx context.Context, store IdempotencyStore, cfg IdempotencyConfig, log *zap.SugaredLogger) {
+	log = log.With(zap.String("comp", "idempotency purge"))
+
+	ticker := time.NewTicker(idempotencyPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := store.PurgeIdempotencyKeys(time.Now().Add(-cfg.TTL))
+		if err != nil {
+			log.Errorf("Error while purging idempotency keys: %v", err)
+		} else if purged > 0 {
+			log.Infof("Purged %d idempotency keys", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// requestFingerprint вычисляет отпечаток запроса по методу, пути и телу
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method))
+	hash.Write([]byte{0})
+	hash.Write([]byte(r.URL.RequestURI()))
+	hash.Write([]byte{0})
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder передает ответ клиенту, одновременно сохраняя код и тело ответа
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	errorDto := &dto.ErrorDto{
+		Error: message,
+	}
+	err := json.NewEncoder(w).Encode(errorDto)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+// dryRunParam читает параметр dry_run: при пробном запуске изменения проверяются, но не записываются в БД
+func dryRunParam(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("dry_run")
+	if value == "" {
+		return false, nil
+	}
+
+	return strconv.ParseBool(value)
+}
+
+type UserResolver interface {
+	ResolveUserId(key string) (int, error)
+}
+
+// userIdParam возвращает внутренний идентификатор пользователя из параметра пути {userId}, в котором может быть
+// передан как числовой идентификатор, так и внешний. При ошибке ответ записывается в w и возвращается false.
+func userIdParam(w http.ResponseWriter, r *http.Request, resolver UserResolver) (int, bool) {
+	return resolveUserId(w, resolver, mux.Vars(r)["userId"])
+}
+
+// resolveUserId возвращает внутренний идентификатор пользователя по числовому или внешнему идентификатору key.
+// При ошибке ответ записывается в w и возвращается false.
+func resolveUserId(w http.ResponseWriter, resolver UserResolver, key string) (int, bool) {
+	userId, err := resolver.ResolveUserId(key)
+	if err == nil {
+		return userId, true
+	}
+
+	status, message := http.StatusInternalServerError, "Возникла внутренняя ошибка при запросе пользователя"
+	switch {
+	case errors.Is(err, repositories.ErrMalformedUserId):
+		status, message = http.StatusBadRequest, "Некорректный идентификатор пользователя"
+	case errors.Is(err, repositories.ErrRecordNotFound):
+		status, message = http.StatusNotFound, "Пользователь с таким идентификатором не найден"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	errorDto := &dto.ErrorDto{
+		Error: message,
+	}
+	err = json.NewEncoder(w).Encode(errorDto)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	return 0, false
+}
+
+// timeParam читает обязательный параметр строки запроса с моментом времени в формате RFC 3339
+func timeParam(r *http.Request, name string) (time.Time, error) {
+	return time.Parse(time.RFC3339, r.URL.Query().Get(name))
+}
+
+// курсор скрывает от клиента идентификатор последнего элемента страницы, чтобы формат можно было поменять
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+func decodeCursor(cursor string) (int64, error) {
+	value, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errInvalidCursor
+	}
+
+	return id, nil
+}
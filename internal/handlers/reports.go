@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/blob"
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+	"github.com/TinyMarcus/avito-tech-task/internal/report"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+type ReportsHandler struct {
+	repository ReportJobRepository
+	runner     ReportRunner
+	store      BlobStore
+	users      UserResolver
+	formatters *report.Formatters
+}
+
+func NewReportsHandler(r ReportJobRepository, runner ReportRunner, store BlobStore, users UserResolver,
+	formatters *report.Formatters) *ReportsHandler {
+	return &ReportsHandler{
+		repository: r,
+		runner:     runner,
+		store:      store,
+		users:      users,
+		formatters: formatters,
+	}
+}
+
+type ReportJobRepository interface {
+	CreateReportJob(job *models.ReportJob) (*models.ReportJob, error)
+	GetReportJob(id string) (*models.ReportJob, error)
+}
+
+type ReportRunner interface {
+	Notify()
+}
+
+type BlobStore interface {
+	SignedURL(key string, download blob.Download) (string, time.Time, error)
+}
+
+// CreateReportHandler godoc
+//
+//	@Summary		Заказать отчет по истории
+//	@Description	Поставить в очередь формирование отчета по истории за период. Отчет формируется в фоне, статус и прогресс задания возвращает GET /api/v1/reports/{id}, а после завершения — и подписанную ссылку на скачивание файла
+//	@ID				create-report
+//	@Tags			history
+//	@Accept			json
+//	@Produce		json
+//	@Param			Report			body	dto.CreateReportDto	true	"Параметры отчета"
+//	@Param			Idempotency-Key	header	string	false	"Ключ идемпотентности для безопасного повтора запроса"
+//	@Success		202		{object}	dto.ReportJobDto		"Задание поставлено в очередь"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Пользователь с данным идентификатором не найден"
+//	@Failure		422		{object}	dto.ErrorDto			"Ключ идемпотентности уже использован для другого запроса"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/reports [post]
+func (h *ReportsHandler) CreateReportHandler(w http.ResponseWriter, r *http.Request) {
+	var createReport dto.CreateReportDto
+
+	w.Header().Add("Content-Type", "application/json")
+	err := json.NewDecoder(r.Body).Decode(&createReport)
+	if err != nil || !createReport.From.Before(createReport.To) {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректные входные данные",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	if createReport.Format == "" {
+		createReport.Format = "csv"
+	}
+	formatter, ok := h.formatters.Select(createReport.Format, "")
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Неподдерживаемый формат отчета",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	var userId int
+	if createReport.UserId != "" {
+		if userId, ok = resolveUserId(w, h.users, createReport.UserId); !ok {
+			return
+		}
+	}
+
+	job, err := h.repository.CreateReportJob(&models.ReportJob{
+		Format: formatter.Name(),
+		UserId: userId,
+		Slug:   createReport.Slug,
+		From:   createReport.From,
+		To:     createReport.To,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorDto := &dto.ErrorDto{
+			Error: "Возникла внутренняя ошибка при создании задания на отчет",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	h.runner.Notify()
+
+	w.Header().Set("Location", "/api/v1/reports/"+job.Id)
+	w.WriteHeader(http.StatusAccepted)
+	err = json.NewEncoder(w).Encode(dto.ConvertReportJobToReportJobDto(job))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// GetReportHandler godoc
+//
+//	@Summary		Получить задание на отчет
+//	@Description	Получить статус и прогресс формирования отчета. Для готового отчета возвращается подписанная ссылка на скачивание с ограниченным сроком действия; при каждом запросе выдается новая ссылка
+//	@ID				get-report
+//	@Tags			history
+//	@Produce		json
+//	@Param			id		path		string					true	"Идентификатор задания"
+//	@Success		200		{object}	dto.ReportJobDto		"Задание успешно получено"
+//	@Failure		404		{object}	dto.ErrorDto			"Задание с данным идентификатором не найдено"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/reports/{id} [get]
+func (h *ReportsHandler) GetReportHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	w.Header().Add("Content-Type", "application/json")
+	job, err := h.repository.GetReportJob(id)
+	if err != nil {
+		switch err {
+		case repositories.ErrRecordNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			errorDto := &dto.ErrorDto{
+				Error: "Задание на отчет с таким идентификатором не найдено",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			errorDto := &dto.ErrorDto{
+				Error: "Возникла внутренняя ошибка при запросе задания на отчет",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+
+		return
+	}
+
+	jobDto := dto.ConvertReportJobToReportJobDto(job)
+	formatter, ok := h.formatters.Select(job.Format, "")
+	if job.Status == repositories.ReportJobDone && job.BlobKey.Valid && ok {
+		downloadUrl, expiresAt, err := h.store.SignedURL(job.BlobKey.String, blob.Download{
+			Filename:    report.Filename(job.From, job.To, formatter),
+			ContentType: formatter.ContentType(),
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			errorDto := &dto.ErrorDto{
+				Error: "Возникла внутренняя ошибка при формировании ссылки на отчет",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			return
+		}
+
+		jobDto.DownloadUrl = downloadUrl
+		jobDto.DownloadExpiresAt = &expiresAt
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(jobDto)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+	"github.com/TinyMarcus/avito-tech-task/internal/rollout"
+)
+
+type RolloutsHandler struct {
+	repository RolloutRepository
+	scheduler  RolloutScheduler
+}
+
+func NewRolloutsHandler(r RolloutRepository, s RolloutScheduler) *RolloutsHandler {
+	return &RolloutsHandler{
+		repository: r,
+		scheduler:  s,
+	}
+}
+
+type RolloutRepository interface {
+	GetRollout(slug string) (*models.Rollout, error)
+	SetRolloutSchedule(slug string, steps []*models.RolloutStep) error
+	SetRolloutPaused(slug string, paused bool) error
+}
+
+type RolloutScheduler interface {
+	Rollback(slug string) (*models.Rollout, error)
+}
+
+// GetRolloutHandler godoc
+//
+//	@Summary		Получить расписание раскатывания
+//	@Description	Получить расписание постепенного раскатывания сегмента и его текущее состояние
+//	@ID				get-rollout
+//	@Tags			rollouts
+//	@Accept			json
+//	@Produce		json
+//	@Param			slug	path		string					true	"Название сегмента"
+//	@Success		200		{object}	dto.RolloutDto			"Расписание успешно получено"
+//	@Failure		404		{object}	dto.ErrorDto			"Расписание для данного сегмента не найдено"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/segments/{slug}/rollout [get]
+func (h *RolloutsHandler) GetRolloutHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	slug := params["slug"]
+
+	w.Header().Add("Content-Type", "application/json")
+	h.writeRollout(w, slug)
+}
+
+func (h *RolloutsHandler) writeRollout(w http.ResponseWriter, slug string) {
+	rollout, err := h.repository.GetRollout(slug)
+	if err != nil {
+		switch err {
+		case repositories.ErrRecordNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			errorDto := &dto.ErrorDto{
+				Error: "Расписание раскатывания для сегмента с таким названием не найдено",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			errorDto := &dto.ErrorDto{
+				Error: "Возникла внутренняя ошибка при запросе расписания раскатывания",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(dto.ConvertRolloutToRolloutDto(rollout))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// SetRolloutHandler godoc
+//
+//		@Summary		Задать расписание раскатывания
+//		@Description	Задать расписание постепенного повышения процента пользователей, автоматически добавляемых в сегмент. Предыдущее расписание сегмента заменяется
+//		@ID				set-rollout
+//		@Tags			rollouts
+//		@Accept			json
+//		@Produce		json
+//		@Param			slug	path		string					true	"Название сегмента"
+//	 	@Param			Расписание	body	dto.SetRolloutDto	    true	"Шаги расписания"
+//		@Success		200		{object}	dto.RolloutDto			"Расписание успешно задано"
+//		@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//		@Failure		404		{object}	dto.ErrorDto			"Сегмент с данным названием не найден"
+//		@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//		@Router			/api/v1/segments/{slug}/rollout [put]
+func (h *RolloutsHandler) SetRolloutHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	slug := params["slug"]
+
+	var schedule dto.SetRolloutDto
+
+	w.Header().Add("Content-Type", "application/json")
+	err := json.NewDecoder(r.Body).Decode(&schedule)
+	if err != nil || !validRolloutSteps(schedule.Steps) {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректные входные данные: шаги должны идти по возрастанию процента и времени, процент — от 0 до 100",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	var steps []*models.RolloutStep
+	for i, val := range schedule.Steps {
+		steps = append(steps, &models.RolloutStep{
+			Slug:    slug,
+			Step:    i,
+			Percent: val.Percent,
+			StartAt: val.StartAt,
+		})
+	}
+
+	err = h.repository.SetRolloutSchedule(slug, steps)
+	if err != nil {
+		switch err {
+		case repositories.ErrRecordNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			errorDto := &dto.ErrorDto{
+				Error: "Запись с таким названием в таблице сегментов не найдена",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			errorDto := &dto.ErrorDto{
+				Error: "Возникла внутренняя ошибка при сохранении расписания раскатывания",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+
+		return
+	}
+
+	h.writeRollout(w, slug)
+}
+
+// PauseRolloutHandler godoc
+//
+//	@Summary		Приостановить раскатывание
+//	@Description	Приостановить применение шагов расписания раскатывания сегмента
+//	@ID				pause-rollout
+//	@Tags			rollouts
+//	@Accept			json
+//	@Produce		json
+//	@Param			slug	path		string					true	"Название сегмента"
+//	@Success		200		{object}	dto.RolloutDto			"Расписание успешно приостановлено"
+//	@Failure		404		{object}	dto.ErrorDto			"Расписание для данного сегмента не найдено"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/segments/{slug}/rollout/pause [post]
+func (h *RolloutsHandler) PauseRolloutHandler(w http.ResponseWriter, r *http.Request) {
+	h.setPaused(w, r, true)
+}
+
+// ResumeRolloutHandler godoc
+//
+//	@Summary		Возобновить раскатывание
+//	@Description	Возобновить применение шагов расписания раскатывания сегмента
+//	@ID				resume-rollout
+//	@Tags			rollouts
+//	@Accept			json
+//	@Produce		json
+//	@Param			slug	path		string					true	"Название сегмента"
+//	@Success		200		{object}	dto.RolloutDto			"Расписание успешно возобновлено"
+//	@Failure		404		{object}	dto.ErrorDto			"Расписание для данного сегмента не найдено"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/segments/{slug}/rollout/resume [post]
+func (h *RolloutsHandler) ResumeRolloutHandler(w http.ResponseWriter, r *http.Request) {
+	h.setPaused(w, r, false)
+}
+
+func (h *RolloutsHandler) setPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	params := mux.Vars(r)
+	slug := params["slug"]
+
+	err := h.repository.SetRolloutPaused(slug, paused)
+	if err != nil {
+		w.Header().Add("Content-Type", "application/json")
+		switch err {
+		case repositories.ErrRecordNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			errorDto := &dto.ErrorDto{
+				Error: "Расписание раскатывания для сегмента с таким названием не найдено",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			errorDto := &dto.ErrorDto{
+				Error: "Возникла внутренняя ошибка при изменении расписания раскатывания",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	h.writeRollout(w, slug)
+}
+
+// RollbackRolloutHandler godoc
+//
+//	@Summary		Откатить раскатывание
+//	@Description	Вернуть сегмент на предыдущий шаг расписания: автоматически добавленные пользователи, не попадающие в прежний процент, удаляются из сегмента, а расписание приостанавливается. Откаченный шаг и следующие за ним переносятся на ROLLOUT_ROLLBACK_DELAY после отката
+//	@ID				rollback-rollout
+//	@Tags			rollouts
+//	@Accept			json
+//	@Produce		json
+//	@Param			slug	path		string					true	"Название сегмента"
+//	@Success		200		{object}	dto.RolloutDto			"Расписание успешно откачено"
+//	@Failure		404		{object}	dto.ErrorDto			"Расписание для данного сегмента не найдено"
+//	@Failure		409		{object}	dto.ErrorDto			"Ни один шаг расписания еще не применен"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/segments/{slug}/rollout/rollback [post]
+func (h *RolloutsHandler) RollbackRolloutHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	slug := params["slug"]
+
+	rolledBack, err := h.scheduler.Rollback(slug)
+	w.Header().Add("Content-Type", "application/json")
+	if err != nil {
+		switch err {
+		case repositories.ErrRecordNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			errorDto := &dto.ErrorDto{
+				Error: "Расписание раскатывания для сегмента с таким названием не найдено",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		case rollout.ErrNothingToRollback:
+			w.WriteHeader(http.StatusConflict)
+			errorDto := &dto.ErrorDto{
+				Error: "Ни один шаг расписания раскатывания еще не применен",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			errorDto := &dto.ErrorDto{
+				Error: "Возникла внутренняя ошибка при откате расписания раскатывания",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(dto.ConvertRolloutToRolloutDto(rolledBack))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func validRolloutSteps(steps []dto.RolloutStepDto) bool {
+	if len(steps) == 0 {
+		return false
+	}
+
+	for i, val := range steps {
+		if val.Percent <= 0 || val.Percent > 100 || val.StartAt.IsZero() {
+			return false
+		}
+
+		if i > 0 && (val.Percent <= steps[i-1].Percent || !val.StartAt.After(steps[i-1].StartAt)) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,32 +1,113 @@
 package handlers
 
 import (
+	"net/http"
+
 	"github.com/gorilla/mux"
 	"github.com/swaggo/http-swagger"
 	"go.uber.org/zap"
 
 	_ "github.com/TinyMarcus/avito-tech-task/api"
 	"github.com/TinyMarcus/avito-tech-task/internal/handlers/middlewares"
+	"github.com/TinyMarcus/avito-tech-task/internal/report"
 )
 
-func Router(logger *zap.SugaredLogger, ur UserRepository, sr SegmentRepository) *mux.Router {
+func Router(logger *zap.SugaredLogger, ur UserRepository, sr SegmentRepository, ho Holdout,
+	rr RolloutRepository, rs RolloutScheduler, er EvaluationRepository, mr MembershipRepository, bc BatchConfig, im Importer,
+	hh HistoryReader, is middlewares.IdempotencyStore, ic middlewares.IdempotencyConfig,
+	rj ReportJobRepository, rn ReportRunner, bs BlobStore, ar AudienceRepository, wr WebhookRepository,
+	wd WebhookDispatcher, es EventRepository, eh EventSubscriber, sc StreamConfig) *mux.Router {
 	router := mux.NewRouter()
 	router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 	router.Use(middlewares.LoggerMiddleware(logger))
 
+	// ключ идемпотентности принимают изменяющие запросы с JSON-телом; потоковые загрузки участников и импорт
+	// не буферизуются целиком, поэтому middleware к ним не подключается
+	idempotent := idempotentHandler(middlewares.IdempotencyMiddleware(is, ic, logger))
+
 	segmentsHandler := NewSegmentsHandler(sr)
 	router.HandleFunc("/api/v1/segments", segmentsHandler.GetSegmentsHandler).Methods("GET")
 	router.HandleFunc("/api/v1/segments/{slug}", segmentsHandler.GetSegmentBySlugHandler).Methods("GET")
-	router.HandleFunc("/api/v1/segments", segmentsHandler.CreateSegmentHandler).Methods("POST")
-	router.HandleFunc("/api/v1/segments/{slug}", segmentsHandler.UpdateSegmentHandler).Methods("PUT")
-	router.HandleFunc("/api/v1/segments/{slug}", segmentsHandler.DeleteSegmentHandler).Methods("DELETE")
+	router.Handle("/api/v1/segments", idempotent(segmentsHandler.CreateSegmentHandler)).Methods("POST")
+	router.Handle("/api/v1/segments/{slug}", idempotent(segmentsHandler.UpdateSegmentHandler)).Methods("PUT")
+	router.Handle("/api/v1/segments/{slug}", idempotent(segmentsHandler.DeleteSegmentHandler)).Methods("DELETE")
+
+	membersHandler := NewMembersHandler(mr, bc)
+	router.HandleFunc("/api/v1/segments/{slug}/members:batchAdd", membersHandler.BatchAddMembersHandler).Methods("POST")
+	router.HandleFunc("/api/v1/segments/{slug}/members:batchRemove", membersHandler.BatchRemoveMembersHandler).Methods("POST")
+
+	rolloutsHandler := NewRolloutsHandler(rr, rs)
+	router.HandleFunc("/api/v1/segments/{slug}/rollout", rolloutsHandler.GetRolloutHandler).Methods("GET")
+	router.Handle("/api/v1/segments/{slug}/rollout", idempotent(rolloutsHandler.SetRolloutHandler)).Methods("PUT")
+	router.Handle("/api/v1/segments/{slug}/rollout/pause", idempotent(rolloutsHandler.PauseRolloutHandler)).Methods("POST")
+	router.Handle("/api/v1/segments/{slug}/rollout/resume", idempotent(rolloutsHandler.ResumeRolloutHandler)).Methods("POST")
+	router.Handle("/api/v1/segments/{slug}/rollout/rollback", idempotent(rolloutsHandler.RollbackRolloutHandler)).Methods("POST")
 
-	usersHandler := NewUsersHandler(ur)
+	usersHandler := NewUsersHandler(ur, bc)
 	router.HandleFunc("/api/v1/users", usersHandler.GetUsersHandler).Methods("GET")
 	router.HandleFunc("/api/v1/users/{userId}", usersHandler.GetUserByIdHandler).Methods("GET")
-	router.HandleFunc("/api/v1/users", usersHandler.CreateUserHandler).Methods("POST")
-	router.HandleFunc("/api/v1/users/{userId}/changeSegmentsOfUser", usersHandler.ChangeSegmentsOfUserHandler).Methods("POST")
+	router.Handle("/api/v1/users", idempotent(usersHandler.CreateUserHandler)).Methods("POST")
+	router.HandleFunc("/api/v1/users/active:batchGet", usersHandler.BatchGetActiveSegmentsHandler).Methods("POST")
+	router.Handle("/api/v1/users/{userId}", idempotent(usersHandler.UpdateUserHandler)).Methods("PATCH")
+	router.Handle("/api/v1/users/{userId}", idempotent(usersHandler.DeleteUserHandler)).Methods("DELETE")
+	router.Handle("/api/v1/users/{userId}/changeSegmentsOfUser", idempotent(usersHandler.ChangeSegmentsOfUserHandler)).Methods("POST")
+	router.Handle("/api/v1/users/{userId}/segments", idempotent(usersHandler.SetSegmentsOfUserHandler)).Methods("PUT")
+	router.HandleFunc("/api/v1/users/{userId}/export", usersHandler.ExportUserHandler).Methods("GET")
 	router.HandleFunc("/api/v1/users/{userId}/active", usersHandler.GetActiveSegmentsOfUser).Methods("GET")
+	router.Handle("/api/v1/users/{userId}/attributes", idempotent(usersHandler.SetUserAttributesHandler)).Methods("PUT")
+	router.HandleFunc("/api/v1/users/{userId}/segments/{slug}/explain", usersHandler.ExplainSegmentOfUserHandler).Methods("GET")
+
+	streamHandler := NewStreamHandler(es, eh, ur, sc)
+	router.HandleFunc("/api/v1/users/{userId}/segments/stream", streamHandler.StreamSegmentsOfUserHandler).Methods("GET")
+
+	formatters := report.Default()
+	historyHandler := NewHistoryHandler(hh, ur, formatters)
+	router.HandleFunc("/api/v1/users/{userId}/segments", historyHandler.GetSegmentsOfUserAsOfHandler).Methods("GET")
+	router.HandleFunc("/api/v1/segments/{slug}/users", historyHandler.GetUsersOfSegmentAsOfHandler).Methods("GET")
+	router.HandleFunc("/api/v1/segments/{slug}/diff", historyHandler.GetSegmentDiffHandler).Methods("GET")
+	router.HandleFunc("/api/v1/segments/{slug}/analytics", historyHandler.GetSegmentAnalyticsHandler).Methods("GET")
+	router.HandleFunc("/api/v1/history", historyHandler.GetHistoryHandler).Methods("GET")
+	router.HandleFunc("/api/v1/history/report", historyHandler.GetHistoryReportHandler).Methods("GET")
+
+	reportsHandler := NewReportsHandler(rj, rn, bs, ur, formatters)
+	router.Handle("/api/v1/reports", idempotent(reportsHandler.CreateReportHandler)).Methods("POST")
+	router.HandleFunc("/api/v1/reports/{id}", reportsHandler.GetReportHandler).Methods("GET")
+
+	// локальное хранилище отдает файлы через сервис, S3-хранилище — само
+	if local, ok := bs.(LocalBlobStore); ok {
+		blobsHandler := NewBlobsHandler(local)
+		router.HandleFunc("/api/v1/blobs/{key:.+}", blobsHandler.DownloadBlobHandler).Methods("GET")
+	}
+
+	audiencesHandler := NewAudiencesHandler(ar)
+	router.HandleFunc("/api/v1/audiences/query", audiencesHandler.QueryAudienceHandler).Methods("POST")
+	router.HandleFunc("/api/v1/audiences/overlap", audiencesHandler.GetSegmentOverlapHandler).Methods("POST")
+
+	webhooksHandler := NewWebhooksHandler(wr, wd)
+	router.HandleFunc("/api/v1/webhooks", webhooksHandler.GetWebhooksHandler).Methods("GET")
+	router.Handle("/api/v1/webhooks", idempotent(webhooksHandler.CreateWebhookHandler)).Methods("POST")
+	router.HandleFunc("/api/v1/webhooks/{id}", webhooksHandler.GetWebhookHandler).Methods("GET")
+	router.Handle("/api/v1/webhooks/{id}", idempotent(webhooksHandler.UpdateWebhookHandler)).Methods("PUT")
+	router.Handle("/api/v1/webhooks/{id}", idempotent(webhooksHandler.DeleteWebhookHandler)).Methods("DELETE")
+	router.HandleFunc("/api/v1/webhooks/{id}/deliveries", webhooksHandler.GetWebhookDeliveriesHandler).Methods("GET")
+	router.Handle("/api/v1/webhooks/{id}/deliveries/{deliveryId}/redeliver",
+		idempotent(webhooksHandler.RedeliverWebhookDeliveryHandler)).Methods("POST")
+
+	importHandler := NewImportHandler(im)
+	router.HandleFunc("/api/v1/import", importHandler.ImportUsersHandler).Methods("POST")
+
+	evaluateHandler := NewEvaluateHandler(er)
+	router.HandleFunc("/api/v1/evaluate", evaluateHandler.EvaluateHandler).Methods("POST")
+
+	holdoutHandler := NewHoldoutHandler(ho, ur)
+	router.HandleFunc("/api/v1/holdout/users/{userId}", holdoutHandler.GetUserHoldoutHandler).Methods("GET")
 
 	return router
 }
+
+// idempotentHandler оборачивает обработчики маршрутов, принимающих ключ идемпотентности, в middleware
+func idempotentHandler(mw mux.MiddlewareFunc) func(http.HandlerFunc) http.Handler {
+	return func(handler http.HandlerFunc) http.Handler {
+		return mw(handler)
+	}
+}
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -9,6 +11,7 @@ import (
 	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
 	"github.com/TinyMarcus/avito-tech-task/internal/models"
 	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+	"github.com/TinyMarcus/avito-tech-task/internal/rules"
 )
 
 type SegmentsHandler struct {
@@ -25,8 +28,8 @@ func NewSegmentsHandler(r SegmentRepository) *SegmentsHandler {
 type SegmentRepository interface {
 	GetAllSegments() ([]*models.Segment, error)
 	GetSegmentBySlug(slug string) (*models.Segment, error)
-	CreateSegment(slug, description string) (string, error)
-	UpdateSegment(slug, description string) (*models.Segment, error)
+	CreateSegment(slug, description, layer, rule string) (string, error)
+	UpdateSegment(slug string, description, layer, rule *string) (*models.Segment, error)
 	DeleteSegment(slug string) (*models.Segment, error)
 }
 
@@ -138,8 +141,10 @@ func (h *SegmentsHandler) GetSegmentBySlugHandler(w http.ResponseWriter, r *http
 //		@Accept			json
 //		@Produce		json
 //	 	@Param			Segment 	body	dto.CreateOrUpdateSegmentDto	    true	"Информация о добавляемом сегменте"
+//		@Param			Idempotency-Key	header	string	false	"Ключ идемпотентности для безопасного повтора запроса"
 //		@Success		201		{object}	dto.CreateSegmentResponseDto		"Сегмент успешно создан"
 //		@Failure		400		{object}	dto.ErrorDto						"Некорректные входные данные"
+//		@Failure		422		{object}	dto.ErrorDto			"Ключ идемпотентности уже использован для другого запроса"
 //		@Failure		500	    {object}	dto.ErrorDto						"Возникла внутренняя ошибка сервера"
 //		@Router			/api/v1/segments [post]
 func (h *SegmentsHandler) CreateSegmentHandler(w http.ResponseWriter, r *http.Request) {
@@ -160,7 +165,22 @@ func (h *SegmentsHandler) CreateSegmentHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	slug, err := h.repository.CreateSegment(segment.Slug, segment.Description)
+	if segment.Rule != "" {
+		if _, err = rules.Parse(segment.Rule); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			errorDto := &dto.ErrorDto{
+				Error: fmt.Sprintf("Некорректное правило сегмента: %v", err),
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			return
+		}
+	}
+
+	slug, err := h.repository.CreateSegment(segment.Slug, segment.Description, segment.Layer, segment.Rule)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		errorDto := &dto.ErrorDto{
@@ -188,23 +208,24 @@ func (h *SegmentsHandler) CreateSegmentHandler(w http.ResponseWriter, r *http.Re
 // UpdateSegmentHandler godoc
 //
 //		@Summary		Обновить сегмент
-//		@Description	Обновить сегмент в БД
+//		@Description	Обновить в БД переданные поля сегмента. Перенос сегмента в слой отклоняется, если его участники уже состоят в других сегментах этого слоя
 //		@ID				update-segment
 //		@Tags			segments
 //		@Accept			json
 //		@Produce		json
 //		@Param			slug	path		string					true		"Название сегмента"
-//	 	@Param			Информация о сегменте	body	dto.CreateOrUpdateSegmentDto	    true	"Информация о добавляемом сегменте"
+//	 	@Param			Информация о сегменте	body	dto.UpdateSegmentDto	    true	"Изменяемые поля сегмента"
 //		@Success		200		{object}	dto.UpdateSegmentResponseDto		"Сегмент с данным названием успешно обновлен"
 //		@Failure		400		{object}	dto.ErrorDto						"Некорректные входные данные"
 //		@Failure		404		{object}	dto.ErrorDto						"Сегмент с данным названием не найден"
+//		@Failure		409		{object}	dto.ErrorDto						"Участники сегмента уже состоят в другом сегменте слоя"
 //		@Failure		500	    {object}	dto.ErrorDto						"Возникла внутренняя ошибка сервреа"
 //		@Router			/api/v1/segments/{slug} [put]
 func (h *SegmentsHandler) UpdateSegmentHandler(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	slug := params["slug"]
 
-	var segment dto.CreateOrUpdateSegmentDto
+	var segment dto.UpdateSegmentDto
 
 	w.Header().Add("Content-Type", "application/json")
 	err := json.NewDecoder(r.Body).Decode(&segment)
@@ -221,10 +242,26 @@ func (h *SegmentsHandler) UpdateSegmentHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	updated, err := h.repository.UpdateSegment(slug, segment.Description)
+	if segment.Rule != nil && *segment.Rule != "" {
+		if _, err = rules.Parse(*segment.Rule); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			errorDto := &dto.ErrorDto{
+				Error: fmt.Sprintf("Некорректное правило сегмента: %v", err),
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			return
+		}
+	}
+
+	updated, err := h.repository.UpdateSegment(slug, segment.Description, segment.Layer, segment.Rule)
 	if err != nil {
-		switch err {
-		case repositories.ErrRecordNotFound:
+		var layerConflict *repositories.LayerConflictError
+		switch {
+		case errors.Is(err, repositories.ErrRecordNotFound):
 			w.WriteHeader(http.StatusNotFound)
 			errorDto := &dto.ErrorDto{
 				Error: "Запись с таким названием в таблице сегментов не найдена",
@@ -233,6 +270,15 @@ func (h *SegmentsHandler) UpdateSegmentHandler(w http.ResponseWriter, r *http.Re
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 			}
+		case errors.As(err, &layerConflict):
+			w.WriteHeader(http.StatusConflict)
+			errorDto := &dto.ErrorDto{
+				Error: fmt.Sprintf("Участники сегмента уже состоят в сегменте %s из слоя %s", layerConflict.Slug, layerConflict.Layer),
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
 		default:
 			w.WriteHeader(http.StatusInternalServerError)
 			errorDto := &dto.ErrorDto{
@@ -251,6 +297,8 @@ func (h *SegmentsHandler) UpdateSegmentHandler(w http.ResponseWriter, r *http.Re
 		Id:          updated.Id,
 		Slug:        updated.Slug,
 		Description: updated.Description,
+		Layer:       updated.Layer.String,
+		Rule:        updated.Rule.String,
 	}
 
 	w.WriteHeader(http.StatusOK)
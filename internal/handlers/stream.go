@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+	"github.com/TinyMarcus/avito-tech-task/internal/stream"
+	"github.com/TinyMarcus/avito-tech-task/internal/webhook"
+)
+
+const (
+	streamBatch = 500
+	// через столько миллисекунд браузер переподключается к оборванному потоку
+	streamRetry = 3000
+)
+
+type StreamConfig struct {
+	Heartbeat time.Duration `envconfig:"HEARTBEAT" default:"15s"`
+}
+
+func (c StreamConfig) Validate() error {
+	if c.Heartbeat <= 0 {
+		return fmt.Errorf("stream heartbeat must be positive, got %s", c.Heartbeat)
+	}
+
+	return nil
+}
+
+type StreamHandler struct {
+	repository EventRepository
+	events     EventSubscriber
+	users      UserResolver
+	heartbeat  time.Duration
+}
+
+func NewStreamHandler(r EventRepository, events EventSubscriber, users UserResolver, cfg StreamConfig) *StreamHandler {
+	return &StreamHandler{
+		repository: r,
+		events:     events,
+		users:      users,
+		heartbeat:  cfg.Heartbeat,
+	}
+}
+
+type EventRepository interface {
+	GetStreamStart() (*models.EventPosition, error)
+	GetUserEvents(userId int, after *models.EventPosition, limit int) ([]*models.OutboxEvent, error)
+}
+
+type EventSubscriber interface {
+	Subscribe(userId int) (<-chan struct{}, func())
+}
+
+// StreamSegmentsOfUserHandler godoc
+//
+//	@Summary		Получить поток изменений сегментов пользователя
+//	@Description	Открыть поток Server-Sent Events с изменениями участия пользователя в сегментах: membership.added, membership.removed, membership.updated и membership.expired. Идентификатор SSE-события — позиция в потоке; при переподключении браузер передает его в заголовке Last-Event-ID, и поток продолжается с пропущенных событий. Без Last-Event-ID поток начинается с новых событий. Пока событий нет, раз в STREAM_HEARTBEAT отправляется комментарий, чтобы соединение не закрывали прокси
+//	@ID				stream-segments-of-user
+//	@Tags			users
+//	@Produce		text/event-stream
+//	@Param			userId			path		string					true	"Идентификатор пользователя (числовой или внешний)"
+//	@Param			Last-Event-ID	header		string					false	"Идентификатор последнего полученного SSE-события"
+//	@Success		200		{string}	string					"Поток событий"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Пользователь с данным идентификатором не найден"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/users/{userId}/segments/stream [get]
+func (h *StreamHandler) StreamSegmentsOfUserHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdParam(w, r, h.users)
+	if !ok {
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorDto := &dto.ErrorDto{
+			Error: "Потоковая передача не поддерживается",
+		}
+		err := json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	var after *models.EventPosition
+	lastEventId := r.Header.Get("Last-Event-ID")
+	var err error
+	if lastEventId != "" {
+		after, err = stream.DecodePosition(lastEventId)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			errorDto := &dto.ErrorDto{
+				Error: "Некорректный заголовок Last-Event-ID",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			return
+		}
+	}
+
+	// подписка оформляется до чтения начальной позиции, чтобы не пропустить события между ними
+	wake, unsubscribe := h.events.Subscribe(userId)
+	defer unsubscribe()
+
+	if lastEventId == "" {
+		after, err = h.repository.GetStreamStart()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			errorDto := &dto.ErrorDto{
+				Error: "Возникла внутренняя ошибка при открытии потока событий",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err = fmt.Fprintf(w, "retry: %d\n\n", streamRetry); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		// при ошибке поток закрывается, и клиент переподключается с Last-Event-ID
+		if after, err = h.writeEvents(w, userId, after); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		// события перечитываются и по таймеру: так поток не зависит от того, дошло ли уведомление
+		select {
+		case <-r.Context().Done():
+			return
+		case <-wake:
+		case <-heartbeat.C:
+			if _, err = fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeEvents записывает в поток все события пользователя после after и возвращает позицию последнего
+func (h *StreamHandler) writeEvents(w http.ResponseWriter, userId int, after *models.EventPosition) (*models.EventPosition, error) {
+	for {
+		events, err := h.repository.GetUserEvents(userId, after, streamBatch)
+		if err != nil {
+			return after, err
+		}
+
+		for _, event := range events {
+			data, err := json.Marshal(webhook.NewPayload(event))
+			if err != nil {
+				return after, err
+			}
+
+			position := &models.EventPosition{TransactionId: event.TransactionId, EventId: event.Id}
+			_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", stream.EncodePosition(position), event.Type, data)
+			if err != nil {
+				return after, err
+			}
+			after = position
+		}
+
+		if len(events) < streamBatch {
+			return after, nil
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+const (
+	exportFormatJson = "json"
+	exportFormatZip  = "zip"
+)
+
+// ExportUserHandler godoc
+//
+//	@Summary		Выгрузить данные пользователя
+//	@Description	Выгрузить все данные пользователя, хранящиеся в сервисе: сам пользователь, текущие и истекшие привязки к сегментам и полная история. По умолчанию возвращается JSON-документ, при format=zip — ZIP-архив с CSV-файлами user.csv, memberships.csv и history.csv
+//	@ID				export-user
+//	@Tags			users
+//	@Produce		json
+//	@Produce		application/zip
+//	@Param			userId	path		string					true	"Идентификатор пользователя"
+//	@Param			format	query		string					false	"Формат выгрузки"	Enums(json, zip)
+//	@Success		200		{object}	dto.UserExportDto		"Данные пользователя успешно выгружены"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Пользователь с данным идентификатором не найден"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/users/{userId}/export [get]
+func (h *UsersHandler) ExportUserHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormatJson
+	}
+
+	if format != exportFormatJson && format != exportFormatZip {
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректные входные данные",
+		}
+		err := json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	userId, ok := userIdParam(w, r, h.repository)
+	if !ok {
+		return
+	}
+
+	export, err := h.repository.ExportUser(userId)
+	if err != nil {
+		w.Header().Add("Content-Type", "application/json")
+		switch err {
+		case repositories.ErrRecordNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			errorDto := &dto.ErrorDto{
+				Error: "Пользователь с таким идентификатором не найден",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			errorDto := &dto.ErrorDto{
+				Error: "Возникла внутренняя ошибка при выгрузке данных пользователя",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+
+		return
+	}
+
+	exportDto := dto.ConvertUserExportToUserExportDto(export)
+	w.Header().Add("Content-Disposition", fmt.Sprintf("attachment; filename=\"user-%d-export.%s\"", userId, format))
+
+	if format == exportFormatZip {
+		w.Header().Add("Content-Type", "application/zip")
+		w.WriteHeader(http.StatusOK)
+		_ = writeUserExportZip(w, exportDto)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(exportDto)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// writeUserExportZip записывает выгрузку в виде ZIP-архива с отдельным CSV-файлом для каждой таблицы
+func writeUserExportZip(w io.Writer, export *dto.UserExportDto) error {
+	archive := zip.NewWriter(w)
+
+	attributes, err := json.Marshal(export.User.Attributes)
+	if err != nil {
+		return err
+	}
+
+	userRecords := [][]string{
+		{"id", "name", "attributes", "exported_at"},
+		{strconv.Itoa(export.User.Id), export.User.Name, string(attributes), export.ExportedAt},
+	}
+
+	membershipRecords := [][]string{{"slug", "deadline_date", "auto_enrolled", "active"}}
+	for _, membership := range export.Memberships {
+		membershipRecords = append(membershipRecords, []string{
+			membership.Slug,
+			membership.DeadlineDate,
+			strconv.FormatBool(membership.AutoEnrolled),
+			strconv.FormatBool(membership.Active),
+		})
+	}
+
+	historyRecords := [][]string{{"slug", "action_date", "operation_type"}}
+	for _, record := range export.History {
+		historyRecords = append(historyRecords, []string{record.Slug, record.ActionDate, record.OperationType})
+	}
+
+	files := []struct {
+		name    string
+		records [][]string
+	}{
+		{"user.csv", userRecords},
+		{"memberships.csv", membershipRecords},
+		{"history.csv", historyRecords},
+	}
+
+	for _, file := range files {
+		fileWriter, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+
+		if err = csv.NewWriter(fileWriter).WriteAll(file.records); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
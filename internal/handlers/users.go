@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"strconv"
 
 	"github.com/gorilla/mux"
 
+	"github.com/TinyMarcus/avito-tech-task/internal/evaluation"
 	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
 	"github.com/TinyMarcus/avito-tech-task/internal/models"
 	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
@@ -14,11 +17,13 @@ import (
 
 type UsersHandler struct {
 	repository UserRepository
+	readLimit  int
 }
 
-func NewUsersHandler(r UserRepository) *UsersHandler {
+func NewUsersHandler(r UserRepository, cfg BatchConfig) *UsersHandler {
 	return &UsersHandler{
 		repository: r,
+		readLimit:  cfg.ReadLimit,
 	}
 }
 
@@ -26,10 +31,17 @@ func NewUsersHandler(r UserRepository) *UsersHandler {
 type UserRepository interface {
 	GetAllUsers() ([]*models.User, error)
 	GetUserById(userId int) (*models.User, error)
-	CreateUser(name string) (int, error)
-	AddSegmentToUser(userId int, slug, ttl string) error
-	TakeSegmentFromUser(userId int, slug string) error
+	ResolveUserId(key string) (int, error)
+	CreateUser(name, externalId string, attributes models.Attributes) (int, error)
+	SetUserAttributes(userId int, attributes models.Attributes) error
+	UpdateUser(userId int, name, externalId *string, attributes models.Attributes) error
+	DeleteUser(userId int) (*models.UserErasure, error)
+	ExportUser(userId int) (*models.UserExport, error)
+	ChangeSegmentsOfUser(key string, add []*models.UserSegment, take []string, dryRun bool) (*models.SegmentChanges, error)
+	SetSegmentsOfUser(key string, segments []*models.UserSegment, dryRun bool) (*models.SegmentChanges, error)
 	GetActiveSegmentsOfUser(userId int) (*dto.UsersActiveSegments, error)
+	GetActiveSegmentsOfUsers(keys []string) ([]*dto.UsersActiveSegments, []string, error)
+	ExplainSegmentOfUser(userId int, slug string) (*evaluation.Explanation, error)
 }
 
 // GetUsersHandler godoc
@@ -84,15 +96,17 @@ func (h *UsersHandler) GetUsersHandler(w http.ResponseWriter, r *http.Request) {
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
-//	@Param			userId	path		int						true	"Идентификатор пользователя"
+//	@Param			userId	path		string						true	"Идентификатор пользователя (числовой или внешний)"
 //	@Success		200	    {object} 	dto.UserDto			"Пользователь с данным идентификатором успешно получен"
 //	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
 //	@Failure		404		{object}	dto.ErrorDto			"Пользователь с данным идентификатором не найден"
 //	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
 //	@Router			/api/v1/users/{userId} [get]
 func (h *UsersHandler) GetUserByIdHandler(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	userId, _ := strconv.Atoi(params["userId"])
+	userId, ok := userIdParam(w, r, h.repository)
+	if !ok {
+		return
+	}
 
 	user, err := h.repository.GetUserById(userId)
 	w.Header().Add("Content-Type", "application/json")
@@ -122,7 +136,7 @@ func (h *UsersHandler) GetUserByIdHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(user)
+	err = json.NewEncoder(w).Encode(dto.ConvertUserToUserDto(user))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -137,8 +151,11 @@ func (h *UsersHandler) GetUserByIdHandler(w http.ResponseWriter, r *http.Request
 //		@Accept			json
 //		@Produce		json
 //	 	@Param			User	body		dto.CreateUserDto	    true	"Информация о добавляемом пользователе"
+//		@Param			Idempotency-Key	header	string	false	"Ключ идемпотентности для безопасного повтора запроса"
 //		@Success		201		{object}	dto.CreateUserResponseDto						"Пользователь успешно создан"
 //		@Failure		400		{object}	dto.ErrorDto										"Некорректные входные данные"
+//		@Failure		409		{object}	dto.ErrorDto			"Пользователь с таким внешним идентификатором уже существует"
+//		@Failure		422		{object}	dto.ErrorDto			"Ключ идемпотентности уже использован для другого запроса"
 //		@Failure		500	    {object}	dto.ErrorDto										"Возникла внутренняя ошибка сервера"
 //		@Router			/api/v1/users [post]
 func (h *UsersHandler) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -146,7 +163,7 @@ func (h *UsersHandler) CreateUserHandler(w http.ResponseWriter, r *http.Request)
 
 	w.Header().Add("Content-Type", "application/json")
 	err := json.NewDecoder(r.Body).Decode(&user)
-	if err != nil {
+	if err != nil || (user.ExternalId != "" && !models.IsValidExternalId(user.ExternalId)) {
 		w.WriteHeader(http.StatusBadRequest)
 		errorDto := &dto.ErrorDto{
 			Error: "Некорректные входные данные",
@@ -159,11 +176,16 @@ func (h *UsersHandler) CreateUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	id, err := h.repository.CreateUser(user.Name)
+	id, err := h.repository.CreateUser(user.Name, user.ExternalId, user.Attributes)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		status, message := http.StatusInternalServerError, "Возникла внутренняя ошибка при создании пользователя"
+		if errors.Is(err, repositories.ErrRecordAlreadyExists) {
+			status, message = http.StatusConflict, "Пользователь с таким внешним идентификатором уже существует"
+		}
+
+		w.WriteHeader(status)
 		errorDto := &dto.ErrorDto{
-			Error: "Возникла внутренняя ошибка при создании пользователя",
+			Error: message,
 		}
 		err = json.NewEncoder(w).Encode(errorDto)
 		if err != nil {
@@ -187,26 +209,33 @@ func (h *UsersHandler) CreateUserHandler(w http.ResponseWriter, r *http.Request)
 // ChangeSegmentsOfUserHandler godoc
 //
 //		@Summary		Изменить сегменты пользователя
-//		@Description	Добавить и удалить у пользователя указанные сегменты
+//		@Description	Добавить и удалить у пользователя указанные сегменты. Изменения применяются в одной транзакции, при dry_run=true только возвращаются планируемые изменения и ошибки проверки
 //		@ID				change-segments-of-user
 //		@Tags			users
 //		@Accept			json
 //		@Produce		json
-//		@Param			userId	path		int						true	"Идентификатор пользователя"
+//		@Param			userId	path		string						true	"Идентификатор пользователя (числовой или внешний)"
+//		@Param			dry_run	query		bool					false	"Только проверить изменения, не применяя их"
 //	 	@Param			Информация о добавляемых и удаляемых сегментах	body	dto.ChangeUserSegmentsDto	    true	"Информация о добавляемых и удаляемых сегментах"
-//		@Success		200											"Сегменты пользователя успешно изменены"
+//		@Param			Idempotency-Key	header	string	false	"Ключ идемпотентности для безопасного повтора запроса"
+//		@Success		200		{object}	dto.UserSegmentsChangesDto	"Сегменты пользователя успешно изменены"
 //		@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
-//		@Failure		404		{object}	dto.ErrorDto			"Пользователь с данным идентификатором не найден"
+//		@Failure		404		{object}	dto.ErrorDto			"Пользователь или сегмент не найден"
+//		@Failure		409		{object}	dto.ErrorDto			"Пользователь уже состоит в другом сегменте того же слоя или входит в контрольную группу"
+//		@Failure		422		{object}	dto.ErrorDto			"Ключ идемпотентности уже использован для другого запроса"
 //		@Failure		500	    {object}	dto.ErrorDto			"Внутренняя ошибка сервера"
+//		@Failure		503	    {object}	dto.ErrorDto			"Сервис пользователей недоступен"
 //		@Router			/api/v1/users/{userId}/changeSegmentsOfUser [post]
 func (h *UsersHandler) ChangeSegmentsOfUserHandler(w http.ResponseWriter, r *http.Request) {
 	var userSegment dto.ChangeUserSegmentsDto
-	params := mux.Vars(r)
-	userId, _ := strconv.Atoi(params["userId"])
 
 	w.Header().Add("Content-Type", "application/json")
+	// пользователь ищется в репозитории, который может создать неизвестного пользователя
+	key := mux.Vars(r)["userId"]
+
 	err := json.NewDecoder(r.Body).Decode(&userSegment)
-	if err != nil {
+	dryRun, dryRunErr := dryRunParam(r)
+	if err != nil || dryRunErr != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		errorDto := &dto.ErrorDto{
 			Error: "Некорректные входные данные",
@@ -219,63 +248,122 @@ func (h *UsersHandler) ChangeSegmentsOfUserHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	for _, val := range userSegment.AddToUser {
-		err = h.repository.AddSegmentToUser(userId, val.Slug, val.DeadlineDate)
-		if err != nil {
-			switch err {
-			case repositories.ErrRecordNotFound:
-				w.WriteHeader(http.StatusNotFound)
-				errorDto := &dto.ErrorDto{
-					Error: "Пользователь с таким идентификатором не найден",
-				}
-				err = json.NewEncoder(w).Encode(errorDto)
-				if err != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-				}
-			default:
-				w.WriteHeader(http.StatusInternalServerError)
-				errorDto := &dto.ErrorDto{
-					Error: "Возникла внутренняя ошибка при добавлении новых сегментов пользователю",
-				}
-				err = json.NewEncoder(w).Encode(errorDto)
-				if err != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-				}
-			}
+	add := make([]*models.UserSegment, 0, len(userSegment.AddToUser))
+	for _, segment := range userSegment.AddToUser {
+		add = append(add, &models.UserSegment{
+			Slug:         segment.Slug,
+			DeadlineDate: sql.NullString{String: segment.DeadlineDate, Valid: segment.DeadlineDate != ""},
+		})
+	}
+
+	changes, err := h.repository.ChangeSegmentsOfUser(key, add, userSegment.TakeFromUser, dryRun)
+	writeSegmentChanges(w, dryRun, changes, err)
+}
+
+// SetSegmentsOfUserHandler godoc
+//
+//		@Summary		Задать сегменты пользователя
+//		@Description	Привести сегменты пользователя к переданному полному набору. Недостающие сегменты добавляются, лишние удаляются, у остальных обновляется дата отключения. Изменения применяются в одной транзакции, добавления и повторные активации записываются в историю как ADDING, удаления — как REMOVING, изменения даты отключения — как UPDATING. При dry_run=true только возвращаются планируемые изменения и ошибки проверки
+//		@ID				set-segments-of-user
+//		@Tags			users
+//		@Accept			json
+//		@Produce		json
+//		@Param			userId	path		string						true	"Идентификатор пользователя (числовой или внешний)"
+//		@Param			dry_run	query		bool					false	"Только проверить изменения, не применяя их"
+//	 	@Param			Сегменты	body	dto.SetUserSegmentsDto		true	"Полный набор сегментов пользователя"
+//		@Success		200		{object}	dto.UserSegmentsChangesDto	"Сегменты пользователя успешно заданы"
+//		@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//		@Failure		404		{object}	dto.ErrorDto			"Пользователь или сегмент не найден"
+//		@Failure		409		{object}	dto.ErrorDto			"Сегменты одного слоя или пользователь входит в контрольную группу"
+//		@Failure		500	    {object}	dto.ErrorDto			"Внутренняя ошибка сервера"
+//		@Failure		503	    {object}	dto.ErrorDto			"Сервис пользователей недоступен"
+//		@Router			/api/v1/users/{userId}/segments [put]
+func (h *UsersHandler) SetSegmentsOfUserHandler(w http.ResponseWriter, r *http.Request) {
+	var userSegments dto.SetUserSegmentsDto
 
-			return
+	w.Header().Add("Content-Type", "application/json")
+	key := mux.Vars(r)["userId"]
+
+	err := json.NewDecoder(r.Body).Decode(&userSegments)
+	dryRun, dryRunErr := dryRunParam(r)
+	if err != nil || dryRunErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректные входные данные",
 		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
 	}
 
-	for _, val := range userSegment.TakeFromUser {
-		err = h.repository.TakeSegmentFromUser(userId, val)
-		if err != nil {
-			switch err {
-			case repositories.ErrRecordNotFound:
-				w.WriteHeader(http.StatusNotFound)
-				errorDto := &dto.ErrorDto{
-					Error: "Пользователь с таким идентификатором не найден",
-				}
-				err = json.NewEncoder(w).Encode(errorDto)
-				if err != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-				}
-			default:
-				w.WriteHeader(http.StatusInternalServerError)
-				errorDto := &dto.ErrorDto{
-					Error: "Возникла внутренняя ошибка при удалении сегментов пользователя",
-				}
-				err = json.NewEncoder(w).Encode(errorDto)
-				if err != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-				}
-			}
+	segments := make([]*models.UserSegment, 0, len(userSegments.Segments))
+	for _, segment := range userSegments.Segments {
+		segments = append(segments, &models.UserSegment{
+			Slug:         segment.Slug,
+			DeadlineDate: sql.NullString{String: segment.DeadlineDate, Valid: segment.DeadlineDate != ""},
+		})
+	}
+
+	changes, err := h.repository.SetSegmentsOfUser(key, segments, dryRun)
+	writeSegmentChanges(w, dryRun, changes, err)
+}
 
-			return
+func writeSegmentChanges(w http.ResponseWriter, dryRun bool, changes *models.SegmentChanges, err error) {
+	if err != nil {
+		status, message := segmentChangeError(err)
+		w.WriteHeader(status)
+		errorDto := &dto.ErrorDto{
+			Error: message,
 		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	changesDto := dto.ConvertSegmentChangesToUserSegmentsChangesDto(changes.UserId, dryRun, changes)
+	for _, segmentError := range changes.Errors {
+		_, message := segmentChangeError(segmentError.Err)
+		changesDto.Errors = append(changesDto.Errors, &dto.SegmentErrorDto{
+			Slug:  segmentError.Slug,
+			Error: message,
+		})
 	}
 
 	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(changesDto)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func segmentChangeError(err error) (int, string) {
+	var layerConflict *repositories.LayerConflictError
+	switch {
+	case errors.Is(err, repositories.ErrMalformedUserId):
+		return http.StatusBadRequest, "Некорректный идентификатор пользователя"
+	case errors.Is(err, repositories.ErrRecordNotFound):
+		return http.StatusNotFound, "Пользователь с таким идентификатором не найден"
+	case errors.Is(err, repositories.ErrSegmentNotFound):
+		return http.StatusNotFound, "Сегмент с таким названием не найден"
+	case errors.Is(err, repositories.ErrUserDirectoryUnavailable):
+		return http.StatusServiceUnavailable, "Сервис пользователей недоступен, повторите запрос позже"
+	case errors.Is(err, repositories.ErrInvalidDeadline):
+		return http.StatusBadRequest, "Некорректная дата отключения от сегмента"
+	case errors.Is(err, repositories.ErrUserInHoldout):
+		return http.StatusConflict, "Пользователь входит в глобальную контрольную группу и не может быть добавлен в сегмент"
+	case errors.As(err, &layerConflict):
+		return http.StatusConflict, fmt.Sprintf("Пользователь уже состоит в сегменте %s из слоя %s", layerConflict.Slug, layerConflict.Layer)
+	case errors.Is(err, repositories.ErrLayerConflict):
+		return http.StatusConflict, "Пользователь уже состоит в другом сегменте того же слоя"
+	default:
+		return http.StatusInternalServerError, "Возникла внутренняя ошибка при изменении сегментов пользователя"
+	}
 }
 
 // GetActiveSegmentsOfUser godoc
@@ -286,14 +374,16 @@ func (h *UsersHandler) ChangeSegmentsOfUserHandler(w http.ResponseWriter, r *htt
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
-//	@Param			userId	path		int					true		"Идентификатор пользователя"
+//	@Param			userId	path		string					true		"Идентификатор пользователя (числовой или внешний)"
 //	@Success		200		{object}	dto.UsersActiveSegments		"Активные сегменты пользователя успешно получены"
 //	@Failure		404		{object}	dto.ErrorDto					"Пользователь с данным идентификатором не найден"
 //	@Failure		500	    {object}	dto.ErrorDto					"Возникла внутренняя ошибка сервера"
 //	@Router			/api/v1/users/{userId}/active [get]
 func (h *UsersHandler) GetActiveSegmentsOfUser(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	userId, _ := strconv.Atoi(params["userId"])
+	userId, ok := userIdParam(w, r, h.repository)
+	if !ok {
+		return
+	}
 
 	usersActiveSegments, err := h.repository.GetActiveSegmentsOfUser(userId)
 	w.Header().Add("Content-Type", "application/json")
@@ -328,3 +418,350 @@ func (h *UsersHandler) GetActiveSegmentsOfUser(w http.ResponseWriter, r *http.Re
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
+
+// BatchGetActiveSegmentsHandler godoc
+//
+//		@Summary		Получить активные сегменты нескольких пользователей
+//		@Description	Получить активные сегменты сразу для нескольких пользователей (не больше BATCH_READ_LIMIT) за один запрос к БД вместо отдельного запроса на каждого. Пользователи задаются числовыми или внешними идентификаторами и возвращаются в порядке идентификаторов в запросе, повторяющиеся пользователи учитываются один раз. Идентификаторы, пользователей с которыми нет в БД, и некорректные идентификаторы возвращаются отдельно
+//		@ID				batch-get-active-segments
+//		@Tags			users
+//		@Accept			json
+//		@Produce		json
+//	 	@Param			Пользователи	body	dto.BatchGetActiveSegmentsDto	true	"Идентификаторы пользователей"
+//		@Success		200		{object}	dto.BatchActiveSegmentsDto	"Активные сегменты пользователей успешно получены"
+//		@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные или слишком много пользователей"
+//		@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//		@Router			/api/v1/users/active:batchGet [post]
+func (h *UsersHandler) BatchGetActiveSegmentsHandler(w http.ResponseWriter, r *http.Request) {
+	var request dto.BatchGetActiveSegmentsDto
+
+	w.Header().Add("Content-Type", "application/json")
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || len(request.UserIds) > h.readLimit {
+		message := "Некорректные входные данные"
+		if err == nil {
+			message = fmt.Sprintf("В запросе может быть не больше %d пользователей", h.readLimit)
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: message,
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	keys := make([]string, 0, len(request.UserIds))
+	for _, key := range request.UserIds {
+		keys = append(keys, string(key))
+	}
+
+	users, unknown, err := h.repository.GetActiveSegmentsOfUsers(keys)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorDto := &dto.ErrorDto{
+			Error: "Возникла внутренняя ошибка при запросе активных сегментов пользователей",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(&dto.BatchActiveSegmentsDto{
+		Users:          users,
+		UnknownUserIds: unknown,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// SetUserAttributesHandler godoc
+//
+//		@Summary		Изменить атрибуты пользователя
+//		@Description	Заменить атрибуты пользователя, по которым вычисляются правила таргетинга сегментов
+//		@ID				set-user-attributes
+//		@Tags			users
+//		@Accept			json
+//		@Produce		json
+//		@Param			userId	path		string						true	"Идентификатор пользователя (числовой или внешний)"
+//	 	@Param			Атрибуты	body	dto.SetUserAttributesDto	    true	"Атрибуты пользователя"
+//		@Success		204											"Атрибуты пользователя успешно изменены"
+//		@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//		@Failure		404		{object}	dto.ErrorDto			"Пользователь с данным идентификатором не найден"
+//		@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//		@Router			/api/v1/users/{userId}/attributes [put]
+func (h *UsersHandler) SetUserAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	var attributes dto.SetUserAttributesDto
+
+	userId, ok := userIdParam(w, r, h.repository)
+	if !ok {
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&attributes)
+
+	if err != nil {
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректные входные данные",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	err = h.repository.SetUserAttributes(userId, attributes.Attributes)
+	if err != nil {
+		w.Header().Add("Content-Type", "application/json")
+		switch err {
+		case repositories.ErrRecordNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			errorDto := &dto.ErrorDto{
+				Error: "Пользователь с таким идентификатором не найден",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			errorDto := &dto.ErrorDto{
+				Error: "Возникла внутренняя ошибка при изменении атрибутов пользователя",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateUserHandler godoc
+//
+//		@Summary		Изменить пользователя
+//		@Description	Изменить имя, внешний идентификатор и (или) атрибуты пользователя. Поля, отсутствующие в запросе, не меняются
+//		@ID				update-user
+//		@Tags			users
+//		@Accept			json
+//		@Produce		json
+//		@Param			userId	path		string						true	"Идентификатор пользователя (числовой или внешний)"
+//	 	@Param			User	body		dto.UpdateUserDto	    true	"Изменяемые поля пользователя"
+//		@Success		200		{object}	dto.UserDto				"Пользователь успешно изменен"
+//		@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//		@Failure		404		{object}	dto.ErrorDto			"Пользователь с данным идентификатором не найден"
+//		@Failure		409		{object}	dto.ErrorDto			"Пользователь с таким внешним идентификатором уже существует или состоит в сегментах"
+//		@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//		@Router			/api/v1/users/{userId} [patch]
+func (h *UsersHandler) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var updateUserDto dto.UpdateUserDto
+
+	w.Header().Add("Content-Type", "application/json")
+	userId, ok := userIdParam(w, r, h.repository)
+	if !ok {
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&updateUserDto)
+	externalId := updateUserDto.ExternalId
+	if err != nil || (externalId != nil && *externalId != "" && !models.IsValidExternalId(*externalId)) {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректные входные данные",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	err = h.repository.UpdateUser(userId, updateUserDto.Name, externalId, updateUserDto.Attributes)
+	var user *models.User
+	if err == nil {
+		user, err = h.repository.GetUserById(userId)
+	}
+
+	if err != nil {
+		switch err {
+		case repositories.ErrRecordNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			errorDto := &dto.ErrorDto{
+				Error: "Пользователь с таким идентификатором не найден",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		case repositories.ErrRecordAlreadyExists:
+			w.WriteHeader(http.StatusConflict)
+			errorDto := &dto.ErrorDto{
+				Error: "Пользователь с таким внешним идентификатором уже существует",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		case repositories.ErrExternalIdInUse:
+			w.WriteHeader(http.StatusConflict)
+			errorDto := &dto.ErrorDto{
+				Error: "Нельзя изменить внешний идентификатор пользователя, состоящего в сегментах",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			errorDto := &dto.ErrorDto{
+				Error: "Возникла внутренняя ошибка при изменении пользователя",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(dto.ConvertUserToUserDto(user))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// DeleteUserHandler godoc
+//
+//	@Summary		Удалить пользователя
+//	@Description	Удалить пользователя по запросу на удаление данных: завершить все его привязки к сегментам, удалить или псевдонимизировать его историю (в зависимости от ERASURE_HISTORY_MODE) и сохранить запись об удалении
+//	@ID				delete-user
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userId	path		string						true	"Идентификатор пользователя (числовой или внешний)"
+//	@Success		204												"Пользователь успешно удален"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Пользователь с данным идентификатором не найден"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/users/{userId} [delete]
+func (h *UsersHandler) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdParam(w, r, h.repository)
+	if !ok {
+		return
+	}
+
+	_, err := h.repository.DeleteUser(userId)
+	if err != nil {
+		w.Header().Add("Content-Type", "application/json")
+		switch err {
+		case repositories.ErrRecordNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			errorDto := &dto.ErrorDto{
+				Error: "Пользователь с таким идентификатором не найден",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			errorDto := &dto.ErrorDto{
+				Error: "Возникла внутренняя ошибка при удалении пользователя",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExplainSegmentOfUserHandler godoc
+//
+//	@Summary		Объяснить принадлежность к сегменту
+//	@Description	Объяснить, почему пользователь попал или не попал в сегмент: явная привязка, контрольная группа, слой и результат вычисления правила таргетинга по условиям
+//	@ID				explain-segment-of-user
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userId	path		string							true	"Идентификатор пользователя (числовой или внешний)"
+//	@Param			slug	path		string						true	"Название сегмента"
+//	@Success		200		{object}	dto.SegmentExplanationDto	"Объяснение успешно получено"
+//	@Failure		400		{object}	dto.ErrorDto				"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto				"Пользователь или сегмент не найден"
+//	@Failure		500	    {object}	dto.ErrorDto				"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/users/{userId}/segments/{slug}/explain [get]
+func (h *UsersHandler) ExplainSegmentOfUserHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	slug := params["slug"]
+
+	w.Header().Add("Content-Type", "application/json")
+	userId, ok := userIdParam(w, r, h.repository)
+	if !ok {
+		return
+	}
+
+	explanation, err := h.repository.ExplainSegmentOfUser(userId, slug)
+	if err != nil {
+		switch err {
+		case repositories.ErrRecordNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			errorDto := &dto.ErrorDto{
+				Error: "Пользователь с таким идентификатором не найден",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		case repositories.ErrSegmentNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			errorDto := &dto.ErrorDto{
+				Error: "Запись с таким названием в таблице сегментов не найдена",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			errorDto := &dto.ErrorDto{
+				Error: "Возникла внутренняя ошибка при вычислении сегмента пользователя",
+			}
+			err = json.NewEncoder(w).Encode(errorDto)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(dto.ConvertExplanationToSegmentExplanationDto(userId, slug, explanation))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
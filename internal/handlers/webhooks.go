@@ -0,0 +1,488 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+const (
+	defaultDeliveriesLimit = 100
+	maxDeliveriesLimit     = 1000
+)
+
+type WebhooksHandler struct {
+	repository WebhookRepository
+	dispatcher WebhookDispatcher
+}
+
+func NewWebhooksHandler(r WebhookRepository, d WebhookDispatcher) *WebhooksHandler {
+	return &WebhooksHandler{
+		repository: r,
+		dispatcher: d,
+	}
+}
+
+type WebhookRepository interface {
+	GetWebhooks() ([]*models.Webhook, error)
+	GetWebhook(id int) (*models.Webhook, error)
+	CreateWebhook(webhook *models.Webhook) (*models.Webhook, error)
+	UpdateWebhook(webhook *models.Webhook) (*models.Webhook, error)
+	DeleteWebhook(id int) error
+	GetWebhookDeliveries(webhookId int, status string, after int64, limit int) ([]*models.WebhookDelivery, error)
+	RedeliverWebhookDelivery(webhookId int, id int64) (*models.WebhookDelivery, error)
+}
+
+type WebhookDispatcher interface {
+	Notify()
+}
+
+// GetWebhooksHandler godoc
+//
+//	@Summary		Получить подписки на события
+//	@Description	Получить все подписки на события об изменении участия в сегментах. Секреты подписок не возвращаются
+//	@ID				get-webhooks
+//	@Tags			webhooks
+//	@Produce		json
+//	@Success		200		{array}		dto.WebhookDto			"Подписки успешно получены"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/webhooks [get]
+func (h *WebhooksHandler) GetWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.repository.GetWebhooks()
+
+	w.Header().Add("Content-Type", "application/json")
+	if err != nil {
+		writeWebhookError(w, err, "Возникла внутренняя ошибка при запросе подписок")
+		return
+	}
+
+	webhookDtos := []*dto.WebhookDto{}
+	for _, webhook := range webhooks {
+		webhookDtos = append(webhookDtos, dto.ConvertWebhookToWebhookDto(webhook))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(webhookDtos)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// GetWebhookHandler godoc
+//
+//	@Summary		Получить подписку на события
+//	@Description	Получить подписку на события по идентификатору. Секрет подписки не возвращается
+//	@ID				get-webhook
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			id		path		int						true	"Идентификатор подписки"
+//	@Success		200		{object}	dto.WebhookDto			"Подписка успешно получена"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Подписка не найдена"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/webhooks/{id} [get]
+func (h *WebhooksHandler) GetWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := webhookIdParam(w, r)
+	if !ok {
+		return
+	}
+
+	webhook, err := h.repository.GetWebhook(id)
+	if err != nil {
+		writeWebhookError(w, err, "Возникла внутренняя ошибка при запросе подписки")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(dto.ConvertWebhookToWebhookDto(webhook))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// CreateWebhookHandler godoc
+//
+//	@Summary		Подписаться на события
+//	@Description	Создать подписку на события об изменении участия пользователей в сегментах: membership.added, membership.removed, membership.updated (изменение даты отключения) и membership.expired (наступление даты отключения). События отправляются POST-запросом с JSON-телом и подписью HMAC-SHA256 в заголовке X-Webhook-Signature. Секрет для проверки подписи возвращается только в ответе на этот запрос
+//	@ID				create-webhook
+//	@Tags			webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			Webhook			body	dto.CreateOrUpdateWebhookDto	true	"Параметры подписки"
+//	@Param			Idempotency-Key	header	string	false	"Ключ идемпотентности для безопасного повтора запроса"
+//	@Success		201		{object}	dto.WebhookDto			"Подписка успешно создана"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		422		{object}	dto.ErrorDto			"Ключ идемпотентности уже использован для другого запроса"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/webhooks [post]
+func (h *WebhooksHandler) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	webhook, ok := decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if webhook.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			writeWebhookError(w, err, "Возникла внутренняя ошибка при создании подписки")
+			return
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+	if !webhook.activeSet {
+		webhook.Active = true
+	}
+
+	created, err := h.repository.CreateWebhook(&webhook.Webhook)
+	if err != nil {
+		writeWebhookError(w, err, "Возникла внутренняя ошибка при создании подписки")
+		return
+	}
+
+	webhookDto := dto.ConvertWebhookToWebhookDto(created)
+	webhookDto.Secret = created.Secret
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/webhooks/%d", created.Id))
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(webhookDto)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// UpdateWebhookHandler godoc
+//
+//	@Summary		Обновить подписку на события
+//	@Description	Заменить адрес, типы событий и сегменты подписки. Если active не передан, подписка остается включенной или выключенной, если не передан secret — секрет не меняется. Выключенной подписке новые события не отправляются, а ее ожидающие доставки откладываются до включения
+//	@ID				update-webhook
+//	@Tags			webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int								true	"Идентификатор подписки"
+//	@Param			Webhook	body		dto.CreateOrUpdateWebhookDto	true	"Параметры подписки"
+//	@Success		200		{object}	dto.WebhookDto			"Подписка успешно обновлена"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Подписка не найдена"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/webhooks/{id} [put]
+func (h *WebhooksHandler) UpdateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := webhookIdParam(w, r)
+	if !ok {
+		return
+	}
+
+	webhook, ok := decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+	webhook.Id = id
+
+	if !webhook.activeSet {
+		existing, err := h.repository.GetWebhook(id)
+		if err != nil {
+			writeWebhookError(w, err, "Возникла внутренняя ошибка при обновлении подписки")
+			return
+		}
+		webhook.Active = existing.Active
+	}
+
+	updated, err := h.repository.UpdateWebhook(&webhook.Webhook)
+	if err != nil {
+		writeWebhookError(w, err, "Возникла внутренняя ошибка при обновлении подписки")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(dto.ConvertWebhookToWebhookDto(updated))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// DeleteWebhookHandler godoc
+//
+//	@Summary		Удалить подписку на события
+//	@Description	Удалить подписку вместе со всеми ее доставками, в том числе недоставленными
+//	@ID				delete-webhook
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			id		path		int						true	"Идентификатор подписки"
+//	@Success		204										"Подписка успешно удалена"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Подписка не найдена"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/webhooks/{id} [delete]
+func (h *WebhooksHandler) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookIdParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.repository.DeleteWebhook(id); err != nil {
+		w.Header().Add("Content-Type", "application/json")
+		writeWebhookError(w, err, "Возникла внутренняя ошибка при удалении подписки")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveriesHandler godoc
+//
+//	@Summary		Получить доставки подписки
+//	@Description	Получить доставки событий подписке от новых к старым. С status=dead возвращаются недоставленные события: доставки, по которым исчерпаны все попытки. Для получения следующей страницы передается next_cursor из предыдущего ответа
+//	@ID				get-webhook-deliveries
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			id		path		int						true	"Идентификатор подписки"
+//	@Param			status	query		string					false	"Статус доставок"	Enums(pending, delivered, dead)
+//	@Param			limit	query		int						false	"Размер страницы (по умолчанию 100, не более 1000)"
+//	@Param			cursor	query		string					false	"Курсор страницы"
+//	@Success		200		{object}	dto.WebhookDeliveriesDto	"Доставки успешно получены"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Подписка не найдена"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/webhooks/{id}/deliveries [get]
+func (h *WebhooksHandler) GetWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := webhookIdParam(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	status := query.Get("status")
+	limit := defaultDeliveriesLimit
+
+	var err error
+	switch status {
+	case "", repositories.WebhookDeliveryPending, repositories.WebhookDeliveryDelivered, repositories.WebhookDeliveryDead:
+	default:
+		err = errors.New("unknown delivery status")
+	}
+	if value := query.Get("limit"); err == nil && value != "" {
+		limit, err = strconv.Atoi(value)
+		if err == nil && (limit <= 0 || limit > maxDeliveriesLimit) {
+			err = errors.New("invalid limit")
+		}
+	}
+	var after int64
+	if value := query.Get("cursor"); err == nil && value != "" {
+		after, err = decodeCursor(value)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректные входные данные",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	deliveries, err := h.repository.GetWebhookDeliveries(id, status, after, limit)
+	if err != nil {
+		writeWebhookError(w, err, "Возникла внутренняя ошибка при запросе доставок подписки")
+		return
+	}
+
+	deliveriesDto := &dto.WebhookDeliveriesDto{
+		Deliveries: []*dto.WebhookDeliveryDto{},
+	}
+	for _, delivery := range deliveries {
+		deliveriesDto.Deliveries = append(deliveriesDto.Deliveries, dto.ConvertWebhookDeliveryToWebhookDeliveryDto(delivery))
+	}
+	if len(deliveries) == limit {
+		deliveriesDto.NextCursor = encodeCursor(deliveries[len(deliveries)-1].Id)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(deliveriesDto)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// RedeliverWebhookDeliveryHandler godoc
+//
+//	@Summary		Повторить недоставленное событие
+//	@Description	Вернуть недоставленное событие в очередь: число попыток сбрасывается, и доставка повторяется по обычным правилам
+//	@ID				redeliver-webhook-delivery
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			id			path		int						true	"Идентификатор подписки"
+//	@Param			deliveryId	path		int						true	"Идентификатор доставки"
+//	@Success		202		{object}	dto.WebhookDeliveryDto	"Доставка возвращена в очередь"
+//	@Failure		400		{object}	dto.ErrorDto			"Некорректные входные данные"
+//	@Failure		404		{object}	dto.ErrorDto			"Подписка или доставка не найдена"
+//	@Failure		409		{object}	dto.ErrorDto			"Доставка не находится в недоставленных"
+//	@Failure		500	    {object}	dto.ErrorDto			"Возникла внутренняя ошибка сервера"
+//	@Router			/api/v1/webhooks/{id}/deliveries/{deliveryId}/redeliver [post]
+func (h *WebhooksHandler) RedeliverWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := webhookIdParam(w, r)
+	if !ok {
+		return
+	}
+
+	deliveryId, err := strconv.ParseInt(mux.Vars(r)["deliveryId"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: "Некорректный идентификатор доставки",
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	delivery, err := h.repository.RedeliverWebhookDelivery(id, deliveryId)
+	if err != nil {
+		writeWebhookError(w, err, "Возникла внутренняя ошибка при повторной отправке события")
+		return
+	}
+	h.dispatcher.Notify()
+
+	w.WriteHeader(http.StatusAccepted)
+	err = json.NewEncoder(w).Encode(dto.ConvertWebhookDeliveryToWebhookDeliveryDto(delivery))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// webhookRequest — подписка из тела запроса; activeSet показывает, было ли передано поле active
+type webhookRequest struct {
+	models.Webhook
+	activeSet bool
+}
+
+// decodeWebhook читает и проверяет параметры подписки. При ошибке ответ записывается в w и возвращается false.
+func decodeWebhook(w http.ResponseWriter, r *http.Request) (*webhookRequest, bool) {
+	var webhookDto dto.CreateOrUpdateWebhookDto
+
+	message := ""
+	err := json.NewDecoder(r.Body).Decode(&webhookDto)
+	if err != nil {
+		message = "Некорректные входные данные"
+	} else if target, err := url.Parse(webhookDto.Url); err != nil || target.Host == "" ||
+		(target.Scheme != "http" && target.Scheme != "https") {
+		message = "Некорректный адрес подписки: нужен абсолютный адрес http или https"
+	} else if eventType := unknownEventType(webhookDto.EventTypes); eventType != "" {
+		message = fmt.Sprintf("Неизвестный тип события: %q", eventType)
+	}
+
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		errorDto := &dto.ErrorDto{
+			Error: message,
+		}
+		err = json.NewEncoder(w).Encode(errorDto)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return nil, false
+	}
+
+	webhook := &webhookRequest{
+		Webhook: models.Webhook{
+			Url:        webhookDto.Url,
+			Secret:     webhookDto.Secret,
+			EventTypes: uniqueStrings(webhookDto.EventTypes),
+			Slugs:      uniqueStrings(webhookDto.Slugs),
+		},
+		activeSet: webhookDto.Active != nil,
+	}
+	if webhookDto.Active != nil {
+		webhook.Active = *webhookDto.Active
+	}
+
+	return webhook, true
+}
+
+func unknownEventType(eventTypes []string) string {
+	for _, eventType := range eventTypes {
+		known := false
+		for _, candidate := range repositories.EventTypes {
+			known = known || eventType == candidate
+		}
+		if !known {
+			return eventType
+		}
+	}
+
+	return ""
+}
+
+func uniqueStrings(values []string) []string {
+	var unique []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+
+	return unique
+}
+
+// webhookIdParam читает идентификатор подписки из параметра пути {id}. При ошибке ответ записывается в w
+// и возвращается false.
+func webhookIdParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err == nil {
+		return id, true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	errorDto := &dto.ErrorDto{
+		Error: "Некорректный идентификатор подписки",
+	}
+	err = json.NewEncoder(w).Encode(errorDto)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	return 0, false
+}
+
+func writeWebhookError(w http.ResponseWriter, err error, internalMessage string) {
+	status, message := http.StatusInternalServerError, internalMessage
+	switch {
+	case errors.Is(err, repositories.ErrRecordNotFound):
+		status, message = http.StatusNotFound, "Подписка или доставка не найдена"
+	case errors.Is(err, repositories.ErrDeliveryNotDead):
+		status, message = http.StatusConflict, "Доставка не находится в недоставленных"
+	}
+
+	w.WriteHeader(status)
+	errorDto := &dto.ErrorDto{
+		Error: message,
+	}
+	err = json.NewEncoder(w).Encode(errorDto)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,43 @@
+package holdout
+
+import (
+	"fmt"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/bucketing"
+)
+
+type HoldoutConfig struct {
+	Percent float64 `envconfig:"PERCENT" default:"0"`
+	Salt    string  `envconfig:"SALT" default:"holdout"`
+}
+
+func (c HoldoutConfig) Validate() error {
+	if !(c.Percent >= 0 && c.Percent <= 100) {
+		return fmt.Errorf("holdout percent must be between 0 and 100, got %v", c.Percent)
+	}
+
+	return nil
+}
+
+// Holdout — глобальная контрольная группа пользователей, которые не попадают ни в один эксперимент
+type Holdout struct {
+	percent float64
+	salt    string
+}
+
+func New(cfg HoldoutConfig) *Holdout {
+	return &Holdout{
+		percent: cfg.Percent,
+		salt:    cfg.Salt,
+	}
+}
+
+// ContainsKey проверяет принадлежность к контрольной группе по ключу пользователя: ключу распределения
+// хранимого пользователя (models.User.BucketingKey) или идентификатору анонимного пользователя, которого нет в БД
+func (h *Holdout) ContainsKey(key string) bool {
+	return bucketing.InPercent(h.salt, key, h.percent)
+}
+
+func (h *Holdout) Percent() float64 {
+	return h.percent
+}
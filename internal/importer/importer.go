@@ -0,0 +1,145 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+var ErrInvalidFile = errors.New("invalid CSV file")
+
+var dateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+// Repository проверяет строки импорта по данным БД и, если это не пробный запуск, применяет их
+type Repository interface {
+	ImportRows(rows []*models.ImportRow, dryRun bool) (*models.ImportReport, error)
+}
+
+// Importer импортирует пользователей и их сегменты из CSV-файла со строками вида `user_id[,slug,deadline]`,
+// где user_id — числовой или внешний идентификатор. Строка только с внешним идентификатором создает
+// пользователя, если его еще нет; строка со слагом добавляет пользователю сегмент с необязательной датой отключения.
+type Importer struct {
+	repository Repository
+}
+
+func New(r Repository) *Importer {
+	return &Importer{
+		repository: r,
+	}
+}
+
+// Import разбирает и проверяет файл. Строки с ошибками попадают в отчет и не применяются,
+// при dryRun ничего не записывается в БД.
+func (i *Importer) Import(r io.Reader, dryRun bool) (*models.ImportReport, error) {
+	rows, errs, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := i.repository.ImportRows(rows, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	report.DryRun = dryRun
+	report.Rows += len(errs)
+	report.Errors = append(report.Errors, errs...)
+	sort.SliceStable(report.Errors, func(a, b int) bool {
+		return report.Errors[a].Line < report.Errors[b].Line
+	})
+
+	return report, nil
+}
+
+// Parse читает CSV-файл и возвращает корректные по формату строки и ошибки в остальных строках.
+// Первая строка пропускается, если это заголовок.
+func Parse(r io.Reader) ([]*models.ImportRow, []*models.ImportError, error) {
+	var rows []*models.ImportRow
+	var errs []*models.ImportError
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				errs = append(errs, &models.ImportError{Line: parseErr.Line, Error: "Некорректная строка CSV"})
+				continue
+			}
+			return nil, nil, ErrInvalidFile
+		}
+
+		line, _ := reader.FieldPos(0)
+		if line == 1 && isHeader(record) {
+			continue
+		}
+
+		row, message := parseRecord(record)
+		if message != "" {
+			errs = append(errs, &models.ImportError{Line: line, Error: message})
+			continue
+		}
+
+		row.Line = line
+		rows = append(rows, row)
+	}
+
+	return rows, errs, nil
+}
+
+func parseRecord(record []string) (*models.ImportRow, string) {
+	if len(record) > 3 {
+		return nil, "Слишком много колонок, ожидается user_id[,slug,deadline]"
+	}
+
+	key := strings.TrimSpace(record[0])
+	if _, _, ok := models.ParseUserKey(key); !ok {
+		return nil, "Некорректный идентификатор пользователя: ожидается число от 1 до 2147483647 или внешний идентификатор"
+	}
+
+	row := &models.ImportRow{UserKey: key}
+	if len(record) > 1 {
+		row.Slug = strings.TrimSpace(record[1])
+	}
+
+	if len(record) > 2 {
+		row.DeadlineDate = strings.TrimSpace(record[2])
+	}
+
+	if row.DeadlineDate != "" {
+		if row.Slug == "" {
+			return nil, "Дата отключения указана без сегмента"
+		}
+
+		if !validDate(row.DeadlineDate) {
+			return nil, "Некорректная дата отключения"
+		}
+	}
+
+	return row, ""
+}
+
+func isHeader(record []string) bool {
+	return strings.EqualFold(strings.TrimSpace(record[0]), "user_id")
+}
+
+func validDate(value string) bool {
+	for _, layout := range dateLayouts {
+		if _, err := time.Parse(layout, value); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
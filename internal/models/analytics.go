@@ -0,0 +1,46 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	AnalyticsPeriodDay   = "day"
+	AnalyticsPeriodWeek  = "week"
+	AnalyticsPeriodMonth = "month"
+)
+
+// SegmentTimeline — исходные данные для аналитики сегмента: записи истории сегмента в хронологическом
+// порядке по каждому пользователю и текущие участники сегмента из users_segments
+type SegmentTimeline struct {
+	Records []*HistoryRecord
+	Members map[int]sql.NullTime
+}
+
+// SegmentAnalytics — показатели сегмента по периодам длины Period, которыми разбит интервал [From, To),
+// и показатели за весь интервал в Total
+type SegmentAnalytics struct {
+	Slug    string
+	From    time.Time
+	To      time.Time
+	Period  string
+	Periods []*AnalyticsPeriod
+	Total   *AnalyticsPeriod
+}
+
+// AnalyticsPeriod — показатели сегмента за период [From, To). Длительности считаются по участиям,
+// завершившимся в этом периоде (удалением или наступлением даты отключения); Completed — их число.
+type AnalyticsPeriod struct {
+	From            time.Time
+	To              time.Time
+	Adds            int
+	Removes         int
+	Expirations     int
+	MembersStart    int
+	MembersEnd      int
+	PeakMembers     int
+	Completed       int
+	MedianDuration  time.Duration
+	AverageDuration time.Duration
+}
@@ -0,0 +1,16 @@
+package models
+
+// AudienceResult — пользователи, подходящие под выражение над сегментами: общее число и страница
+// идентификаторов по возрастанию
+type AudienceResult struct {
+	Count   int
+	UserIds []int
+}
+
+// SegmentOverlap — пересечения сегментов: Sizes[i] — число активных участников сегмента Slugs[i],
+// Matrix[i][j] — число пользователей, состоящих одновременно в сегментах Slugs[i] и Slugs[j]
+type SegmentOverlap struct {
+	Slugs  []string
+	Sizes  []int
+	Matrix [][]int
+}
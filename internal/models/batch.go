@@ -0,0 +1,10 @@
+package models
+
+// BatchResult — итог массового изменения участников сегмента
+type BatchResult struct {
+	Added       int
+	Reactivated int
+	Removed     int
+	Skipped     int
+	Missing     int
+}
@@ -0,0 +1,18 @@
+package models
+
+// SegmentChanges — изменения сегментов пользователя: примененные или, при пробном запуске, планируемые
+type SegmentChanges struct {
+	UserId      int
+	Added       []string
+	Removed     []string
+	Updated     []string
+	Reactivated []string
+	Ignored     []string
+	Errors      []*SegmentError
+}
+
+// SegmentError — ошибка проверки изменения одного сегмента пользователя
+type SegmentError struct {
+	Slug string
+	Err  error
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+const (
+	DiffReasonRemoved = "removed"
+	DiffReasonExpired = "expired"
+)
+
+// SegmentDiff — изменение состава сегмента между двумя моментами времени
+type SegmentDiff struct {
+	Slug        string
+	From        time.Time
+	To          time.Time
+	MembersFrom int
+	MembersTo   int
+	Joined      []*DiffEntry
+	Left        []*DiffEntry
+}
+
+// DiffEntry — пользователь, который вошел в сегмент или вышел из него. Для вошедших Date — время последнего
+// добавления; для вышедших — время удаления (Reason = removed) или дата отключения (Reason = expired).
+type DiffEntry struct {
+	UserId int
+	Reason string
+	Date   time.Time
+}
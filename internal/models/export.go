@@ -0,0 +1,34 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// UserExport — все данные пользователя, хранящиеся в сервисе
+type UserExport struct {
+	User        *User
+	Memberships []*ExportedMembership
+	History     []*HistoryRecord
+	ExportedAt  time.Time
+}
+
+// ExportedMembership — текущая или истекшая привязка пользователя к сегменту
+type ExportedMembership struct {
+	Slug         string
+	DeadlineDate sql.NullString
+	AutoEnrolled bool
+	Active       bool
+}
+
+// HistoryRecord — запись истории добавления пользователя в сегмент или удаления из него.
+// UserId равен 0 для псевдонимизированных записей удаленных пользователей.
+type HistoryRecord struct {
+	Id            int64
+	UserId        int
+	Slug          string
+	ActionDate    time.Time
+	OperationType string
+	DeadlineDate  sql.NullTime
+	Actor         sql.NullString
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// HistoryFilter — условия выборки записей истории. Пустые значения полей не ограничивают выборку.
+// Записи возвращаются от новых к старым, After — идентификатор последней записи предыдущей страницы.
+type HistoryFilter struct {
+	UserId        int
+	Slug          string
+	OperationType string
+	Actor         string
+	From          time.Time
+	To            time.Time
+	After         int64
+	Limit         int
+}
+
+// HistoryReport — записи истории за период [From, To) в хронологическом порядке
+type HistoryReport struct {
+	From    time.Time
+	To      time.Time
+	Records []*HistoryRecord
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// IdempotencyRecord — сохраненный запрос с ключом идемпотентности и ответ на него.
+// Пока запрос выполняется, StatusCode не заполнен.
+type IdempotencyRecord struct {
+	Key          string
+	Fingerprint  string
+	StatusCode   sql.NullInt64
+	ContentType  sql.NullString
+	ResponseBody []byte
+	CreatedAt    time.Time
+}
@@ -0,0 +1,24 @@
+package models
+
+// ImportRow — строка CSV-файла импорта: пользователь и, если указан, сегмент, который ему нужно добавить
+type ImportRow struct {
+	Line         int
+	UserKey      string // Числовой или внешний идентификатор пользователя
+	Slug         string
+	DeadlineDate string
+}
+
+// ImportError — ошибка в строке CSV-файла импорта
+type ImportError struct {
+	Line  int
+	Error string
+}
+
+// ImportReport — итог импорта пользователей и их сегментов
+type ImportReport struct {
+	DryRun  bool
+	Rows    int
+	Applied int
+	Skipped int
+	Errors  []*ImportError
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ReportJob — задание на асинхронное формирование отчета по истории. UserId равен 0 и Slug пуст,
+// если отчет не ограничен пользователем или сегментом.
+type ReportJob struct {
+	Id         string
+	Status     string
+	Format     string
+	UserId     int
+	Slug       string
+	From       time.Time
+	To         time.Time
+	Progress   int
+	BlobKey    sql.NullString
+	Error      sql.NullString
+	CreatedAt  time.Time
+	StartedAt  sql.NullTime
+	FinishedAt sql.NullTime
+}
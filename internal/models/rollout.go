@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type Rollout struct {
+	Slug        string
+	Paused      bool
+	CurrentStep int
+	Steps       []*RolloutStep
+}
+
+type RolloutStep struct {
+	Slug    string
+	Step    int
+	Percent float64
+	StartAt time.Time
+}
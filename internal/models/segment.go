@@ -6,10 +6,14 @@ type Segment struct {
 	Id          int
 	Slug        string
 	Description string
+	Layer       sql.NullString
+	Percent     sql.NullFloat64
+	Rule        sql.NullString
 }
 
 type UserSegment struct {
 	UserId       int
 	Slug         string
 	DeadlineDate sql.NullString
+	Source       string
 }
@@ -1,6 +1,101 @@
 package models
 
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
 type User struct {
-	Id   int
-	Name string
+	Id         int
+	ExternalId sql.NullString
+	Name       string
+	Attributes Attributes
+}
+
+// BucketingKey возвращает ключ, по которому пользователь распределяется по процентным сегментам, контрольной
+// группе и шагам раскатывания: внешний идентификатор, если он задан, иначе внутренний. По тому же ключу
+// вычисляются сегменты пользователя, которого еще нет в БД, поэтому после его создания они не меняются.
+func (u *User) BucketingKey() string {
+	if u.ExternalId.Valid {
+		return u.ExternalId.String
+	}
+
+	return strconv.Itoa(u.Id)
+}
+
+// Attributes — произвольные типизированные атрибуты пользователя (город, платформа, дата регистрации и т.д.),
+// хранящиеся в БД в формате jsonb
+type Attributes map[string]interface{}
+
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return []byte("{}"), nil
+	}
+
+	return json.Marshal(a)
+}
+
+func (a *Attributes) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*a = Attributes{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("unsupported type for attributes")
+	}
+
+	return json.Unmarshal(data, a)
+}
+
+// UserErasure — запись об удалении пользователя по запросу на удаление данных
+type UserErasure struct {
+	UserId           int
+	ErasedAt         time.Time
+	HistoryMode      string
+	MembershipsEnded int
+	HistoryRows      int
+}
+
+var externalIdPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:@-]{0,127}$`)
+
+// IsValidExternalId проверяет формат внешнего идентификатора пользователя: строка до 128 символов из латинских
+// букв, цифр и символов ._:@-, например UUID. Идентификатор из одних цифр не допускается, чтобы его нельзя
+// было спутать с внутренним числовым идентификатором.
+func IsValidExternalId(id string) bool {
+	if !externalIdPattern.MatchString(id) {
+		return false
+	}
+
+	for _, c := range id {
+		if c < '0' || c > '9' {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseUserKey разбирает идентификатор пользователя из запроса: положительное число в диапазоне столбца users.id
+// считается внутренним идентификатором, остальное — внешним. ok = false, если ключ не подходит ни под один формат.
+func ParseUserKey(key string) (userId int, externalId string, ok bool) {
+	if id, err := strconv.Atoi(key); err == nil {
+		return id, "", id > 0 && id <= math.MaxInt32
+	}
+
+	if !IsValidExternalId(key) {
+		return 0, "", false
+	}
+
+	return 0, key, true
 }
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Webhook — подписка внешнего сервиса на события об изменении участия в сегментах. Пустые EventTypes и Slugs
+// означают подписку на все типы событий и все сегменты.
+type Webhook struct {
+	Id         int
+	Url        string
+	Secret     string
+	EventTypes []string
+	Slugs      []string
+	Active     bool
+	CreatedAt  time.Time
+}
+
+// OutboxEvent — событие об изменении участия пользователя в сегменте, записанное в outbox в одной транзакции
+// с самим изменением. DeadlineDate — дата отключения, действующая после изменения.
+type OutboxEvent struct {
+	Id           int64
+	Type         string
+	UserId       int
+	ExternalId   sql.NullString
+	Slug         string
+	DeadlineDate sql.NullTime
+	Actor        sql.NullString
+	OccurredAt   time.Time
+	// TransactionId — транзакция, в которой записано событие; используется для упорядочивания потока событий
+	TransactionId uint64
+}
+
+// EventPosition — позиция в потоке событий. События упорядочены по транзакции, а внутри нее — по идентификатору:
+// в отличие от одного идентификатора, такой порядок не меняется, когда транзакции фиксируются не в порядке
+// выдачи идентификаторов.
+type EventPosition struct {
+	TransactionId uint64
+	EventId       int64
+}
+
+// WebhookDelivery — доставка одного события одной подписке
+type WebhookDelivery struct {
+	Id             int64
+	WebhookId      int
+	Event          *OutboxEvent
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastStatusCode sql.NullInt32
+	LastError      sql.NullString
+	CreatedAt      time.Time
+	DeliveredAt    sql.NullTime
+}
+
+// WebhookDeliveryTask — взятая в работу доставка вместе с подпиской, которой ее нужно отправить
+type WebhookDeliveryTask struct {
+	Delivery *WebhookDelivery
+	Webhook  *Webhook
+}
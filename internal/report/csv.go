@@ -0,0 +1,84 @@
+package report
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+// CSVFormatter записывает отчет в CSV: одна строка на запись истории
+type CSVFormatter struct{}
+
+func (f *CSVFormatter) Name() string {
+	return "csv"
+}
+
+func (f *CSVFormatter) ContentType() string {
+	return "text/csv"
+}
+
+func (f *CSVFormatter) Extension() string {
+	return "csv"
+}
+
+var csvHeader = []string{"user_id", "slug", "operation_type", "action_date", "deadline_date", "actor"}
+
+func (f *CSVFormatter) NewWriter(w io.Writer, from, to time.Time) RecordWriter {
+	return &csvWriter{writer: csv.NewWriter(w)}
+}
+
+func (f *CSVFormatter) Format(w io.Writer, report *models.HistoryReport) error {
+	return format(f.NewWriter(w, report.From, report.To), report.Records)
+}
+
+type csvWriter struct {
+	writer  *csv.Writer
+	started bool
+}
+
+// Write дописывает строки и сбрасывает их в w, чтобы записи не копились в буфере
+func (c *csvWriter) Write(records []*models.HistoryRecord) error {
+	if !c.started {
+		c.started = true
+		if err := c.writer.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+
+	for _, record := range records {
+		if err := c.writer.Write(recordFields(record)); err != nil {
+			return err
+		}
+	}
+
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// Close записывает заголовок, если записей не было
+func (c *csvWriter) Close() error {
+	return c.Write(nil)
+}
+
+// recordFields возвращает поля записи истории в порядке колонок отчета
+func recordFields(record *models.HistoryRecord) []string {
+	var userId, deadline string
+	if record.UserId != 0 {
+		userId = strconv.Itoa(record.UserId)
+	}
+	if record.DeadlineDate.Valid {
+		deadline = record.DeadlineDate.Time.Format(time.RFC3339)
+	}
+
+	return []string{
+		userId,
+		record.Slug,
+		record.OperationType,
+		record.ActionDate.Format(time.RFC3339),
+		deadline,
+		record.Actor.String,
+	}
+}
@@ -0,0 +1,212 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+// DOCXFormatter записывает отчет в документ Word со сводной таблицей по сегментам: число добавлений,
+// удалений и изменений даты отключения за период и число затронутых пользователей
+type DOCXFormatter struct{}
+
+func (f *DOCXFormatter) Name() string {
+	return "docx"
+}
+
+func (f *DOCXFormatter) ContentType() string {
+	return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+}
+
+func (f *DOCXFormatter) Extension() string {
+	return "docx"
+}
+
+type segmentSummary struct {
+	slug    string
+	added   int
+	removed int
+	updated int
+	users   map[int]bool
+}
+
+func (s *segmentSummary) add(record *models.HistoryRecord) {
+	switch record.OperationType {
+	case repositories.OperationAdding:
+		s.added++
+	case repositories.OperationRemoving:
+		s.removed++
+	case repositories.OperationUpdating:
+		s.updated++
+	}
+
+	if record.UserId != 0 {
+		s.users[record.UserId] = true
+	}
+}
+
+var docxColumns = []struct {
+	title string
+	width int
+}{
+	{"Сегмент", 3400},
+	{"Добавлений", 1400},
+	{"Удалений", 1400},
+	{"Изменений даты", 1600},
+	{"Пользователей", 1600},
+}
+
+func (f *DOCXFormatter) NewWriter(w io.Writer, from, to time.Time) RecordWriter {
+	return &docxWriter{w: w, from: from, to: to, bySlug: make(map[string]*segmentSummary)}
+}
+
+func (f *DOCXFormatter) Format(w io.Writer, report *models.HistoryReport) error {
+	return format(f.NewWriter(w, report.From, report.To), report.Records)
+}
+
+// docxWriter копит только сводку по сегментам, а документ записывает при закрытии
+type docxWriter struct {
+	w       io.Writer
+	from    time.Time
+	to      time.Time
+	records int
+	bySlug  map[string]*segmentSummary
+}
+
+func (d *docxWriter) Write(records []*models.HistoryRecord) error {
+	for _, record := range records {
+		summary, ok := d.bySlug[record.Slug]
+		if !ok {
+			summary = &segmentSummary{slug: record.Slug, users: make(map[int]bool)}
+			d.bySlug[record.Slug] = summary
+		}
+		summary.add(record)
+	}
+	d.records += len(records)
+
+	return nil
+}
+
+func (d *docxWriter) Close() error {
+	summaries := sortedSummaries(d.bySlug)
+
+	var body strings.Builder
+	body.WriteString(docxParagraph("Отчет по истории сегментов", true, 32))
+	body.WriteString(docxParagraph(fmt.Sprintf("Период: %s — %s (UTC)",
+		d.from.UTC().Format("2006-01-02 15:04"), d.to.UTC().Format("2006-01-02 15:04")), false, 0))
+	body.WriteString(docxParagraph(fmt.Sprintf("Всего записей истории: %d", d.records), false, 0))
+
+	body.WriteString(`<w:tbl><w:tblPr><w:tblW w:w="0" w:type="auto"/><w:tblBorders>`)
+	for _, border := range []string{"top", "left", "bottom", "right", "insideH", "insideV"} {
+		fmt.Fprintf(&body, `<w:%s w:val="single" w:sz="4" w:space="0" w:color="808080"/>`, border)
+	}
+	body.WriteString(`</w:tblBorders></w:tblPr><w:tblGrid>`)
+	for _, column := range docxColumns {
+		fmt.Fprintf(&body, `<w:gridCol w:w="%d"/>`, column.width)
+	}
+	body.WriteString(`</w:tblGrid>`)
+
+	header := make([]string, 0, len(docxColumns))
+	for _, column := range docxColumns {
+		header = append(header, column.title)
+	}
+	body.WriteString(docxRow(header, true, true))
+
+	total := &segmentSummary{users: make(map[int]bool)}
+	for _, summary := range summaries {
+		body.WriteString(docxRow(summary.cells(summary.slug), false, false))
+
+		total.added += summary.added
+		total.removed += summary.removed
+		total.updated += summary.updated
+		for userId := range summary.users {
+			total.users[userId] = true
+		}
+	}
+	body.WriteString(docxRow(total.cells("Итого"), false, true))
+	body.WriteString(`</w:tbl>`)
+
+	body.WriteString(docxParagraph("Пользователи считаются без учета псевдонимизированных записей удаленных пользователей.", false, 18))
+	body.WriteString(`<w:sectPr><w:pgSz w:w="11906" w:h="16838"/>` +
+		`<w:pgMar w:top="1134" w:right="850" w:bottom="1134" w:left="1701" w:header="708" w:footer="708" w:gutter="0"/></w:sectPr>`)
+
+	return writeOOXML(d.w, []ooxmlPart{
+		{name: "[Content_Types].xml", content: `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>` +
+			`</Types>`},
+		{name: "_rels/.rels", content: `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>` +
+			`</Relationships>`},
+		{name: "word/document.xml", content: `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+			body.String() + `</w:body></w:document>`},
+	})
+}
+
+// sortedSummaries упорядочивает сводку по названию сегмента
+func sortedSummaries(bySlug map[string]*segmentSummary) []*segmentSummary {
+	summaries := make([]*segmentSummary, 0, len(bySlug))
+	for _, summary := range bySlug {
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].slug < summaries[j].slug
+	})
+
+	return summaries
+}
+
+func (s *segmentSummary) cells(title string) []string {
+	return []string{
+		title,
+		strconv.Itoa(s.added),
+		strconv.Itoa(s.removed),
+		strconv.Itoa(s.updated),
+		strconv.Itoa(len(s.users)),
+	}
+}
+
+func docxParagraph(text string, bold bool, size int) string {
+	var props string
+	if bold {
+		props += `<w:b/>`
+	}
+	if size > 0 {
+		props += fmt.Sprintf(`<w:sz w:val="%d"/>`, size)
+	}
+
+	return fmt.Sprintf(`<w:p><w:r><w:rPr>%s</w:rPr><w:t xml:space="preserve">%s</w:t></w:r></w:p>`, props, escape(text))
+}
+
+// docxRow формирует строку таблицы; строка заголовка повторяется на каждой странице и выделяется фоном
+func docxRow(cells []string, header, bold bool) string {
+	var row strings.Builder
+	row.WriteString(`<w:tr>`)
+	if header {
+		row.WriteString(`<w:trPr><w:tblHeader/></w:trPr>`)
+	}
+
+	for i, cell := range cells {
+		fmt.Fprintf(&row, `<w:tc><w:tcPr><w:tcW w:w="%d" w:type="dxa"/>`, docxColumns[i].width)
+		if header {
+			row.WriteString(`<w:shd w:val="clear" w:color="auto" w:fill="D9E2F3"/>`)
+		}
+		row.WriteString(`</w:tcPr>`)
+
+		var props string
+		if bold {
+			props = `<w:b/>`
+		}
+		fmt.Fprintf(&row, `<w:p><w:r><w:rPr>%s</w:rPr><w:t xml:space="preserve">%s</w:t></w:r></w:p></w:tc>`, props, escape(cell))
+	}
+
+	row.WriteString(`</w:tr>`)
+	return row.String()
+}
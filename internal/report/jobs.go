@@ -0,0 +1,231 @@
+package report
+
+import (
+	"context"
+	goErrors "errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/blob"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+type JobsConfig struct {
+	Interval   time.Duration `envconfig:"INTERVAL" default:"5s"`
+	StaleAfter time.Duration `envconfig:"STALE_AFTER" default:"5m"`
+}
+
+func (c JobsConfig) Validate() error {
+	if c.Interval <= 0 || c.StaleAfter < time.Second {
+		return fmt.Errorf("reports interval must be positive and stale after at least 1s, got %s and %s", c.Interval, c.StaleAfter)
+	}
+
+	return nil
+}
+
+type JobRepository interface {
+	ClaimReportJob(staleBefore time.Time) (*models.ReportJob, error)
+	SetReportJobProgress(id string, progress int) error
+	TouchReportJob(id string) error
+	CompleteReportJob(id, blobKey string) error
+	FailReportJob(id, message string) error
+}
+
+type HistorySource interface {
+	GetHistoryReport(userId int, slug string, from, to time.Time) (*models.HistoryReport, error)
+}
+
+// Прогресс задания: выборка истории и запись ее в файл занимают первые 90%, завершение файла и загрузка
+// в хранилище — остальные
+const (
+	progressFetched   = 90
+	progressFormatted = 95
+)
+
+// Runner выполняет задания на формирование отчетов. История выбирается по месяцам, чтобы отчет за большой
+// период не требовал одного долгого запроса и чтобы по заданию был виден прогресс; каждый месяц сразу
+// дописывается в файл отчета и не держится в памяти. Готовый файл загружается в хранилище под ключом
+// reports/{id}.{расширение}.
+type Runner struct {
+	jobs       JobRepository
+	history    HistorySource
+	store      blob.BlobStore
+	formatters *Formatters
+	interval   time.Duration
+	staleAfter time.Duration
+	wake       chan struct{}
+	logger     *zap.SugaredLogger
+}
+
+func NewRunner(jobs JobRepository, history HistorySource, store blob.BlobStore, formatters *Formatters,
+	cfg JobsConfig, logger *zap.SugaredLogger) *Runner {
+	return &Runner{
+		jobs:       jobs,
+		history:    history,
+		store:      store,
+		formatters: formatters,
+		interval:   cfg.Interval,
+		staleAfter: cfg.StaleAfter,
+		wake:       make(chan struct{}, 1),
+		logger:     logger.With(zap.String("comp", "report runner")),
+	}
+}
+
+// Notify будит обработчик, чтобы новое задание не ждало следующего тика
+func (r *Runner) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Runner) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// drain выполняет задания, пока они есть
+func (r *Runner) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := r.jobs.ClaimReportJob(time.Now().Add(-r.staleAfter))
+		if err != nil {
+			if !goErrors.Is(err, repositories.ErrRecordNotFound) {
+				r.logger.Errorf("Error while claiming report job: %v", err)
+			}
+			return
+		}
+
+		if err = r.process(ctx, job); err != nil {
+			// при остановке сервиса задание не считается проваленным: его доделает следующий обработчик
+			if ctx.Err() != nil {
+				return
+			}
+
+			r.logger.Errorf("Report job %s failed: %v", job.Id, err)
+			if err = r.jobs.FailReportJob(job.Id, err.Error()); err != nil {
+				r.logger.Errorf("Error while saving failure of report job %s: %v", job.Id, err)
+			}
+			continue
+		}
+
+		r.logger.Infof("Report job %s is done", job.Id)
+	}
+}
+
+func (r *Runner) process(ctx context.Context, job *models.ReportJob) error {
+	formatter, ok := r.formatters.Select(job.Format, "")
+	if !ok {
+		return fmt.Errorf("unknown report format %q", job.Format)
+	}
+
+	stop := r.heartbeat(job.Id)
+	defer stop()
+
+	file, err := os.CreateTemp("", "report-*."+formatter.Extension())
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) //nolint:errcheck
+	defer file.Close()
+
+	writer := formatter.NewWriter(file, job.From, job.To)
+	months := monthRanges(job.From, job.To)
+	for i, month := range months {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		part, err := r.history.GetHistoryReport(job.UserId, job.Slug, month[0], month[1])
+		if err != nil {
+			return err
+		}
+		if err = writer.Write(part.Records); err != nil {
+			return err
+		}
+
+		if err = r.jobs.SetReportJobProgress(job.Id, progressFetched*(i+1)/len(months)); err != nil {
+			return err
+		}
+	}
+
+	if err = writer.Close(); err != nil {
+		return err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err = r.jobs.SetReportJobProgress(job.Id, progressFormatted); err != nil {
+		return err
+	}
+
+	key := "reports/" + job.Id + "." + formatter.Extension()
+	if err = r.store.Put(ctx, key, formatter.ContentType(), file); err != nil {
+		return err
+	}
+
+	return r.jobs.CompleteReportJob(job.Id, key)
+}
+
+// heartbeat, пока задание выполняется, трижды за StaleAfter отмечает, что обработчик жив: прогресс
+// сохраняется только между месяцами, и без этого месяц, который выбирается дольше StaleAfter, позволил бы
+// другому обработчику счесть задание брошенным. Возвращаемая функция останавливает отметки.
+func (r *Runner) heartbeat(id string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(r.staleAfter / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := r.jobs.TouchReportJob(id); err != nil {
+					r.logger.Errorf("Error while touching report job %s: %v", id, err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// monthRanges делит период [from, to) на части по границам календарных месяцев (по UTC)
+func monthRanges(from, to time.Time) [][2]time.Time {
+	var ranges [][2]time.Time
+	for start := from; start.Before(to); {
+		utc := start.UTC()
+		end := time.Date(utc.Year(), utc.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		if end.After(to) {
+			end = to
+		}
+
+		ranges = append(ranges, [2]time.Time{start, end})
+		start = end
+	}
+
+	return ranges
+}
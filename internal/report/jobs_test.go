@@ -0,0 +1,235 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/blob"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+func date(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestMonthRanges(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+
+	tests := []struct {
+		name string
+		from time.Time
+		to   time.Time
+		want [][2]time.Time
+	}{
+		{name: "empty period", from: date("2023-01-10T00:00:00Z"), to: date("2023-01-10T00:00:00Z")},
+		{name: "reversed period", from: date("2023-02-10T00:00:00Z"), to: date("2023-01-10T00:00:00Z")},
+		{
+			name: "inside one month",
+			from: date("2023-01-10T00:00:00Z"),
+			to:   date("2023-01-20T00:00:00Z"),
+			want: [][2]time.Time{{date("2023-01-10T00:00:00Z"), date("2023-01-20T00:00:00Z")}},
+		},
+		{
+			name: "whole month",
+			from: date("2023-02-01T00:00:00Z"),
+			to:   date("2023-03-01T00:00:00Z"),
+			want: [][2]time.Time{{date("2023-02-01T00:00:00Z"), date("2023-03-01T00:00:00Z")}},
+		},
+		{
+			name: "across year",
+			from: date("2022-11-15T12:00:00Z"),
+			to:   date("2023-01-02T00:00:00Z"),
+			want: [][2]time.Time{
+				{date("2022-11-15T12:00:00Z"), date("2022-12-01T00:00:00Z")},
+				{date("2022-12-01T00:00:00Z"), date("2023-01-01T00:00:00Z")},
+				{date("2023-01-01T00:00:00Z"), date("2023-01-02T00:00:00Z")},
+			},
+		},
+		{
+			name: "month boundaries are in UTC",
+			from: time.Date(2023, time.March, 1, 1, 0, 0, 0, moscow),
+			to:   time.Date(2023, time.March, 2, 0, 0, 0, 0, moscow),
+			want: [][2]time.Time{
+				{time.Date(2023, time.March, 1, 1, 0, 0, 0, moscow), date("2023-03-01T00:00:00Z")},
+				{date("2023-03-01T00:00:00Z"), time.Date(2023, time.March, 2, 0, 0, 0, 0, moscow)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := monthRanges(tt.from, tt.to)
+			if len(got) != len(tt.want) {
+				t.Fatalf("monthRanges() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i][0].Equal(tt.want[i][0]) || !got[i][1].Equal(tt.want[i][1]) {
+					t.Errorf("monthRanges()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+type fakeJobs struct {
+	mu       sync.Mutex
+	progress []int
+	touched  int
+	blobKey  string
+}
+
+func (f *fakeJobs) ClaimReportJob(time.Time) (*models.ReportJob, error) { return nil, nil }
+
+func (f *fakeJobs) SetReportJobProgress(_ string, progress int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.progress = append(f.progress, progress)
+	return nil
+}
+
+func (f *fakeJobs) TouchReportJob(string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.touched++
+	return nil
+}
+
+func (f *fakeJobs) CompleteReportJob(_, blobKey string) error {
+	f.blobKey = blobKey
+	return nil
+}
+
+func (f *fakeJobs) FailReportJob(string, string) error { return nil }
+
+// fakeHistory отдает по записи на каждый запрошенный месяц и запоминает запрошенные периоды
+type fakeHistory struct {
+	requested [][2]time.Time
+	delay     time.Duration
+}
+
+func (f *fakeHistory) GetHistoryReport(_ int, slug string, from, to time.Time) (*models.HistoryReport, error) {
+	time.Sleep(f.delay)
+	f.requested = append(f.requested, [2]time.Time{from, to})
+	return &models.HistoryReport{From: from, To: to, Records: []*models.HistoryRecord{
+		{UserId: len(f.requested), Slug: slug, OperationType: "ADDING", ActionDate: from},
+	}}, nil
+}
+
+type fakeStore struct {
+	blob.BlobStore
+	body bytes.Buffer
+}
+
+func (f *fakeStore) Put(_ context.Context, _, _ string, body io.ReadSeeker) error {
+	_, err := io.Copy(&f.body, body)
+	return err
+}
+
+func TestRunnerProcess(t *testing.T) {
+	tests := []struct {
+		name         string
+		staleAfter   time.Duration
+		delay        time.Duration
+		wantCSV      string
+		wantProgress []int
+		wantTouched  bool
+	}{
+		{
+			name:       "months are written in order",
+			staleAfter: time.Minute,
+			wantCSV: "user_id,slug,operation_type,action_date,deadline_date,actor\n" +
+				"1,AVITO,ADDING,2023-01-20T00:00:00Z,,\n" +
+				"2,AVITO,ADDING,2023-02-01T00:00:00Z,,\n" +
+				"3,AVITO,ADDING,2023-03-01T00:00:00Z,,\n",
+			wantProgress: []int{30, 60, 90, 95},
+		},
+		{
+			name:       "slow month keeps the job alive",
+			staleAfter: 30 * time.Millisecond,
+			delay:      40 * time.Millisecond,
+			wantCSV: "user_id,slug,operation_type,action_date,deadline_date,actor\n" +
+				"1,AVITO,ADDING,2023-01-20T00:00:00Z,,\n" +
+				"2,AVITO,ADDING,2023-02-01T00:00:00Z,,\n" +
+				"3,AVITO,ADDING,2023-03-01T00:00:00Z,,\n",
+			wantProgress: []int{30, 60, 90, 95},
+			wantTouched:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs, history, store := &fakeJobs{}, &fakeHistory{delay: tt.delay}, &fakeStore{}
+			runner := NewRunner(jobs, history, store, Default(), JobsConfig{Interval: time.Second, StaleAfter: tt.staleAfter},
+				zap.NewNop().Sugar())
+
+			job := &models.ReportJob{Id: "job", Format: "csv", Slug: "AVITO",
+				From: date("2023-01-20T00:00:00Z"), To: date("2023-03-10T00:00:00Z")}
+			if err := runner.process(context.Background(), job); err != nil {
+				t.Fatalf("process() unexpected error: %v", err)
+			}
+
+			if len(history.requested) != 3 {
+				t.Errorf("history was requested for %v, want 3 months", history.requested)
+			}
+			if got := store.body.String(); got != tt.wantCSV {
+				t.Errorf("report = %q, want %q", got, tt.wantCSV)
+			}
+			if !reflect.DeepEqual(jobs.progress, tt.wantProgress) {
+				t.Errorf("progress = %v, want %v", jobs.progress, tt.wantProgress)
+			}
+			if jobs.blobKey != "reports/job.csv" {
+				t.Errorf("blob key = %s, want reports/job.csv", jobs.blobKey)
+			}
+			if tt.wantTouched && jobs.touched == 0 {
+				t.Error("job was not touched while a month was fetched longer than StaleAfter")
+			}
+		})
+	}
+}
+
+func TestRecordWritersMatchFormat(t *testing.T) {
+	report := &models.HistoryReport{From: date("2023-01-15T00:00:00Z"), To: date("2023-04-01T00:00:00Z"), Records: []*models.HistoryRecord{
+		{UserId: 1, Slug: "A", OperationType: "ADDING", ActionDate: date("2023-01-20T10:00:00Z")},
+		{UserId: 2, Slug: "B", OperationType: "ADDING", ActionDate: date("2023-01-21T10:00:00Z")},
+		{UserId: 1, Slug: "A", OperationType: "REMOVING", ActionDate: date("2023-03-02T10:00:00Z")},
+	}}
+
+	for _, formatter := range Default().formatters {
+		t.Run(formatter.Name(), func(t *testing.T) {
+			var whole bytes.Buffer
+			if err := formatter.Format(&whole, report); err != nil {
+				t.Fatal(err)
+			}
+
+			var parts bytes.Buffer
+			writer := formatter.NewWriter(&parts, report.From, report.To)
+			for _, part := range [][]*models.HistoryRecord{report.Records[:2], nil, report.Records[2:]} {
+				if err := writer.Write(part); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(whole.Bytes(), parts.Bytes()) {
+				t.Errorf("report written by parts differs from the whole one")
+			}
+			if formatter.Name() == "csv" && strings.Count(parts.String(), "\n") != 4 {
+				t.Errorf("csv report = %q, want header and 3 rows", parts.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+)
+
+// Файлы XLSX и DOCX — ZIP-архивы с XML-частями в формате Office Open XML. Части формируются вручную,
+// чтобы отчеты не зависели от внешних библиотек и сервисов.
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+type ooxmlPart struct {
+	name    string
+	content string
+}
+
+func writeOOXML(w io.Writer, parts []ooxmlPart) error {
+	archive := zip.NewWriter(w)
+	if err := writeParts(archive, parts); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func writeParts(archive *zip.Writer, parts []ooxmlPart) error {
+	for _, part := range parts {
+		partWriter, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+
+		if _, err = io.WriteString(partWriter, xmlHeader+part.content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func escape(value string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
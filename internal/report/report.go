@@ -0,0 +1,131 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+// ReportFormatter записывает отчет по истории в своем формате
+type ReportFormatter interface {
+	// Name — значение параметра format, по которому выбирается формат
+	Name() string
+	ContentType() string
+	Extension() string
+	// NewWriter начинает отчет за период [from, to), записи которого передаются частями
+	NewWriter(w io.Writer, from, to time.Time) RecordWriter
+	Format(w io.Writer, report *models.HistoryReport) error
+}
+
+// RecordWriter записывает отчет по частям, чтобы отчет за большой период не приходилось держать в памяти
+// целиком. Записи передаются в хронологическом порядке; Close дописывает файл, но не закрывает w.
+type RecordWriter interface {
+	Write(records []*models.HistoryRecord) error
+	Close() error
+}
+
+// format записывает отчет целиком одной частью
+func format(writer RecordWriter, records []*models.HistoryRecord) error {
+	if err := writer.Write(records); err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
+
+// Formatters — набор доступных форматов отчета; первый из них используется по умолчанию
+type Formatters struct {
+	formatters []ReportFormatter
+}
+
+func NewFormatters(formatters ...ReportFormatter) *Formatters {
+	return &Formatters{
+		formatters: formatters,
+	}
+}
+
+// Default возвращает форматы CSV, XLSX и DOCX
+func Default() *Formatters {
+	return NewFormatters(&CSVFormatter{}, &XLSXFormatter{}, &DOCXFormatter{})
+}
+
+// Select выбирает формат по параметру format, а если он не задан — по заголовку Accept.
+// Если заголовок не задан или допускает любой тип, возвращается формат по умолчанию.
+func (f *Formatters) Select(format, accept string) (ReportFormatter, bool) {
+	if format != "" {
+		for _, formatter := range f.formatters {
+			if strings.EqualFold(formatter.Name(), format) {
+				return formatter, true
+			}
+		}
+
+		return nil, false
+	}
+
+	if accept == "" {
+		return f.formatters[0], true
+	}
+
+	var best ReportFormatter
+	bestQuality := 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality <= bestQuality {
+			continue
+		}
+
+		for _, formatter := range f.formatters {
+			if matchesMediaRange(mediaType, formatter.ContentType()) {
+				best, bestQuality = formatter, quality
+				break
+			}
+		}
+	}
+
+	return best, best != nil
+}
+
+func matchesMediaRange(mediaRange, contentType string) bool {
+	if mediaRange == "*/*" || mediaRange == contentType {
+		return true
+	}
+
+	prefix, isWildcard := strings.CutSuffix(mediaRange, "/*")
+	return isWildcard && strings.HasPrefix(contentType, prefix+"/")
+}
+
+// Filename возвращает имя файла отчета за период
+func Filename(from, to time.Time, formatter ReportFormatter) string {
+	return fmt.Sprintf("history-%s-%s.%s", from.UTC().Format("20060102"), to.UTC().Format("20060102"), formatter.Extension())
+}
+
+var operationNames = map[string]string{
+	repositories.OperationAdding:   "Добавление",
+	repositories.OperationRemoving: "Удаление",
+	repositories.OperationUpdating: "Изменение даты отключения",
+}
+
+// operationName возвращает название операции для отчетов, которые читают люди
+func operationName(operationType string) string {
+	if name, ok := operationNames[operationType]; ok {
+		return name
+	}
+
+	return operationType
+}
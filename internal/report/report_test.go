@@ -0,0 +1,49 @@
+package report
+
+import (
+	"testing"
+)
+
+func TestFormattersSelect(t *testing.T) {
+	formatters := Default()
+
+	tests := []struct {
+		name   string
+		format string
+		accept string
+		want   string
+		wantOk bool
+	}{
+		{name: "default", want: "csv", wantOk: true},
+		{name: "format parameter", format: "xlsx", want: "xlsx", wantOk: true},
+		{name: "format is case-insensitive", format: "DOCX", want: "docx", wantOk: true},
+		{name: "format wins over accept", format: "csv", accept: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+			want: "csv", wantOk: true},
+		{name: "unknown format", format: "pdf"},
+		{name: "exact accept", accept: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", want: "docx", wantOk: true},
+		{name: "any type", accept: "*/*", want: "csv", wantOk: true},
+		{name: "type wildcard", accept: "text/*", want: "csv", wantOk: true},
+		{name: "quality", accept: "text/csv;q=0.5, application/vnd.openxmlformats-officedocument.spreadsheetml.sheet;q=0.9",
+			want: "xlsx", wantOk: true},
+		{name: "first of equal quality", accept: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet, text/csv",
+			want: "xlsx", wantOk: true},
+		{name: "unsupported type is skipped", accept: "application/pdf, text/csv;q=0.1", want: "csv", wantOk: true},
+		{name: "zero quality", accept: "text/csv;q=0"},
+		{name: "malformed quality", accept: "text/csv;q=high"},
+		{name: "malformed media range", accept: "text/csv;;, application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+			want: "docx", wantOk: true},
+		{name: "unsupported only", accept: "application/pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := formatters.Select(tt.format, tt.accept)
+			if ok != tt.wantOk {
+				t.Fatalf("Select(%q, %q) ok = %v, want %v", tt.format, tt.accept, ok, tt.wantOk)
+			}
+			if ok && got.Name() != tt.want {
+				t.Errorf("Select(%q, %q) = %s, want %s", tt.format, tt.accept, got.Name(), tt.want)
+			}
+		})
+	}
+}
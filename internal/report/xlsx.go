@@ -0,0 +1,255 @@
+package report
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+// XLSXFormatter записывает отчет в книгу Excel: по листу на каждый месяц (по UTC) с выделенной
+// строкой заголовков, закрепленной первой строкой и автофильтром
+type XLSXFormatter struct{}
+
+func (f *XLSXFormatter) Name() string {
+	return "xlsx"
+}
+
+func (f *XLSXFormatter) ContentType() string {
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
+
+func (f *XLSXFormatter) Extension() string {
+	return "xlsx"
+}
+
+const (
+	xlsxStyleDefault = 0
+	xlsxStyleHeader  = 1
+	xlsxStyleDate    = 2
+)
+
+var xlsxColumns = []struct {
+	title string
+	width int
+}{
+	{"Пользователь", 14},
+	{"Сегмент", 30},
+	{"Операция", 28},
+	{"Дата операции", 20},
+	{"Дата отключения", 20},
+	{"Источник", 12},
+}
+
+func (f *XLSXFormatter) NewWriter(w io.Writer, from, to time.Time) RecordWriter {
+	return &xlsxWriter{archive: zip.NewWriter(w), from: from}
+}
+
+func (f *XLSXFormatter) Format(w io.Writer, report *models.HistoryReport) error {
+	return format(f.NewWriter(w, report.From, report.To), report.Records)
+}
+
+type xlsxSheet struct {
+	name string
+	rows int
+}
+
+// xlsxWriter записывает строки сразу в лист архива. Записи приходят в хронологическом порядке, поэтому лист
+// месяца дописывается до начала следующего, а для книги в памяти остаются только названия листов и число строк.
+type xlsxWriter struct {
+	archive *zip.Writer
+	from    time.Time
+	sheets  []*xlsxSheet
+	current io.Writer
+}
+
+func (x *xlsxWriter) Write(records []*models.HistoryRecord) error {
+	for _, record := range records {
+		name := record.ActionDate.UTC().Format("2006-01")
+		if x.current == nil || x.sheets[len(x.sheets)-1].name != name {
+			if err := x.startSheet(name); err != nil {
+				return err
+			}
+		}
+
+		sheet := x.sheets[len(x.sheets)-1]
+		sheet.rows++
+		if _, err := io.WriteString(x.current, worksheetRow(sheet.rows+1, record)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close дописывает последний лист и книгу. Если записей не было, в книге остается один пустой лист
+// для месяца начала периода.
+func (x *xlsxWriter) Close() error {
+	if len(x.sheets) == 0 {
+		if err := x.startSheet(x.from.UTC().Format("2006-01")); err != nil {
+			return err
+		}
+	}
+	if err := x.endSheet(); err != nil {
+		return err
+	}
+
+	var sheetEntries, sheetRels, sheetTypes, definedNames strings.Builder
+	for i, sheet := range x.sheets {
+		id := i + 1
+		fmt.Fprintf(&sheetEntries, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(sheet.name), id, id)
+		fmt.Fprintf(&sheetRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, id, id)
+		fmt.Fprintf(&sheetTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, id)
+		fmt.Fprintf(&definedNames, `<definedName name="_xlnm._FilterDatabase" localSheetId="%d" hidden="1">'%s'!%s</definedName>`,
+			i, escape(sheet.name), absoluteRange(sheet.rows+1))
+	}
+
+	stylesId := len(x.sheets) + 1
+	err := writeParts(x.archive, []ooxmlPart{
+		{name: "[Content_Types].xml", content: `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			sheetTypes.String() + `</Types>`},
+		{name: "_rels/.rels", content: `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{name: "xl/workbook.xml", content: `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheetEntries.String() + `</sheets>` +
+			`<definedNames>` + definedNames.String() + `</definedNames></workbook>`},
+		{name: "xl/_rels/workbook.xml.rels", content: `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			sheetRels.String() +
+			fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, stylesId) +
+			`</Relationships>`},
+		{name: "xl/styles.xml", content: xlsxStyles},
+	})
+	if err != nil {
+		return err
+	}
+
+	return x.archive.Close()
+}
+
+func (x *xlsxWriter) startSheet(name string) error {
+	if err := x.endSheet(); err != nil {
+		return err
+	}
+
+	part, err := x.archive.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(x.sheets)+1))
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(part, xmlHeader+worksheetStart()); err != nil {
+		return err
+	}
+
+	x.sheets = append(x.sheets, &xlsxSheet{name: name})
+	x.current = part
+	return nil
+}
+
+func (x *xlsxWriter) endSheet() error {
+	if x.current == nil {
+		return nil
+	}
+
+	_, err := fmt.Fprintf(x.current, `</sheetData><autoFilter ref="%s"/></worksheet>`, cellRange(x.sheets[len(x.sheets)-1].rows+1))
+	x.current = nil
+	return err
+}
+
+// worksheetStart возвращает начало листа до строк с записями: закрепленную строку заголовков и ширину колонок
+func worksheetStart() string {
+	var sheet strings.Builder
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	sheet.WriteString(`<sheetViews><sheetView workbookViewId="0">` +
+		`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+
+	sheet.WriteString(`<cols>`)
+	for i, column := range xlsxColumns {
+		fmt.Fprintf(&sheet, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, column.width)
+	}
+	sheet.WriteString(`</cols><sheetData>`)
+
+	sheet.WriteString(`<row r="1">`)
+	for i, column := range xlsxColumns {
+		writeStringCell(&sheet, i, 1, column.title, xlsxStyleHeader)
+	}
+	sheet.WriteString(`</row>`)
+
+	return sheet.String()
+}
+
+func worksheetRow(row int, record *models.HistoryRecord) string {
+	var sheet strings.Builder
+	fmt.Fprintf(&sheet, `<row r="%d">`, row)
+	if record.UserId != 0 {
+		fmt.Fprintf(&sheet, `<c r="%s"><v>%d</v></c>`, cellRef(0, row), record.UserId)
+	}
+	writeStringCell(&sheet, 1, row, record.Slug, xlsxStyleDefault)
+	writeStringCell(&sheet, 2, row, operationName(record.OperationType), xlsxStyleDefault)
+	writeDateCell(&sheet, 3, row, record.ActionDate)
+	if record.DeadlineDate.Valid {
+		writeDateCell(&sheet, 4, row, record.DeadlineDate.Time)
+	}
+	if record.Actor.Valid {
+		writeStringCell(&sheet, 5, row, record.Actor.String, xlsxStyleDefault)
+	}
+	sheet.WriteString(`</row>`)
+
+	return sheet.String()
+}
+
+func writeStringCell(sheet *strings.Builder, column, row int, value string, style int) {
+	fmt.Fprintf(sheet, `<c r="%s" t="inlineStr" s="%d"><is><t xml:space="preserve">%s</t></is></c>`,
+		cellRef(column, row), style, escape(value))
+}
+
+// writeDateCell записывает дату как число дней с 30.12.1899 — так даты хранятся в Excel
+func writeDateCell(sheet *strings.Builder, column, row int, value time.Time) {
+	serial := value.UTC().Sub(excelEpoch).Hours() / 24
+	fmt.Fprintf(sheet, `<c r="%s" s="%d"><v>%s</v></c>`, cellRef(column, row), xlsxStyleDate,
+		strconv.FormatFloat(serial, 'f', -1, 64))
+}
+
+var excelEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+func cellRef(column, row int) string {
+	return string(rune('A'+column)) + strconv.Itoa(row)
+}
+
+func cellRange(rows int) string {
+	return "A1:" + cellRef(len(xlsxColumns)-1, rows)
+}
+
+func absoluteRange(rows int) string {
+	last := string(rune('A' + len(xlsxColumns) - 1))
+	return fmt.Sprintf("$A$1:$%s$%d", last, rows)
+}
+
+const xlsxStyles = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2">` +
+	`<font><sz val="11"/><name val="Calibri"/><family val="2"/></font>` +
+	`<font><b/><sz val="11"/><color rgb="FFFFFFFF"/><name val="Calibri"/><family val="2"/></font>` +
+	`</fonts>` +
+	`<fills count="3">` +
+	`<fill><patternFill patternType="none"/></fill>` +
+	`<fill><patternFill patternType="gray125"/></fill>` +
+	`<fill><patternFill patternType="solid"><fgColor rgb="FF4472C4"/><bgColor indexed="64"/></patternFill></fill>` +
+	`</fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="2" borderId="0" xfId="0" applyFont="1" applyFill="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
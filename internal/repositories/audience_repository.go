@@ -0,0 +1,161 @@
+package repositories
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/audience"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+type PostgresAudienceRepository struct {
+	db *sqlx.DB
+}
+
+func NewAudienceRepository(db *sqlx.DB) *PostgresAudienceRepository {
+	return &PostgresAudienceRepository{
+		db: db,
+	}
+}
+
+// UnknownSegmentsError содержит названия сегментов из запроса, которых не существует
+type UnknownSegmentsError struct {
+	Slugs []string
+}
+
+func (e *UnknownSegmentsError) Error() string {
+	return fmt.Sprintf("segments not found: %s", strings.Join(e.Slugs, ", "))
+}
+
+func (e *UnknownSegmentsError) Unwrap() error {
+	return ErrSegmentNotFound
+}
+
+const (
+	selectExistingSegments = `SELECT slug FROM segments WHERE slug = ANY($1);`
+	// условие выражения собирается из audienceMembership для каждого сегмента; названия сегментов
+	// передаются первыми параметрами, за ними — курсор и размер страницы
+	selectAudienceCount = `SELECT count(*) FROM users u WHERE %s;`
+	selectAudiencePage  = `SELECT u.id FROM users u WHERE %s AND u.id > $%d ORDER BY u.id LIMIT $%d;`
+	audienceMembership  = `EXISTS (SELECT 1 FROM users_segments us WHERE us.user_id = u.id AND us.slug = $%d
+                                    AND (us.deadline_date IS NULL OR us.deadline_date > CURRENT_TIMESTAMP))`
+	selectSegmentOverlap = `SELECT a.slug, b.slug, count(*) FROM users_segments a
+                                    JOIN users_segments b ON b.user_id = a.user_id
+                                    WHERE a.slug = ANY($1) AND b.slug = ANY($1)
+                                    AND (a.deadline_date IS NULL OR a.deadline_date > CURRENT_TIMESTAMP)
+                                    AND (b.deadline_date IS NULL OR b.deadline_date > CURRENT_TIMESTAMP)
+                                    GROUP BY a.slug, b.slug;`
+)
+
+// QueryAudience возвращает число пользователей, подходящих под выражение, и страницу их идентификаторов
+// после after. Учитываются только активные участия; NOT отбирает всех пользователей, не состоящих в сегменте.
+func (r *PostgresAudienceRepository) QueryAudience(expression *audience.Expression, after, limit int) (*models.AudienceResult, error) {
+	slugs := expression.Slugs()
+	if err := r.checkSegments(slugs); err != nil {
+		return nil, err
+	}
+
+	params := make(map[string]int, len(slugs))
+	args := make([]interface{}, 0, len(slugs)+2)
+	for _, slug := range slugs {
+		args = append(args, slug)
+		params[slug] = len(args)
+	}
+	condition := expression.Compile(func(slug string) string {
+		return fmt.Sprintf(audienceMembership, params[slug])
+	})
+
+	result := new(models.AudienceResult)
+	if err := r.db.QueryRow(fmt.Sprintf(selectAudienceCount, condition), args...).Scan(&result.Count); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	args = append(args, after, limit)
+	page := fmt.Sprintf(selectAudiencePage, condition, len(args)-1, len(args))
+	userIds, err := selectIds(r.db, page, args...)
+	if err != nil {
+		return nil, err
+	}
+	result.UserIds = userIds
+
+	return result, nil
+}
+
+// GetSegmentOverlap считает попарные пересечения активных участников сегментов
+func (r *PostgresAudienceRepository) GetSegmentOverlap(slugs []string) (*models.SegmentOverlap, error) {
+	if err := r.checkSegments(slugs); err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int, len(slugs))
+	overlap := &models.SegmentOverlap{
+		Slugs:  slugs,
+		Sizes:  make([]int, len(slugs)),
+		Matrix: make([][]int, len(slugs)),
+	}
+	for i, slug := range slugs {
+		index[slug] = i
+		overlap.Matrix[i] = make([]int, len(slugs))
+	}
+
+	rows, err := r.db.Query(selectSegmentOverlap, pq.Array(slugs))
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a, b string
+		var count int
+		if err := rows.Scan(&a, &b, &count); err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+
+		overlap.Matrix[index[a]][index[b]] = count
+		if a == b {
+			overlap.Sizes[index[a]] = count
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return overlap, nil
+}
+
+func (r *PostgresAudienceRepository) checkSegments(slugs []string) error {
+	rows, err := r.db.Query(selectExistingSegments, pq.Array(slugs))
+	if err != nil {
+		return ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool, len(slugs))
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return ErrDatabaseReadingError
+		}
+		existing[slug] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return ErrDatabaseReadingError
+	}
+
+	var unknown []string
+	for _, slug := range slugs {
+		if !existing[slug] {
+			unknown = append(unknown, slug)
+		}
+	}
+	if len(unknown) > 0 {
+		return &UnknownSegmentsError{Slugs: unknown}
+	}
+
+	return nil
+}
@@ -1,10 +1,14 @@
 package repositories
 
 import (
+	"database/sql"
 	goErrors "errors"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
 )
 
 type PostgresHistoryRepository struct {
@@ -25,11 +29,41 @@ func NewHistoryRepository(db *sqlx.DB) *PostgresHistoryRepository {
 }
 
 const (
-	saveRecord = `INSERT INTO history (user_id, slug, action_date, operation_type) VALUES ($1, $2, $3, $4);`
+	OperationAdding   = "ADDING"
+	OperationRemoving = "REMOVING"
+	// OperationUpdating — изменение даты отключения пользователя, который уже состоит в сегменте
+	OperationUpdating = "UPDATING"
+)
+
+// Источники изменений, которые записываются в историю как actor
+const (
+	ActorApi     = "api"
+	ActorImport  = "import"
+	ActorRollout = "rollout"
+	ActorErasure = "erasure"
+)
+
+// Вместе с операцией сохраняется дата отключения, действующая после нее, чтобы по истории можно было
+// восстановить состав сегментов на любой момент времени. Для удаления привязки ее уже нет, и дата остается пустой.
+// Каждая запись истории тем же запросом попадает в outbox как событие об изменении участия — так событие
+// записывается в одной транзакции с изменением и не может ни потеряться, ни появиться без него.
+const (
+	saveBulkRecords = `WITH records AS (
+                                        INSERT INTO history (user_id, slug, action_date, operation_type, deadline_date, actor)
+                                        SELECT u.id, $2, $3, $4, us.deadline_date, $5 FROM unnest($1::integer[]) AS u (id)
+                                        LEFT JOIN users_segments us ON us.user_id = u.id AND us.slug = $2
+                                        RETURNING user_id, slug, action_date, operation_type, deadline_date, actor
+                                    )
+                                    INSERT INTO outbox_events (event_type, user_id, external_id, slug, deadline_date, actor, occurred_at)
+                                    SELECT CASE r.operation_type WHEN 'ADDING' THEN 'membership.added'
+                                            WHEN 'REMOVING' THEN 'membership.removed' ELSE 'membership.updated' END,
+                                        r.user_id, u.external_id, r.slug, r.deadline_date, r.actor, r.action_date
+                                    FROM records r LEFT JOIN users u ON u.id = r.user_id;`
 )
 
-func (r *PostgresHistoryRepository) SetAddingHistoryRecord(userId int, slug string) error {
-	_, err := r.db.Exec(saveRecord, userId, slug, time.Now(), "ADDING")
+// SetBulkHistoryRecords записывает одну операцию над сегментом для множества пользователей в рамках транзакции
+func (r *PostgresHistoryRepository) SetBulkHistoryRecords(tx *sqlx.Tx, userIds []int, slug, operationType, actor string) error {
+	_, err := tx.Exec(saveBulkRecords, pq.Array(userIds), slug, time.Now(), operationType, actor)
 	if err != nil {
 		return ErrDatabaseWritingError
 	}
@@ -37,11 +71,297 @@ func (r *PostgresHistoryRepository) SetAddingHistoryRecord(userId int, slug stri
 	return nil
 }
 
-func (r *PostgresHistoryRepository) SetRemovingHistoryRecord(userId int, slug string) error {
-	_, err := r.db.Exec(saveRecord, userId, slug, time.Now(), "REMOVING")
+// Состав сегментов на момент asOf восстанавливается по последней операции над каждой привязкой, выполненной
+// не позже asOf: привязка действовала, если это не удаление и дата отключения еще не наступила.
+// Псевдонимизированная история удаленных пользователей не учитывается. Записи, сделанные до того, как в историю
+// начала сохраняться дата отключения, не содержат ее — если такая запись последняя для привязки, дата берется
+// из users_segments, как и при восстановлении участий в analytics.
+const (
+	// legacyDeadline присоединяет к последней до момента записи истории last дату отключения из users_segments,
+	// если в записи ее нет и после нее привязка не менялась
+	legacyDeadline = `LEFT JOIN users_segments us ON us.user_id = last.user_id AND us.slug = last.slug
+                                    AND last.deadline_date IS NULL
+                                    AND NOT EXISTS (SELECT 1 FROM history later
+                                        WHERE later.user_id = last.user_id AND later.slug = last.slug AND later.id > last.id)`
+
+	selectSegmentsOfUserAsOf = `SELECT last.slug, COALESCE(last.deadline_date, us.deadline_date) FROM (
+                                        SELECT DISTINCT ON (slug) id, user_id, slug, operation_type, deadline_date FROM history
+                                        WHERE user_id = $1 AND action_date <= $2
+                                        ORDER BY slug, action_date DESC, id DESC
+                                    ) last ` + legacyDeadline + `
+                                    WHERE last.operation_type <> 'REMOVING'
+                                    AND COALESCE(last.deadline_date, us.deadline_date, 'infinity') > $2
+                                    ORDER BY last.slug;`
+	selectUsersOfSegmentAsOf = `SELECT last.user_id FROM (
+                                        SELECT DISTINCT ON (user_id) id, user_id, slug, operation_type, deadline_date FROM history
+                                        WHERE slug = $1 AND user_id IS NOT NULL AND action_date <= $2
+                                        ORDER BY user_id, action_date DESC, id DESC
+                                    ) last ` + legacyDeadline + `
+                                    WHERE last.operation_type <> 'REMOVING'
+                                    AND COALESCE(last.deadline_date, us.deadline_date, 'infinity') > $2
+                                    ORDER BY last.user_id;`
+)
+
+// GetSegmentsOfUserAsOf возвращает сегменты, в которых пользователь состоял на момент asOf, с действовавшими тогда датами отключения
+func (r *PostgresHistoryRepository) GetSegmentsOfUserAsOf(userId int, asOf time.Time) ([]*models.UserSegment, error) {
+	rows, err := r.db.Query(selectSegmentsOfUserAsOf, userId, asOf)
 	if err != nil {
-		return ErrDatabaseWritingError
+		return nil, ErrDatabaseReadingError
 	}
+	defer rows.Close()
 
-	return nil
+	var segments []*models.UserSegment
+	for rows.Next() {
+		segment := &models.UserSegment{UserId: userId}
+		if err := rows.Scan(&segment.Slug, &segment.DeadlineDate); err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		segments = append(segments, segment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return segments, nil
+}
+
+// GetUsersOfSegmentAsOf возвращает идентификаторы пользователей, которые состояли в сегменте на момент asOf
+func (r *PostgresHistoryRepository) GetUsersOfSegmentAsOf(slug string, asOf time.Time) ([]int, error) {
+	var exists bool
+	if err := r.db.QueryRow(selectSegmentExists, slug).Scan(&exists); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	if !exists {
+		return nil, ErrSegmentNotFound
+	}
+
+	return selectIds(r.db, selectUsersOfSegmentAsOf, slug, asOf)
+}
+
+const (
+	selectSegmentStatesAsOf = `SELECT last.user_id, last.operation_type, last.action_date,
+                                        COALESCE(last.deadline_date, us.deadline_date) FROM (
+                                        SELECT DISTINCT ON (user_id) id, user_id, slug, operation_type, action_date, deadline_date
+                                        FROM history
+                                        WHERE slug = $1 AND user_id IS NOT NULL AND action_date <= $2
+                                        ORDER BY user_id, action_date DESC, id DESC
+                                    ) last ` + legacyDeadline + `
+                                    ORDER BY last.user_id;`
+)
+
+type membershipState struct {
+	operationType string
+	actionDate    time.Time
+	deadlineDate  sql.NullTime
+}
+
+func (s *membershipState) activeAt(moment time.Time) bool {
+	return s.operationType != OperationRemoving && (!s.deadlineDate.Valid || s.deadlineDate.Time.After(moment))
+}
+
+// GetSegmentDiff сравнивает состав сегмента в моменты from и to: возвращает вошедших в сегмент и вышедших из него
+// пользователей с причиной выхода — удаление или наступление даты отключения
+func (r *PostgresHistoryRepository) GetSegmentDiff(slug string, from, to time.Time) (*models.SegmentDiff, error) {
+	var exists bool
+	if err := r.db.QueryRow(selectSegmentExists, slug).Scan(&exists); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	if !exists {
+		return nil, ErrSegmentNotFound
+	}
+
+	fromIds, err := selectIds(r.db, selectUsersOfSegmentAsOf, slug, from)
+	if err != nil {
+		return nil, err
+	}
+	membersFrom := toSet(fromIds)
+
+	rows, err := r.db.Query(selectSegmentStatesAsOf, slug, to)
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	diff := &models.SegmentDiff{
+		Slug:        slug,
+		From:        from,
+		To:          to,
+		MembersFrom: len(fromIds),
+	}
+	for rows.Next() {
+		var userId int
+		state := new(membershipState)
+		if err := rows.Scan(&userId, &state.operationType, &state.actionDate, &state.deadlineDate); err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+
+		active := state.activeAt(to)
+		switch {
+		case active:
+			diff.MembersTo++
+			if !membersFrom[userId] {
+				diff.Joined = append(diff.Joined, &models.DiffEntry{UserId: userId, Date: state.actionDate})
+			}
+		case membersFrom[userId] && state.operationType == OperationRemoving:
+			diff.Left = append(diff.Left, &models.DiffEntry{UserId: userId, Reason: models.DiffReasonRemoved, Date: state.actionDate})
+		case membersFrom[userId]:
+			diff.Left = append(diff.Left, &models.DiffEntry{UserId: userId, Reason: models.DiffReasonExpired, Date: state.deadlineDate.Time})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return diff, nil
+}
+
+const (
+	selectHistory = `SELECT id, COALESCE(user_id, 0), slug, action_date, operation_type, deadline_date, actor FROM history
+                                    WHERE ($1 = 0 OR user_id = $1)
+                                    AND ($2 = '' OR slug = $2)
+                                    AND ($3 = '' OR operation_type = $3)
+                                    AND ($4 = '' OR actor = $4)
+                                    AND ($5::timestamptz IS NULL OR action_date >= $5)
+                                    AND ($6::timestamptz IS NULL OR action_date < $6)
+                                    AND ($7::bigint = 0 OR id < $7)
+                                    ORDER BY id DESC
+                                    LIMIT $8;`
+)
+
+// GetHistory возвращает страницу записей истории, подходящих под фильтр, от новых к старым
+func (r *PostgresHistoryRepository) GetHistory(filter *models.HistoryFilter) ([]*models.HistoryRecord, error) {
+	var from, to interface{}
+	if !filter.From.IsZero() {
+		from = filter.From
+	}
+	if !filter.To.IsZero() {
+		to = filter.To
+	}
+
+	rows, err := r.db.Query(selectHistory, filter.UserId, filter.Slug, filter.OperationType, filter.Actor,
+		from, to, filter.After, filter.Limit)
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	var records []*models.HistoryRecord
+	for rows.Next() {
+		record := new(models.HistoryRecord)
+		err := rows.Scan(&record.Id, &record.UserId, &record.Slug, &record.ActionDate, &record.OperationType,
+			&record.DeadlineDate, &record.Actor)
+		if err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return records, nil
+}
+
+const (
+	selectHistoryReport = `SELECT id, COALESCE(user_id, 0), slug, action_date, operation_type, deadline_date, actor FROM history
+                                    WHERE ($1 = 0 OR user_id = $1)
+                                    AND ($2 = '' OR slug = $2)
+                                    AND action_date >= $3 AND action_date < $4
+                                    ORDER BY action_date, id;`
+)
+
+// GetHistoryReport возвращает записи истории за период [from, to) в хронологическом порядке для отчета.
+// Нулевой userId и пустой slug не ограничивают выборку.
+func (r *PostgresHistoryRepository) GetHistoryReport(userId int, slug string, from, to time.Time) (*models.HistoryReport, error) {
+	rows, err := r.db.Query(selectHistoryReport, userId, slug, from, to)
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	report := &models.HistoryReport{
+		From: from,
+		To:   to,
+	}
+	for rows.Next() {
+		record := new(models.HistoryRecord)
+		err := rows.Scan(&record.Id, &record.UserId, &record.Slug, &record.ActionDate, &record.OperationType,
+			&record.DeadlineDate, &record.Actor)
+		if err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		report.Records = append(report.Records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return report, nil
+}
+
+const (
+	selectSegmentTimeline = `SELECT id, user_id, slug, action_date, operation_type, deadline_date, actor FROM history
+                                    WHERE slug = $1 AND user_id IS NOT NULL AND action_date < $2
+                                    ORDER BY user_id, action_date, id;`
+	selectSegmentDeadlines = `SELECT user_id, deadline_date FROM users_segments WHERE slug = $1;`
+)
+
+// GetSegmentTimeline возвращает записи истории сегмента до момента to, сгруппированные по пользователям,
+// и текущих участников сегмента. Записи псевдонимизированных пользователей не возвращаются.
+func (r *PostgresHistoryRepository) GetSegmentTimeline(slug string, to time.Time) (*models.SegmentTimeline, error) {
+	var exists bool
+	if err := r.db.QueryRow(selectSegmentExists, slug).Scan(&exists); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	if !exists {
+		return nil, ErrSegmentNotFound
+	}
+
+	rows, err := r.db.Query(selectSegmentTimeline, slug, to)
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	timeline := &models.SegmentTimeline{
+		Members: make(map[int]sql.NullTime),
+	}
+	for rows.Next() {
+		record := new(models.HistoryRecord)
+		err := rows.Scan(&record.Id, &record.UserId, &record.Slug, &record.ActionDate, &record.OperationType,
+			&record.DeadlineDate, &record.Actor)
+		if err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		timeline.Records = append(timeline.Records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	members, err := r.db.Query(selectSegmentDeadlines, slug)
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer members.Close()
+
+	for members.Next() {
+		var userId int
+		var deadline sql.NullTime
+		if err := members.Scan(&userId, &deadline); err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		timeline.Members[userId] = deadline
+	}
+
+	if err := members.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return timeline, nil
 }
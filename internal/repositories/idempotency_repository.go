@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"database/sql"
+	goErrors "errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+type PostgresIdempotencyRepository struct {
+	db *sqlx.DB
+}
+
+func NewIdempotencyRepository(db *sqlx.DB) *PostgresIdempotencyRepository {
+	return &PostgresIdempotencyRepository{
+		db: db,
+	}
+}
+
+const (
+	// ключ освобождается, если истек его TTL или если запрос не завершился за время аренды
+	deleteExpiredIdempotencyKey = `DELETE FROM idempotency_keys WHERE key = $1
+                                    AND (created_at < $2 OR (status_code IS NULL AND created_at < $3));`
+	reserveIdempotencyKey = `INSERT INTO idempotency_keys (key, fingerprint, created_at) VALUES ($1, $2, $3)
+                                    ON CONFLICT (key) DO NOTHING;`
+	selectIdempotencyKey = `SELECT key, fingerprint, status_code, content_type, response_body, created_at
+                                    FROM idempotency_keys WHERE key = $1;`
+	completeIdempotencyKey = `UPDATE idempotency_keys SET status_code = $2, content_type = $3, response_body = $4
+                                    WHERE key = $1 AND created_at = $5 AND status_code IS NULL;`
+	releaseIdempotencyKey = `DELETE FROM idempotency_keys WHERE key = $1 AND created_at = $2 AND status_code IS NULL;`
+	purgeIdempotencyKeys  = `DELETE FROM idempotency_keys WHERE created_at < $1;`
+)
+
+// ReserveIdempotencyKey занимает ключ для нового запроса с временем резервирования reservedAt. Если ключ уже занят запросом,
+// сохраненным не раньше expiredBefore, возвращается этот запрос и false. Истекшие ключи, а также ключи
+// незавершенных запросов, занятые раньше leaseExpiredBefore, перезаписываются.
+func (r *PostgresIdempotencyRepository) ReserveIdempotencyKey(key, fingerprint string, reservedAt, expiredBefore,
+	leaseExpiredBefore time.Time) (*models.IdempotencyRecord, bool, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, false, ErrDatabaseWritingError
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err = tx.Exec(deleteExpiredIdempotencyKey, key, expiredBefore, leaseExpiredBefore); err != nil {
+		return nil, false, ErrDatabaseWritingError
+	}
+
+	result, err := tx.Exec(reserveIdempotencyKey, key, fingerprint, reservedAt)
+	if err != nil {
+		return nil, false, ErrDatabaseWritingError
+	}
+
+	reserved, err := result.RowsAffected()
+	if err != nil {
+		return nil, false, ErrDatabaseWritingError
+	}
+
+	record := new(models.IdempotencyRecord)
+	if reserved == 0 {
+		err = tx.QueryRow(selectIdempotencyKey, key).Scan(&record.Key, &record.Fingerprint, &record.StatusCode,
+			&record.ContentType, &record.ResponseBody, &record.CreatedAt)
+		if err != nil {
+			if goErrors.Is(err, sql.ErrNoRows) {
+				return nil, false, ErrRecordNotFound
+			}
+
+			return nil, false, ErrDatabaseReadingError
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, false, ErrDatabaseWritingError
+	}
+
+	return record, reserved > 0, nil
+}
+
+// CompleteIdempotencyKey сохраняет ответ на запрос с ключом идемпотентности, занятым в reservedAt.
+// Если после истечения аренды ключ занял повтор, ответ не сохраняется.
+func (r *PostgresIdempotencyRepository) CompleteIdempotencyKey(key string, reservedAt time.Time, statusCode int,
+	contentType string, body []byte) error {
+	_, err := r.db.Exec(completeIdempotencyKey, key, statusCode, contentType, body, reservedAt)
+	if err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey освобождает ключ запроса, который не удалось выполнить, чтобы его можно было повторить
+func (r *PostgresIdempotencyRepository) ReleaseIdempotencyKey(key string, reservedAt time.Time) error {
+	_, err := r.db.Exec(releaseIdempotencyKey, key, reservedAt)
+	if err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	return nil
+}
+
+// PurgeIdempotencyKeys удаляет ключи идемпотентности, занятые раньше before, и возвращает их число
+func (r *PostgresIdempotencyRepository) PurgeIdempotencyKeys(before time.Time) (int, error) {
+	result, err := r.db.Exec(purgeIdempotencyKeys, before)
+	if err != nil {
+		return 0, ErrDatabaseWritingError
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, ErrDatabaseWritingError
+	}
+
+	return int(purged), nil
+}
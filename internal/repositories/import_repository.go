@@ -0,0 +1,241 @@
+package repositories
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+type PostgresImportRepository struct {
+	db      *sqlx.DB
+	hr      HistoryRepository
+	holdout Holdout
+	users   *UserProvisioner
+}
+
+func NewImportRepository(db *sqlx.DB, hr HistoryRepository, holdout Holdout, users *UserProvisioner) *PostgresImportRepository {
+	return &PostgresImportRepository{
+		db:      db,
+		hr:      hr,
+		holdout: holdout,
+		users:   users,
+	}
+}
+
+const (
+	selectImportSegments    = `SELECT slug, COALESCE(layer, '') FROM segments WHERE slug = ANY($1);`
+	selectImportMemberships = `SELECT us.user_id, us.slug, COALESCE(s.layer, '') FROM users_segments us
+                                    JOIN segments s ON s.slug = us.slug
+                                    WHERE us.user_id = ANY($1)
+                                    AND (us.deadline_date IS NULL OR us.deadline_date > CURRENT_TIMESTAMP);`
+	importMembership = `INSERT INTO users_segments (user_id, slug, deadline_date) VALUES ($1, $2, $3)
+                                    ON CONFLICT (user_id, slug) DO UPDATE
+                                    SET deadline_date = EXCLUDED.deadline_date, auto_enrolled = false;`
+)
+
+// importKey — пара пользователь и сегмент либо пользователь и слой
+type importKey struct {
+	userId int
+	value  string
+}
+
+// ImportRows проверяет строки импорта и в одной транзакции применяет корректные из них.
+// Ошибочные строки попадают в отчет, при dryRun транзакция откатывается.
+func (r *PostgresImportRepository) ImportRows(rows []*models.ImportRow, dryRun bool) (*models.ImportReport, error) {
+	report := &models.ImportReport{Rows: len(rows)}
+
+	var keys, memberKeys, createKeys, slugs []string
+	for _, row := range rows {
+		keys = append(keys, row.UserKey)
+		if row.Slug != "" {
+			memberKeys = append(memberKeys, row.UserKey)
+			slugs = append(slugs, row.Slug)
+		} else {
+			createKeys = append(createKeys, row.UserKey)
+		}
+	}
+	keys = uniqueKeys(keys)
+
+	// пользователи из строк с сегментами создаются, если это разрешено режимом USERS_MODE, а из строк без
+	// сегмента — в любом режиме, кроме directory, где их должен подтвердить сервис пользователей
+	resolution, err := r.users.ResolveCreating(r.db, uniqueKeys(memberKeys), uniqueKeys(createKeys))
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if err = r.users.Provision(tx, resolution); err != nil {
+		return nil, err
+	}
+
+	users, err := resolveUsers(tx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	erased, err := selectErasedKeys(tx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	layers, err := selectSegmentLayers(tx, slugs)
+	if err != nil {
+		return nil, err
+	}
+
+	userIds := make([]int, 0, len(users))
+	for _, user := range users {
+		userIds = append(userIds, user.Id)
+	}
+
+	memberships, occupied, err := r.selectMemberships(tx, uniqueIds(userIds))
+	if err != nil {
+		return nil, err
+	}
+
+	added := make(map[string][]int)
+	for _, row := range rows {
+		if erased[row.UserKey] {
+			report.Errors = append(report.Errors, &models.ImportError{Line: row.Line, Error: "Пользователь удален по запросу на удаление данных"})
+			continue
+		}
+
+		user, userExists := users[row.UserKey]
+		if row.Slug == "" {
+			_, externalId, _ := models.ParseUserKey(row.UserKey)
+			switch {
+			case resolution.Created[row.UserKey]:
+				// повторные строки того же пользователя пропускаются
+				delete(resolution.Created, row.UserKey)
+				report.Applied++
+			case userExists:
+				report.Skipped++
+			case externalId == "":
+				report.Errors = append(report.Errors, &models.ImportError{Line: row.Line,
+					Error: "Пользователь не найден: числовой идентификатор назначает сервис, создать пользователя можно только по внешнему идентификатору"})
+			default:
+				report.Errors = append(report.Errors, &models.ImportError{Line: row.Line,
+					Error: "Пользователь не найден в сервисе пользователей"})
+			}
+			continue
+		}
+
+		layer, segmentExists := layers[row.Slug]
+
+		var message string
+		switch {
+		case !userExists:
+			message = "Пользователь не найден"
+		case !segmentExists:
+			message = fmt.Sprintf("Сегмент %s не найден", row.Slug)
+		case memberships[importKey{userId: user.Id, value: row.Slug}]:
+			report.Skipped++
+			continue
+		case r.holdout.ContainsKey(user.BucketingKey()):
+			message = "Пользователь входит в глобальную контрольную группу"
+		case layer != "" && occupied[importKey{userId: user.Id, value: layer}] != "":
+			message = fmt.Sprintf("Пользователь уже состоит в сегменте %s из слоя %s", occupied[importKey{userId: user.Id, value: layer}], layer)
+		}
+
+		if message != "" {
+			report.Errors = append(report.Errors, &models.ImportError{Line: row.Line, Error: message})
+			continue
+		}
+
+		var deadline interface{}
+		if row.DeadlineDate != "" {
+			deadline = row.DeadlineDate
+		}
+
+		if _, err = tx.Exec(importMembership, user.Id, row.Slug, deadline); err != nil {
+			return nil, membershipWritingError(err)
+		}
+
+		memberships[importKey{userId: user.Id, value: row.Slug}] = true
+		if layer != "" {
+			occupied[importKey{userId: user.Id, value: layer}] = row.Slug
+		}
+		added[row.Slug] = append(added[row.Slug], user.Id)
+		report.Applied++
+	}
+
+	for slug, ids := range added {
+		if err = r.hr.SetBulkHistoryRecords(tx, ids, slug, OperationAdding, ActorImport); err != nil {
+			return nil, err
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+
+	return report, nil
+}
+
+// selectSegmentLayers возвращает слои существующих сегментов из списка (пустая строка — сегмент вне слоя)
+func selectSegmentLayers(tx *sqlx.Tx, slugs []string) (map[string]string, error) {
+	layers := make(map[string]string)
+
+	rows, err := tx.Query(selectImportSegments, pq.Array(slugs))
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var slug, layer string
+		if err := rows.Scan(&slug, &layer); err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		layers[slug] = layer
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return layers, nil
+}
+
+// selectMemberships возвращает активные привязки пользователей и занятые ими слои
+func (r *PostgresImportRepository) selectMemberships(tx *sqlx.Tx, userIds []int) (map[importKey]bool, map[importKey]string, error) {
+	memberships := make(map[importKey]bool)
+	occupied := make(map[importKey]string)
+
+	rows, err := tx.Query(selectImportMemberships, pq.Array(userIds))
+	if err != nil {
+		return nil, nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userId int
+		var slug, layer string
+		if err := rows.Scan(&userId, &slug, &layer); err != nil {
+			return nil, nil, ErrDatabaseReadingError
+		}
+
+		memberships[importKey{userId: userId, value: slug}] = true
+		if layer != "" {
+			occupied[importKey{userId: userId, value: layer}] = slug
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, ErrDatabaseReadingError
+	}
+
+	return memberships, occupied, nil
+}
@@ -0,0 +1,298 @@
+package repositories
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+type PostgresMembershipRepository struct {
+	db      *sqlx.DB
+	hr      HistoryRepository
+	holdout Holdout
+	users   *UserProvisioner
+}
+
+func NewMembershipRepository(db *sqlx.DB, hr HistoryRepository, holdout Holdout, users *UserProvisioner) *PostgresMembershipRepository {
+	return &PostgresMembershipRepository{
+		db:      db,
+		hr:      hr,
+		holdout: holdout,
+		users:   users,
+	}
+}
+
+const (
+	selectExistingUsers  = `SELECT id FROM users WHERE id = ANY($1);`
+	selectSegmentMembers = `SELECT user_id FROM users_segments WHERE slug = $1 AND user_id = ANY($2)
+                                    AND (deadline_date IS NULL OR deadline_date > CURRENT_TIMESTAMP);`
+	selectExpiredMembers = `SELECT user_id FROM users_segments WHERE slug = $1 AND user_id = ANY($2)
+                                    AND deadline_date <= CURRENT_TIMESTAMP;`
+	selectLayerConflicted = `SELECT DISTINCT us.user_id FROM users_segments us
+                                    JOIN segments s ON s.slug = us.slug
+                                    WHERE us.user_id = ANY($2) AND us.slug <> $1
+                                    AND s.layer = (SELECT layer FROM segments WHERE slug = $1)
+                                    AND (us.deadline_date IS NULL OR us.deadline_date > CURRENT_TIMESTAMP);`
+	addSegmentToUsers = `INSERT INTO users_segments (user_id, slug, deadline_date)
+                                    SELECT unnest($2::integer[]), $1, $3
+                                    ON CONFLICT (user_id, slug) DO UPDATE
+                                    SET deadline_date = EXCLUDED.deadline_date, auto_enrolled = false
+                                    RETURNING user_id;`
+	checkDeadline        = `SELECT $1::timestamp with time zone;`
+	takeSegmentFromUsers = `DELETE FROM users_segments WHERE slug = $1 AND user_id = ANY($2)
+                                    AND (deadline_date IS NULL OR deadline_date > CURRENT_TIMESTAMP) RETURNING user_id;`
+)
+
+func (r *PostgresMembershipRepository) CheckIfSegmentExists(slug string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(selectSegmentExists, slug).Scan(&exists)
+	if err != nil {
+		return false, ErrDatabaseReadingError
+	}
+
+	return exists, nil
+}
+
+// CheckDeadline проверяет, что дату отключения от сегмента можно сохранить, до применения первой пачки
+func (r *PostgresMembershipRepository) CheckDeadline(ttl string) error {
+	var deadline interface{}
+	err := r.db.QueryRow(checkDeadline, ttl).Scan(&deadline)
+	if err != nil {
+		return membershipWritingError(err)
+	}
+
+	return nil
+}
+
+// AddSegmentToUsers добавляет сегмент пачке пользователей в одной транзакции. Пропускаются пользователи,
+// которые уже состоят в сегменте, входят в контрольную группу или состоят в другом сегменте того же слоя,
+// истекшие привязки активируются повторно. Пользователи задаются числовыми или внешними идентификаторами,
+// неизвестные пользователи с внешним идентификатором создаются, если это разрешено режимом USERS_MODE.
+// При dryRun транзакция откатывается.
+func (r *PostgresMembershipRepository) AddSegmentToUsers(slug string, keys []string, ttl string, dryRun bool) (*models.BatchResult, error) {
+	keys = uniqueKeys(keys)
+	result := new(models.BatchResult)
+
+	resolution, err := r.users.Resolve(r.db, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if err = r.users.Provision(tx, resolution); err != nil {
+		return nil, err
+	}
+	result.Missing = len(keys) - len(resolution.Users)
+
+	// пользователи, найденные до начала транзакции, могли быть удалены
+	userIds := resolution.UserIds()
+	existing, err := selectIds(tx, selectExistingUsers, pq.Array(userIds))
+	if err != nil {
+		return nil, err
+	}
+	result.Missing += len(userIds) - len(existing)
+
+	inHoldout := make(map[int]bool, len(resolution.Users))
+	for _, user := range resolution.Users {
+		inHoldout[user.Id] = r.holdout.ContainsKey(user.BucketingKey())
+	}
+
+	members, err := selectIds(tx, selectSegmentMembers, slug, pq.Array(existing))
+	if err != nil {
+		return nil, err
+	}
+
+	conflicted, err := selectIds(tx, selectLayerConflicted, slug, pq.Array(existing))
+	if err != nil {
+		return nil, err
+	}
+
+	expired, err := selectIds(tx, selectExpiredMembers, slug, pq.Array(existing))
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := toSet(members, conflicted)
+	var adding []int
+	for _, userId := range existing {
+		if excluded[userId] || inHoldout[userId] {
+			continue
+		}
+		adding = append(adding, userId)
+	}
+
+	var deadline interface{}
+	if ttl != "" {
+		deadline = ttl
+	}
+
+	added, err := selectIds(tx, addSegmentToUsers, slug, pq.Array(adding), deadline)
+	if err != nil {
+		return nil, membershipWritingError(err)
+	}
+	reactivated := toSet(expired)
+	for _, userId := range added {
+		if reactivated[userId] {
+			result.Reactivated++
+		}
+	}
+	result.Added = len(added) - result.Reactivated
+	result.Skipped = len(existing) - len(added)
+
+	if dryRun {
+		return result, nil
+	}
+
+	if len(added) > 0 {
+		if err = r.hr.SetBulkHistoryRecords(tx, added, slug, OperationAdding, ActorApi); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+
+	return result, nil
+}
+
+// TakeSegmentFromUsers удаляет сегмент у пачки пользователей, заданных числовыми или внешними идентификаторами,
+// в одной транзакции. При dryRun транзакция откатывается.
+func (r *PostgresMembershipRepository) TakeSegmentFromUsers(slug string, keys []string, dryRun bool) (*models.BatchResult, error) {
+	keys = uniqueKeys(keys)
+	result := new(models.BatchResult)
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	users, err := resolveUsers(tx, keys)
+	if err != nil {
+		return nil, err
+	}
+	result.Missing = len(keys) - len(users)
+
+	existing := make([]int, 0, len(users))
+	for _, user := range users {
+		existing = append(existing, user.Id)
+	}
+	existing = uniqueIds(existing)
+
+	removed, err := selectIds(tx, takeSegmentFromUsers, slug, pq.Array(existing))
+	if err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+	result.Removed = len(removed)
+	result.Skipped = len(existing) - len(removed)
+
+	if dryRun {
+		return result, nil
+	}
+
+	if len(removed) > 0 {
+		if err = r.hr.SetBulkHistoryRecords(tx, removed, slug, OperationRemoving, ActorApi); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+
+	return result, nil
+}
+
+func selectIds(q sqlx.Queryer, query string, args ...interface{}) ([]int, error) {
+	var ids []int
+
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return ids, nil
+}
+
+// selectBucketedUsers возвращает пользователей с идентификатором и внешним идентификатором — всем,
+// что нужно для их ключа распределения по процентам. Запрос должен выбирать id и external_id.
+func selectBucketedUsers(q sqlx.Queryer, query string, args ...interface{}) ([]*models.User, error) {
+	var users []*models.User
+
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := new(models.User)
+		if err := rows.Scan(&user.Id, &user.ExternalId); err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return users, nil
+}
+
+func uniqueKeys(keys []string) []string {
+	seen := make(map[string]bool, len(keys))
+	unique := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, key)
+		}
+	}
+
+	return unique
+}
+
+func uniqueIds(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	unique := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	return unique
+}
+
+func toSet(lists ...[]int) map[int]bool {
+	set := make(map[int]bool)
+	for _, list := range lists {
+		for _, id := range list {
+			set[id] = true
+		}
+	}
+
+	return set
+}
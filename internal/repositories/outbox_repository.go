@@ -0,0 +1,260 @@
+package repositories
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+// Типы событий об изменении участия. Добавление, удаление и изменение даты отключения записываются вместе
+// с историей, наступление даты отключения в истории не отражается и записывается диспетчером.
+const (
+	EventMembershipAdded   = "membership.added"
+	EventMembershipRemoved = "membership.removed"
+	EventMembershipUpdated = "membership.updated"
+	EventMembershipExpired = "membership.expired"
+)
+
+var EventTypes = []string{EventMembershipAdded, EventMembershipRemoved, EventMembershipUpdated, EventMembershipExpired}
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+type PostgresOutboxRepository struct {
+	db *sqlx.DB
+}
+
+func NewOutboxRepository(db *sqlx.DB) *PostgresOutboxRepository {
+	return &PostgresOutboxRepository{
+		db: db,
+	}
+}
+
+// Отключение по дате отмечается в expiry_event_deadline: при продлении или повторном добавлении дата
+// отключения меняется, и следующее отключение снова порождает событие
+const (
+	emitExpiryEvents = `WITH expired AS (
+                                        UPDATE users_segments SET expiry_event_deadline = deadline_date
+                                        WHERE deadline_date <= $1 AND deadline_date > $2
+                                        AND expiry_event_deadline IS DISTINCT FROM deadline_date
+                                        RETURNING user_id, slug, deadline_date
+                                    )
+                                    INSERT INTO outbox_events (event_type, user_id, external_id, slug, deadline_date, occurred_at)
+                                    SELECT 'membership.expired', e.user_id, u.external_id, e.slug, e.deadline_date, e.deadline_date
+                                    FROM expired e LEFT JOIN users u ON u.id = e.user_id
+                                    ORDER BY e.deadline_date;`
+	fanOutEvents = `WITH batch AS (
+                                        SELECT id, event_type, slug FROM outbox_events WHERE dispatched_at IS NULL
+                                        ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED
+                                    ), deliveries AS (
+                                        INSERT INTO webhook_deliveries (webhook_id, event_id, status, next_attempt_at)
+                                        SELECT w.id, b.id, 'pending', $1 FROM batch b
+                                        JOIN webhooks w ON w.active
+                                            AND (cardinality(w.event_types) = 0 OR b.event_type = ANY(w.event_types))
+                                            AND (cardinality(w.slugs) = 0 OR b.slug = ANY(w.slugs))
+                                        ON CONFLICT DO NOTHING
+                                    )
+                                    UPDATE outbox_events SET dispatched_at = $1 WHERE id IN (SELECT id FROM batch);`
+	claimWebhookDeliveries = `WITH claimed AS (
+                                        UPDATE webhook_deliveries SET next_attempt_at = $2 WHERE id IN (
+                                            SELECT d.id FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+                                            WHERE d.status = 'pending' AND d.next_attempt_at <= $1 AND w.active
+                                            ORDER BY d.next_attempt_at, d.id LIMIT $3 FOR UPDATE OF d SKIP LOCKED
+                                        )
+                                        RETURNING id, webhook_id, event_id, status, attempts, next_attempt_at, created_at
+                                    )
+                                    SELECT c.id, c.status, c.attempts, c.next_attempt_at, c.created_at,
+                                        w.id, w.url, w.secret,
+                                        e.id, e.event_type, e.user_id, e.external_id, e.slug, e.deadline_date, e.actor, e.occurred_at
+                                    FROM claimed c
+                                    JOIN webhooks w ON w.id = c.webhook_id
+                                    JOIN outbox_events e ON e.id = c.event_id
+                                    ORDER BY c.id;`
+	completeWebhookDelivery = `UPDATE webhook_deliveries SET status = 'delivered', attempts = attempts + 1, delivered_at = $2,
+                                    last_status_code = $3, last_error = NULL WHERE id = $1;`
+	retryWebhookDelivery = `UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = $2,
+                                    last_status_code = NULLIF($3, 0), last_error = $4 WHERE id = $1;`
+	deadLetterWebhookDelivery = `UPDATE webhook_deliveries SET status = 'dead', attempts = attempts + 1,
+                                    last_status_code = NULLIF($2, 0), last_error = $3 WHERE id = $1;`
+	purgeWebhookDeliveries = `DELETE FROM webhook_deliveries WHERE status = 'delivered' AND delivered_at < $1;`
+	purgeOutboxEvents      = `DELETE FROM outbox_events e WHERE dispatched_at < $1
+                                    AND NOT EXISTS (SELECT 1 FROM webhook_deliveries d WHERE d.event_id = e.id);`
+)
+
+// EmitExpiryEvents записывает события об отключениях по дате, наступивших в интервале (since, now].
+// Отключения раньше since пропускаются, чтобы после долгого простоя или первого запуска не отправлять
+// события о давно истекших участиях.
+func (r *PostgresOutboxRepository) EmitExpiryEvents(now, since time.Time) (int, error) {
+	return affectedRows(r.db, emitExpiryEvents, now, since)
+}
+
+// FanOutEvents создает доставки не более чем limit еще не разосланных событий всем подходящим активным
+// подпискам и возвращает число обработанных событий. Подписки, созданные позже события, его не получают.
+func (r *PostgresOutboxRepository) FanOutEvents(now time.Time, limit int) (int, error) {
+	return affectedRows(r.db, fanOutEvents, now, limit)
+}
+
+// ClaimWebhookDeliveries берет в работу не более limit наступивших доставок активных подписок. До leaseUntil
+// доставка не будет взята повторно; если обработчик упадет, не сохранив результат, после leaseUntil ее
+// отправит другой.
+func (r *PostgresOutboxRepository) ClaimWebhookDeliveries(now, leaseUntil time.Time, limit int) ([]*models.WebhookDeliveryTask, error) {
+	rows, err := r.db.Query(claimWebhookDeliveries, now, leaseUntil, limit)
+	if err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+	defer rows.Close()
+
+	var tasks []*models.WebhookDeliveryTask
+	for rows.Next() {
+		task := &models.WebhookDeliveryTask{
+			Delivery: &models.WebhookDelivery{Event: new(models.OutboxEvent)},
+			Webhook:  new(models.Webhook),
+		}
+		delivery, event := task.Delivery, task.Delivery.Event
+		err := rows.Scan(&delivery.Id, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt, &delivery.CreatedAt,
+			&task.Webhook.Id, &task.Webhook.Url, &task.Webhook.Secret,
+			&event.Id, &event.Type, &event.UserId, &event.ExternalId, &event.Slug, &event.DeadlineDate, &event.Actor,
+			&event.OccurredAt)
+		if err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		delivery.WebhookId = task.Webhook.Id
+		tasks = append(tasks, task)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return tasks, nil
+}
+
+func (r *PostgresOutboxRepository) CompleteWebhookDelivery(id int64, statusCode int) error {
+	if _, err := r.db.Exec(completeWebhookDelivery, id, time.Now(), statusCode); err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	return nil
+}
+
+// RetryWebhookDelivery сохраняет неудачную попытку и откладывает следующую до nextAttemptAt.
+// Нулевой statusCode означает, что ответ не был получен.
+func (r *PostgresOutboxRepository) RetryWebhookDelivery(id int64, nextAttemptAt time.Time, statusCode int, message string) error {
+	if _, err := r.db.Exec(retryWebhookDelivery, id, nextAttemptAt, statusCode, message); err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	return nil
+}
+
+// DeadLetterWebhookDelivery сохраняет последнюю неудачную попытку и переносит доставку в недоставленные
+func (r *PostgresOutboxRepository) DeadLetterWebhookDelivery(id int64, statusCode int, message string) error {
+	if _, err := r.db.Exec(deadLetterWebhookDelivery, id, statusCode, message); err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	return nil
+}
+
+// PurgeOutbox удаляет доставленные до before доставки и разосланные до before события, у которых не осталось
+// доставок. Недоставленные и ожидающие доставки остаются вместе с их событиями.
+func (r *PostgresOutboxRepository) PurgeOutbox(before time.Time) (int, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, ErrDatabaseWritingError
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err = tx.Exec(purgeWebhookDeliveries, before); err != nil {
+		return 0, ErrDatabaseWritingError
+	}
+
+	purged, err := affectedRows(tx, purgeOutboxEvents, before)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, ErrDatabaseWritingError
+	}
+
+	return purged, nil
+}
+
+// Поток событий читается только по транзакциям младше горизонта pg_snapshot_xmin: все они уже завершены,
+// а события еще не завершенных и будущих транзакций окажутся в потоке после них. Поэтому позиция в потоке
+// только растет и событие транзакции, зафиксированной позже соседней, не пропускается.
+const (
+	selectStreamStart = `SELECT pg_snapshot_xmin(pg_current_snapshot())::text;`
+	selectUserEvents  = `SELECT id, event_type, user_id, external_id, slug, deadline_date, actor, occurred_at, transaction_id::text
+                                    FROM outbox_events
+                                    WHERE user_id = $1 AND (transaction_id, id) > ($2::text::xid8, $3)
+                                    AND transaction_id < pg_snapshot_xmin(pg_current_snapshot())
+                                    ORDER BY transaction_id, id LIMIT $4;`
+)
+
+// GetStreamStart возвращает позицию, с которой поток содержит только события, записанные после вызова
+func (r *PostgresOutboxRepository) GetStreamStart() (*models.EventPosition, error) {
+	var xmin string
+	if err := r.db.QueryRow(selectStreamStart).Scan(&xmin); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	transactionId, err := strconv.ParseUint(xmin, 10, 64)
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return &models.EventPosition{TransactionId: transactionId}, nil
+}
+
+// GetUserEvents возвращает не более limit событий пользователя после позиции after в порядке потока.
+// События хранятся, пока их не удалит очистка outbox, поэтому продолжить чтение можно не дальше этого срока.
+func (r *PostgresOutboxRepository) GetUserEvents(userId int, after *models.EventPosition, limit int) ([]*models.OutboxEvent, error) {
+	rows, err := r.db.Query(selectUserEvents, userId, strconv.FormatUint(after.TransactionId, 10), after.EventId, limit)
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	var events []*models.OutboxEvent
+	for rows.Next() {
+		event := new(models.OutboxEvent)
+		var transactionId string
+		err := rows.Scan(&event.Id, &event.Type, &event.UserId, &event.ExternalId, &event.Slug, &event.DeadlineDate,
+			&event.Actor, &event.OccurredAt, &transactionId)
+		if err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		if event.TransactionId, err = strconv.ParseUint(transactionId, 10, 64); err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return events, nil
+}
+
+func affectedRows(e sqlx.Execer, query string, args ...interface{}) (int, error) {
+	result, err := e.Exec(query, args...)
+	if err != nil {
+		return 0, ErrDatabaseWritingError
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, ErrDatabaseWritingError
+	}
+
+	return int(affected), nil
+}
@@ -0,0 +1,136 @@
+package repositories
+
+import (
+	"database/sql"
+	goErrors "errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+const (
+	ReportJobPending = "pending"
+	ReportJobRunning = "running"
+	ReportJobDone    = "done"
+	ReportJobFailed  = "failed"
+)
+
+type PostgresReportJobRepository struct {
+	db *sqlx.DB
+}
+
+func NewReportJobRepository(db *sqlx.DB) *PostgresReportJobRepository {
+	return &PostgresReportJobRepository{
+		db: db,
+	}
+}
+
+const (
+	reportJobColumns = `id, status, format, COALESCE(user_id, 0), COALESCE(slug, ''), from_date, to_date, progress,
+                                    blob_key, error, created_at, started_at, finished_at`
+	insertReportJob = `INSERT INTO report_jobs (id, status, format, user_id, slug, from_date, to_date)
+                                    VALUES ($1, 'pending', $2, NULLIF($3, 0), NULLIF($4, ''), $5, $6)
+                                    RETURNING ` + reportJobColumns + `;`
+	selectReportJob = `SELECT ` + reportJobColumns + ` FROM report_jobs WHERE id = $1;`
+	claimReportJob  = `UPDATE report_jobs SET status = 'running', started_at = COALESCE(started_at, $1), updated_at = $1
+                                    WHERE id = (SELECT id FROM report_jobs
+                                        WHERE status = 'pending' OR (status = 'running' AND updated_at < $2)
+                                        ORDER BY created_at LIMIT 1 FOR UPDATE SKIP LOCKED)
+                                    RETURNING ` + reportJobColumns + `;`
+	setReportJobProgress = `UPDATE report_jobs SET progress = $2, updated_at = $3 WHERE id = $1 AND status = 'running';`
+	touchReportJob       = `UPDATE report_jobs SET updated_at = $2 WHERE id = $1 AND status = 'running';`
+	completeReportJob    = `UPDATE report_jobs SET status = 'done', progress = 100, blob_key = $2, updated_at = $3, finished_at = $3
+                                    WHERE id = $1;`
+	failReportJob = `UPDATE report_jobs SET status = 'failed', error = $2, updated_at = $3, finished_at = $3 WHERE id = $1;`
+)
+
+func (r *PostgresReportJobRepository) CreateReportJob(job *models.ReportJob) (*models.ReportJob, error) {
+	created, err := scanReportJob(r.db.QueryRow(insertReportJob, uuid.New().String(), job.Format, job.UserId, job.Slug,
+		job.From, job.To))
+	if err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+
+	return created, nil
+}
+
+func (r *PostgresReportJobRepository) GetReportJob(id string) (*models.ReportJob, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrRecordNotFound
+	}
+
+	job, err := scanReportJob(r.db.QueryRow(selectReportJob, id))
+	if err != nil {
+		if goErrors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, ErrDatabaseReadingError
+	}
+
+	return job, nil
+}
+
+// ClaimReportJob берет в работу самое старое ожидающее задание. Задание, которое выполняется, но не
+// обновлялось с момента staleBefore, считается брошенным упавшим обработчиком и тоже может быть взято.
+// Если заданий нет, возвращается ErrRecordNotFound.
+func (r *PostgresReportJobRepository) ClaimReportJob(staleBefore time.Time) (*models.ReportJob, error) {
+	job, err := scanReportJob(r.db.QueryRow(claimReportJob, time.Now(), staleBefore))
+	if err != nil {
+		if goErrors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, ErrDatabaseWritingError
+	}
+
+	return job, nil
+}
+
+// SetReportJobProgress сохраняет прогресс задания и заодно отмечает, что обработчик жив
+func (r *PostgresReportJobRepository) SetReportJobProgress(id string, progress int) error {
+	if _, err := r.db.Exec(setReportJobProgress, id, progress, time.Now()); err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	return nil
+}
+
+// TouchReportJob отмечает, что обработчик задания жив, не меняя прогресс
+func (r *PostgresReportJobRepository) TouchReportJob(id string) error {
+	if _, err := r.db.Exec(touchReportJob, id, time.Now()); err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	return nil
+}
+
+func (r *PostgresReportJobRepository) CompleteReportJob(id, blobKey string) error {
+	if _, err := r.db.Exec(completeReportJob, id, blobKey, time.Now()); err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	return nil
+}
+
+func (r *PostgresReportJobRepository) FailReportJob(id, message string) error {
+	if _, err := r.db.Exec(failReportJob, id, message, time.Now()); err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	return nil
+}
+
+func scanReportJob(row *sql.Row) (*models.ReportJob, error) {
+	job := new(models.ReportJob)
+	err := row.Scan(&job.Id, &job.Status, &job.Format, &job.UserId, &job.Slug, &job.From, &job.To, &job.Progress,
+		&job.BlobKey, &job.Error, &job.CreatedAt, &job.StartedAt, &job.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
@@ -0,0 +1,256 @@
+package repositories
+
+import (
+	"database/sql"
+	goErrors "errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+type PostgresRolloutRepository struct {
+	db *sqlx.DB
+	hr HistoryRepository
+}
+
+func NewRolloutRepository(db *sqlx.DB, hr HistoryRepository) *PostgresRolloutRepository {
+	return &PostgresRolloutRepository{
+		db: db,
+		hr: hr,
+	}
+}
+
+const (
+	selectSegmentExists = `SELECT EXISTS (SELECT 1 FROM segments WHERE slug = $1);`
+	selectRollout       = `SELECT slug, paused, current_step FROM rollouts WHERE slug = $1;`
+	selectRolloutSteps  = `SELECT slug, step, percent, start_at FROM rollout_steps WHERE slug = $1 ORDER BY step;`
+	upsertRollout       = `INSERT INTO rollouts (slug, paused, current_step) VALUES ($1, false, -1)
+                                    ON CONFLICT (slug) DO UPDATE SET paused = false, current_step = -1;`
+	deleteRolloutSteps = `DELETE FROM rollout_steps WHERE slug = $1;`
+	insertRolloutStep  = `INSERT INTO rollout_steps (slug, step, percent, start_at) VALUES ($1, $2, $3, $4);`
+	setRolloutPaused   = `UPDATE rollouts SET paused = $1 WHERE slug = $2;`
+	selectDueSteps     = `SELECT DISTINCT ON (rs.slug) rs.slug, rs.step, rs.percent, rs.start_at FROM rollout_steps rs
+                                    JOIN rollouts r ON r.slug = rs.slug
+                                    WHERE NOT r.paused AND rs.step > r.current_step AND rs.start_at <= $1
+                                    ORDER BY rs.slug, rs.step DESC;`
+	delayRolloutSteps = `UPDATE rollout_steps SET start_at = start_at + make_interval(secs => $3)
+                                    WHERE slug = $1 AND step > $2;`
+	setRolloutStep        = `UPDATE rollouts SET current_step = $1 WHERE slug = $2;`
+	setRolloutStepPaused  = `UPDATE rollouts SET current_step = $1, paused = true WHERE slug = $2;`
+	setSegmentPercent     = `UPDATE segments SET percent = $1 WHERE slug = $2;`
+	selectEnrollmentUsers = `SELECT u.id, u.external_id FROM users u
+                                    WHERE NOT EXISTS (SELECT 1 FROM users_segments us WHERE us.user_id = u.id AND us.slug = $1)
+                                    AND NOT EXISTS (SELECT 1 FROM users_segments us JOIN segments s ON s.slug = us.slug
+                                        WHERE us.user_id = u.id
+                                        AND s.layer = (SELECT layer FROM segments WHERE slug = $1)
+                                        AND (us.deadline_date IS NULL OR us.deadline_date > CURRENT_TIMESTAMP))
+                                    AND NOT EXISTS (SELECT 1 FROM history h
+                                        WHERE h.user_id = u.id AND h.slug = $1
+                                        AND h.operation_type = 'REMOVING' AND h.actor = 'api');`
+	selectAutoEnrolledUsers = `SELECT u.id, u.external_id FROM users_segments us
+                                    JOIN users u ON u.id = us.user_id
+                                    WHERE us.slug = $1 AND us.auto_enrolled;`
+	enrollUsers = `INSERT INTO users_segments (user_id, slug, deadline_date, auto_enrolled)
+                                    SELECT unnest($2::integer[]), $1, NULL, true
+                                    ON CONFLICT (user_id, slug) DO NOTHING;`
+	unenrollUsers = `DELETE FROM users_segments WHERE slug = $1 AND auto_enrolled AND user_id = ANY($2);`
+)
+
+func (r *PostgresRolloutRepository) GetRollout(slug string) (*models.Rollout, error) {
+	rollout := new(models.Rollout)
+	err := r.db.QueryRow(selectRollout, slug).Scan(&rollout.Slug, &rollout.Paused, &rollout.CurrentStep)
+	if err != nil {
+		if goErrors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, ErrDatabaseReadingError
+	}
+
+	rows, err := r.db.Query(selectRolloutSteps, slug)
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		step := new(models.RolloutStep)
+		if err := rows.Scan(&step.Slug, &step.Step, &step.Percent, &step.StartAt); err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		rollout.Steps = append(rollout.Steps, step)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return rollout, nil
+}
+
+func (r *PostgresRolloutRepository) SetRolloutSchedule(slug string, steps []*models.RolloutStep) error {
+	var exists bool
+	err := r.db.QueryRow(selectSegmentExists, slug).Scan(&exists)
+	if err != nil {
+		return ErrDatabaseReadingError
+	}
+
+	if !exists {
+		return ErrRecordNotFound
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return ErrDatabaseWritingError
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err = tx.Exec(upsertRollout, slug); err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	if _, err = tx.Exec(deleteRolloutSteps, slug); err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	for i, step := range steps {
+		if _, err = tx.Exec(insertRolloutStep, slug, i, step.Percent, step.StartAt); err != nil {
+			return ErrDatabaseWritingError
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	return nil
+}
+
+func (r *PostgresRolloutRepository) SetRolloutPaused(slug string, paused bool) error {
+	result, err := r.db.Exec(setRolloutPaused, paused, slug)
+	if err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetDueRolloutSteps возвращает для каждого активного расписания последний наступивший, но еще не примененный шаг
+func (r *PostgresRolloutRepository) GetDueRolloutSteps(now time.Time) ([]*models.RolloutStep, error) {
+	return r.selectSteps(selectDueSteps, now)
+}
+
+func (r *PostgresRolloutRepository) selectSteps(query string, args ...interface{}) ([]*models.RolloutStep, error) {
+	var steps []*models.RolloutStep
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		step := new(models.RolloutStep)
+		if err := rows.Scan(&step.Slug, &step.Step, &step.Percent, &step.StartAt); err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		steps = append(steps, step)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return steps, nil
+}
+
+// ApplyRolloutStep отмечает шаг расписания примененным и выставляет сегменту процент этого шага
+func (r *PostgresRolloutRepository) ApplyRolloutStep(slug string, step int, percent float64) error {
+	return r.setStep(setRolloutStep, slug, step, percent, 0)
+}
+
+// RollbackRolloutStep возвращает расписание на указанный шаг и приостанавливает его. Если delay положителен,
+// последующие шаги переносятся на delay вперед.
+func (r *PostgresRolloutRepository) RollbackRolloutStep(slug string, step int, percent float64, delay time.Duration) error {
+	return r.setStep(setRolloutStepPaused, slug, step, percent, delay)
+}
+
+func (r *PostgresRolloutRepository) setStep(query, slug string, step int, percent float64, delay time.Duration) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return ErrDatabaseWritingError
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err = tx.Exec(query, step, slug); err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	if delay > 0 {
+		if _, err = tx.Exec(delayRolloutSteps, slug, step, delay.Seconds()); err != nil {
+			return ErrDatabaseWritingError
+		}
+	}
+
+	if _, err = tx.Exec(setSegmentPercent, percent, slug); err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	if err = tx.Commit(); err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	return nil
+}
+
+// GetEnrollmentCandidates возвращает пользователей, которых можно автоматически добавить в сегмент:
+// они еще не состоят в нем, не состоят в другом активном сегменте того же слоя и не были удалены из него через API.
+// Удаление через API записывается в историю и считается отказом пользователя от раскатки.
+func (r *PostgresRolloutRepository) GetEnrollmentCandidates(slug string) ([]*models.User, error) {
+	return selectBucketedUsers(r.db, selectEnrollmentUsers, slug)
+}
+
+func (r *PostgresRolloutRepository) GetAutoEnrolledUsers(slug string) ([]*models.User, error) {
+	return selectBucketedUsers(r.db, selectAutoEnrolledUsers, slug)
+}
+
+func (r *PostgresRolloutRepository) EnrollUsers(slug string, userIds []int) error {
+	return r.changeMembers(enrollUsers, OperationAdding, slug, userIds)
+}
+
+func (r *PostgresRolloutRepository) UnenrollUsers(slug string, userIds []int) error {
+	return r.changeMembers(unenrollUsers, OperationRemoving, slug, userIds)
+}
+
+func (r *PostgresRolloutRepository) changeMembers(query, operationType, slug string, userIds []int) error {
+	if len(userIds) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return ErrDatabaseWritingError
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err = tx.Exec(query, slug, pq.Array(userIds)); err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	if err = r.hr.SetBulkHistoryRecords(tx, userIds, slug, operationType, ActorRollout); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	return nil
+}
@@ -20,10 +20,25 @@ func NewSegmentRepository(db *sqlx.DB) *PostgresSegmentRepository {
 }
 
 const (
-	selectSegments       = `SELECT id, slug, description FROM segments;`
-	selectSegmentBySlug  = `SELECT id, slug, description FROM segments WHERE Slug = $1;`
-	createSegment        = `INSERT INTO segments (slug, description) VALUES ($1, $2) RETURNING slug;`
-	updateSegment        = `UPDATE segments SET description = $1 WHERE slug = $2;`
+	selectSegments      = `SELECT id, slug, description, layer, percent, rule FROM segments;`
+	selectSegmentBySlug = `SELECT id, slug, description, layer, percent, rule FROM segments WHERE Slug = $1;`
+	createSegment       = `INSERT INTO segments (slug, description, layer, rule) VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, '')) RETURNING slug;`
+	// поле, переданное как NULL, не меняется; пустая строка снимает слой или правило
+	updateSegment = `UPDATE segments SET description = COALESCE($2, description),
+                                    layer = CASE WHEN $3::text IS NULL THEN layer ELSE NULLIF($3, '') END,
+                                    rule = CASE WHEN $4::text IS NULL THEN rule ELSE NULLIF($4, '') END
+                                    WHERE slug = $1 RETURNING id, slug, description, layer, percent, rule;`
+	selectSegmentForUpdate = `SELECT layer FROM segments WHERE slug = $1 FOR UPDATE;`
+	// исключительная блокировка слоя ждет завершения параллельных добавлений в его сегменты,
+	// которые берут ее разделяемой в триггере trg_users_segments_layer
+	lockLayer           = `SELECT pg_advisory_xact_lock(hashtext('layer:' || $1)::bigint);`
+	selectLayerOccupant = `SELECT o.slug FROM users_segments m
+                                    JOIN users_segments o ON o.user_id = m.user_id AND o.slug <> m.slug
+                                    JOIN segments s ON s.slug = o.slug
+                                    WHERE m.slug = $1 AND s.layer = $2
+                                    AND (m.deadline_date IS NULL OR m.deadline_date > CURRENT_TIMESTAMP)
+                                    AND (o.deadline_date IS NULL OR o.deadline_date > CURRENT_TIMESTAMP)
+                                    LIMIT 1;`
 	deleteSegment        = `DELETE FROM segments WHERE slug = $1 RETURNING slug;`
 	checkIfSegmentExists = `SELECT id, slug, description FROM segments WHERE slug = $1;`
 )
@@ -42,7 +57,7 @@ func (r *PostgresSegmentRepository) GetAllSegments() ([]*models.Segment, error)
 
 	for rows.Next() {
 		segment := new(models.Segment)
-		if err := rows.Scan(&segment.Id, &segment.Slug, &segment.Description); err != nil {
+		if err := rows.Scan(&segment.Id, &segment.Slug, &segment.Description, &segment.Layer, &segment.Percent, &segment.Rule); err != nil {
 			return nil, ErrDatabaseReadingError
 		}
 		segments = append(segments, segment)
@@ -54,7 +69,7 @@ func (r *PostgresSegmentRepository) GetAllSegments() ([]*models.Segment, error)
 
 func (r *PostgresSegmentRepository) GetSegmentBySlug(slug string) (*models.Segment, error) {
 	segment := new(models.Segment)
-	err := r.db.QueryRow(selectSegmentBySlug, slug).Scan(&segment.Id, &segment.Slug, &segment.Description)
+	err := r.db.QueryRow(selectSegmentBySlug, slug).Scan(&segment.Id, &segment.Slug, &segment.Description, &segment.Layer, &segment.Percent, &segment.Rule)
 	if err != nil {
 		if goErrors.Is(err, sql.ErrNoRows) {
 			return nil, ErrRecordNotFound
@@ -71,9 +86,9 @@ func (r *PostgresSegmentRepository) CheckIfSegmentAlreadyExists(slug string) boo
 	return err != sql.ErrNoRows
 }
 
-func (r *PostgresSegmentRepository) CreateSegment(slug, description string) (string, error) {
+func (r *PostgresSegmentRepository) CreateSegment(slug, description, layer, rule string) (string, error) {
 	if exists := r.CheckIfSegmentAlreadyExists(slug); !exists {
-		row := r.db.QueryRow(createSegment, slug, description)
+		row := r.db.QueryRow(createSegment, slug, description, layer, rule)
 		if err := row.Scan(&slug); err != nil {
 			return "", ErrDatabaseWritingError
 		}
@@ -84,24 +99,53 @@ func (r *PostgresSegmentRepository) CreateSegment(slug, description string) (str
 	}
 }
 
-func (r *PostgresSegmentRepository) UpdateSegment(slug, description string) (*models.Segment, error) {
-	updating := new(models.Segment)
-	err := r.db.QueryRow(selectSegmentBySlug, slug).Scan(&updating.Id, &updating.Slug, &updating.Description)
+// UpdateSegment обновляет переданные (не nil) поля сегмента. При переносе сегмента в слой проверяется, что его
+// участники не состоят в других сегментах этого слоя, иначе возвращается LayerConflictError.
+func (r *PostgresSegmentRepository) UpdateSegment(slug string, description, layer, rule *string) (*models.Segment, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	// строка сегмента блокируется до слоя в том же порядке, что и в триггере при добавлении участников
+	var current sql.NullString
+	err = tx.QueryRow(selectSegmentForUpdate, slug).Scan(&current)
 	if err != nil {
 		if goErrors.Is(err, sql.ErrNoRows) {
 			return nil, ErrRecordNotFound
 		}
+
+		return nil, ErrDatabaseReadingError
+	}
+
+	moving := layer != nil && *layer != ""
+	if moving {
+		if _, err = tx.Exec(lockLayer, *layer); err != nil {
+			return nil, ErrDatabaseWritingError
+		}
 	}
 
-	_, err = r.db.Exec(updateSegment, description, slug)
+	if moving && current.String != *layer {
+		var occupant string
+		err = tx.QueryRow(selectLayerOccupant, slug, *layer).Scan(&occupant)
+		switch {
+		case err == nil:
+			return nil, &LayerConflictError{Layer: *layer, Slug: occupant}
+		case !goErrors.Is(err, sql.ErrNoRows):
+			return nil, ErrDatabaseReadingError
+		}
+	}
+
+	updated := new(models.Segment)
+	err = tx.QueryRow(updateSegment, slug, description, layer, rule).Scan(&updated.Id, &updated.Slug,
+		&updated.Description, &updated.Layer, &updated.Percent, &updated.Rule)
 	if err != nil {
 		return nil, ErrDatabaseWritingError
 	}
 
-	updated := &models.Segment{
-		Id:          updating.Id,
-		Slug:        slug,
-		Description: description,
+	if err = tx.Commit(); err != nil {
+		return nil, ErrDatabaseWritingError
 	}
 
 	return updated, nil
@@ -109,7 +153,7 @@ func (r *PostgresSegmentRepository) UpdateSegment(slug, description string) (*mo
 
 func (r *PostgresSegmentRepository) DeleteSegment(slug string) (*models.Segment, error) {
 	deleted := new(models.Segment)
-	err := r.db.QueryRow(selectSegmentBySlug, slug).Scan(&deleted.Id, &deleted.Slug, &deleted.Description)
+	err := r.db.QueryRow(selectSegmentBySlug, slug).Scan(&deleted.Id, &deleted.Slug, &deleted.Description, &deleted.Layer, &deleted.Percent, &deleted.Rule)
 	if err != nil {
 		if goErrors.Is(err, sql.ErrNoRows) {
 			return nil, ErrRecordNotFound
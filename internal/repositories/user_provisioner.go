@@ -0,0 +1,332 @@
+package repositories
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+const (
+	UsersModeLocal     = "local"
+	UsersModeImplicit  = "implicit"
+	UsersModeDirectory = "directory"
+)
+
+// UsersConfig задает, как проверяется существование пользователей при добавлении им сегментов:
+// local — пользователь должен быть заранее создан в сервисе, implicit — неизвестные пользователи создаются
+// автоматически, directory — неизвестные пользователи создаются, только если их подтвердил сервис пользователей
+type UsersConfig struct {
+	Mode             string        `envconfig:"MODE" default:"local"`
+	DirectoryURL     string        `envconfig:"DIRECTORY_URL"`
+	DirectoryTimeout time.Duration `envconfig:"DIRECTORY_TIMEOUT" default:"2s"`
+}
+
+func (c UsersConfig) Validate() error {
+	switch c.Mode {
+	case UsersModeLocal, UsersModeImplicit:
+		return nil
+	case UsersModeDirectory:
+		if c.DirectoryURL == "" {
+			return errors.New("users directory URL is required in directory mode")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown users mode %q", c.Mode)
+}
+
+// UserDirectory — внешний сервис пользователей, который является источником истины об их существовании
+type UserDirectory interface {
+	// ExistingUsers возвращает те внешние идентификаторы из переданных, пользователи с которыми существуют
+	ExistingUsers(externalIds []string) ([]string, error)
+}
+
+// ErrUserDirectoryUnavailable возвращается, если сервис пользователей не ответил или ответил ошибкой
+var ErrUserDirectoryUnavailable = errors.New("User directory is unavailable")
+
+const (
+	selectUsersByKeys       = `SELECT id, external_id FROM users WHERE id = ANY($1) OR external_id = ANY($2);`
+	selectErasedUsers       = `SELECT user_id FROM user_erasures WHERE user_id = ANY($1);`
+	selectErasedExternalIds = `SELECT external_id_hash FROM user_erasures WHERE external_id_hash = ANY($1);`
+	// идентификатор назначает последовательность; пользователь, созданный параллельным запросом, не дублируется
+	provisionUsers = `INSERT INTO users (name, external_id) SELECT '', unnest($1::text[])
+                                    ON CONFLICT (external_id) DO NOTHING RETURNING external_id;`
+	selectProvisionedUsers = `SELECT id, external_id FROM users WHERE external_id = ANY($1);`
+)
+
+// UserProvisioner проверяет существование пользователей перед изменением их сегментов и в режимах
+// implicit и directory создает неизвестных пользователей
+type UserProvisioner struct {
+	mode      string
+	directory UserDirectory
+}
+
+func NewUserProvisioner(mode string, directory UserDirectory) *UserProvisioner {
+	return &UserProvisioner{
+		mode:      mode,
+		directory: directory,
+	}
+}
+
+// UserResolution — пользователи из запроса, найденные по числовым и внешним идентификаторам, и внешние
+// идентификаторы неизвестных пользователей, которых нужно создать
+type UserResolution struct {
+	// Users — найденные и созданные пользователи по идентификатору из запроса
+	Users map[string]*models.User
+	// Created — внешние идентификаторы пользователей, созданных Provision (а не параллельным запросом)
+	Created   map[string]bool
+	provision []string
+}
+
+// UserIds возвращает внутренние идентификаторы найденных и созданных пользователей без повторов
+func (r *UserResolution) UserIds() []int {
+	ids := make([]int, 0, len(r.Users))
+	for _, user := range r.Users {
+		ids = append(ids, user.Id)
+	}
+
+	return uniqueIds(ids)
+}
+
+// Resolve находит пользователей по идентификаторам из запроса и отбирает для создания неизвестных, если это
+// разрешено режимом. Числовые идентификаторы назначает только БД, поэтому создаются лишь пользователи с внешним
+// идентификатором; удаленные по запросу на удаление данных повторно не создаются. Сервис пользователей
+// опрашивается здесь, до открытия транзакции, чтобы она не оставалась открытой на время сетевого вызова.
+func (p *UserProvisioner) Resolve(q sqlx.Queryer, keys []string) (*UserResolution, error) {
+	return p.ResolveCreating(q, keys, nil)
+}
+
+// ResolveCreating работает как Resolve, но пользователей с внешними идентификаторами из create отбирает для
+// создания и в режиме local: так создаются пользователи, явно перечисленные в импорте. В режиме directory они,
+// как и остальные, создаются только после подтверждения сервисом пользователей.
+func (p *UserProvisioner) ResolveCreating(q sqlx.Queryer, keys, create []string) (*UserResolution, error) {
+	all := append(append([]string(nil), keys...), create...)
+	users, err := resolveUsers(q, all)
+	if err != nil {
+		return nil, err
+	}
+
+	resolution := &UserResolution{Users: users}
+	candidates := create
+	if p.mode != UsersModeLocal {
+		candidates = all
+	}
+	if len(candidates) == 0 {
+		return resolution, nil
+	}
+
+	var unknown []string
+	seen := make(map[string]bool, len(candidates))
+	for _, key := range candidates {
+		if _, ok := users[key]; !ok && !seen[key] && models.IsValidExternalId(key) {
+			unknown = append(unknown, key)
+		}
+		seen[key] = true
+	}
+
+	if unknown, err = withoutErased(q, unknown); err != nil {
+		return nil, err
+	}
+
+	if len(unknown) > 0 && p.mode == UsersModeDirectory {
+		confirmed, err := p.directory.ExistingUsers(unknown)
+		if err != nil {
+			return nil, ErrUserDirectoryUnavailable
+		}
+
+		confirmedSet := make(map[string]bool, len(confirmed))
+		for _, externalId := range confirmed {
+			confirmedSet[externalId] = true
+		}
+
+		known := unknown[:0]
+		for _, externalId := range unknown {
+			if confirmedSet[externalId] {
+				known = append(known, externalId)
+			}
+		}
+		unknown = known
+	}
+
+	resolution.provision = unknown
+	return resolution, nil
+}
+
+// Provision создает в транзакции пользователей, отобранных Resolve, и добавляет их в resolution.Users
+func (p *UserProvisioner) Provision(tx *sqlx.Tx, resolution *UserResolution) error {
+	if len(resolution.provision) == 0 {
+		return nil
+	}
+
+	rows, err := tx.Query(provisionUsers, pq.Array(resolution.provision))
+	if err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	resolution.Created = make(map[string]bool, len(resolution.provision))
+	for rows.Next() {
+		var externalId string
+		if err = rows.Scan(&externalId); err != nil {
+			rows.Close()
+			return ErrDatabaseWritingError
+		}
+		resolution.Created[externalId] = true
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	users, err := selectBucketedUsers(tx, selectProvisionedUsers, pq.Array(resolution.provision))
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		resolution.Users[user.ExternalId.String] = user
+	}
+
+	return nil
+}
+
+// resolveUsers находит пользователей по числовым и внешним идентификаторам одним запросом.
+// Некорректные и неизвестные идентификаторы в результат не попадают.
+func resolveUsers(q sqlx.Queryer, keys []string) (map[string]*models.User, error) {
+	userIds, externalIds := splitUserKeys(keys)
+
+	users := make(map[string]*models.User, len(keys))
+	if len(userIds) == 0 && len(externalIds) == 0 {
+		return users, nil
+	}
+
+	found, err := selectBucketedUsers(q, selectUsersByKeys, pq.Array(userIds), pq.Array(externalIds))
+	if err != nil {
+		return nil, err
+	}
+
+	requested := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		requested[key] = true
+	}
+
+	for _, user := range found {
+		if id := strconv.Itoa(user.Id); requested[id] {
+			users[id] = user
+		}
+		if user.ExternalId.Valid && requested[user.ExternalId.String] {
+			users[user.ExternalId.String] = user
+		}
+	}
+
+	return users, nil
+}
+
+// splitUserKeys разделяет идентификаторы из запроса на числовые и внешние, пропуская некорректные
+func splitUserKeys(keys []string) ([]int, []string) {
+	var userIds []int
+	var externalIds []string
+	for _, key := range keys {
+		userId, externalId, ok := models.ParseUserKey(key)
+		switch {
+		case !ok:
+		case externalId != "":
+			externalIds = append(externalIds, externalId)
+		default:
+			userIds = append(userIds, userId)
+		}
+	}
+
+	return userIds, externalIds
+}
+
+// withoutErased исключает внешние идентификаторы пользователей, удаленных по запросу на удаление данных
+func withoutErased(q sqlx.Queryer, externalIds []string) ([]string, error) {
+	erased, err := selectErasedKeys(q, externalIds)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(externalIds))
+	for _, externalId := range externalIds {
+		if !erased[externalId] {
+			result = append(result, externalId)
+		}
+	}
+
+	return result, nil
+}
+
+// selectErasedKeys возвращает те числовые и внешние идентификаторы из переданных, пользователи с которыми
+// удалены по запросу на удаление данных. Внешние идентификаторы сравниваются по хешу.
+func selectErasedKeys(q sqlx.Queryer, keys []string) (map[string]bool, error) {
+	erased := make(map[string]bool)
+
+	var userIds []int
+	keyByHash := make(map[string]string)
+	for _, key := range keys {
+		userId, externalId, ok := models.ParseUserKey(key)
+		switch {
+		case !ok:
+		case externalId != "":
+			keyByHash[externalIdHash(externalId)] = externalId
+		default:
+			userIds = append(userIds, userId)
+		}
+	}
+
+	if len(userIds) > 0 {
+		erasedIds, err := selectIds(q, selectErasedUsers, pq.Array(userIds))
+		if err != nil {
+			return nil, err
+		}
+		for _, userId := range erasedIds {
+			erased[strconv.Itoa(userId)] = true
+		}
+	}
+
+	if len(keyByHash) == 0 {
+		return erased, nil
+	}
+
+	hashes := make([]string, 0, len(keyByHash))
+	for hash := range keyByHash {
+		hashes = append(hashes, hash)
+	}
+
+	rows, err := q.Query(selectErasedExternalIds, pq.Array(hashes))
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		erased[keyByHash[hash]] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return erased, nil
+}
+
+// externalIdHash — хеш внешнего идентификатора, который хранится в записи об удалении пользователя вместо
+// самого идентификатора: по нему удаленный пользователь не создается повторно, но восстановить
+// идентификатор по записи нельзя
+func externalIdHash(externalId string) string {
+	sum := sha256.Sum256([]byte(externalId))
+	return hex.EncodeToString(sum[:])
+}
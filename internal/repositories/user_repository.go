@@ -1,37 +1,83 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 
+	"github.com/TinyMarcus/avito-tech-task/internal/evaluation"
 	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
 	"github.com/TinyMarcus/avito-tech-task/internal/models"
 )
 
 type PostgresUserRepository struct {
-	db *sqlx.DB
-	hr HistoryRepository
+	db        *sqlx.DB
+	hr        HistoryRepository
+	holdout   Holdout
+	evaluator *evaluation.Evaluator
+	erasure   ErasureConfig
+	users     *UserProvisioner
 }
 
-func NewUserRepository(db *sqlx.DB, hr HistoryRepository) *PostgresUserRepository {
+func NewUserRepository(db *sqlx.DB, hr HistoryRepository, holdout Holdout, evaluator *evaluation.Evaluator,
+	erasure ErasureConfig, users *UserProvisioner) *PostgresUserRepository {
 	return &PostgresUserRepository{
-		db: db,
-		hr: hr,
+		db:        db,
+		hr:        hr,
+		holdout:   holdout,
+		evaluator: evaluator,
+		erasure:   erasure,
+		users:     users,
 	}
 }
 
+const (
+	HistoryModeDelete       = "delete"
+	HistoryModePseudonymize = "pseudonymize"
+)
+
+// ErasureConfig задает, что происходит с историей пользователя при его удалении:
+// delete — записи удаляются, pseudonymize — идентификатор пользователя в них заменяется псевдонимом
+type ErasureConfig struct {
+	HistoryMode string `envconfig:"HISTORY_MODE" default:"delete"`
+}
+
+func (c ErasureConfig) Validate() error {
+	switch c.HistoryMode {
+	case HistoryModeDelete, HistoryModePseudonymize:
+		return nil
+	}
+
+	return fmt.Errorf("unknown erasure history mode %q", c.HistoryMode)
+}
+
 type HistoryRepository interface {
-	SetAddingHistoryRecord(userId int, slug string) error
-	SetRemovingHistoryRecord(userId int, slug string) error
+	SetBulkHistoryRecords(tx *sqlx.Tx, userIds []int, slug, operationType, actor string) error
 	// GetHistoryByDate() ([]*models.Segment, error) TODO: сделать получение истории
 }
 
+type Holdout interface {
+	ContainsKey(key string) bool
+}
+
 const (
-	selectUsers    = `SELECT id, Name FROM users;`
-	selectUserById = `SELECT id, Name FROM users WHERE id = $1;`
-	createUser     = `INSERT INTO users (name) VALUES ($1) RETURNING id;`
+	selectUsers            = `SELECT id, Name, attributes, external_id FROM users;`
+	selectUserById         = `SELECT id, Name, attributes, external_id FROM users WHERE id = $1;`
+	selectUserByExternal   = `SELECT id, Name, attributes, external_id FROM users WHERE external_id = $1;`
+	selectUserIdByExternal = `SELECT id FROM users WHERE external_id = $1;`
+	createUser             = `INSERT INTO users (name, external_id, attributes) VALUES ($1, NULLIF($2, ''), $3) RETURNING id;`
+	setUserAttributes      = `UPDATE users SET attributes = $1 WHERE id = $2;`
+	selectDynamicSegments  = `SELECT id, slug, description, layer, percent, rule FROM segments
+                                    WHERE rule IS NOT NULL OR layer IS NOT NULL OR percent > 0;`
 )
 
 func (r *PostgresUserRepository) GetAllUsers() ([]*models.User, error) {
@@ -48,7 +94,7 @@ func (r *PostgresUserRepository) GetAllUsers() ([]*models.User, error) {
 
 	for rows.Next() {
 		user := new(models.User)
-		if err := rows.Scan(&user.Id, &user.Name); err != nil {
+		if err := rows.Scan(&user.Id, &user.Name, &user.Attributes, &user.ExternalId); err != nil {
 			return nil, ErrDatabaseReadingError
 		}
 		users = append(users, user)
@@ -60,105 +106,586 @@ func (r *PostgresUserRepository) GetAllUsers() ([]*models.User, error) {
 
 func (r *PostgresUserRepository) GetUserById(userId int) (*models.User, error) {
 	user := new(models.User)
-	err := r.db.QueryRow(selectUserById, userId).Scan(&user.Id, &user.Name)
+	err := r.db.QueryRow(selectUserById, userId).Scan(&user.Id, &user.Name, &user.Attributes, &user.ExternalId)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrRecordNotFound
 		}
+
+		return nil, ErrDatabaseReadingError
 	}
 
 	return user, nil
 }
 
-func (r *PostgresUserRepository) CreateUser(name string) (int, error) {
+// ErrMalformedUserId возвращается, если идентификатор пользователя не является ни положительным числом
+// в диапазоне столбца users.id, ни корректным внешним идентификатором
+var ErrMalformedUserId = errors.New("Malformed user id")
+
+// ResolveUserId возвращает внутренний идентификатор пользователя по ключу из запроса. Числовой ключ считается
+// внутренним идентификатором и возвращается без обращения к БД, остальные ищутся среди внешних идентификаторов.
+func (r *PostgresUserRepository) ResolveUserId(key string) (int, error) {
+	if userId, err := strconv.Atoi(key); err == nil {
+		if userId <= 0 || userId > math.MaxInt32 {
+			return 0, ErrMalformedUserId
+		}
+
+		return userId, nil
+	}
+
+	if !models.IsValidExternalId(key) {
+		return 0, ErrMalformedUserId
+	}
+
+	var userId int
+	err := r.db.QueryRow(selectUserIdByExternal, key).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+
+		return 0, ErrDatabaseReadingError
+	}
+
+	return userId, nil
+}
+
+// CreateUser создает пользователя; пустой externalId означает, что внешний идентификатор не задан
+func (r *PostgresUserRepository) CreateUser(name, externalId string, attributes models.Attributes) (int, error) {
 	var id int
 
-	row := r.db.QueryRow(createUser, name)
+	row := r.db.QueryRow(createUser, name, externalId, attributes)
 	if err := row.Scan(&id); err != nil {
-		return 0, ErrDatabaseWritingError
+		return 0, userWritingError(err)
 	}
 
 	return id, nil
 }
 
+func (r *PostgresUserRepository) SetUserAttributes(userId int, attributes models.Attributes) error {
+	result, err := r.db.Exec(setUserAttributes, attributes, userId)
+	if err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
 const (
-	addSegmentToUser        = `INSERT INTO users_segments (user_id, slug, deadline_date) VALUES ($1, $2, $3);`
-	takeSegmentFromUser     = `DELETE FROM users_segments WHERE user_id = $1 AND slug = $2;`
-	getActiveSegmentsOfUser = `SELECT user_id, slug, deadline_date FROM users_segments 
-                                    WHERE user_id = $1 AND (deadline_date IS NULL OR deadline_date > CURRENT_TIMESTAMP);`
-	checkIfUserHasSegment = `SELECT user_id, slug, deadline_date FROM users_segments 
-                                    WHERE user_id = $1 AND slug = $2`
+	updateUser = `UPDATE users SET name = COALESCE($1, name), attributes = COALESCE($2, attributes),
+                                    external_id = CASE WHEN $4::text IS NULL THEN external_id ELSE NULLIF($4, '') END
+                                    WHERE id = $3;`
+	lockUser             = `SELECT external_id FROM users WHERE id = $1 FOR UPDATE;`
+	selectHasMemberships = `SELECT EXISTS (SELECT 1 FROM users_segments WHERE user_id = $1);`
+	endMemberships       = `DELETE FROM users_segments WHERE user_id = $1
+                                    RETURNING slug, (deadline_date IS NULL OR deadline_date > CURRENT_TIMESTAMP);`
+	deleteUserHistory       = `DELETE FROM history WHERE user_id = $1;`
+	pseudonymizeUserHistory = `UPDATE history SET user_id = NULL, pseudonym = $2 WHERE user_id = $1;`
+	deleteUser              = `DELETE FROM users WHERE id = $1;`
+	// завершенные доставки событий удаляются каскадно
+	deleteUserEvents = `DELETE FROM outbox_events e WHERE user_id = $1 AND dispatched_at IS NOT NULL
+                                    AND NOT EXISTS (SELECT 1 FROM webhook_deliveries d WHERE d.event_id = e.id AND d.status = 'pending');`
+	insertUserErasure = `INSERT INTO user_erasures (user_id, external_id_hash, erased_at, history_mode,
+                                    memberships_ended, history_rows) VALUES ($1, $2, $3, $4, $5, $6);`
 )
 
-func (r *PostgresUserRepository) CheckIfUserAlreadyHasSegment(userId int, slug string) bool {
-	userSegment := new(models.UserSegment)
-	err := r.db.QueryRow(checkIfUserHasSegment, userId, slug).Scan(&userSegment.UserId, &userSegment.Slug, &userSegment.DeadlineDate)
+// ErrExternalIdInUse возвращается при попытке изменить внешний идентификатор пользователя, у которого есть привязки
+// к сегментам: внешний идентификатор — ключ распределения, и его смена переместила бы пользователя между контрольной
+// группой, процентами сегментов и шагами раскатывания
+var ErrExternalIdInUse = errors.New("External id of user with segments can not be changed")
+
+// UpdateUser изменяет имя, внешний идентификатор и атрибуты пользователя; nil означает, что поле не меняется,
+// пустой externalId удаляет внешний идентификатор. Внешний идентификатор можно изменить, только пока у пользователя
+// нет привязок к сегментам. Строка пользователя блокируется, поэтому параллельно добавляемая привязка дождется изменения.
+func (r *PostgresUserRepository) UpdateUser(userId int, name, externalId *string, attributes models.Attributes) error {
+	var attributesArg interface{}
+	if attributes != nil {
+		attributesArg = attributes
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return ErrDatabaseWritingError
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var current sql.NullString
+	if err = tx.QueryRow(lockUser, userId).Scan(&current); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+
+		return ErrDatabaseReadingError
+	}
+
+	if externalId != nil && *externalId != current.String {
+		var hasMemberships bool
+		if err = tx.QueryRow(selectHasMemberships, userId).Scan(&hasMemberships); err != nil {
+			return ErrDatabaseReadingError
+		}
 
-	return err != sql.ErrNoRows
+		if hasMemberships {
+			return ErrExternalIdInUse
+		}
+	}
+
+	if _, err = tx.Exec(updateUser, name, attributesArg, userId, externalId); err != nil {
+		return userWritingError(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return ErrDatabaseWritingError
+	}
+
+	return nil
 }
 
-func (r *PostgresUserRepository) AddSegmentToUser(userId int, slug, ttl string) error {
-	var err error
+// DeleteUser удаляет пользователя по запросу на удаление данных: завершает все его привязки к сегментам с событиями
+// membership.removed, удаляет или псевдонимизирует его историю в зависимости от настроек, удаляет его уже
+// доставленные события из outbox и оставляет запись об удалении.
+// Запись об удалении не содержит псевдоним, поэтому связать псевдонимизированную историю с пользователем нельзя.
+func (r *PostgresUserRepository) DeleteUser(userId int) (*models.UserErasure, error) {
+	erasure := &models.UserErasure{
+		UserId:      userId,
+		ErasedAt:    time.Now(),
+		HistoryMode: r.erasure.HistoryMode,
+	}
 
-	user := new(models.User)
-	err = r.db.QueryRow(selectUserById, userId).Scan(&user.Id, &user.Name)
+	tx, err := r.db.Beginx()
 	if err != nil {
-		return ErrRecordNotFound
+		return nil, ErrDatabaseWritingError
 	}
+	defer tx.Rollback() //nolint:errcheck
 
-	if exists := r.CheckIfUserAlreadyHasSegment(userId, slug); exists {
-		return nil
+	var externalId sql.NullString
+	if err = tx.QueryRow(lockUser, userId).Scan(&externalId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, ErrDatabaseReadingError
 	}
 
-	if ttl == "" {
-		_, err = r.db.Query(addSegmentToUser, userId, slug, nil)
-	} else {
-		_, err = r.db.Query(addSegmentToUser, userId, slug, ttl)
+	rows, err := tx.Query(endMemberships, userId)
+	if err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+
+	var ended []string
+	for rows.Next() {
+		var slug string
+		var active bool
+		if err := rows.Scan(&slug, &active); err != nil {
+			rows.Close()
+			return nil, ErrDatabaseWritingError
+		}
+		if active {
+			ended = append(ended, slug)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseWritingError
 	}
+	erasure.MembershipsEnded = len(ended)
 
+	// завершение привязок записывается в историю вместе с событиями membership.removed, чтобы подписчики узнали
+	// о нем, а псевдонимизированная история оставалась согласованной; в режиме delete записи истории удаляются ниже
+	for _, slug := range ended {
+		if err = r.hr.SetBulkHistoryRecords(tx, []int{userId}, slug, OperationRemoving, ActorErasure); err != nil {
+			return nil, err
+		}
+	}
+
+	var result sql.Result
+	switch r.erasure.HistoryMode {
+	case HistoryModePseudonymize:
+		result, err = tx.Exec(pseudonymizeUserHistory, userId, uuid.New().String())
+	case HistoryModeDelete:
+		result, err = tx.Exec(deleteUserHistory, userId)
+	default:
+		return nil, r.erasure.Validate()
+	}
 	if err != nil {
-		return ErrDatabaseWritingError
+		return nil, ErrDatabaseWritingError
 	}
 
-	err = r.hr.SetAddingHistoryRecord(userId, slug)
+	historyRows, err := result.RowsAffected()
 	if err != nil {
-		return err
+		return nil, ErrDatabaseWritingError
 	}
+	erasure.HistoryRows = int(historyRows)
 
-	return nil
+	// уже доставленные события содержат идентификаторы пользователя и позволили бы связать с ним
+	// псевдонимизированную историю, поэтому удаляются сразу; недоставленные, в том числе записанные выше,
+	// остаются до доставки и удаляются вместе с остальными по истечении срока хранения
+	if _, err = tx.Exec(deleteUserEvents, userId); err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+
+	if _, err = tx.Exec(deleteUser, userId); err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+
+	// вместо внешнего идентификатора сохраняется его хеш, чтобы пользователь не был создан повторно
+	var externalIdHashArg interface{}
+	if externalId.Valid {
+		externalIdHashArg = externalIdHash(externalId.String)
+	}
+
+	_, err = tx.Exec(insertUserErasure, erasure.UserId, externalIdHashArg, erasure.ErasedAt, erasure.HistoryMode,
+		erasure.MembershipsEnded, erasure.HistoryRows)
+	if err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+
+	return erasure, nil
 }
 
-func (r *PostgresUserRepository) TakeSegmentFromUser(userId int, slug string) error {
-	user := new(models.User)
-	err := r.db.QueryRow(selectUserById, userId).Scan(&user.Id, &user.Name)
+const (
+	selectExportMemberships = `SELECT slug, deadline_date, auto_enrolled,
+                                    (deadline_date IS NULL OR deadline_date > CURRENT_TIMESTAMP)
+                                    FROM users_segments WHERE user_id = $1 ORDER BY slug;`
+	selectExportHistory = `SELECT user_id, slug, action_date, operation_type FROM history
+                                    WHERE user_id = $1 ORDER BY action_date;`
+)
+
+// ExportUser собирает все данные пользователя: сам пользователь, текущие и истекшие привязки к сегментам
+// и полная история. Данные читаются в одной транзакции, чтобы выгрузка была согласованной.
+func (r *PostgresUserRepository) ExportUser(userId int) (*models.UserExport, error) {
+	tx, err := r.db.BeginTxx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
 	if err != nil {
-		return ErrRecordNotFound
+		return nil, ErrDatabaseReadingError
 	}
+	defer tx.Rollback() //nolint:errcheck
 
-	if exists := r.CheckIfUserAlreadyHasSegment(userId, slug); !exists {
-		return nil
+	export := &models.UserExport{
+		User:       new(models.User),
+		ExportedAt: time.Now(),
 	}
 
-	_, err = r.db.Query(takeSegmentFromUser, userId, slug)
+	err = tx.QueryRow(selectUserById, userId).Scan(&export.User.Id, &export.User.Name, &export.User.Attributes, &export.User.ExternalId)
 	if err != nil {
-		return ErrDatabaseWritingError
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, ErrDatabaseReadingError
 	}
 
-	err = r.hr.SetRemovingHistoryRecord(userId, slug)
+	rows, err := tx.Query(selectExportMemberships, userId)
 	if err != nil {
-		return err
+		return nil, ErrDatabaseReadingError
 	}
+	defer rows.Close()
 
-	return nil
+	for rows.Next() {
+		membership := new(models.ExportedMembership)
+		if err := rows.Scan(&membership.Slug, &membership.DeadlineDate, &membership.AutoEnrolled, &membership.Active); err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		export.Memberships = append(export.Memberships, membership)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	historyRows, err := tx.Query(selectExportHistory, userId)
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer historyRows.Close()
+
+	for historyRows.Next() {
+		record := new(models.HistoryRecord)
+		if err := historyRows.Scan(&record.UserId, &record.Slug, &record.ActionDate, &record.OperationType); err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		export.History = append(export.History, record)
+	}
+
+	if err := historyRows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return export, nil
+}
+
+// getDynamicSegments возвращает сегменты, участвующие в вычислении: с правилом таргетинга, процентом или слоем
+func (r *PostgresUserRepository) getDynamicSegments() ([]*models.Segment, error) {
+	var segments []*models.Segment
+
+	rows, err := r.db.Query(selectDynamicSegments)
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		segment := new(models.Segment)
+		if err := rows.Scan(&segment.Id, &segment.Slug, &segment.Description, &segment.Layer, &segment.Percent, &segment.Rule); err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		segments = append(segments, segment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return segments, nil
+}
+
+const getActiveSegmentsOfUser = `SELECT user_id, slug, deadline_date FROM users_segments
+                                    WHERE user_id = $1 AND (deadline_date IS NULL OR deadline_date > CURRENT_TIMESTAMP);`
+
+// ErrSegmentNotFound возвращается, если сегмент с указанным названием не существует
+var ErrSegmentNotFound = errors.New("Segment was not found")
+
+// ErrUserInHoldout возвращается при попытке добавить в сегмент пользователя из глобальной контрольной группы
+var ErrUserInHoldout = errors.New("User belongs to the global holdout")
+
+// ErrLayerConflict возвращается, если пользователь уже состоит в другом сегменте того же слоя
+var ErrLayerConflict = errors.New("User already belongs to another segment of this layer")
+
+// LayerConflictError содержит слой и сегмент, в котором пользователь уже состоит
+type LayerConflictError struct {
+	Layer string
+	Slug  string
+}
+
+func (e *LayerConflictError) Error() string {
+	return fmt.Sprintf("user already belongs to segment %s of layer %s", e.Slug, e.Layer)
+}
+
+func (e *LayerConflictError) Unwrap() error {
+	return ErrLayerConflict
 }
 
 func (r *PostgresUserRepository) GetActiveSegmentsOfUser(userId int) (*dto.UsersActiveSegments, error) {
 	user := new(models.User)
-	err := r.db.QueryRow(selectUserById, userId).Scan(&user.Id, &user.Name)
+	err := r.db.QueryRow(selectUserById, userId).Scan(&user.Id, &user.Name, &user.Attributes, &user.ExternalId)
 	if err != nil {
-		return nil, ErrRecordNotFound
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, ErrDatabaseReadingError
 	}
 
+	memberships, err := r.getActiveMemberships(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicSegments, err := r.getDynamicSegments()
+	if err != nil {
+		return nil, err
+	}
+
+	segments := r.evaluator.Evaluate(storedSubject(user, memberships), dynamicSegments)
+	active := dto.ConvertUserSegmentToUsersActiveSegments(userId, segments)
+	active.ExternalId = user.ExternalId.String
+	return active, nil
+}
+
+const selectUsersWithActiveSegments = `SELECT u.id, u.name, u.attributes, u.external_id, us.user_id, us.slug, us.deadline_date
+                                    FROM users u
+                                    LEFT JOIN users_segments us ON us.user_id = u.id
+                                        AND (us.deadline_date IS NULL OR us.deadline_date > CURRENT_TIMESTAMP)
+                                    WHERE u.id = ANY($1) OR u.external_id = ANY($2)
+                                    ORDER BY u.id, us.slug;`
+
+// GetActiveSegmentsOfUsers возвращает активные сегменты сразу нескольких пользователей, заданных числовыми или
+// внешними идентификаторами, в порядке идентификаторов в keys, а также идентификаторы, пользователей с которыми
+// нет в БД (в том числе некорректные). Пользователи и их привязки читаются одним запросом, сегменты для
+// вычисления — еще одним на весь набор.
+func (r *PostgresUserRepository) GetActiveSegmentsOfUsers(keys []string) ([]*dto.UsersActiveSegments, []string, error) {
+	userIds, externalIds := splitUserKeys(keys)
+
+	rows, err := r.db.Query(selectUsersWithActiveSegments, pq.Array(userIds), pq.Array(externalIds))
+	if err != nil {
+		return nil, nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	users := make(map[int]*models.User)
+	byExternalId := make(map[string]*models.User)
+	memberships := make(map[int][]*models.UserSegment)
+	for rows.Next() {
+		user := new(models.User)
+		var membershipUserId sql.NullInt64
+		var slug, deadlineDate sql.NullString
+		if err := rows.Scan(&user.Id, &user.Name, &user.Attributes, &user.ExternalId,
+			&membershipUserId, &slug, &deadlineDate); err != nil {
+			return nil, nil, ErrDatabaseReadingError
+		}
+
+		if _, ok := users[user.Id]; !ok {
+			users[user.Id] = user
+			if user.ExternalId.Valid {
+				byExternalId[user.ExternalId.String] = user
+			}
+		}
+		if slug.Valid {
+			memberships[user.Id] = append(memberships[user.Id], &models.UserSegment{
+				UserId:       int(membershipUserId.Int64),
+				Slug:         slug.String,
+				DeadlineDate: deadlineDate,
+			})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, ErrDatabaseReadingError
+	}
+
+	dynamicSegments, err := r.getDynamicSegments()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := make([]*dto.UsersActiveSegments, 0, len(users))
+	unknown := make([]string, 0)
+	seenKeys := make(map[string]bool, len(keys))
+	seenUsers := make(map[int]bool, len(users))
+	for _, key := range keys {
+		if seenKeys[key] {
+			continue
+		}
+		seenKeys[key] = true
+
+		var user *models.User
+		if userId, externalId, ok := models.ParseUserKey(key); ok && externalId == "" {
+			user = users[userId]
+		} else if ok {
+			user = byExternalId[externalId]
+		}
+
+		if user == nil {
+			unknown = append(unknown, key)
+			continue
+		}
+
+		// пользователь, переданный и числовым, и внешним идентификатором, возвращается один раз
+		if seenUsers[user.Id] {
+			continue
+		}
+		seenUsers[user.Id] = true
+
+		segments := r.evaluator.Evaluate(storedSubject(user, memberships[user.Id]), dynamicSegments)
+		active := dto.ConvertUserSegmentToUsersActiveSegments(user.Id, segments)
+		active.ExternalId = user.ExternalId.String
+		result = append(result, active)
+	}
+
+	return result, unknown, nil
+}
+
+// ExplainSegmentOfUser объясняет, почему пользователь попал или не попал в сегмент
+func (r *PostgresUserRepository) ExplainSegmentOfUser(userId int, slug string) (*evaluation.Explanation, error) {
+	user := new(models.User)
+	err := r.db.QueryRow(selectUserById, userId).Scan(&user.Id, &user.Name, &user.Attributes, &user.ExternalId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, ErrDatabaseReadingError
+	}
+
+	segment := new(models.Segment)
+	err = r.db.QueryRow(selectSegmentBySlug, slug).Scan(&segment.Id, &segment.Slug, &segment.Description,
+		&segment.Layer, &segment.Percent, &segment.Rule)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSegmentNotFound
+		}
+
+		return nil, ErrDatabaseReadingError
+	}
+
+	memberships, err := r.getActiveMemberships(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicSegments, err := r.getDynamicSegments()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.evaluator.Explain(storedSubject(user, memberships), dynamicSegments, segment), nil
+}
+
+// EvaluateUser вычисляет сегменты пользователя, который может отсутствовать в БД. Если пользователь
+// с таким ключом хранится в сервисе, учитываются его привязки, а переданные атрибуты дополняют сохраненные.
+func (r *PostgresUserRepository) EvaluateUser(key string, attributes models.Attributes) ([]*models.UserSegment, bool, error) {
+	subject := &evaluation.Subject{
+		Key:        key,
+		Attributes: attributes,
+	}
+
+	// числовой ключ ищется среди внутренних идентификаторов, остальные — среди внешних
+	var query string
+	var arg interface{}
+	if userId, externalId, ok := models.ParseUserKey(key); ok && externalId == "" {
+		query, arg = selectUserById, userId
+	} else if ok {
+		query, arg = selectUserByExternal, externalId
+	}
+
+	if query != "" {
+		user := new(models.User)
+		err := r.db.QueryRow(query, arg).Scan(&user.Id, &user.Name, &user.Attributes, &user.ExternalId)
+		switch {
+		case err == nil:
+			memberships, err := r.getActiveMemberships(user.Id)
+			if err != nil {
+				return nil, false, err
+			}
+
+			if user.Attributes == nil {
+				user.Attributes = models.Attributes{}
+			}
+			for name, value := range attributes {
+				user.Attributes[name] = value
+			}
+
+			subject = storedSubject(user, memberships)
+		case !errors.Is(err, sql.ErrNoRows):
+			return nil, false, ErrDatabaseReadingError
+		}
+	}
+
+	dynamicSegments, err := r.getDynamicSegments()
+	if err != nil {
+		return nil, false, err
+	}
+
+	return r.evaluator.Evaluate(subject, dynamicSegments), subject.Stored, nil
+}
+
+func storedSubject(user *models.User, memberships []*models.UserSegment) *evaluation.Subject {
+	return &evaluation.Subject{
+		UserId:      user.Id,
+		Key:         user.BucketingKey(),
+		Attributes:  user.Attributes,
+		Memberships: memberships,
+		Stored:      true,
+	}
+}
+
+func (r *PostgresUserRepository) getActiveMemberships(userId int) ([]*models.UserSegment, error) {
 	var segments []*models.UserSegment
 
 	rows, err := r.db.Query(getActiveSegmentsOfUser, userId)
@@ -179,5 +706,379 @@ func (r *PostgresUserRepository) GetActiveSegmentsOfUser(userId int) (*dto.Users
 	}
 
 	defer rows.Close()
-	return dto.ConvertUserSegmentToUsersActiveSegments(userId, segments), nil
+	return segments, nil
+}
+
+const (
+	selectMembershipsForChange = `SELECT us.slug, COALESCE(s.layer, ''),
+                                    (us.deadline_date IS NULL OR us.deadline_date > CURRENT_TIMESTAMP)
+                                    FROM users_segments us
+                                    JOIN segments s ON s.slug = us.slug
+                                    WHERE us.user_id = $1 FOR UPDATE OF us;`
+	takeSegmentFromUser = `DELETE FROM users_segments WHERE user_id = $1 AND slug = $2;`
+	upsertSegmentOfUser = `INSERT INTO users_segments (user_id, slug, deadline_date) VALUES ($1, $2, $3)
+                                    ON CONFLICT (user_id, slug) DO UPDATE
+                                    SET deadline_date = EXCLUDED.deadline_date, auto_enrolled = false;`
+	updateSegmentOfUser = `UPDATE users_segments SET deadline_date = $3, auto_enrolled = false
+                                    WHERE user_id = $1 AND slug = $2 AND deadline_date IS DISTINCT FROM $3::timestamptz;`
+	savepointChange           = `SAVEPOINT segment_change;`
+	rollbackToSavepointChange = `ROLLBACK TO SAVEPOINT segment_change;`
+)
+
+// ErrInvalidDeadline возвращается, если дату отключения от сегмента не удалось разобрать
+var ErrInvalidDeadline = errors.New("Invalid deadline date")
+
+type currentMembership struct {
+	layer  string
+	active bool
+}
+
+// segmentsChange — изменение сегментов одного пользователя в рамках транзакции. Ошибки проверки отдельных
+// сегментов не прерывают транзакцию, а накапливаются в changes.Errors, чтобы пробный запуск вернул их все.
+type segmentsChange struct {
+	tx        *sqlx.Tx
+	userId    int
+	inHoldout bool
+	current   map[string]*currentMembership
+	layers    map[string]string
+	occupied  map[string]string
+	changes   *models.SegmentChanges
+}
+
+func (r *PostgresUserRepository) beginSegmentsChange(key string, slugs []string) (*segmentsChange, error) {
+	if _, _, ok := models.ParseUserKey(key); !ok {
+		return nil, ErrMalformedUserId
+	}
+
+	resolution, err := r.users.Resolve(r.db, []string{key})
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+
+	if err = r.users.Provision(tx, resolution); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return nil, err
+	}
+
+	user, ok := resolution.Users[key]
+	if !ok {
+		tx.Rollback() //nolint:errcheck
+		return nil, ErrRecordNotFound
+	}
+
+	// блокировка защищает от удаления пользователя, найденного до начала транзакции
+	var externalId sql.NullString
+	if err = tx.QueryRow(lockUser, user.Id).Scan(&externalId); err != nil {
+		tx.Rollback() //nolint:errcheck
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, ErrDatabaseReadingError
+	}
+
+	c := &segmentsChange{
+		tx:        tx,
+		userId:    user.Id,
+		inHoldout: r.holdout.ContainsKey(user.BucketingKey()),
+		occupied:  make(map[string]string),
+		changes:   &models.SegmentChanges{UserId: user.Id},
+	}
+
+	if c.layers, err = selectSegmentLayers(tx, slugs); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return nil, err
+	}
+
+	if c.current, err = selectCurrentMemberships(tx, user.Id); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return nil, err
+	}
+
+	for slug, membership := range c.current {
+		if membership.active && membership.layer != "" {
+			c.occupied[membership.layer] = slug
+		}
+	}
+
+	return c, nil
+}
+
+func (c *segmentsChange) fail(slug string, err error) {
+	c.changes.Errors = append(c.changes.Errors, &models.SegmentError{Slug: slug, Err: err})
+}
+
+// exec выполняет запрос внутри точки сохранения, чтобы ошибка в одном сегменте не прерывала транзакцию
+func (c *segmentsChange) exec(query string, args ...interface{}) (int64, error) {
+	if _, err := c.tx.Exec(savepointChange); err != nil {
+		return 0, ErrDatabaseWritingError
+	}
+
+	result, err := c.tx.Exec(query, args...)
+	if err != nil {
+		if _, rollbackErr := c.tx.Exec(rollbackToSavepointChange); rollbackErr != nil {
+			return 0, ErrDatabaseWritingError
+		}
+
+		return 0, membershipWritingError(err)
+	}
+
+	return result.RowsAffected()
+}
+
+func (c *segmentsChange) take(slug string) error {
+	membership, ok := c.current[slug]
+	if !ok || !membership.active {
+		c.changes.Ignored = append(c.changes.Ignored, slug)
+		return nil
+	}
+
+	if _, err := c.exec(takeSegmentFromUser, c.userId, slug); err != nil {
+		return err
+	}
+
+	delete(c.current, slug)
+	if c.occupied[membership.layer] == slug {
+		delete(c.occupied, membership.layer)
+	}
+	c.changes.Removed = append(c.changes.Removed, slug)
+
+	return nil
+}
+
+// add добавляет сегмент пользователю. Если пользователь уже состоит в сегменте, то при updateDeadline
+// обновляется дата отключения, иначе сегмент игнорируется.
+func (c *segmentsChange) add(slug, deadline string, updateDeadline bool) error {
+	layer, ok := c.layers[slug]
+	if !ok {
+		c.fail(slug, ErrSegmentNotFound)
+		return nil
+	}
+
+	var ttl interface{}
+	if deadline != "" {
+		ttl = deadline
+	}
+
+	membership, isMember := c.current[slug]
+	if isMember && membership.active {
+		if !updateDeadline {
+			c.changes.Ignored = append(c.changes.Ignored, slug)
+			return nil
+		}
+
+		affected, err := c.exec(updateSegmentOfUser, c.userId, slug, ttl)
+		switch {
+		case errors.Is(err, ErrInvalidDeadline):
+			c.fail(slug, err)
+		case err != nil:
+			return err
+		case affected > 0:
+			c.changes.Updated = append(c.changes.Updated, slug)
+		default:
+			c.changes.Ignored = append(c.changes.Ignored, slug)
+		}
+
+		return nil
+	}
+
+	if c.inHoldout {
+		c.fail(slug, ErrUserInHoldout)
+		return nil
+	}
+
+	if occupant := c.occupied[layer]; layer != "" && occupant != "" {
+		c.fail(slug, &LayerConflictError{Layer: layer, Slug: occupant})
+		return nil
+	}
+
+	if _, err := c.exec(upsertSegmentOfUser, c.userId, slug, ttl); err != nil {
+		if errors.Is(err, ErrInvalidDeadline) || errors.Is(err, ErrLayerConflict) {
+			c.fail(slug, err)
+			return nil
+		}
+		return err
+	}
+
+	if layer != "" {
+		c.occupied[layer] = slug
+	}
+	c.current[slug] = &currentMembership{layer: layer, active: true}
+	if isMember {
+		c.changes.Reactivated = append(c.changes.Reactivated, slug)
+	} else {
+		c.changes.Added = append(c.changes.Added, slug)
+	}
+
+	return nil
+}
+
+// finish фиксирует изменения с записью истории. При пробном запуске или ошибках проверки транзакция
+// откатывается; при ошибках проверки вне пробного запуска возвращается первая из них.
+func (c *segmentsChange) finish(hr HistoryRepository, dryRun bool) (*models.SegmentChanges, error) {
+	defer c.tx.Rollback() //nolint:errcheck
+
+	if dryRun {
+		return c.changes, nil
+	}
+
+	if len(c.changes.Errors) > 0 {
+		return c.changes, c.changes.Errors[0].Err
+	}
+
+	for _, slugs := range [][]string{c.changes.Added, c.changes.Reactivated} {
+		for _, slug := range slugs {
+			if err := hr.SetBulkHistoryRecords(c.tx, []int{c.userId}, slug, OperationAdding, ActorApi); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, slug := range c.changes.Removed {
+		if err := hr.SetBulkHistoryRecords(c.tx, []int{c.userId}, slug, OperationRemoving, ActorApi); err != nil {
+			return nil, err
+		}
+	}
+	for _, slug := range c.changes.Updated {
+		if err := hr.SetBulkHistoryRecords(c.tx, []int{c.userId}, slug, OperationUpdating, ActorApi); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.tx.Commit(); err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+
+	return c.changes, nil
+}
+
+// ChangeSegmentsOfUser в одной транзакции удаляет у пользователя сегменты take и добавляет сегменты add.
+// Пользователь задается числовым или внешним идентификатором key; неизвестный пользователь с внешним
+// идентификатором создается, если это разрешено режимом USERS_MODE. Сегменты, в которых пользователь
+// уже состоит, игнорируются, истекшие привязки активируются повторно. Удаление сегмента, в который пользователь
+// добавлен планировщиком раскатывания, считается отказом от раскатывания, и повторно пользователь не добавляется.
+func (r *PostgresUserRepository) ChangeSegmentsOfUser(key string, add []*models.UserSegment, take []string, dryRun bool) (*models.SegmentChanges, error) {
+	slugs := make([]string, 0, len(add))
+	for _, segment := range add {
+		slugs = append(slugs, segment.Slug)
+	}
+
+	c, err := r.beginSegmentsChange(key, slugs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, slug := range take {
+		if err = c.take(slug); err != nil {
+			c.tx.Rollback() //nolint:errcheck
+			return nil, err
+		}
+	}
+
+	for _, segment := range add {
+		if err = c.add(segment.Slug, segment.DeadlineDate.String, false); err != nil {
+			c.tx.Rollback() //nolint:errcheck
+			return nil, err
+		}
+	}
+
+	return c.finish(r.hr, dryRun)
+}
+
+// SetSegmentsOfUser приводит сегменты пользователя к желаемому набору: в одной транзакции добавляет
+// недостающие сегменты, удаляет лишние и обновляет изменившиеся даты отключения. Сегменты, в которые
+// пользователь добавлен планировщиком раскатывания, удаляются так же, как в ChangeSegmentsOfUser.
+// Пользователь задается и при необходимости создается так же, как в ChangeSegmentsOfUser.
+func (r *PostgresUserRepository) SetSegmentsOfUser(key string, segments []*models.UserSegment, dryRun bool) (*models.SegmentChanges, error) {
+	desired := make(map[string]string)
+	var slugs []string
+	for _, segment := range segments {
+		if _, ok := desired[segment.Slug]; !ok {
+			slugs = append(slugs, segment.Slug)
+		}
+		desired[segment.Slug] = segment.DeadlineDate.String
+	}
+
+	c, err := r.beginSegmentsChange(key, slugs)
+	if err != nil {
+		return nil, err
+	}
+
+	var take []string
+	for slug, membership := range c.current {
+		if _, ok := desired[slug]; !ok && membership.active {
+			take = append(take, slug)
+		}
+	}
+	sort.Strings(take)
+
+	for _, slug := range take {
+		if err = c.take(slug); err != nil {
+			c.tx.Rollback() //nolint:errcheck
+			return nil, err
+		}
+	}
+
+	for _, slug := range slugs {
+		if err = c.add(slug, desired[slug], true); err != nil {
+			c.tx.Rollback() //nolint:errcheck
+			return nil, err
+		}
+	}
+
+	return c.finish(r.hr, dryRun)
+}
+
+func selectCurrentMemberships(tx *sqlx.Tx, userId int) (map[string]*currentMembership, error) {
+	memberships := make(map[string]*currentMembership)
+
+	rows, err := tx.Query(selectMembershipsForChange, userId)
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var slug string
+		membership := new(currentMembership)
+		if err := rows.Scan(&slug, &membership.layer, &membership.active); err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		memberships[slug] = membership
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return memberships, nil
+}
+
+// userWritingError отличает нарушение уникальности внешнего идентификатора от остальных ошибок записи
+func userWritingError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrRecordAlreadyExists
+	}
+
+	return ErrDatabaseWritingError
+}
+
+// membershipWritingError отличает при записи участия в сегменте некорректную дату отключения (ошибки класса 22 —
+// data exception) и нарушение слоя, обнаруженное триггером при параллельном добавлении, от остальных ошибок записи
+func membershipWritingError(err error) error {
+	var pqErr *pq.Error
+	switch {
+	case !errors.As(err, &pqErr):
+	case pqErr.Code.Class() == "22":
+		return ErrInvalidDeadline
+	case pqErr.Code.Name() == "exclusion_violation":
+		return ErrLayerConflict
+	}
+
+	return ErrDatabaseWritingError
 }
@@ -0,0 +1,214 @@
+package repositories
+
+import (
+	"database/sql"
+	goErrors "errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+// ErrDeliveryNotDead возвращается при попытке повторно отправить доставку, которая не находится в недоставленных
+var ErrDeliveryNotDead = goErrors.New("Webhook delivery is not dead-lettered")
+
+type PostgresWebhookRepository struct {
+	db *sqlx.DB
+}
+
+func NewWebhookRepository(db *sqlx.DB) *PostgresWebhookRepository {
+	return &PostgresWebhookRepository{
+		db: db,
+	}
+}
+
+const (
+	webhookColumns = `id, url, secret, event_types, slugs, active, created_at`
+	selectWebhooks = `SELECT ` + webhookColumns + ` FROM webhooks ORDER BY id;`
+	selectWebhook  = `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1;`
+	insertWebhook  = `INSERT INTO webhooks (url, secret, event_types, slugs, active) VALUES ($1, $2, $3, $4, $5)
+                                    RETURNING ` + webhookColumns + `;`
+	updateWebhook = `UPDATE webhooks SET url = $2, secret = COALESCE(NULLIF($3, ''), secret), event_types = $4, slugs = $5,
+                                    active = $6 WHERE id = $1 RETURNING ` + webhookColumns + `;`
+	deleteWebhook = `DELETE FROM webhooks WHERE id = $1;`
+)
+
+func (r *PostgresWebhookRepository) GetWebhooks() ([]*models.Webhook, error) {
+	rows, err := r.db.Query(selectWebhooks)
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	var webhooks []*models.Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return webhooks, nil
+}
+
+func (r *PostgresWebhookRepository) GetWebhook(id int) (*models.Webhook, error) {
+	webhook, err := scanWebhook(r.db.QueryRow(selectWebhook, id))
+	if err != nil {
+		if goErrors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, ErrDatabaseReadingError
+	}
+
+	return webhook, nil
+}
+
+func (r *PostgresWebhookRepository) CreateWebhook(webhook *models.Webhook) (*models.Webhook, error) {
+	created, err := scanWebhook(r.db.QueryRow(insertWebhook, webhook.Url, webhook.Secret,
+		pq.Array(nonNil(webhook.EventTypes)), pq.Array(nonNil(webhook.Slugs)), webhook.Active))
+	if err != nil {
+		return nil, ErrDatabaseWritingError
+	}
+
+	return created, nil
+}
+
+// UpdateWebhook заменяет параметры подписки; пустой Secret оставляет прежний секрет
+func (r *PostgresWebhookRepository) UpdateWebhook(webhook *models.Webhook) (*models.Webhook, error) {
+	updated, err := scanWebhook(r.db.QueryRow(updateWebhook, webhook.Id, webhook.Url, webhook.Secret,
+		pq.Array(nonNil(webhook.EventTypes)), pq.Array(nonNil(webhook.Slugs)), webhook.Active))
+	if err != nil {
+		if goErrors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, ErrDatabaseWritingError
+	}
+
+	return updated, nil
+}
+
+// DeleteWebhook удаляет подписку вместе со всеми ее доставками
+func (r *PostgresWebhookRepository) DeleteWebhook(id int) error {
+	affected, err := affectedRows(r.db, deleteWebhook, id)
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+const (
+	webhookDeliveryColumns = `d.id, d.webhook_id, d.status, d.attempts, d.next_attempt_at, d.last_status_code, d.last_error,
+                                    d.created_at, d.delivered_at,
+                                    e.id, e.event_type, e.user_id, e.external_id, e.slug, e.deadline_date, e.actor, e.occurred_at`
+	selectWebhookDeliveries = `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries d
+                                    JOIN outbox_events e ON e.id = d.event_id
+                                    WHERE d.webhook_id = $1 AND ($2 = '' OR d.status = $2) AND ($3::bigint = 0 OR d.id < $3)
+                                    ORDER BY d.id DESC LIMIT $4;`
+	redeliverWebhookDelivery = `UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = $3
+                                    WHERE webhook_id = $1 AND id = $2 AND status = 'dead';`
+	selectWebhookDelivery = `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries d
+                                    JOIN outbox_events e ON e.id = d.event_id
+                                    WHERE d.webhook_id = $1 AND d.id = $2;`
+)
+
+// GetWebhookDeliveries возвращает доставки подписки от новых к старым; пустой status не ограничивает выборку,
+// after — идентификатор последней доставки предыдущей страницы
+func (r *PostgresWebhookRepository) GetWebhookDeliveries(webhookId int, status string, after int64, limit int) ([]*models.WebhookDelivery, error) {
+	if _, err := r.GetWebhook(webhookId); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(selectWebhookDeliveries, webhookId, status, after, limit)
+	if err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, ErrDatabaseReadingError
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, ErrDatabaseReadingError
+	}
+
+	return deliveries, nil
+}
+
+// RedeliverWebhookDelivery возвращает недоставленную доставку в очередь со сброшенным числом попыток
+func (r *PostgresWebhookRepository) RedeliverWebhookDelivery(webhookId int, id int64) (*models.WebhookDelivery, error) {
+	affected, err := affectedRows(r.db, redeliverWebhookDelivery, webhookId, id, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err := scanWebhookDelivery(r.db.QueryRow(selectWebhookDelivery, webhookId, id))
+	if err != nil {
+		if goErrors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, ErrDatabaseReadingError
+	}
+
+	if affected == 0 {
+		return nil, ErrDeliveryNotDead
+	}
+
+	return delivery, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWebhook(row rowScanner) (*models.Webhook, error) {
+	webhook := new(models.Webhook)
+	err := row.Scan(&webhook.Id, &webhook.Url, &webhook.Secret, pq.Array(&webhook.EventTypes), pq.Array(&webhook.Slugs),
+		&webhook.Active, &webhook.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func scanWebhookDelivery(row rowScanner) (*models.WebhookDelivery, error) {
+	delivery := &models.WebhookDelivery{Event: new(models.OutboxEvent)}
+	event := delivery.Event
+	err := row.Scan(&delivery.Id, &delivery.WebhookId, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt,
+		&delivery.LastStatusCode, &delivery.LastError, &delivery.CreatedAt, &delivery.DeliveredAt,
+		&event.Id, &event.Type, &event.UserId, &event.ExternalId, &event.Slug, &event.DeadlineDate, &event.Actor,
+		&event.OccurredAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+
+	return values
+}
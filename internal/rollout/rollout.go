@@ -0,0 +1,183 @@
+package rollout
+
+import (
+	"context"
+	goErrors "errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/bucketing"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+var ErrNothingToRollback = goErrors.New("Rollout has no applied steps to roll back")
+
+type RolloutConfig struct {
+	Interval time.Duration `envconfig:"INTERVAL" default:"1m"`
+	// RollbackDelay — через сколько после отката откаченный шаг наступает снова
+	RollbackDelay time.Duration `envconfig:"ROLLBACK_DELAY" default:"24h"`
+}
+
+func (c RolloutConfig) Validate() error {
+	switch {
+	case c.Interval <= 0:
+		return fmt.Errorf("rollout interval must be positive, got %s", c.Interval)
+	case c.RollbackDelay < 0:
+		return fmt.Errorf("rollout rollback delay must not be negative, got %s", c.RollbackDelay)
+	}
+
+	return nil
+}
+
+type Repository interface {
+	GetRollout(slug string) (*models.Rollout, error)
+	GetDueRolloutSteps(now time.Time) ([]*models.RolloutStep, error)
+	ApplyRolloutStep(slug string, step int, percent float64) error
+	RollbackRolloutStep(slug string, step int, percent float64, delay time.Duration) error
+	GetEnrollmentCandidates(slug string) ([]*models.User, error)
+	GetAutoEnrolledUsers(slug string) ([]*models.User, error)
+	EnrollUsers(slug string, userIds []int) error
+	UnenrollUsers(slug string, userIds []int) error
+}
+
+type Holdout interface {
+	ContainsKey(key string) bool
+}
+
+// Scheduler по расписанию повышает процент пользователей, автоматически добавляемых в сегмент.
+// Попадание пользователя в процент определяется детерминированным хешем от ключа распределения пользователя
+// (models.User.BucketingKey) и названия сегмента, поэтому при повышении процента ранее добавленные пользователи остаются в сегменте.
+type Scheduler struct {
+	repository    Repository
+	holdout       Holdout
+	interval      time.Duration
+	rollbackDelay time.Duration
+	logger        *zap.SugaredLogger
+}
+
+func NewScheduler(r Repository, h Holdout, cfg RolloutConfig, logger *zap.SugaredLogger) *Scheduler {
+	return &Scheduler{
+		repository:    r,
+		holdout:       h,
+		interval:      cfg.Interval,
+		rollbackDelay: cfg.RollbackDelay,
+		logger:        logger.With(zap.String("comp", "rollout scheduler")),
+	}
+}
+
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Tick(time.Now()); err != nil {
+			s.logger.Errorf("Error while applying rollout steps: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick применяет все наступившие шаги расписаний. Пользователи добавляются в сегмент только при смене шага;
+// шаг отмечается примененным после того, как они добавлены, поэтому при ошибке он будет повторен на следующем тике.
+// Ошибка одного расписания не мешает применить шаги остальных.
+func (s *Scheduler) Tick(now time.Time) error {
+	steps, err := s.repository.GetDueRolloutSteps(now)
+	if err != nil {
+		return err
+	}
+
+	for _, step := range steps {
+		if err := s.apply(step); err != nil {
+			s.logger.Errorf("Error while applying step %d of segment %s rollout: %v", step.Step, step.Slug, err)
+			continue
+		}
+
+		s.logger.Infof("Rollout of segment %s moved to step %d (%.2f%%)", step.Slug, step.Step, step.Percent)
+	}
+
+	return nil
+}
+
+func (s *Scheduler) apply(step *models.RolloutStep) error {
+	if err := s.enroll(step.Slug, step.Percent); err != nil {
+		return err
+	}
+
+	return s.repository.ApplyRolloutStep(step.Slug, step.Step, step.Percent)
+}
+
+// Rollback возвращает расписание сегмента на предыдущий шаг, убирает из сегмента автоматически
+// добавленных пользователей, не попадающих в прежний процент, и приостанавливает расписание. Откаченный шаг
+// переносится на RollbackDelay вперед (последующие — на столько же), чтобы после возобновления он не был
+// сразу применен повторно.
+func (s *Scheduler) Rollback(slug string) (*models.Rollout, error) {
+	rollout, err := s.repository.GetRollout(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	if rollout.CurrentStep < 0 {
+		return nil, ErrNothingToRollback
+	}
+
+	previousStep := rollout.CurrentStep - 1
+	var percent float64
+	if previousStep >= 0 {
+		percent = rollout.Steps[previousStep].Percent
+	}
+
+	if err := s.unenroll(slug, percent); err != nil {
+		return nil, err
+	}
+
+	delay := time.Now().Add(s.rollbackDelay).Sub(rollout.Steps[rollout.CurrentStep].StartAt)
+	if err := s.repository.RollbackRolloutStep(slug, previousStep, percent, delay); err != nil {
+		return nil, err
+	}
+
+	return s.repository.GetRollout(slug)
+}
+
+func (s *Scheduler) enroll(slug string, percent float64) error {
+	candidates, err := s.repository.GetEnrollmentCandidates(slug)
+	if err != nil {
+		return err
+	}
+
+	var enrolling []int
+	for _, user := range candidates {
+		if s.eligible(slug, user, percent) {
+			enrolling = append(enrolling, user.Id)
+		}
+	}
+
+	return s.repository.EnrollUsers(slug, enrolling)
+}
+
+func (s *Scheduler) unenroll(slug string, percent float64) error {
+	members, err := s.repository.GetAutoEnrolledUsers(slug)
+	if err != nil {
+		return err
+	}
+
+	var unenrolling []int
+	for _, user := range members {
+		if !s.eligible(slug, user, percent) {
+			unenrolling = append(unenrolling, user.Id)
+		}
+	}
+
+	return s.repository.UnenrollUsers(slug, unenrolling)
+}
+
+func (s *Scheduler) eligible(slug string, user *models.User, percent float64) bool {
+	key := user.BucketingKey()
+	return bucketing.InPercent(slug, key, percent) && !s.holdout.ContainsKey(key)
+}
@@ -0,0 +1,68 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+)
+
+// statusError переводит ошибку репозитория в статус gRPC с тем же сообщением, что и в REST API.
+// Для неизвестных ошибок возвращается INTERNAL с сообщением internal.
+func statusError(err error, internal string) error {
+	var layerConflict *repositories.LayerConflictError
+	switch {
+	case errors.Is(err, repositories.ErrMalformedUserId):
+		return status.Error(codes.InvalidArgument, "Некорректный идентификатор пользователя")
+	case errors.Is(err, repositories.ErrRecordNotFound):
+		return status.Error(codes.NotFound, "Пользователь с таким идентификатором не найден")
+	case errors.Is(err, repositories.ErrSegmentNotFound):
+		return status.Error(codes.NotFound, "Сегмент с таким названием не найден")
+	case errors.Is(err, repositories.ErrRecordAlreadyExists):
+		return status.Error(codes.AlreadyExists, "Запись с такими данными уже существует")
+	case errors.Is(err, repositories.ErrInvalidDeadline):
+		return status.Error(codes.InvalidArgument, "Некорректная дата отключения от сегмента")
+	case errors.Is(err, repositories.ErrUserInHoldout):
+		return status.Error(codes.FailedPrecondition,
+			"Пользователь входит в глобальную контрольную группу и не может быть добавлен в сегмент")
+	case errors.As(err, &layerConflict):
+		return status.Error(codes.FailedPrecondition,
+			fmt.Sprintf("Пользователь уже состоит в сегменте %s из слоя %s", layerConflict.Slug, layerConflict.Layer))
+	case errors.Is(err, repositories.ErrLayerConflict):
+		return status.Error(codes.FailedPrecondition, "Пользователь уже состоит в другом сегменте того же слоя")
+	case errors.Is(err, repositories.ErrUserDirectoryUnavailable):
+		return status.Error(codes.Unavailable, "Сервис пользователей недоступен, повторите запрос позже")
+	default:
+		return status.Error(codes.Internal, internal)
+	}
+}
+
+// segmentStatusError — то же для операций с сегментом, где ErrRecordNotFound означает отсутствие сегмента
+func segmentStatusError(err error, internal string) error {
+	if errors.Is(err, repositories.ErrRecordNotFound) {
+		return status.Error(codes.NotFound, "Запись с таким названием в таблице сегментов не найдена")
+	}
+
+	return statusError(err, internal)
+}
+
+func statusMessage(err error) string {
+	return status.Convert(err).Message()
+}
+
+func invalidArgument(message string) error {
+	return status.Error(codes.InvalidArgument, message)
+}
+
+// isServerError сообщает, что вызов завершился по вине сервиса, а не клиента
+func isServerError(code codes.Code) bool {
+	switch code {
+	case codes.Internal, codes.Unknown, codes.Unavailable, codes.DataLoss:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,108 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/TinyMarcus/avito-tech-task/api/proto/segmentation/v1"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+	"github.com/TinyMarcus/avito-tech-task/internal/repositories"
+	"github.com/TinyMarcus/avito-tech-task/internal/rules"
+)
+
+func (s *Server) ListSegments(ctx context.Context, req *pb.ListSegmentsRequest) (*pb.ListSegmentsResponse, error) {
+	segments, err := s.segments.GetAllSegments()
+	if err != nil {
+		return nil, statusError(err, "Возникла внутренняя ошибка при запросе всех сегментов")
+	}
+
+	response := &pb.ListSegmentsResponse{
+		Segments: make([]*pb.Segment, 0, len(segments)),
+	}
+	for _, segment := range segments {
+		response.Segments = append(response.Segments, segmentToProto(segment))
+	}
+
+	return response, nil
+}
+
+func (s *Server) GetSegment(ctx context.Context, req *pb.GetSegmentRequest) (*pb.Segment, error) {
+	segment, err := s.segments.GetSegmentBySlug(req.GetSlug())
+	if err != nil {
+		return nil, segmentStatusError(err, "Возникла внутренняя ошибка при запросе сегмента по названию")
+	}
+
+	return segmentToProto(segment), nil
+}
+
+func (s *Server) CreateSegment(ctx context.Context, req *pb.CreateSegmentRequest) (*pb.CreateSegmentResponse, error) {
+	if err := validateRule(req.GetRule()); err != nil {
+		return nil, err
+	}
+
+	slug, err := s.segments.CreateSegment(req.GetSlug(), req.GetDescription(), req.GetLayer(), req.GetRule())
+	if err != nil {
+		return nil, statusError(err, "Возникла внутренняя ошибка при создании сегмента")
+	}
+
+	return &pb.CreateSegmentResponse{Slug: slug}, nil
+}
+
+func (s *Server) UpdateSegment(ctx context.Context, req *pb.UpdateSegmentRequest) (*pb.Segment, error) {
+	if err := validateRule(req.GetRule()); err != nil {
+		return nil, err
+	}
+
+	segment, err := s.segments.UpdateSegment(req.GetSlug(), req.Description, req.Layer, req.Rule)
+	var layerConflict *repositories.LayerConflictError
+	if errors.As(err, &layerConflict) {
+		return nil, status.Error(codes.FailedPrecondition,
+			fmt.Sprintf("Участники сегмента уже состоят в сегменте %s из слоя %s", layerConflict.Slug, layerConflict.Layer))
+	}
+	if err != nil {
+		return nil, segmentStatusError(err, "Возникла внутренняя ошибка при обновлении сегмента")
+	}
+
+	return segmentToProto(segment), nil
+}
+
+func (s *Server) DeleteSegment(ctx context.Context, req *pb.DeleteSegmentRequest) (*pb.DeleteSegmentResponse, error) {
+	_, err := s.segments.DeleteSegment(req.GetSlug())
+	if err != nil {
+		return nil, segmentStatusError(err, "Возникла внутренняя ошибка при удалении сегмента")
+	}
+
+	return &pb.DeleteSegmentResponse{}, nil
+}
+
+func validateRule(rule string) error {
+	if rule == "" {
+		return nil
+	}
+
+	if _, err := rules.Parse(rule); err != nil {
+		return invalidArgument(fmt.Sprintf("Некорректное правило сегмента: %v", err))
+	}
+
+	return nil
+}
+
+func segmentToProto(segment *models.Segment) *pb.Segment {
+	result := &pb.Segment{
+		Id:          int64(segment.Id),
+		Slug:        segment.Slug,
+		Description: segment.Description,
+		Layer:       segment.Layer.String,
+		Rule:        segment.Rule.String,
+	}
+
+	if segment.Percent.Valid {
+		result.Percent = &segment.Percent.Float64
+	}
+
+	return result
+}
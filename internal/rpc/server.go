@@ -0,0 +1,128 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/TinyMarcus/avito-tech-task/api/proto/segmentation/v1"
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers"
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+type GrpcConfig struct {
+	Port string `envconfig:"PORT" default:"9090"`
+}
+
+func (c GrpcConfig) Validate() error {
+	if c.Port == "" {
+		return errors.New("grpc port must be set")
+	}
+
+	return nil
+}
+
+// Server реализует gRPC API поверх тех же репозиториев, что и REST API
+type Server struct {
+	pb.UnimplementedSegmentationServiceServer
+
+	segments   SegmentRepository
+	users      UserRepository
+	events     EventRepository
+	subscriber EventSubscriber
+	readLimit  int
+	poll       time.Duration
+	logger     *zap.SugaredLogger
+}
+
+func NewServer(sr SegmentRepository, ur UserRepository, es EventRepository, eh EventSubscriber,
+	bc handlers.BatchConfig, sc handlers.StreamConfig, logger *zap.SugaredLogger) *Server {
+	return &Server{
+		segments:   sr,
+		users:      ur,
+		events:     es,
+		subscriber: eh,
+		readLimit:  bc.ReadLimit,
+		poll:       sc.Heartbeat,
+		logger:     logger.With(zap.String("comp", "grpc server")),
+	}
+}
+
+type SegmentRepository interface {
+	GetAllSegments() ([]*models.Segment, error)
+	GetSegmentBySlug(slug string) (*models.Segment, error)
+	CreateSegment(slug, description, layer, rule string) (string, error)
+	UpdateSegment(slug string, description, layer, rule *string) (*models.Segment, error)
+	DeleteSegment(slug string) (*models.Segment, error)
+}
+
+type UserRepository interface {
+	ResolveUserId(key string) (int, error)
+	CreateUser(name, externalId string, attributes models.Attributes) (int, error)
+	ChangeSegmentsOfUser(key string, add []*models.UserSegment, take []string, dryRun bool) (*models.SegmentChanges, error)
+	GetActiveSegmentsOfUser(userId int) (*dto.UsersActiveSegments, error)
+	GetActiveSegmentsOfUsers(keys []string) ([]*dto.UsersActiveSegments, []string, error)
+}
+
+type EventRepository interface {
+	GetStreamStart() (*models.EventPosition, error)
+	GetUserEvents(userId int, after *models.EventPosition, limit int) ([]*models.OutboxEvent, error)
+}
+
+type EventSubscriber interface {
+	Subscribe(userId int) (<-chan struct{}, func())
+}
+
+// ListenAndServe принимает gRPC-запросы на адресе addr. Описание сервиса доступно через reflection,
+// поэтому к нему можно обращаться grpcurl без proto-файла.
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(s.logUnary),
+		grpc.ChainStreamInterceptor(s.logStream),
+	)
+	pb.RegisterSegmentationServiceServer(server, s)
+	reflection.Register(server)
+
+	return server.Serve(listener)
+}
+
+func (s *Server) logUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	startTime := time.Now()
+	resp, err := handler(ctx, req)
+	s.logCall(info.FullMethod, time.Since(startTime), err)
+
+	return resp, err
+}
+
+func (s *Server) logStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	startTime := time.Now()
+	err := handler(srv, ss)
+	s.logCall(info.FullMethod, time.Since(startTime), err)
+
+	return err
+}
+
+func (s *Server) logCall(method string, duration time.Duration, err error) {
+	code := status.Code(err)
+	callLog := s.logger.With("method", method).With("code", code.String())
+	if isServerError(code) {
+		callLog.Errorf("call failed with duration %f seconds: %v", duration.Seconds(), err)
+		return
+	}
+
+	callLog.Infof("call finished with duration %f seconds", duration.Seconds())
+}
@@ -0,0 +1,115 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	pb "github.com/TinyMarcus/avito-tech-task/api/proto/segmentation/v1"
+	"github.com/TinyMarcus/avito-tech-task/internal/handlers/dto"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+func (s *Server) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.CreateUserResponse, error) {
+	if req.GetExternalId() != "" && !models.IsValidExternalId(req.GetExternalId()) {
+		return nil, invalidArgument("Некорректный внешний идентификатор пользователя")
+	}
+
+	var attributes models.Attributes
+	if req.GetAttributes() != nil {
+		attributes = req.GetAttributes().AsMap()
+	}
+
+	id, err := s.users.CreateUser(req.GetName(), req.GetExternalId(), attributes)
+	if err != nil {
+		return nil, statusError(err, "Возникла внутренняя ошибка при создании пользователя")
+	}
+
+	return &pb.CreateUserResponse{Id: int64(id)}, nil
+}
+
+func (s *Server) ChangeSegmentsOfUser(ctx context.Context, req *pb.ChangeSegmentsOfUserRequest) (*pb.SegmentChanges, error) {
+	add := make([]*models.UserSegment, 0, len(req.GetAddToUser()))
+	for _, segment := range req.GetAddToUser() {
+		add = append(add, &models.UserSegment{
+			Slug:         segment.GetSlug(),
+			DeadlineDate: sql.NullString{String: segment.GetDeadlineDate(), Valid: segment.GetDeadlineDate() != ""},
+		})
+	}
+
+	changes, err := s.users.ChangeSegmentsOfUser(req.GetUserId(), add, req.GetTakeFromUser(), req.GetDryRun())
+	if err != nil {
+		return nil, statusError(err, "Возникла внутренняя ошибка при изменении сегментов пользователя")
+	}
+
+	result := &pb.SegmentChanges{
+		UserId:      int64(changes.UserId),
+		DryRun:      req.GetDryRun(),
+		Added:       changes.Added,
+		Removed:     changes.Removed,
+		Updated:     changes.Updated,
+		Reactivated: changes.Reactivated,
+		Ignored:     changes.Ignored,
+	}
+	for _, segmentError := range changes.Errors {
+		// сообщение берется из статуса, в который переводится ошибка, чтобы оно совпадало с ответом без dry_run
+		result.Errors = append(result.Errors, &pb.SegmentError{
+			Slug:  segmentError.Slug,
+			Error: statusMessage(statusError(segmentError.Err, "Возникла внутренняя ошибка при изменении сегментов пользователя")),
+		})
+	}
+
+	return result, nil
+}
+
+func (s *Server) GetActiveSegments(ctx context.Context, req *pb.GetActiveSegmentsRequest) (*pb.ActiveSegments, error) {
+	userId, err := s.users.ResolveUserId(req.GetUserId())
+	if err != nil {
+		return nil, statusError(err, "Возникла внутренняя ошибка при запросе пользователя")
+	}
+
+	segments, err := s.users.GetActiveSegmentsOfUser(userId)
+	if err != nil {
+		return nil, statusError(err, "Возникла внутренняя ошибка при запросе активных сегментов пользователя")
+	}
+
+	return activeSegmentsToProto(segments), nil
+}
+
+func (s *Server) BatchGetActiveSegments(ctx context.Context, req *pb.BatchGetActiveSegmentsRequest) (*pb.BatchGetActiveSegmentsResponse, error) {
+	if len(req.GetUserIds()) > s.readLimit {
+		return nil, invalidArgument(fmt.Sprintf("В запросе может быть не больше %d пользователей", s.readLimit))
+	}
+
+	users, unknown, err := s.users.GetActiveSegmentsOfUsers(req.GetUserIds())
+	if err != nil {
+		return nil, statusError(err, "Возникла внутренняя ошибка при запросе активных сегментов пользователей")
+	}
+
+	response := &pb.BatchGetActiveSegmentsResponse{
+		Users:          make([]*pb.ActiveSegments, 0, len(users)),
+		UnknownUserIds: unknown,
+	}
+	for _, segments := range users {
+		response.Users = append(response.Users, activeSegmentsToProto(segments))
+	}
+
+	return response, nil
+}
+
+func activeSegmentsToProto(segments *dto.UsersActiveSegments) *pb.ActiveSegments {
+	result := &pb.ActiveSegments{
+		UserId:     int64(segments.UserId),
+		ExternalId: segments.ExternalId,
+		Segments:   make([]*pb.SegmentWithDeadline, 0, len(segments.Segments)),
+	}
+	for _, segment := range segments.Segments {
+		result.Segments = append(result.Segments, &pb.SegmentWithDeadline{
+			Slug:         segment.Slug,
+			DeadlineDate: segment.DeadlineDate,
+			Source:       segment.Source,
+		})
+	}
+
+	return result
+}
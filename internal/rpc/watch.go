@@ -0,0 +1,100 @@
+package rpc
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/TinyMarcus/avito-tech-task/api/proto/segmentation/v1"
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+	"github.com/TinyMarcus/avito-tech-task/internal/stream"
+)
+
+const watchBatch = 500
+
+// WatchSegmentsOfUser отправляет изменения участия пользователя в сегментах так же, как SSE-поток REST API:
+// события читаются из outbox по уведомлению или раз в STREAM_HEARTBEAT, а позиция последнего полученного
+// события в поле after позволяет продолжить поток после переподключения
+func (s *Server) WatchSegmentsOfUser(req *pb.WatchSegmentsOfUserRequest, srv pb.SegmentationService_WatchSegmentsOfUserServer) error {
+	userId, err := s.users.ResolveUserId(req.GetUserId())
+	if err != nil {
+		return statusError(err, "Возникла внутренняя ошибка при запросе пользователя")
+	}
+
+	var after *models.EventPosition
+	if req.GetAfter() != "" {
+		after, err = stream.DecodePosition(req.GetAfter())
+		if err != nil {
+			return invalidArgument("Некорректная позиция в потоке событий")
+		}
+	}
+
+	// подписка оформляется до чтения начальной позиции, чтобы не пропустить события между ними
+	wake, unsubscribe := s.subscriber.Subscribe(userId)
+	defer unsubscribe()
+
+	if after == nil {
+		after, err = s.events.GetStreamStart()
+		if err != nil {
+			return statusError(err, "Возникла внутренняя ошибка при открытии потока событий")
+		}
+	}
+
+	poll := time.NewTicker(s.poll)
+	defer poll.Stop()
+
+	for {
+		if after, err = s.sendEvents(srv, userId, after); err != nil {
+			return err
+		}
+
+		select {
+		case <-srv.Context().Done():
+			return nil
+		case <-wake:
+		case <-poll.C:
+		}
+	}
+}
+
+// sendEvents отправляет все события пользователя после after и возвращает позицию последнего
+func (s *Server) sendEvents(srv pb.SegmentationService_WatchSegmentsOfUserServer, userId int,
+	after *models.EventPosition) (*models.EventPosition, error) {
+	for {
+		events, err := s.events.GetUserEvents(userId, after, watchBatch)
+		if err != nil {
+			return after, statusError(err, "Возникла внутренняя ошибка при чтении событий")
+		}
+
+		for _, event := range events {
+			position := &models.EventPosition{TransactionId: event.TransactionId, EventId: event.Id}
+			if err = srv.Send(eventToProto(event, position)); err != nil {
+				return after, err
+			}
+			after = position
+		}
+
+		if len(events) < watchBatch {
+			return after, nil
+		}
+	}
+}
+
+func eventToProto(event *models.OutboxEvent, position *models.EventPosition) *pb.MembershipEvent {
+	result := &pb.MembershipEvent{
+		Id:         event.Id,
+		Type:       event.Type,
+		OccurredAt: timestamppb.New(event.OccurredAt),
+		UserId:     int64(event.UserId),
+		ExternalId: event.ExternalId.String,
+		Slug:       event.Slug,
+		Actor:      event.Actor.String,
+		Position:   stream.EncodePosition(position),
+	}
+
+	if event.DeadlineDate.Valid {
+		result.DeadlineDate = timestamppb.New(event.DeadlineDate.Time)
+	}
+
+	return result
+}
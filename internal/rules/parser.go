@@ -0,0 +1,311 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenComma
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+	pos   int
+}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{kind: tokenLBracket, text: "[", pos: i})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{kind: tokenRBracket, text: "]", pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: i})
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			var sb strings.Builder
+			for end < len(runes) && runes[end] != c {
+				if runes[end] == '\\' && end+1 < len(runes) {
+					end++
+				}
+				sb.WriteRune(runes[end])
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: string(runes[i : end+1]), value: sb.String(), pos: i})
+			i = end + 1
+		case strings.ContainsRune("=!<>&|", c):
+			end := i + 1
+			if end < len(runes) && strings.ContainsRune("=&|", runes[end]) {
+				end++
+			}
+			op := string(runes[i:end])
+			switch op {
+			case "==", "!=", "<", "<=", ">", ">=":
+			case "&&":
+				op = "and"
+			case "||":
+				op = "or"
+			case "!":
+				op = "not"
+			default:
+				return nil, fmt.Errorf("unknown operator %q at position %d", op, i)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+			i = end
+		case c == '-' || unicode.IsDigit(c):
+			end := i + 1
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.') {
+				end++
+			}
+			text := string(runes[i:end])
+			number, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", text, i)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text, value: number, pos: i})
+			i = end
+		case unicode.IsLetter(c) || c == '_':
+			end := i + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) ||
+				runes[end] == '_' || runes[end] == '.') {
+				end++
+			}
+			word := string(runes[i:end])
+			switch strings.ToLower(word) {
+			case "and", "or", "not", "in":
+				tokens = append(tokens, token{kind: tokenOperator, text: strings.ToLower(word), pos: i})
+			case "true", "false":
+				tokens = append(tokens, token{kind: tokenIdent, text: strings.ToLower(word), value: strings.ToLower(word) == "true", pos: i})
+			default:
+				tokens = append(tokens, token{kind: tokenIdent, text: word, pos: i})
+			}
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(runes)}), nil
+}
+
+// maxDepth ограничивает вложенность скобок и отрицаний, чтобы разбор и вычисление правила
+// не исчерпали стек на специально составленном выражении
+const maxDepth = 64
+
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isOperator(op string) bool {
+	t := p.peek()
+	return t.kind == tokenOperator && t.text == op
+}
+
+// descend увеличивает глубину вложенности; вызывающий уменьшает ее, выйдя из вложенного выражения
+func (p *parser) descend(pos int) error {
+	p.depth++
+	if p.depth > maxDepth {
+		return fmt.Errorf("rule is nested deeper than %d levels at position %d", maxDepth, pos)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "or", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "and", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.isOperator("not") {
+		if err := p.descend(p.next().pos); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenLParen:
+		if err := p.descend(t.pos); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, fmt.Errorf("expected ) at position %d", closing.pos)
+		}
+		return inner, nil
+	case tokenIdent:
+		if t.value != nil {
+			return nil, fmt.Errorf("expected attribute name at position %d, got %s", t.pos, t.text)
+		}
+		return p.parseComparison(t.text)
+	default:
+		return nil, fmt.Errorf("expected attribute name or ( at position %d", t.pos)
+	}
+}
+
+func (p *parser) parseComparison(attribute string) (node, error) {
+	t := p.next()
+	if t.kind != tokenOperator {
+		return nil, fmt.Errorf("expected operator after %s at position %d", attribute, t.pos)
+	}
+
+	switch t.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+		value, err := p.parseScalar()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := value.(bool); ok && t.text != "==" && t.text != "!=" {
+			return nil, fmt.Errorf("operator %s can not be applied to boolean at position %d", t.text, t.pos)
+		}
+		return &comparisonNode{attribute: attribute, op: t.text, value: value}, nil
+	case "in":
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return &inNode{attribute: attribute, values: values}, nil
+	case "not":
+		if in := p.next(); in.kind != tokenOperator || in.text != "in" {
+			return nil, fmt.Errorf("expected in after not at position %d", in.pos)
+		}
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: &inNode{attribute: attribute, values: values}}, nil
+	default:
+		return nil, fmt.Errorf("unexpected operator %s at position %d", t.text, t.pos)
+	}
+}
+
+func (p *parser) parseScalar() (interface{}, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokenString || t.kind == tokenNumber:
+		return t.value, nil
+	case t.kind == tokenIdent && t.value != nil:
+		return t.value, nil
+	default:
+		return nil, fmt.Errorf("expected string, number or boolean at position %d", t.pos)
+	}
+}
+
+func (p *parser) parseList() ([]interface{}, error) {
+	if t := p.next(); t.kind != tokenLBracket {
+		return nil, fmt.Errorf("expected [ at position %d", t.pos)
+	}
+
+	var values []interface{}
+	for {
+		value, err := p.parseScalar()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		t := p.next()
+		if t.kind == tokenRBracket {
+			return values, nil
+		}
+		if t.kind != tokenComma {
+			return nil, fmt.Errorf("expected , or ] at position %d", t.pos)
+		}
+	}
+}
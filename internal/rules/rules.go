@@ -0,0 +1,268 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule — правило таргетинга сегмента по атрибутам пользователя,
+// например `city in ["Moscow", "SPb"] and platform == "android"`
+type Rule struct {
+	source string
+	root   node
+}
+
+// Explanation описывает, как было вычислено правило (или его часть) для конкретного пользователя
+type Explanation struct {
+	Expression string         `json:"expression"`         // Часть правила
+	Matched    bool           `json:"matched"`            // Результат вычисления
+	Actual     interface{}    `json:"actual,omitempty"`   // Значение атрибута пользователя
+	Reason     string         `json:"reason,omitempty"`   // Пояснение для несработавшего условия
+	Children   []*Explanation `json:"children,omitempty"` // Вложенные условия
+}
+
+type node interface {
+	explain(attributes map[string]interface{}) *Explanation
+	String() string
+}
+
+// Parse разбирает и проверяет правило
+func Parse(source string) (*Rule, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", t.text, t.pos)
+	}
+
+	return &Rule{source: source, root: root}, nil
+}
+
+func (r *Rule) String() string {
+	return r.source
+}
+
+func (r *Rule) Match(attributes map[string]interface{}) bool {
+	return r.root.explain(attributes).Matched
+}
+
+func (r *Rule) Explain(attributes map[string]interface{}) *Explanation {
+	return r.root.explain(attributes)
+}
+
+type logicalNode struct {
+	op    string
+	left  node
+	right node
+}
+
+func (n *logicalNode) explain(attributes map[string]interface{}) *Explanation {
+	left := n.left.explain(attributes)
+	right := n.right.explain(attributes)
+
+	matched := left.Matched && right.Matched
+	if n.op == "or" {
+		matched = left.Matched || right.Matched
+	}
+
+	return &Explanation{
+		Expression: n.String(),
+		Matched:    matched,
+		Children:   []*Explanation{left, right},
+	}
+}
+
+func (n *logicalNode) String() string {
+	return fmt.Sprintf("(%s %s %s)", n.left, n.op, n.right)
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n *notNode) explain(attributes map[string]interface{}) *Explanation {
+	operand := n.operand.explain(attributes)
+
+	return &Explanation{
+		Expression: n.String(),
+		Matched:    !operand.Matched,
+		Children:   []*Explanation{operand},
+	}
+}
+
+func (n *notNode) String() string {
+	if _, ok := n.operand.(*logicalNode); ok {
+		return fmt.Sprintf("not %s", n.operand)
+	}
+	return fmt.Sprintf("not (%s)", n.operand)
+}
+
+type comparisonNode struct {
+	attribute string
+	op        string
+	value     interface{}
+}
+
+func (n *comparisonNode) explain(attributes map[string]interface{}) *Explanation {
+	explanation := &Explanation{Expression: n.String()}
+
+	actual, ok := attributes[n.attribute]
+	if !ok || actual == nil {
+		explanation.Reason = "attribute is not set"
+		return explanation
+	}
+	explanation.Actual = actual
+
+	cmp, ok := compare(actual, n.value)
+	if !ok {
+		explanation.Matched = n.op == "!="
+		if !explanation.Matched {
+			explanation.Reason = "attribute type does not match the value"
+		}
+		return explanation
+	}
+
+	switch n.op {
+	case "==":
+		explanation.Matched = cmp == 0
+	case "!=":
+		explanation.Matched = cmp != 0
+	case "<":
+		explanation.Matched = cmp < 0
+	case "<=":
+		explanation.Matched = cmp <= 0
+	case ">":
+		explanation.Matched = cmp > 0
+	case ">=":
+		explanation.Matched = cmp >= 0
+	}
+
+	return explanation
+}
+
+func (n *comparisonNode) String() string {
+	return fmt.Sprintf("%s %s %s", n.attribute, n.op, formatValue(n.value))
+}
+
+type inNode struct {
+	attribute string
+	values    []interface{}
+}
+
+func (n *inNode) explain(attributes map[string]interface{}) *Explanation {
+	explanation := &Explanation{Expression: n.String()}
+
+	actual, ok := attributes[n.attribute]
+	if !ok || actual == nil {
+		explanation.Reason = "attribute is not set"
+		return explanation
+	}
+	explanation.Actual = actual
+
+	for _, value := range n.values {
+		if cmp, ok := compare(actual, value); ok && cmp == 0 {
+			explanation.Matched = true
+			return explanation
+		}
+	}
+
+	explanation.Reason = "attribute value is not in the list"
+	return explanation
+}
+
+func (n *inNode) String() string {
+	values := make([]string, 0, len(n.values))
+	for _, value := range n.values {
+		values = append(values, formatValue(value))
+	}
+
+	return fmt.Sprintf("%s in [%s]", n.attribute, strings.Join(values, ", "))
+}
+
+// compare сравнивает значение атрибута со значением из правила. Строки, которые в обоих случаях
+// являются датами, сравниваются как даты. Второе возвращаемое значение равно false, если типы несовместимы.
+func compare(actual, expected interface{}) (int, bool) {
+	switch expectedValue := expected.(type) {
+	case float64:
+		actualValue, ok := toNumber(actual)
+		if !ok {
+			return 0, false
+		}
+		return compareOrdered(actualValue, expectedValue), true
+	case bool:
+		actualValue, ok := actual.(bool)
+		if !ok {
+			return 0, false
+		}
+		if actualValue == expectedValue {
+			return 0, true
+		}
+		return 1, true
+	case string:
+		actualValue, ok := actual.(string)
+		if !ok {
+			return 0, false
+		}
+		actualTime, actualIsTime := parseTime(actualValue)
+		expectedTime, expectedIsTime := parseTime(expectedValue)
+		if actualIsTime && expectedIsTime {
+			return actualTime.Compare(expectedTime), true
+		}
+		return strings.Compare(actualValue, expectedValue), true
+	}
+
+	return 0, false
+}
+
+func compareOrdered(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case json.Number:
+		number, err := v.Float64()
+		return number, err == nil
+	}
+	return 0, false
+}
+
+func parseTime(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
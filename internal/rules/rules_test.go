@@ -0,0 +1,175 @@
+package rules
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		want    string
+		wantErr string
+	}{
+		{name: "comparison", source: `platform == "android"`, want: `platform == "android"`},
+		{name: "symbolic operators", source: `a == 1 && !(b != 2) || c < 3`, want: `((a == 1 and not (b != 2)) or c < 3)`},
+		{name: "precedence", source: `a == 1 or b == 2 and c == 3`, want: `(a == 1 or (b == 2 and c == 3))`},
+		{name: "in list", source: `city in ["Moscow", 'SPb']`, want: `city in ["Moscow", "SPb"]`},
+		{name: "not in list", source: `city not in ["Moscow"]`, want: `not (city in ["Moscow"])`},
+		{name: "boolean", source: `premium == TRUE`, want: `premium == true`},
+		{name: "negative number", source: `balance >= -10.5`, want: `balance >= -10.5`},
+		{name: "escaped quote", source: `name == "a\"b"`, want: `name == "a\"b"`},
+		{name: "non-ASCII attribute", source: `город == "Москва"`, want: `город == "Москва"`},
+		{name: "empty", source: ``, wantErr: "expected attribute name or ( at position 0"},
+		{name: "unterminated string", source: `city == "Moscow`, wantErr: "unterminated string at position 8"},
+		{name: "unknown operator", source: `a = 1`, wantErr: `unknown operator "=" at position 2`},
+		{name: "non-ASCII character position", source: `город == 1 §`, wantErr: `unexpected character '§' at position 11`},
+		{name: "invalid number", source: `a == 1.2.3`, wantErr: `invalid number "1.2.3" at position 5`},
+		{name: "missing value", source: `a ==`, wantErr: "expected string, number or boolean at position 4"},
+		{name: "ordering of boolean", source: `a < true`, wantErr: "operator < can not be applied to boolean"},
+		{name: "unclosed paren", source: `(a == 1`, wantErr: "expected ) at position 7"},
+		{name: "trailing token", source: `a == 1 b`, wantErr: "unexpected b at position 7"},
+		{name: "bad list", source: `a in [1 2]`, wantErr: "expected , or ] at position 8"},
+		{name: "boolean as attribute", source: `true == 1`, wantErr: "expected attribute name at position 0, got true"},
+		{name: "max depth", source: strings.Repeat("(", maxDepth) + "a == 1" + strings.Repeat(")", maxDepth), want: "a == 1"},
+		{name: "too deep parens", source: strings.Repeat("(", maxDepth+1) + "a == 1" + strings.Repeat(")", maxDepth+1),
+			wantErr: "rule is nested deeper than 64 levels at position 64"},
+		{name: "too deep negations", source: strings.Repeat("not ", maxDepth+1) + "a == 1",
+			wantErr: "rule is nested deeper than 64 levels at position 256"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.source)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse(%q) error = %v, want %q", tt.source, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.source, err)
+			}
+			if got := rule.root.String(); got != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	attributes := map[string]interface{}{
+		"city":       "Moscow",
+		"platform":   "android",
+		"age":        json.Number("30"),
+		"balance":    float64(-5),
+		"premium":    true,
+		"registered": "2023-05-10",
+		"город":      "Москва",
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		want   bool
+	}{
+		{name: "string equal", source: `city == "Moscow"`, want: true},
+		{name: "string not equal", source: `city != "Moscow"`, want: false},
+		{name: "json number", source: `age > 18`, want: true},
+		{name: "float", source: `balance < 0`, want: true},
+		{name: "boolean", source: `premium == false`, want: false},
+		{name: "date comparison", source: `registered >= "2023-01-01"`, want: true},
+		{name: "date against RFC3339", source: `registered < "2023-05-10T00:00:01Z"`, want: true},
+		{name: "in list", source: `city in ["SPb", "Moscow"]`, want: true},
+		{name: "not in list", source: `platform not in ["ios", "web"]`, want: true},
+		{name: "and", source: `city == "Moscow" and platform == "ios"`, want: false},
+		{name: "or", source: `city == "SPb" or platform == "android"`, want: true},
+		{name: "not", source: `not (city == "SPb")`, want: true},
+		{name: "missing attribute", source: `country == "RU"`, want: false},
+		{name: "missing attribute with not equal", source: `country != "RU"`, want: false},
+		{name: "type mismatch with not equal", source: `city != 1`, want: true},
+		{name: "type mismatch", source: `city == 1`, want: false},
+		{name: "non-ASCII attribute", source: `город == "Москва"`, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.source)
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.source, err)
+			}
+			if got := rule.Match(attributes); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExplain(t *testing.T) {
+	attributes := map[string]interface{}{"city": "Moscow", "age": float64(16)}
+
+	tests := []struct {
+		name   string
+		source string
+		want   *Explanation
+	}{
+		{
+			name:   "matched comparison",
+			source: `city == "Moscow"`,
+			want:   &Explanation{Expression: `city == "Moscow"`, Matched: true, Actual: "Moscow"},
+		},
+		{
+			name:   "missing attribute",
+			source: `platform == "ios"`,
+			want:   &Explanation{Expression: `platform == "ios"`, Reason: "attribute is not set"},
+		},
+		{
+			name:   "type mismatch",
+			source: `city > 1`,
+			want:   &Explanation{Expression: `city > 1`, Actual: "Moscow", Reason: "attribute type does not match the value"},
+		},
+		{
+			name:   "value not in list",
+			source: `city in ["SPb"]`,
+			want:   &Explanation{Expression: `city in ["SPb"]`, Actual: "Moscow", Reason: "attribute value is not in the list"},
+		},
+		{
+			name:   "logical with children",
+			source: `city == "Moscow" and age >= 18`,
+			want: &Explanation{Expression: `(city == "Moscow" and age >= 18)`, Children: []*Explanation{
+				{Expression: `city == "Moscow"`, Matched: true, Actual: "Moscow"},
+				{Expression: `age >= 18`, Actual: float64(16)},
+			}},
+		},
+		{
+			name:   "negation",
+			source: `!(age >= 18)`,
+			want: &Explanation{Expression: `not (age >= 18)`, Matched: true, Children: []*Explanation{
+				{Expression: `age >= 18`, Actual: float64(16)},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.source)
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.source, err)
+			}
+
+			got, err := json.Marshal(rule.Explain(attributes))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := json.Marshal(tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("Explain(%q) = %s, want %s", tt.source, got, want)
+			}
+		})
+	}
+}
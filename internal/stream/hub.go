@@ -0,0 +1,137 @@
+package stream
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// Channel — канал уведомлений Postgres, в который триггер на outbox_events после фиксации транзакции
+// отправляет идентификаторы пользователей с новыми событиями через запятую или * для всех пользователей
+const Channel = "outbox_events"
+
+const (
+	minReconnectInterval = time.Second
+	maxReconnectInterval = time.Minute
+	pingInterval         = time.Minute
+)
+
+// Hub держит одно соединение с LISTEN на канал Channel и будит подписчиков, у пользователей которых появились
+// новые события. Сами события подписчики читают из outbox, поэтому поток может обслуживать любая реплика
+// сервиса, а уведомление только сообщает, что читать пора.
+type Hub struct {
+	dsn         string
+	mu          sync.Mutex
+	subscribers map[int]map[chan struct{}]struct{}
+	logger      *zap.SugaredLogger
+}
+
+func NewHub(dsn string, logger *zap.SugaredLogger) *Hub {
+	return &Hub{
+		dsn:         dsn,
+		subscribers: make(map[int]map[chan struct{}]struct{}),
+		logger:      logger.With(zap.String("comp", "stream hub")),
+	}
+}
+
+// Subscribe возвращает канал, в который приходит сигнал при появлении событий пользователя, и функцию отписки.
+// Сигналы не копятся: несколько уведомлений подряд могут слиться в один.
+func (h *Hub) Subscribe(userId int) (<-chan struct{}, func()) {
+	wake := make(chan struct{}, 1)
+
+	h.mu.Lock()
+	if h.subscribers[userId] == nil {
+		h.subscribers[userId] = make(map[chan struct{}]struct{})
+	}
+	h.subscribers[userId][wake] = struct{}{}
+	h.mu.Unlock()
+
+	return wake, func() {
+		h.mu.Lock()
+		delete(h.subscribers[userId], wake)
+		if len(h.subscribers[userId]) == 0 {
+			delete(h.subscribers, userId)
+		}
+		h.mu.Unlock()
+	}
+}
+
+func (h *Hub) Run(ctx context.Context) {
+	listener := pq.NewListener(h.dsn, minReconnectInterval, maxReconnectInterval,
+		func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				h.logger.Errorf("Error in notification listener: %v", err)
+			}
+		})
+	defer listener.Close()
+
+	if err := listener.Listen(Channel); err != nil {
+		h.logger.Errorf("Error while listening to channel %s: %v", Channel, err)
+	}
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-listener.Notify:
+			// nil приходит после переподключения: уведомления за время разрыва потеряны, поэтому будятся все
+			if notification == nil {
+				h.wakeAll()
+				continue
+			}
+			h.dispatch(notification.Extra)
+		case <-ticker.C:
+			go func() {
+				if err := listener.Ping(); err != nil {
+					h.logger.Errorf("Error while pinging notification listener: %v", err)
+				}
+			}()
+		}
+	}
+}
+
+func (h *Hub) dispatch(payload string) {
+	if payload == "*" {
+		h.wakeAll()
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, value := range strings.Split(payload, ",") {
+		userId, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		for wake := range h.subscribers[userId] {
+			notify(wake)
+		}
+	}
+}
+
+func (h *Hub) wakeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, subscribers := range h.subscribers {
+		for wake := range subscribers {
+			notify(wake)
+		}
+	}
+}
+
+func notify(wake chan struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
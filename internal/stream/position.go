@@ -0,0 +1,40 @@
+package stream
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+var ErrInvalidPosition = errors.New("invalid stream position")
+
+// EncodePosition возвращает позицию в потоке событий в виде, скрытом от клиента, как и курсор страницы
+func EncodePosition(position *models.EventPosition) string {
+	value := strconv.FormatUint(position.TransactionId, 10) + ":" + strconv.FormatInt(position.EventId, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+func DecodePosition(id string) (*models.EventPosition, error) {
+	value, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return nil, ErrInvalidPosition
+	}
+
+	transactionId, eventId, found := strings.Cut(string(value), ":")
+	if !found {
+		return nil, ErrInvalidPosition
+	}
+
+	position := new(models.EventPosition)
+	if position.TransactionId, err = strconv.ParseUint(transactionId, 10, 64); err != nil {
+		return nil, ErrInvalidPosition
+	}
+	if position.EventId, err = strconv.ParseInt(eventId, 10, 64); err != nil || position.EventId < 0 {
+		return nil, ErrInvalidPosition
+	}
+
+	return position, nil
+}
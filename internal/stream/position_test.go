@@ -0,0 +1,60 @@
+package stream
+
+import (
+	"encoding/base64"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+func TestDecodePosition(t *testing.T) {
+	encode := func(value string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+
+	tests := []struct {
+		name    string
+		id      string
+		want    models.EventPosition
+		wantErr bool
+	}{
+		{name: "position", id: encode("1234:56"), want: models.EventPosition{TransactionId: 1234, EventId: 56}},
+		{name: "zero position", id: encode("0:0"), want: models.EventPosition{}},
+		{name: "largest transaction", id: encode("18446744073709551615:1"),
+			want: models.EventPosition{TransactionId: math.MaxUint64, EventId: 1}},
+		{name: "empty", id: "", wantErr: true},
+		{name: "not base64", id: "!!!", wantErr: true},
+		{name: "padded base64", id: base64.URLEncoding.EncodeToString([]byte("12:3")), wantErr: true},
+		{name: "plain event id", id: encode("56"), wantErr: true},
+		{name: "missing transaction", id: encode(":56"), wantErr: true},
+		{name: "missing event", id: encode("1234:"), wantErr: true},
+		{name: "negative transaction", id: encode("-1:56"), wantErr: true},
+		{name: "negative event", id: encode("1234:-56"), wantErr: true},
+		{name: "transaction overflow", id: encode("18446744073709551616:1"), wantErr: true},
+		{name: "extra part", id: encode("1:2:3"), wantErr: true},
+		{name: "not a number", id: encode("a:b"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodePosition(tt.id)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidPosition) {
+					t.Fatalf("DecodePosition(%q) error = %v, want %v", tt.id, err, ErrInvalidPosition)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodePosition(%q) unexpected error: %v", tt.id, err)
+			}
+			if *got != tt.want {
+				t.Errorf("DecodePosition(%q) = %+v, want %+v", tt.id, *got, tt.want)
+			}
+			if encoded := EncodePosition(got); encoded != tt.id {
+				t.Errorf("EncodePosition(%+v) = %s, want %s", *got, encoded, tt.id)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+const (
+	fanOutBatch   = 500
+	purgeInterval = time.Hour
+	// в сообщение об ошибке сохраняется начало ответа получателя
+	maxErrorBody = 512
+)
+
+type WebhookConfig struct {
+	Interval       time.Duration `envconfig:"INTERVAL" default:"2s"`
+	Timeout        time.Duration `envconfig:"TIMEOUT" default:"10s"`
+	Workers        int           `envconfig:"WORKERS" default:"8"`
+	MaxAttempts    int           `envconfig:"MAX_ATTEMPTS" default:"8"`
+	InitialBackoff time.Duration `envconfig:"INITIAL_BACKOFF" default:"30s"`
+	MaxBackoff     time.Duration `envconfig:"MAX_BACKOFF" default:"1h"`
+	ExpiryLookback time.Duration `envconfig:"EXPIRY_LOOKBACK" default:"24h"`
+	Retention      time.Duration `envconfig:"RETENTION" default:"168h"`
+}
+
+func (c WebhookConfig) Validate() error {
+	switch {
+	case c.Interval <= 0 || c.Timeout <= 0:
+		return errors.New("webhook interval and timeout must be positive")
+	case c.Workers < 1 || c.MaxAttempts < 1:
+		return errors.New("webhook workers and max attempts must be at least 1")
+	case c.InitialBackoff <= 0 || c.MaxBackoff < c.InitialBackoff:
+		return fmt.Errorf("webhook backoff must be positive and not exceed max backoff %s", c.MaxBackoff)
+	case c.ExpiryLookback <= 0 || c.Retention <= 0:
+		return errors.New("webhook expiry lookback and retention must be positive")
+	}
+
+	return nil
+}
+
+type Repository interface {
+	EmitExpiryEvents(now, since time.Time) (int, error)
+	FanOutEvents(now time.Time, limit int) (int, error)
+	ClaimWebhookDeliveries(now, leaseUntil time.Time, limit int) ([]*models.WebhookDeliveryTask, error)
+	CompleteWebhookDelivery(id int64, statusCode int) error
+	RetryWebhookDelivery(id int64, nextAttemptAt time.Time, statusCode int, message string) error
+	DeadLetterWebhookDelivery(id int64, statusCode int, message string) error
+	PurgeOutbox(before time.Time) (int, error)
+}
+
+// Dispatcher рассылает события из outbox подпискам. На каждом тике он записывает события о наступивших
+// датах отключения, создает доставки новых событий подходящим подпискам и отправляет наступившие доставки.
+// Неудачная доставка повторяется с экспоненциально растущей задержкой, после MaxAttempts попыток
+// она переносится в недоставленные. Порядок доставки событий не гарантируется: получатель может
+// упорядочить их по идентификатору события.
+type Dispatcher struct {
+	repository Repository
+	client     *http.Client
+	cfg        WebhookConfig
+	wake       chan struct{}
+	lastPurge  time.Time
+	logger     *zap.SugaredLogger
+}
+
+func NewDispatcher(r Repository, cfg WebhookConfig, logger *zap.SugaredLogger) *Dispatcher {
+	return &Dispatcher{
+		repository: r,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// перенаправление не считается доставкой: POST по нему превратился бы в GET без тела
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		cfg:    cfg,
+		wake:   make(chan struct{}, 1),
+		logger: logger.With(zap.String("comp", "webhook dispatcher")),
+	}
+}
+
+// Notify будит диспетчер, чтобы доставка, возвращенная в очередь, не ждала следующего тика
+func (d *Dispatcher) Notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		d.Tick(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) Tick(ctx context.Context, now time.Time) {
+	expired, err := d.repository.EmitExpiryEvents(now, now.Add(-d.cfg.ExpiryLookback))
+	if err != nil {
+		d.logger.Errorf("Error while emitting expiry events: %v", err)
+	} else if expired > 0 {
+		d.logger.Infof("Emitted %d expiry events", expired)
+	}
+
+	for ctx.Err() == nil {
+		events, err := d.repository.FanOutEvents(now, fanOutBatch)
+		if err != nil {
+			d.logger.Errorf("Error while fanning out outbox events: %v", err)
+			break
+		}
+		if events < fanOutBatch {
+			break
+		}
+	}
+
+	d.deliver(ctx)
+
+	if now.Sub(d.lastPurge) >= purgeInterval {
+		d.lastPurge = now
+		purged, err := d.repository.PurgeOutbox(now.Add(-d.cfg.Retention))
+		if err != nil {
+			d.logger.Errorf("Error while purging outbox: %v", err)
+		} else if purged > 0 {
+			d.logger.Infof("Purged %d outbox events", purged)
+		}
+	}
+}
+
+// deliver отправляет наступившие доставки пачками по числу обработчиков, пока они есть. Доставка берется
+// в работу на удвоенный таймаут запроса: за это время результат точно будет сохранен или обработчик упал.
+func (d *Dispatcher) deliver(ctx context.Context) {
+	for ctx.Err() == nil {
+		now := time.Now()
+		tasks, err := d.repository.ClaimWebhookDeliveries(now, now.Add(2*d.cfg.Timeout), d.cfg.Workers)
+		if err != nil {
+			d.logger.Errorf("Error while claiming webhook deliveries: %v", err)
+			return
+		}
+		if len(tasks) == 0 {
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, task := range tasks {
+			wg.Add(1)
+			go func(task *models.WebhookDeliveryTask) {
+				defer wg.Done()
+				d.process(ctx, task)
+			}(task)
+		}
+		wg.Wait()
+	}
+}
+
+func (d *Dispatcher) process(ctx context.Context, task *models.WebhookDeliveryTask) {
+	delivery := task.Delivery
+	statusCode, err := d.send(ctx, task)
+	// при остановке сервиса попытка не засчитывается: доставку повторят после окончания аренды
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err == nil {
+		if err = d.repository.CompleteWebhookDelivery(delivery.Id, statusCode); err != nil {
+			d.logger.Errorf("Error while saving webhook delivery %d: %v", delivery.Id, err)
+		}
+		return
+	}
+
+	attempts := delivery.Attempts + 1
+	if attempts >= d.cfg.MaxAttempts {
+		d.logger.Warnf("Webhook delivery %d to webhook %d is dead after %d attempts: %v", delivery.Id, task.Webhook.Id,
+			attempts, err)
+		err = d.repository.DeadLetterWebhookDelivery(delivery.Id, statusCode, err.Error())
+	} else {
+		err = d.repository.RetryWebhookDelivery(delivery.Id, time.Now().Add(d.Backoff(attempts)), statusCode, err.Error())
+	}
+	if err != nil {
+		d.logger.Errorf("Error while saving webhook delivery %d: %v", delivery.Id, err)
+	}
+}
+
+// send отправляет событие и возвращает код ответа; ответ вне 2xx считается ошибкой
+func (d *Dispatcher) send(ctx context.Context, task *models.WebhookDeliveryTask) (int, error) {
+	body, err := json.Marshal(NewPayload(task.Delivery.Event))
+	if err != nil {
+		return 0, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, task.Webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(HeaderEventId, strconv.FormatInt(task.Delivery.Event.Id, 10))
+	request.Header.Set(HeaderEventType, task.Delivery.Event.Type)
+	request.Header.Set(HeaderDelivery, strconv.FormatInt(task.Delivery.Id, 10))
+	request.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+	request.Header.Set(HeaderSignature, Sign(task.Webhook.Secret, timestamp, body))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBody))
+		return response.StatusCode, fmt.Errorf("unexpected status %d: %s", response.StatusCode,
+			strings.TrimSpace(string(snippet)))
+	}
+	_, _ = io.Copy(io.Discard, response.Body)
+
+	return response.StatusCode, nil
+}
+
+// Backoff возвращает задержку перед попыткой, следующей за attempts неудачными: InitialBackoff, удваивающийся
+// с каждой попыткой, но не больше MaxBackoff, со случайной добавкой до 20%, чтобы повторы многих доставок
+// одному получателю не приходили одновременно
+func (d *Dispatcher) Backoff(attempts int) time.Duration {
+	delay := d.cfg.InitialBackoff
+	for i := 1; i < attempts && delay < d.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.cfg.MaxBackoff {
+		delay = d.cfg.MaxBackoff
+	}
+
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/TinyMarcus/avito-tech-task/internal/models"
+)
+
+// Заголовки запроса с событием. Подпись — HMAC-SHA256 от строки "{timestamp}.{тело запроса}" на секрете
+// подписки в шестнадцатеричном виде с префиксом sha256=. Временная метка входит в подпись, чтобы получатель
+// мог отвергать повторно отправленные старые запросы.
+const (
+	HeaderEventId   = "X-Webhook-Event-Id"
+	HeaderEventType = "X-Webhook-Event-Type"
+	HeaderDelivery  = "X-Webhook-Delivery-Id"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Payload — тело запроса с событием
+type Payload struct {
+	Id         int64     `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       Data      `json:"data"`
+}
+
+type Data struct {
+	UserId       int        `json:"user_id"`
+	ExternalId   string     `json:"external_id,omitempty"`
+	Slug         string     `json:"slug"`
+	DeadlineDate *time.Time `json:"deadline_date,omitempty"`
+	Actor        string     `json:"actor,omitempty"`
+}
+
+func NewPayload(event *models.OutboxEvent) *Payload {
+	payload := &Payload{
+		Id:         event.Id,
+		Type:       event.Type,
+		OccurredAt: event.OccurredAt,
+		Data: Data{
+			UserId:     event.UserId,
+			ExternalId: event.ExternalId.String,
+			Slug:       event.Slug,
+			Actor:      event.Actor.String,
+		},
+	}
+
+	if event.DeadlineDate.Valid {
+		payload.Data.DeadlineDate = &event.DeadlineDate.Time
+	}
+
+	return payload
+}
+
+// Sign возвращает значение заголовка X-Webhook-Signature для тела body, отправленного в момент timestamp
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return fmt.Sprintf("sha256=%s", hex.EncodeToString(mac.Sum(nil)))
+}
@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestSign(t *testing.T) {
+	timestamp := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp time.Time
+		body      string
+		want      string
+	}{
+		{
+			name:      "payload",
+			secret:    "secret",
+			timestamp: timestamp,
+			body:      `{"id":1}`,
+			want:      "sha256=3dd1b9aef568d75f6790a84bd2e5dfa1f44409eef3cbdbd3f10b837376100c11",
+		},
+		{
+			name:      "other secret",
+			secret:    "other",
+			timestamp: timestamp,
+			body:      `{"id":1}`,
+			want:      "sha256=e0cb77fc6d5b2877ec062213c262d236b5dd5a833d29fdc5a058c5fbfa287b47",
+		},
+		{
+			name:      "empty body",
+			secret:    "secret",
+			timestamp: timestamp,
+			want:      "sha256=4bc5f74d868b97888288889c5d9d65df02526f94c1592a79fdf4fe8b26e311e5",
+		},
+		{
+			name:      "sub-second part is ignored",
+			secret:    "secret",
+			timestamp: timestamp.Add(999 * time.Millisecond),
+			body:      `{"id":1}`,
+			want:      "sha256=3dd1b9aef568d75f6790a84bd2e5dfa1f44409eef3cbdbd3f10b837376100c11",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("Sign() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(nil, WebhookConfig{InitialBackoff: 30 * time.Second, MaxBackoff: time.Hour}, zap.NewNop().Sugar())
+
+	tests := []struct {
+		name     string
+		attempts int
+		want     time.Duration
+	}{
+		{name: "first retry", attempts: 1, want: 30 * time.Second},
+		{name: "no attempts yet", attempts: 0, want: 30 * time.Second},
+		{name: "doubled", attempts: 2, want: time.Minute},
+		{name: "doubled twice", attempts: 3, want: 2 * time.Minute},
+		{name: "just below max", attempts: 7, want: 32 * time.Minute},
+		{name: "capped", attempts: 8, want: time.Hour},
+		{name: "many attempts", attempts: 1000, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// добавка случайна, поэтому проверяется диапазон по нескольким вычислениям
+			for i := 0; i < 100; i++ {
+				got := d.Backoff(tt.attempts)
+				if got < tt.want || got > tt.want+tt.want/5 {
+					t.Fatalf("Backoff(%d) = %s, want between %s and %s", tt.attempts, got, tt.want, tt.want+tt.want/5)
+				}
+			}
+		})
+	}
+}
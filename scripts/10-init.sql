@@ -5,28 +5,211 @@ WHERE NOT EXISTS (SELECT FROM pg_database WHERE datname = 'dynamic-user-segmenta
 
 CREATE TABLE IF NOT EXISTS users (
     id serial PRIMARY KEY,
-    name text
+    external_id text,
+    name text,
+    attributes jsonb NOT NULL DEFAULT '{}'
 );
 
+CREATE UNIQUE INDEX IF NOT EXISTS uq_users_external_id ON users (external_id);
+
 CREATE TABLE IF NOT EXISTS segments (
     id serial PRIMARY KEY,
     slug text UNIQUE,
-    description text
+    description text,
+    layer text,
+    percent numeric(5, 2),
+    rule text
 );
 
 CREATE TABLE IF NOT EXISTS users_segments (
     user_id serial,
     slug text,
     deadline_date timestamp with time zone,
+    auto_enrolled boolean NOT NULL DEFAULT false,
+    expiry_event_deadline timestamp with time zone,
+    CONSTRAINT uq_user_segment UNIQUE (user_id, slug),
     CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id),
     CONSTRAINT fk_segment FOREIGN KEY (slug) REFERENCES segments (slug)
 );
 
 CREATE TABLE IF NOT EXISTS history (
-    user_id serial NOT NULL,
+    id bigserial PRIMARY KEY,
+    user_id integer,
+    pseudonym text,
     slug text NOT NULL,
     action_date timestamp with time zone NOT NULL,
-    operation_type text NOT NULL CHECK (operation_type IN ('ADDING', 'REMOVING')),
+    operation_type text NOT NULL CHECK (operation_type IN ('ADDING', 'REMOVING', 'UPDATING')),
+    deadline_date timestamp with time zone,
+    actor text,
+    CONSTRAINT ck_history_subject CHECK (user_id IS NOT NULL OR pseudonym IS NOT NULL),
     CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id),
     CONSTRAINT fk_segment FOREIGN KEY (slug) REFERENCES segments (slug)
 );
+
+CREATE INDEX IF NOT EXISTS idx_history_user ON history (user_id, slug, action_date);
+CREATE INDEX IF NOT EXISTS idx_history_slug ON history (slug, user_id, action_date);
+CREATE INDEX IF NOT EXISTS idx_history_action_date ON history (action_date);
+CREATE INDEX IF NOT EXISTS idx_history_actor ON history (actor, id);
+CREATE INDEX IF NOT EXISTS idx_history_user_id ON history (user_id, id);
+CREATE INDEX IF NOT EXISTS idx_history_slug_id ON history (slug, id);
+
+CREATE TABLE IF NOT EXISTS rollouts (
+    slug text PRIMARY KEY,
+    paused boolean NOT NULL DEFAULT false,
+    current_step integer NOT NULL DEFAULT -1,
+    CONSTRAINT fk_segment FOREIGN KEY (slug) REFERENCES segments (slug) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS rollout_steps (
+    slug text NOT NULL,
+    step integer NOT NULL,
+    percent numeric(5, 2) NOT NULL CHECK (percent > 0 AND percent <= 100),
+    start_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (slug, step),
+    CONSTRAINT fk_rollout FOREIGN KEY (slug) REFERENCES rollouts (slug) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key text PRIMARY KEY,
+    fingerprint text NOT NULL,
+    status_code integer,
+    content_type text,
+    response_body bytea,
+    created_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys (created_at);
+
+CREATE TABLE IF NOT EXISTS user_erasures (
+    user_id integer PRIMARY KEY,
+    external_id_hash text,
+    erased_at timestamp with time zone NOT NULL,
+    history_mode text NOT NULL CHECK (history_mode IN ('delete', 'pseudonymize')),
+    memberships_ended integer NOT NULL,
+    history_rows integer NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_erasures_external_id_hash ON user_erasures (external_id_hash);
+
+CREATE TABLE IF NOT EXISTS report_jobs (
+    id uuid PRIMARY KEY,
+    status text NOT NULL CHECK (status IN ('pending', 'running', 'done', 'failed')),
+    format text NOT NULL,
+    user_id integer,
+    slug text,
+    from_date timestamp with time zone NOT NULL,
+    to_date timestamp with time zone NOT NULL,
+    progress integer NOT NULL DEFAULT 0 CHECK (progress BETWEEN 0 AND 100),
+    blob_key text,
+    error text,
+    created_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at timestamp with time zone,
+    updated_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at timestamp with time zone
+);
+
+CREATE INDEX IF NOT EXISTS idx_report_jobs_status ON report_jobs (status, created_at);
+
+CREATE INDEX IF NOT EXISTS idx_users_segments_deadline ON users_segments (deadline_date) WHERE deadline_date IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id bigserial PRIMARY KEY,
+    event_type text NOT NULL,
+    user_id integer NOT NULL,
+    external_id text,
+    slug text NOT NULL,
+    deadline_date timestamp with time zone,
+    actor text,
+    occurred_at timestamp with time zone NOT NULL,
+    dispatched_at timestamp with time zone,
+    transaction_id xid8 NOT NULL DEFAULT pg_current_xact_id()
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_pending ON outbox_events (id) WHERE dispatched_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id serial PRIMARY KEY,
+    url text NOT NULL,
+    secret text NOT NULL,
+    event_types text[] NOT NULL DEFAULT '{}',
+    slugs text[] NOT NULL DEFAULT '{}',
+    active boolean NOT NULL DEFAULT true,
+    created_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    webhook_id integer NOT NULL,
+    event_id bigint NOT NULL,
+    status text NOT NULL CHECK (status IN ('pending', 'delivered', 'dead')),
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp with time zone NOT NULL,
+    last_status_code integer,
+    last_error text,
+    created_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at timestamp with time zone,
+    CONSTRAINT uq_webhook_delivery UNIQUE (webhook_id, event_id),
+    CONSTRAINT fk_webhook FOREIGN KEY (webhook_id) REFERENCES webhooks (id) ON DELETE CASCADE,
+    CONSTRAINT fk_event FOREIGN KEY (event_id) REFERENCES outbox_events (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status ON webhook_deliveries (webhook_id, status, id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_event ON webhook_deliveries (event_id);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_user ON outbox_events (user_id, transaction_id, id);
+
+CREATE OR REPLACE FUNCTION notify_outbox_events() RETURNS trigger AS $$
+DECLARE
+    users text;
+BEGIN
+    SELECT string_agg(DISTINCT user_id::text, ',') INTO users FROM inserted;
+    IF users IS NULL THEN
+        RETURN NULL;
+    END IF;
+    -- полезная нагрузка уведомления ограничена 8000 байтами, при большом изменении будятся все слушатели
+    IF length(users) > 7000 THEN
+        users := '*';
+    END IF;
+    PERFORM pg_notify('outbox_events', users);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_outbox_events_notify ON outbox_events;
+CREATE TRIGGER trg_outbox_events_notify AFTER INSERT ON outbox_events
+    REFERENCING NEW TABLE AS inserted FOR EACH STATEMENT EXECUTE FUNCTION notify_outbox_events();
+
+-- пользователь не может одновременно состоять в двух активных сегментах одного слоя. Проверка в приложении
+-- не защищает от параллельных добавлений, поэтому вставки в слой сериализуются блокировкой по паре слой
+-- и пользователь, а перенос сегмента в слой (UpdateSegment) берет на слой исключительную блокировку.
+CREATE OR REPLACE FUNCTION check_users_segments_layer() RETURNS trigger AS $$
+DECLARE
+    segment_layer text;
+    occupant text;
+BEGIN
+    IF NEW.deadline_date IS NOT NULL AND NEW.deadline_date <= CURRENT_TIMESTAMP THEN
+        RETURN NEW;
+    END IF;
+    SELECT layer INTO segment_layer FROM segments WHERE slug = NEW.slug FOR SHARE;
+    IF segment_layer IS NULL THEN
+        RETURN NEW;
+    END IF;
+    PERFORM pg_advisory_xact_lock_shared(hashtext('layer:' || segment_layer)::bigint);
+    PERFORM pg_advisory_xact_lock(hashtext('layer:' || segment_layer), NEW.user_id);
+    SELECT us.slug INTO occupant FROM users_segments us
+        JOIN segments s ON s.slug = us.slug
+        WHERE us.user_id = NEW.user_id AND us.slug <> NEW.slug AND s.layer = segment_layer
+        AND (us.deadline_date IS NULL OR us.deadline_date > CURRENT_TIMESTAMP)
+        LIMIT 1;
+    IF occupant IS NOT NULL THEN
+        RAISE EXCEPTION 'user % already belongs to segment % of layer %', NEW.user_id, occupant, segment_layer
+            USING ERRCODE = 'exclusion_violation';
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_users_segments_layer ON users_segments;
+CREATE TRIGGER trg_users_segments_layer BEFORE INSERT OR UPDATE OF slug, deadline_date ON users_segments
+    FOR EACH ROW EXECUTE FUNCTION check_users_segments_layer();